@@ -1,13 +1,14 @@
 package main
 
 import (
-	"encoding/gob"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/tw93/mole/internal/diskscan"
 )
 
 func resetOverviewSnapshotForTest() {
@@ -59,7 +60,7 @@ func TestScanPathConcurrentBasic(t *testing.T) {
 
 	expectedDirSize := int64(len("alpha") + len(strings.Repeat("b", 32)))
 	expectedRootFileSize := int64(len("root-data"))
-	expectedLinkSize := getActualFileSize(linkPath, linkInfo)
+	expectedLinkSize := diskscan.FileSize(linkInfo)
 	expectedTotal := expectedDirSize + expectedRootFileSize + expectedLinkSize
 
 	if result.TotalSize != expectedTotal {
@@ -159,41 +160,95 @@ func TestOverviewStoreAndLoad(t *testing.T) {
 	}
 }
 
-func TestCacheSaveLoadRoundTrip(t *testing.T) {
+func TestScanCmdLoadsSavedIndex(t *testing.T) {
 	home := t.TempDir()
 	t.Setenv("HOME", home)
 
 	target := filepath.Join(home, "cache-target")
-	if err := os.MkdirAll(target, 0o755); err != nil {
+	if err := os.MkdirAll(filepath.Join(target, "alpha"), 0o755); err != nil {
 		t.Fatalf("create target dir: %v", err)
 	}
-
-	result := scanResult{
-		Entries: []dirEntry{
-			{Name: "alpha", Path: filepath.Join(target, "alpha"), Size: 10, IsDir: true},
-		},
-		LargeFiles: []fileEntry{
-			{Name: "big.bin", Path: filepath.Join(target, "big.bin"), Size: 2048},
-		},
-		TotalSize: 42,
+	if err := os.WriteFile(filepath.Join(target, "alpha", "data.bin"), make([]byte, 16<<10), 0o644); err != nil {
+		t.Fatalf("write data: %v", err)
 	}
 
-	if err := saveCacheToDisk(target, result); err != nil {
-		t.Fatalf("saveCacheToDisk: %v", err)
+	first := newModel(target, false).scanCmd(target)().(scanResultMsg)
+	if first.err != nil || first.index == nil {
+		t.Fatalf("first scan = %+v, want a new index", first)
 	}
+	first.index.Close()
 
-	cache, err := loadCacheFromDisk(target)
+	cacheDir, err := getCacheDir()
 	if err != nil {
-		t.Fatalf("loadCacheFromDisk: %v", err)
+		t.Fatalf("getCacheDir: %v", err)
+	}
+	if _, err := os.Stat(diskscan.IndexFile(cacheDir, target)); err != nil {
+		t.Fatalf("index not saved: %v", err)
+	}
+
+	// A fresh session lists the directory from the saved index
+	m := newModel(target, false)
+	second := m.scanCmd(target)().(scanResultMsg)
+	if second.err != nil || second.index == nil {
+		t.Fatalf("second scan = %+v, want the saved index", second)
+	}
+	defer second.index.Close()
+	if files := atomic.LoadInt64(m.filesScanned); files != 0 {
+		t.Fatalf("loading the index scanned %d files", files)
+	}
+	if second.result.TotalSize != first.result.TotalSize || len(second.result.Entries) != len(first.result.Entries) {
+		t.Fatalf("loaded %+v, want %+v", second.result, first.result)
+	}
+	if size, err := indexedSize(filepath.Join(target, "alpha")); err != nil || size != first.result.Entries[0].Size {
+		t.Fatalf("indexedSize = %d, %v, want %d", size, err, first.result.Entries[0].Size)
+	}
+}
+
+func TestScanCmdAppliesDeletionsToIndex(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	root := filepath.Join(home, "tree")
+	deep := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatalf("create dirs: %v", err)
+	}
+	victim := filepath.Join(deep, "victim.bin")
+	if err := os.WriteFile(victim, make([]byte, 64<<10), 0o644); err != nil {
+		t.Fatalf("write victim: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "keep.bin"), make([]byte, 8<<10), 0o644); err != nil {
+		t.Fatalf("write keep: %v", err)
+	}
+
+	m := newModel(root, false)
+	first := m.scanCmd(root)().(scanResultMsg)
+	if first.err != nil || first.index == nil {
+		t.Fatalf("first scan = %+v, want a new index", first)
 	}
-	if cache.TotalSize != result.TotalSize {
-		t.Fatalf("total size mismatch: want %d, got %d", result.TotalSize, cache.TotalSize)
+	defer first.index.Close()
+	m.index = first.index
+
+	// Entering a subdirectory comes from the index
+	sub := m.scanCmd(filepath.Join(root, "a"))().(scanResultMsg)
+	if sub.index != nil || sub.result.TotalSize == 0 {
+		t.Fatalf("subdirectory = %+v, want it listed from the index", sub)
+	}
+
+	if err := os.Remove(victim); err != nil {
+		t.Fatalf("remove victim: %v", err)
 	}
-	if len(cache.Entries) != len(result.Entries) {
-		t.Fatalf("entry count mismatch: want %d, got %d", len(result.Entries), len(cache.Entries))
+	after := m.scanCmd(root, parentDirs([]string{victim})...)().(scanResultMsg)
+	if after.index != nil {
+		t.Fatal("deletion triggered a full rescan")
 	}
-	if len(cache.LargeFiles) != len(result.LargeFiles) {
-		t.Fatalf("large file count mismatch: want %d, got %d", len(result.LargeFiles), len(cache.LargeFiles))
+	if after.result.TotalSize >= first.result.TotalSize {
+		t.Fatalf("total after delete = %d, want less than %d", after.result.TotalSize, first.result.TotalSize)
+	}
+	for _, e := range after.result.Entries {
+		if e.Name == "a" && e.Size != 0 {
+			t.Errorf("a still counts %d bytes", e.Size)
+		}
 	}
 }
 
@@ -265,66 +320,75 @@ func TestHasUsefulVolumeMounts(t *testing.T) {
 	}
 }
 
-func TestLoadCacheExpiresWhenDirectoryChanges(t *testing.T) {
+func TestLoadIndexRefreshesChangedDirectories(t *testing.T) {
 	home := t.TempDir()
 	t.Setenv("HOME", home)
 
 	target := filepath.Join(home, "change-target")
-	if err := os.MkdirAll(target, 0o755); err != nil {
+	sub := filepath.Join(target, "sub")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
 		t.Fatalf("create target: %v", err)
 	}
+	if err := os.WriteFile(filepath.Join(sub, "old.bin"), make([]byte, 8<<10), 0o644); err != nil {
+		t.Fatalf("write old: %v", err)
+	}
 
-	result := scanResult{TotalSize: 5}
-	if err := saveCacheToDisk(target, result); err != nil {
-		t.Fatalf("saveCacheToDisk: %v", err)
+	first := newModel(target, false).scanCmd(target)().(scanResultMsg)
+	if first.err != nil || first.index == nil {
+		t.Fatalf("first scan = %+v, want a new index", first)
 	}
+	first.index.Close()
 
-	// Touch directory to advance mtime beyond grace period.
-	time.Sleep(time.Millisecond * 10)
-	if err := os.Chtimes(target, time.Now(), time.Now()); err != nil {
+	// Changes made while nothing was watching are picked up on load
+	if err := os.WriteFile(filepath.Join(sub, "new.bin"), make([]byte, 32<<10), 0o644); err != nil {
+		t.Fatalf("write new: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(sub, later, later); err != nil {
 		t.Fatalf("chtimes: %v", err)
 	}
 
-	// Force modtime difference beyond grace window by simulating an older cache entry.
-	cachePath, err := getCachePath(target)
+	tree, err := loadIndex(target)
 	if err != nil {
-		t.Fatalf("getCachePath: %v", err)
+		t.Fatalf("loadIndex: %v", err)
 	}
-	if _, err := os.Stat(cachePath); err != nil {
-		t.Fatalf("stat cache: %v", err)
-	}
-	oldTime := time.Now().Add(-cacheModTimeGrace - time.Minute)
-	if err := os.Chtimes(cachePath, oldTime, oldTime); err != nil {
-		t.Fatalf("chtimes cache: %v", err)
+	defer tree.Close()
+	result, ok := tree.Result(target)
+	if !ok || result.TotalSize <= first.result.TotalSize {
+		t.Fatalf("total after change = %d, want more than %d", result.TotalSize, first.result.TotalSize)
 	}
+}
 
-	file, err := os.Open(cachePath)
+func TestFirstSavedIndexRemovesLegacyCaches(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cacheDir, err := getCacheDir()
 	if err != nil {
-		t.Fatalf("open cache: %v", err)
+		t.Fatalf("getCacheDir: %v", err)
 	}
-	var entry cacheEntry
-	if err := gob.NewDecoder(file).Decode(&entry); err != nil {
-		t.Fatalf("decode cache: %v", err)
+	legacy := filepath.Join(cacheDir, "9f3c2a71b04e5d68.cache")
+	kept := filepath.Join(cacheDir, "notes.cache")
+	for _, file := range []string{legacy, kept} {
+		if err := os.WriteFile(file, []byte("gob"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", file, err)
+		}
 	}
-	_ = file.Close()
 
-	entry.ScanTime = time.Now().Add(-8 * 24 * time.Hour)
-
-	tmp := cachePath + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		t.Fatalf("create tmp cache: %v", err)
-	}
-	if err := gob.NewEncoder(f).Encode(&entry); err != nil {
-		t.Fatalf("encode tmp cache: %v", err)
+	target := filepath.Join(home, "target")
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatalf("create target: %v", err)
 	}
-	_ = f.Close()
-	if err := os.Rename(tmp, cachePath); err != nil {
-		t.Fatalf("rename tmp cache: %v", err)
+	msg := newModel(target, false).scanCmd(target)().(scanResultMsg)
+	if msg.err != nil || msg.index == nil {
+		t.Fatalf("scan = %+v, want a new index", msg)
 	}
+	msg.index.Close()
 
-	if _, err := loadCacheFromDisk(target); err == nil {
-		t.Fatalf("expected cache load to fail after stale scan time")
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy cache still there: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
 	}
 }
 
@@ -2,15 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
+	"github.com/tw93/mole/internal/diskscan"
 )
 
 type overviewSizeSnapshot struct {
@@ -168,107 +169,95 @@ func loadOverviewCachedSize(path string) (int64, error) {
 	if snapshot, err := loadStoredOverviewSize(path); err == nil {
 		return snapshot, nil
 	}
-	cacheEntry, err := loadCacheFromDisk(path)
+	size, err := indexedSize(path)
 	if err != nil {
 		return 0, err
 	}
-	_ = storeOverviewSize(path, cacheEntry.TotalSize)
-	return cacheEntry.TotalSize, nil
+	_ = storeOverviewSize(path, size)
+	return size, nil
 }
 
 func getCacheDir() (string, error) {
-	home, err := os.UserHomeDir()
+	cacheDir, err := diskscan.CacheDir()
 	if err != nil {
 		return "", err
 	}
-	cacheDir := filepath.Join(home, ".cache", "mole")
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return "", err
 	}
 	return cacheDir, nil
 }
 
-func getCachePath(path string) (string, error) {
+// findIndex loads the saved index covering path, unless it is older than
+// indexMaxAge.
+func findIndex(path string) (*diskscan.Tree, error) {
 	cacheDir, err := getCacheDir()
-	if err != nil {
-		return "", err
-	}
-	hash := xxhash.Sum64String(path)
-	filename := fmt.Sprintf("%x.cache", hash)
-	return filepath.Join(cacheDir, filename), nil
-}
-
-func loadCacheFromDisk(path string) (*cacheEntry, error) {
-	cachePath, err := getCachePath(path)
 	if err != nil {
 		return nil, err
 	}
-
-	file, err := os.Open(cachePath)
+	tree, err := diskscan.FindIndex(cacheDir, path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	var entry cacheEntry
-	decoder := gob.NewDecoder(file)
-	if err := decoder.Decode(&entry); err != nil {
-		return nil, err
+	if time.Since(tree.Scanned()) > indexMaxAge {
+		return nil, fmt.Errorf("index expired: too old")
 	}
+	return tree, nil
+}
 
-	info, err := os.Stat(path)
+// loadIndex is findIndex brought up to date: directories modified since
+// the index was saved are measured again.
+func loadIndex(path string) (*diskscan.Tree, error) {
+	tree, err := findIndex(path)
 	if err != nil {
 		return nil, err
 	}
-
-	if info.ModTime().After(entry.ModTime) {
-		// Only expire cache if the directory has been newer for longer than the grace window.
-		if cacheModTimeGrace <= 0 || info.ModTime().Sub(entry.ModTime) > cacheModTimeGrace {
-			return nil, fmt.Errorf("cache expired: directory modified")
-		}
-	}
-
-	if time.Since(entry.ScanTime) > 7*24*time.Hour {
-		return nil, fmt.Errorf("cache expired: too old")
-	}
-
-	return &entry, nil
+	tree.Refresh()
+	return tree, nil
 }
 
-func saveCacheToDisk(path string, result scanResult) error {
-	cachePath, err := getCachePath(path)
+// saveIndex writes tree to the cache, where later changes to it are
+// recorded too. The first index saved clears out the per-directory caches
+// earlier versions wrote, which indexes replace.
+func saveIndex(tree *diskscan.Tree) error {
+	cacheDir, err := getCacheDir()
 	if err != nil {
 		return err
 	}
-
-	info, err := os.Stat(path)
-	if err != nil {
-		return err
+	if saved, _ := filepath.Glob(filepath.Join(cacheDir, "*.idx")); len(saved) == 0 {
+		removeLegacyCaches(cacheDir)
 	}
+	return tree.Save(diskscan.IndexFile(cacheDir, tree.Root()))
+}
 
-	entry := cacheEntry{
-		Entries:    result.Entries,
-		LargeFiles: result.LargeFiles,
-		TotalSize:  result.TotalSize,
-		ModTime:    info.ModTime(),
-		ScanTime:   time.Now(),
+// removeLegacyCaches deletes the <hash>.cache files earlier versions kept
+// for each scanned directory.
+func removeLegacyCaches(cacheDir string) {
+	files, _ := filepath.Glob(filepath.Join(cacheDir, "*.cache"))
+	for _, file := range files {
+		hash := strings.TrimSuffix(filepath.Base(file), ".cache")
+		if _, err := strconv.ParseUint(hash, 16, 64); err == nil {
+			_ = os.Remove(file)
+		}
 	}
+}
 
-	file, err := os.Create(cachePath)
+// indexedSize returns the size of path recorded in a saved index.
+func indexedSize(path string) (int64, error) {
+	tree, err := findIndex(path)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer file.Close()
-
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(entry)
+	dir, _, ok := tree.Dir(path)
+	if !ok {
+		return 0, fmt.Errorf("not indexed: %s", path)
+	}
+	return dir.Size, nil
 }
 
+// invalidateCache drops the overview size cached for path. Saved indexes
+// stay: changes are applied to them instead.
 func invalidateCache(path string) {
-	cachePath, err := getCachePath(path)
-	if err == nil {
-		_ = os.Remove(cachePath)
-	}
 	removeOverviewSnapshot(path)
 }
 
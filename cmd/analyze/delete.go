@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -9,8 +10,24 @@ import (
 	"sync/atomic"
 
 	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/tw93/mole/internal/pathpolicy"
 )
 
+// checkDeletable runs paths through the shared safety policy, returning a
+// status line naming the first refusal or "" when all may be removed.
+func checkDeletable(paths []string) string {
+	_, refused := pathpolicy.Default().Partition(paths)
+	switch len(refused) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("Refused %s: %s", filepath.Base(refused[0].Path), refused[0].Reason)
+	default:
+		return fmt.Sprintf("Refused %d items (%s: %s)", len(refused), filepath.Base(refused[0].Path), refused[0].Reason)
+	}
+}
+
 func deletePathCmd(path string, counter *int64) tea.Cmd {
 	return func() tea.Msg {
 		count, err := deletePathWithProgress(path, counter)
@@ -19,6 +36,7 @@ func deletePathCmd(path string, counter *int64) tea.Cmd {
 			err:   err,
 			count: count,
 			path:  path,
+			paths: []string{path},
 		}
 	}
 }
@@ -57,6 +75,7 @@ func deleteMultiplePathsCmd(paths []string, counter *int64) tea.Cmd {
 			err:   resultErr,
 			count: totalCount,
 			path:  "", // Empty path signals multiple deletions
+			paths: paths,
 		}
 	}
 }
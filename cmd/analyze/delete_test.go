@@ -43,3 +43,39 @@ func TestDeleteMultiplePathsCmdHandlesParentChild(t *testing.T) {
 		t.Fatalf("expected child to be removed, err=%v", err)
 	}
 }
+
+func TestQuarantinePathsCmdMovesAndRestores(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	target := filepath.Join(home, "build")
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "out.bin"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	msg := quarantinePathsCmd([]string{target}, map[string]int64{target: 4})()
+	progress, ok := msg.(deleteProgressMsg)
+	if !ok || progress.err != nil || !progress.quarantined || progress.count != 1 {
+		t.Fatalf("unexpected result: %#v", msg)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("expected target to be moved, err=%v", err)
+	}
+
+	list, ok := loadQuarantineCmd()().(quarantineListMsg)
+	if !ok || list.err != nil || len(list.items) != 1 || list.items[0].Source != "analyze" {
+		t.Fatalf("unexpected quarantine list: %#v", list)
+	}
+
+	restored, ok := restoreQuarantineCmd(list.items[0].ID)().(quarantineActionMsg)
+	if !ok || restored.err != nil || !restored.restored {
+		t.Fatalf("restore failed: %#v", restored)
+	}
+	if _, err := os.Stat(filepath.Join(target, "out.bin")); err != nil {
+		t.Fatalf("expected restored file: %v", err)
+	}
+}
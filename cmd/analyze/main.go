@@ -13,35 +13,17 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-)
-
-type dirEntry struct {
-	Name       string
-	Path       string
-	Size       int64
-	IsDir      bool
-	LastAccess time.Time
-}
 
-type fileEntry struct {
-	Name string
-	Path string
-	Size int64
-}
-
-type scanResult struct {
-	Entries    []dirEntry
-	LargeFiles []fileEntry
-	TotalSize  int64
-}
+	"github.com/tw93/mole/internal/diskscan"
+	"github.com/tw93/mole/internal/quarantine"
+)
 
-type cacheEntry struct {
-	Entries    []dirEntry
-	LargeFiles []fileEntry
-	TotalSize  int64
-	ModTime    time.Time
-	ScanTime   time.Time
-}
+// The scan types live in internal/diskscan, which the web server shares.
+type (
+	dirEntry   = diskscan.Entry
+	fileEntry  = diskscan.File
+	scanResult = diskscan.Result
+)
 
 type historyEntry struct {
 	Path          string
@@ -57,10 +39,18 @@ type historyEntry struct {
 }
 
 type scanResultMsg struct {
+	path   string
 	result scanResult
+	index  *diskscan.Tree // Set when the scan built a new index
 	err    error
 }
 
+// indexChangedMsg reports that the index picked up filesystem changes.
+type indexChangedMsg struct {
+	index   *diskscan.Tree
+	watched bool // Sent by the watcher, which must be waited on again
+}
+
 type overviewSizeMsg struct {
 	Path  string
 	Index int
@@ -71,10 +61,12 @@ type overviewSizeMsg struct {
 type tickMsg time.Time
 
 type deleteProgressMsg struct {
-	done  bool
-	err   error
-	count int64
-	path  string
+	done        bool
+	err         error
+	count       int64
+	path        string
+	paths       []string // Everything that was asked to be removed
+	quarantined bool     // Items were moved to quarantine, not deleted
 }
 
 type model struct {
@@ -112,6 +104,11 @@ type model struct {
 	height               int             // Terminal height
 	multiSelected        map[string]bool // Track multi-selected items by path (safer than index)
 	largeMultiSelected   map[string]bool // Track multi-selected large files by path (safer than index)
+	showQuarantine       bool            // Quarantine view is open
+	quarantineItems      []quarantine.Item
+	quarantineSelected   int
+	quarantineConfirm    bool           // Waiting for second ⌫ to delete a quarantined item permanently
+	index                *diskscan.Tree // Sizes below the last full scan, kept current by watching
 }
 
 func (m model) inOverviewMode() bool {
@@ -146,6 +143,7 @@ func main() {
 	prefetchCtx, prefetchCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer prefetchCancel()
 	go prefetchOverviewCache(prefetchCtx)
+	go expireQuarantine()
 
 	p := tea.NewProgram(newModel(abs, isOverview), tea.WithAltScreen())
 	if err := p.Start(); err != nil {
@@ -357,42 +355,101 @@ func (m model) Init() tea.Cmd {
 	return tea.Batch(m.scanCmd(m.path), tickCmd())
 }
 
-func (m model) scanCmd(path string) tea.Cmd {
+// scanCmd lists path, from the index when it covers path, else from the
+// disk cache or a full scan. Directories in changed are applied to the
+// index first.
+func (m model) scanCmd(path string, changed ...string) tea.Cmd {
+	index := m.index
 	return func() tea.Msg {
-		// Try to load from persistent cache first
-		if cached, err := loadCacheFromDisk(path); err == nil {
-			result := scanResult{
-				Entries:    cached.Entries,
-				LargeFiles: cached.LargeFiles,
-				TotalSize:  cached.TotalSize,
+		if index != nil {
+			for _, dir := range changed {
+				index.Apply(dir)
+			}
+			if msg := indexResultCmd(index, path)(); msg != nil {
+				return msg
 			}
-			return scanResultMsg{result: result, err: nil}
 		}
 
-		// Use singleflight to avoid duplicate scans of the same path
-		// If multiple goroutines request the same path, only one scan will be performed
-		v, err, _ := scanGroup.Do(path, func() (interface{}, error) {
-			return scanPathConcurrent(path, m.filesScanned, m.dirsScanned, m.bytesScanned, m.currentPath)
-		})
+		// A saved index, brought up to date, spares the full scan and is
+		// watched from here on
+		if saved, err := loadIndex(path); err == nil {
+			if result, ok := saved.Result(path); ok {
+				return scanResultMsg{path: path, result: result, index: saved}
+			}
+		}
 
-		if err != nil {
-			return scanResultMsg{err: err}
+		return m.fullScan(path)
+	}
+}
+
+// fullScan walks path from scratch and saves the resulting index.
+func (m model) fullScan(path string) tea.Msg {
+	// Use singleflight to avoid duplicate scans of the same path
+	// If multiple goroutines request the same path, only one scan will be performed
+	v, err, shared := scanGroup.Do(path, func() (interface{}, error) {
+		tree, result, err := indexPathConcurrent(path, m.filesScanned, m.dirsScanned, m.bytesScanned, m.currentPath)
+		if err == nil {
+			// Index save failure is not critical
+			_ = saveIndex(tree)
 		}
+		return scanResultMsg{path: path, result: result, index: tree}, err
+	})
 
-		result := v.(scanResult)
+	if err != nil {
+		return scanResultMsg{path: path, err: err}
+	}
 
-		// Save to persistent cache asynchronously with error logging
-		go func(p string, r scanResult) {
-			if err := saveCacheToDisk(p, r); err != nil {
-				// Log error but don't fail the scan
-				_ = err // Cache save failure is not critical
-			}
-		}(path, result)
+	msg := v.(scanResultMsg)
+	if shared {
+		// Only one caller may own the index
+		msg.index = nil
+	}
+	return msg
+}
 
-		return scanResultMsg{result: result, err: nil}
+// applyIndexCmd applies changed directories to the index outside a scan.
+func applyIndexCmd(index *diskscan.Tree, changed ...string) tea.Cmd {
+	if index == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		for _, dir := range changed {
+			index.Apply(dir)
+		}
+		return indexChangedMsg{index: index}
+	}
+}
+
+// indexResultCmd lists path again from the index, if it covers path.
+func indexResultCmd(index *diskscan.Tree, path string) tea.Cmd {
+	return func() tea.Msg {
+		result, ok := index.Result(path)
+		if !ok {
+			return nil
+		}
+		return scanResultMsg{path: path, result: result}
 	}
 }
 
+// watchIndexCmd waits for the index to apply a batch of filesystem changes.
+func watchIndexCmd(index *diskscan.Tree) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-index.Changes(); !ok {
+			return nil
+		}
+		return indexChangedMsg{index: index, watched: true}
+	}
+}
+
+// parentDirs returns the directories holding paths.
+func parentDirs(paths []string) []string {
+	dirs := make([]string, 0, len(paths))
+	for _, p := range paths {
+		dirs = append(dirs, filepath.Dir(p))
+	}
+	return dirs
+}
+
 func tickCmd() tea.Cmd {
 	return tea.Tick(time.Millisecond*80, func(t time.Time) tea.Msg {
 		return tickMsg(t)
@@ -421,16 +478,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					invalidateCache(msg.path)
 				}
 				invalidateCache(m.path)
-				m.status = fmt.Sprintf("Deleted %d items", msg.count)
-				// Mark all caches as dirty
-				for i := range m.history {
-					m.history[i].Dirty = true
+				for _, dir := range parentDirs(msg.paths) {
+					invalidateCache(dir)
 				}
-				for path := range m.cache {
-					entry := m.cache[path]
-					entry.Dirty = true
-					m.cache[path] = entry
+				if msg.quarantined {
+					m.status = fmt.Sprintf("Moved %d items to quarantine (U to restore)", msg.count)
+				} else {
+					m.status = fmt.Sprintf("Deleted %d items", msg.count)
 				}
+				// Mark all caches as dirty
+				m.markCachesDirty()
 				// Refresh the view
 				m.scanning = true
 				// Reset scan counters for rescan
@@ -440,16 +497,58 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.currentPath != nil {
 					*m.currentPath = ""
 				}
-				return m, tea.Batch(m.scanCmd(m.path), tickCmd())
+				return m, tea.Batch(m.scanCmd(m.path, parentDirs(msg.paths)...), tickCmd())
 			}
 		}
 		return m, nil
+	case quarantineListMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Failed to load quarantine: %v", msg.err)
+			return m, nil
+		}
+		m.quarantineItems = msg.items
+		if m.quarantineSelected >= len(m.quarantineItems) {
+			m.quarantineSelected = max(0, len(m.quarantineItems)-1)
+		}
+		return m, nil
+	case quarantineActionMsg:
+		switch {
+		case msg.err != nil:
+			m.status = fmt.Sprintf("Failed: %v", msg.err)
+		case msg.restored:
+			m.status = fmt.Sprintf("Restored %s", displayPath(msg.item.OriginalPath))
+			invalidateCache(filepath.Dir(msg.item.OriginalPath))
+			invalidateCache(m.path)
+			m.markCachesDirty()
+			return m, tea.Batch(loadQuarantineCmd(), applyIndexCmd(m.index, filepath.Dir(msg.item.OriginalPath)))
+		default:
+			m.status = fmt.Sprintf("Permanently deleted %s (%s)", filepath.Base(msg.item.OriginalPath), humanizeBytes(msg.item.Size))
+		}
+		return m, loadQuarantineCmd()
 	case scanResultMsg:
+		if msg.path != m.path {
+			// The view moved on while this was listed
+			if msg.index != nil {
+				_ = msg.index.Close()
+			}
+			return m, nil
+		}
 		m.scanning = false
 		if msg.err != nil {
 			m.status = fmt.Sprintf("Scan failed: %v", msg.err)
 			return m, nil
 		}
+		var cmd tea.Cmd
+		if msg.index != nil {
+			// A full scan replaces the index; watch the new one
+			if m.index != nil {
+				_ = m.index.Close()
+			}
+			m.index = msg.index
+			if m.index.Watch() == nil {
+				cmd = watchIndexCmd(m.index)
+			}
+		}
 		// Filter out 0-byte items for cleaner view
 		filteredEntries := make([]dirEntry, 0, len(msg.result.Entries))
 		for _, e := range msg.result.Entries {
@@ -461,6 +560,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.largeFiles = msg.result.LargeFiles
 		m.totalSize = msg.result.TotalSize
 		m.status = fmt.Sprintf("Scanned %s", humanizeBytes(m.totalSize))
+		if !msg.result.Exact {
+			m.status += " (estimated, some folders were unreadable or cached)"
+		}
+		if msg.result.SharedSize > 0 {
+			m.status += fmt.Sprintf(", %s shared by hard links or clones", humanizeBytes(msg.result.SharedSize))
+		}
+		if cmd != nil {
+			if n := m.index.Unwatched(); n > 0 {
+				m.status += fmt.Sprintf("; %d folders too many to watch, press R to pick up their changes", n)
+			}
+		}
 		m.clampEntrySelection()
 		m.clampLargeSelection()
 		m.cache[m.path] = cacheSnapshot(m)
@@ -473,7 +583,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				_ = storeOverviewSize(path, size)
 			}(m.path, m.totalSize)
 		}
-		return m, nil
+		return m, cmd
+	case indexChangedMsg:
+		if msg.index != m.index {
+			return m, nil // From an index a later scan replaced
+		}
+		var cmds []tea.Cmd
+		if msg.watched {
+			cmds = append(cmds, watchIndexCmd(m.index))
+		}
+		m.markCachesDirty()
+		// Refresh the listing in place unless something else is under way
+		if !m.scanning && !m.deleting && !m.inOverviewMode() {
+			cmds = append(cmds, indexResultCmd(m.index, m.path))
+		}
+		return m, tea.Batch(cmds...)
 	case overviewSizeMsg:
 		// Remove from scanning set
 		delete(m.overviewScanningSet, msg.Path)
@@ -538,43 +662,40 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.showQuarantine {
+		return m.updateQuarantineKey(msg)
+	}
+
 	// Handle delete confirmation
 	if m.deleteConfirm {
 		switch msg.String() {
-		case "delete", "backspace":
-			// Confirm delete - start async deletion
+		case "delete", "backspace", "m", "M":
+			// Confirm delete - start async deletion, or move to quarantine
+			toQuarantine := msg.String() == "m" || msg.String() == "M" || quarantineByDefault()
 			m.deleteConfirm = false
 			m.deleting = true
 			var deleteCount int64
 			m.deleteCount = &deleteCount
 
-			// Collect paths to delete (multi-select or single)
-			// Using paths instead of indices is safer - avoids deleting wrong files if list changes
-			var pathsToDelete []string
-			if m.showLargeFiles {
-				if len(m.largeMultiSelected) > 0 {
-					for path := range m.largeMultiSelected {
-						pathsToDelete = append(pathsToDelete, path)
-					}
-				} else if m.deleteTarget != nil {
-					pathsToDelete = append(pathsToDelete, m.deleteTarget.Path)
-				}
-			} else {
-				if len(m.multiSelected) > 0 {
-					for path := range m.multiSelected {
-						pathsToDelete = append(pathsToDelete, path)
-					}
-				} else if m.deleteTarget != nil {
-					pathsToDelete = append(pathsToDelete, m.deleteTarget.Path)
-				}
-			}
-
+			pathsToDelete, sizes := m.pendingDeletePaths()
 			m.deleteTarget = nil
 			if len(pathsToDelete) == 0 {
 				m.deleting = false
 				m.status = "Nothing to delete"
 				return m, nil
 			}
+			// Refuse the whole batch if any path is protected, so the user
+			// sees why before anything is removed.
+			if reason := checkDeletable(pathsToDelete); reason != "" {
+				m.deleting = false
+				m.status = reason
+				return m, nil
+			}
+
+			if toQuarantine {
+				m.status = fmt.Sprintf("Moving %d items to quarantine...", len(pathsToDelete))
+				return m, tea.Batch(quarantinePathsCmd(pathsToDelete, sizes), tickCmd())
+			}
 
 			if len(pathsToDelete) == 1 {
 				targetPath := pathsToDelete[0]
@@ -715,8 +836,12 @@ func (m model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, tea.Batch(m.scheduleOverviewScans(), tickCmd())
 		}
 
-		// Normal mode: Invalidate cache before rescanning
+		// Normal mode: Drop the cache and index and scan from scratch
 		invalidateCache(m.path)
+		if m.index != nil {
+			_ = m.index.Close()
+			m.index = nil
+		}
 		m.status = "Refreshing..."
 		m.scanning = true
 		// Reset scan counters for refresh
@@ -726,7 +851,15 @@ func (m model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.currentPath != nil {
 			*m.currentPath = ""
 		}
-		return m, tea.Batch(m.scanCmd(m.path), tickCmd())
+		path := m.path
+		return m, tea.Batch(func() tea.Msg { return m.fullScan(path) }, tickCmd())
+	case "u", "U":
+		// Open the quarantine to restore or purge previously removed items
+		m.showQuarantine = true
+		m.quarantineSelected = 0
+		m.quarantineConfirm = false
+		m.status = "Quarantine"
+		return m, loadQuarantineCmd()
 	case "t", "T":
 		// Don't allow switching to large files view in overview mode
 		if !m.inOverviewMode() {
@@ -974,6 +1107,34 @@ func (m model) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// pendingDeletePaths collects the paths awaiting delete confirmation
+// (multi-select or the single target) along with their known sizes.
+// Using paths instead of indices is safer - avoids deleting wrong files if list changes
+func (m model) pendingDeletePaths() ([]string, map[string]int64) {
+	var paths []string
+	sizes := make(map[string]int64)
+	if m.showLargeFiles {
+		for _, file := range m.largeFiles {
+			if m.largeMultiSelected[file.Path] {
+				paths = append(paths, file.Path)
+				sizes[file.Path] = file.Size
+			}
+		}
+	} else {
+		for _, entry := range m.entries {
+			if m.multiSelected[entry.Path] {
+				paths = append(paths, entry.Path)
+				sizes[entry.Path] = entry.Size
+			}
+		}
+	}
+	if len(paths) == 0 && m.deleteTarget != nil {
+		paths = append(paths, m.deleteTarget.Path)
+		sizes[m.deleteTarget.Path] = m.deleteTarget.Size
+	}
+	return paths, sizes
+}
+
 func (m *model) switchToOverviewMode() tea.Cmd {
 	m.isOverview = true
 	m.path = "/"
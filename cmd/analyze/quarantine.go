@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/tw93/mole/internal/quarantine"
+)
+
+type quarantineListMsg struct {
+	items []quarantine.Item
+	err   error
+}
+
+type quarantineActionMsg struct {
+	item     quarantine.Item
+	err      error
+	restored bool // false means permanently deleted
+}
+
+// quarantineByDefault reports whether ⌫ should quarantine rather than
+// delete, controlled by MO_ANALYZE_QUARANTINE=1.
+func quarantineByDefault() bool {
+	v := strings.ToLower(os.Getenv("MO_ANALYZE_QUARANTINE"))
+	return v == "1" || v == "true" || v == "yes"
+}
+
+// expireQuarantine drops quarantined items past their retention. Errors are
+// ignored; expiry is retried on the next launch.
+func expireQuarantine() {
+	if store, err := quarantine.Default(); err == nil {
+		_, _ = store.Expire(time.Now())
+	}
+}
+
+// quarantinePathsCmd moves paths into the quarantine instead of deleting
+// them. It reports through deleteProgressMsg so the view refreshes the same
+// way as after a delete.
+func quarantinePathsCmd(paths []string, sizes map[string]int64) tea.Cmd {
+	return func() tea.Msg {
+		store, err := quarantine.Default()
+		if err != nil {
+			return deleteProgressMsg{done: true, err: err, quarantined: true}
+		}
+
+		// Move deeper paths first so a selected parent doesn't swallow a
+		// selected child.
+		ordered := append([]string(nil), paths...)
+		sort.Slice(ordered, func(i, j int) bool {
+			return strings.Count(ordered[i], string(filepath.Separator)) > strings.Count(ordered[j], string(filepath.Separator))
+		})
+
+		var count int64
+		var errors []string
+		for _, path := range ordered {
+			if _, err := store.Move(path, sizes[path], "analyze"); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				errors = append(errors, err.Error())
+				continue
+			}
+			count++
+		}
+
+		msg := deleteProgressMsg{done: true, count: count, paths: paths, quarantined: true}
+		if len(errors) > 0 {
+			msg.err = &multiDeleteError{errors: errors}
+		}
+		if len(paths) == 1 {
+			msg.path = paths[0]
+		}
+		return msg
+	}
+}
+
+func loadQuarantineCmd() tea.Cmd {
+	return func() tea.Msg {
+		store, err := quarantine.Default()
+		if err != nil {
+			return quarantineListMsg{err: err}
+		}
+		items, err := store.List()
+		return quarantineListMsg{items: items, err: err}
+	}
+}
+
+func restoreQuarantineCmd(id string) tea.Cmd {
+	return func() tea.Msg {
+		store, err := quarantine.Default()
+		if err != nil {
+			return quarantineActionMsg{err: err, restored: true}
+		}
+		item, err := store.Restore(id)
+		return quarantineActionMsg{item: item, err: err, restored: true}
+	}
+}
+
+func removeQuarantineCmd(id string) tea.Cmd {
+	return func() tea.Msg {
+		store, err := quarantine.Default()
+		if err != nil {
+			return quarantineActionMsg{err: err}
+		}
+		item, err := store.Remove(id)
+		return quarantineActionMsg{item: item, err: err}
+	}
+}
+
+// updateQuarantineKey handles keys while the quarantine view is open.
+func (m model) updateQuarantineKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "esc", "u", "U", "b", "left", "h":
+		if m.quarantineConfirm {
+			m.quarantineConfirm = false
+			return m, nil
+		}
+		m.showQuarantine = false
+		m.quarantineConfirm = false
+		m.status = "Ready"
+		return m, nil
+	case "up", "k":
+		m.quarantineConfirm = false
+		if m.quarantineSelected > 0 {
+			m.quarantineSelected--
+		}
+	case "down", "j":
+		m.quarantineConfirm = false
+		if m.quarantineSelected < len(m.quarantineItems)-1 {
+			m.quarantineSelected++
+		}
+	case "enter", "right", "l":
+		if m.quarantineSelected < len(m.quarantineItems) {
+			item := m.quarantineItems[m.quarantineSelected]
+			m.status = "Restoring " + filepath.Base(item.OriginalPath) + "..."
+			return m, restoreQuarantineCmd(item.ID)
+		}
+	case "delete", "backspace":
+		if m.quarantineSelected >= len(m.quarantineItems) {
+			return m, nil
+		}
+		if !m.quarantineConfirm {
+			m.quarantineConfirm = true
+			return m, nil
+		}
+		m.quarantineConfirm = false
+		return m, removeQuarantineCmd(m.quarantineItems[m.quarantineSelected].ID)
+	}
+	return m, nil
+}
+
+// markCachesDirty forces rescans after the filesystem changed under us.
+func (m *model) markCachesDirty() {
+	for i := range m.history {
+		m.history[i].Dirty = true
+	}
+	for path := range m.cache {
+		entry := m.cache[path]
+		entry.Dirty = true
+		m.cache[path] = entry
+	}
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
+
+	"github.com/tw93/mole/internal/diskscan"
 )
 
 // View renders the TUI display.
 func (m model) View() string {
+	if m.showQuarantine {
+		return m.quarantineView()
+	}
+
 	var b strings.Builder
 	fmt.Fprintln(&b)
 
@@ -223,7 +230,7 @@ func (m model) View() string {
 						// For overview mode, get access time on-demand if not set
 						lastAccess := entry.LastAccess
 						if lastAccess.IsZero() && entry.Path != "" {
-							lastAccess = getLastAccessTime(entry.Path)
+							lastAccess = diskscan.LastAccess(entry.Path)
 						}
 						if unusedTime := formatUnusedTime(lastAccess); unusedTime != "" {
 							hintLabel = fmt.Sprintf("%s%s%s", colorGray, unusedTime, colorReset)
@@ -326,7 +333,7 @@ func (m model) View() string {
 						// Get access time on-demand if not set
 						lastAccess := entry.LastAccess
 						if lastAccess.IsZero() && entry.Path != "" {
-							lastAccess = getLastAccessTime(entry.Path)
+							lastAccess = diskscan.LastAccess(entry.Path)
 						}
 						if unusedTime := formatUnusedTime(lastAccess); unusedTime != "" {
 							hintLabel = fmt.Sprintf("%s%s%s", colorGray, unusedTime, colorReset)
@@ -351,31 +358,31 @@ func (m model) View() string {
 	if m.inOverviewMode() {
 		// Show ← Back if there's history (entered from a parent directory)
 		if len(m.history) > 0 {
-			fmt.Fprintf(&b, "%s↑↓←→ | Enter | R Refresh | O Open | F File | ← Back | Q Quit%s\n", colorGray, colorReset)
+			fmt.Fprintf(&b, "%s↑↓←→ | Enter | R Refresh | O Open | F File | ← Back | U Trash | Q Quit%s\n", colorGray, colorReset)
 		} else {
-			fmt.Fprintf(&b, "%s↑↓→ | Enter | R Refresh | O Open | F File | Q Quit%s\n", colorGray, colorReset)
+			fmt.Fprintf(&b, "%s↑↓→ | Enter | R Refresh | O Open | F File | U Trash | Q Quit%s\n", colorGray, colorReset)
 		}
 	} else if m.showLargeFiles {
 		selectCount := len(m.largeMultiSelected)
 		if selectCount > 0 {
-			fmt.Fprintf(&b, "%s↑↓← | Space Select | R Refresh | O Open | F File | ⌫ Del(%d) | ← Back | Q Quit%s\n", colorGray, selectCount, colorReset)
+			fmt.Fprintf(&b, "%s↑↓← | Space Select | R Refresh | O Open | F File | ⌫ Del(%d) | ← Back | U Trash | Q Quit%s\n", colorGray, selectCount, colorReset)
 		} else {
-			fmt.Fprintf(&b, "%s↑↓← | Space Select | R Refresh | O Open | F File | ⌫ Del | ← Back | Q Quit%s\n", colorGray, colorReset)
+			fmt.Fprintf(&b, "%s↑↓← | Space Select | R Refresh | O Open | F File | ⌫ Del | ← Back | U Trash | Q Quit%s\n", colorGray, colorReset)
 		}
 	} else {
 		largeFileCount := len(m.largeFiles)
 		selectCount := len(m.multiSelected)
 		if selectCount > 0 {
 			if largeFileCount > 0 {
-				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del(%d) | T Top(%d) | Q Quit%s\n", colorGray, selectCount, largeFileCount, colorReset)
+				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del(%d) | T Top(%d) | U Trash | Q Quit%s\n", colorGray, selectCount, largeFileCount, colorReset)
 			} else {
-				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del(%d) | Q Quit%s\n", colorGray, selectCount, colorReset)
+				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del(%d) | U Trash | Q Quit%s\n", colorGray, selectCount, colorReset)
 			}
 		} else {
 			if largeFileCount > 0 {
-				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del | T Top(%d) | Q Quit%s\n", colorGray, largeFileCount, colorReset)
+				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del | T Top(%d) | U Trash | Q Quit%s\n", colorGray, largeFileCount, colorReset)
 			} else {
-				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del | Q Quit%s\n", colorGray, colorReset)
+				fmt.Fprintf(&b, "%s↑↓←→ | Space Select | Enter | R Refresh | O Open | F File | ⌫ Del | U Trash | Q Quit%s\n", colorGray, colorReset)
 			}
 		}
 	}
@@ -408,21 +415,75 @@ func (m model) View() string {
 			}
 		}
 
+		prompt := "Press ⌫ again  |  M quarantine  |  ESC cancel"
+		if quarantineByDefault() {
+			prompt = "Press ⌫ again to quarantine  |  ESC cancel"
+		}
 		if deleteCount > 1 {
-			fmt.Fprintf(&b, "%sDelete:%s %d items (%s)  %sPress ⌫ again  |  ESC cancel%s\n",
+			fmt.Fprintf(&b, "%sDelete:%s %d items (%s)  %s%s%s\n",
 				colorRed, colorReset,
 				deleteCount, humanizeBytes(totalDeleteSize),
-				colorGray, colorReset)
+				colorGray, prompt, colorReset)
 		} else {
-			fmt.Fprintf(&b, "%sDelete:%s %s (%s)  %sPress ⌫ again  |  ESC cancel%s\n",
+			fmt.Fprintf(&b, "%sDelete:%s %s (%s)  %s%s%s\n",
 				colorRed, colorReset,
 				m.deleteTarget.Name, humanizeBytes(m.deleteTarget.Size),
-				colorGray, colorReset)
+				colorGray, prompt, colorReset)
 		}
 	}
 	return b.String()
 }
 
+// quarantineView lists quarantined items for restore or permanent removal.
+func (m model) quarantineView() string {
+	var b strings.Builder
+	fmt.Fprintln(&b)
+
+	var total int64
+	for _, item := range m.quarantineItems {
+		total += item.Size
+	}
+	fmt.Fprintf(&b, "%sQuarantine%s  %s%d items  |  %s%s\n\n",
+		colorPurpleBold, colorReset, colorGray, len(m.quarantineItems), humanizeBytes(total), colorReset)
+
+	if len(m.quarantineItems) == 0 {
+		fmt.Fprintf(&b, "  %sNothing in quarantine%s\n", colorGray, colorReset)
+	} else {
+		viewport := calculateViewport(m.height, true)
+		start := 0
+		if m.quarantineSelected >= viewport {
+			start = m.quarantineSelected - viewport + 1
+		}
+		end := min(start+viewport, len(m.quarantineItems))
+		for idx := start; idx < end; idx++ {
+			item := m.quarantineItems[idx]
+			prefix, nameColor := "  ", ""
+			if idx == m.quarantineSelected {
+				prefix, nameColor = fmt.Sprintf("%s▶%s ", colorCyan, colorReset), colorCyan
+			}
+			expires := "no expiry"
+			if !item.ExpiresAt.IsZero() {
+				expires = "expires " + item.ExpiresAt.Format("Jan 2")
+			}
+			fmt.Fprintf(&b, "%s%s%s%s  %s%10s%s  %s%s%s\n",
+				prefix, nameColor, truncateMiddle(displayPath(item.OriginalPath), 60), colorReset,
+				colorGray, humanizeBytes(item.Size), colorReset,
+				colorGray, expires, colorReset)
+		}
+	}
+
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "%s↑↓ | Enter Restore | ⌫ Delete | U/ESC Back | Q Quit%s\n", colorGray, colorReset)
+	if m.quarantineConfirm && m.quarantineSelected < len(m.quarantineItems) {
+		item := m.quarantineItems[m.quarantineSelected]
+		fmt.Fprintf(&b, "\n%sDelete permanently:%s %s (%s)  %sPress ⌫ again  |  ESC cancel%s\n",
+			colorRed, colorReset, filepath.Base(item.OriginalPath), humanizeBytes(item.Size), colorGray, colorReset)
+	} else if m.status != "" {
+		fmt.Fprintf(&b, "\n%s%s%s\n", colorGray, m.status, colorReset)
+	}
+	return b.String()
+}
+
 // calculateViewport computes the number of visible items based on terminal height.
 func calculateViewport(termHeight int, isLargeFiles bool) int {
 	if termHeight <= 0 {
@@ -7,6 +7,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tw93/mole/internal/metrics"
 )
 
 const refreshInterval = time.Second
@@ -20,15 +21,15 @@ type tickMsg struct{}
 type animTickMsg struct{}
 
 type metricsMsg struct {
-	data MetricsSnapshot
+	data metrics.MetricsSnapshot
 	err  error
 }
 
 type model struct {
-	collector   *Collector
+	collector   *metrics.Collector
 	width       int
 	height      int
-	metrics     MetricsSnapshot
+	metrics     metrics.MetricsSnapshot
 	errMessage  string
 	ready       bool
 	lastUpdated time.Time
@@ -38,7 +39,7 @@ type model struct {
 
 func newModel() model {
 	return model{
-		collector: NewCollector(),
+		collector: metrics.NewCollector(),
 	}
 }
 
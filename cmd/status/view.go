@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/tw93/mole/internal/metrics"
 )
 
 var (
@@ -164,7 +165,7 @@ type cardData struct {
 	lines []string
 }
 
-func renderHeader(m MetricsSnapshot, errMsg string, animFrame int, termWidth int) string {
+func renderHeader(m metrics.MetricsSnapshot, errMsg string, animFrame int, termWidth int) string {
 	// Title
 	title := titleStyle.Render("Mole Status")
 
@@ -231,7 +232,7 @@ func getScoreStyle(score int) lipgloss.Style {
 	}
 }
 
-func buildCards(m MetricsSnapshot, _ int) []cardData {
+func buildCards(m metrics.MetricsSnapshot, _ int) []cardData {
 	cards := []cardData{
 		renderCPUCard(m.CPU),
 		renderMemoryCard(m.Memory),
@@ -247,7 +248,7 @@ func buildCards(m MetricsSnapshot, _ int) []cardData {
 	return cards
 }
 
-func hasSensorData(sensors []SensorReading) bool {
+func hasSensorData(sensors []metrics.SensorReading) bool {
 	for _, s := range sensors {
 		if s.Note == "" && s.Value > 0 {
 			return true
@@ -256,7 +257,7 @@ func hasSensorData(sensors []SensorReading) bool {
 	return false
 }
 
-func renderCPUCard(cpu CPUStatus) cardData {
+func renderCPUCard(cpu metrics.CPUStatus) cardData {
 	var lines []string
 	lines = append(lines, fmt.Sprintf("Total  %s  %5.1f%%", progressBar(cpu.Usage), cpu.Usage))
 
@@ -294,7 +295,7 @@ func renderCPUCard(cpu CPUStatus) cardData {
 	return cardData{icon: iconCPU, title: "CPU", lines: lines}
 }
 
-func renderGPUCard(gpus []GPUStatus) cardData {
+func renderGPUCard(gpus []metrics.GPUStatus) cardData {
 	var lines []string
 	if len(gpus) == 0 {
 		lines = append(lines, subtleStyle.Render("No GPU detected"))
@@ -316,14 +317,14 @@ func renderGPUCard(gpus []GPUStatus) cardData {
 	return cardData{icon: iconGPU, title: "GPU", lines: lines}
 }
 
-func renderMemoryCard(mem MemoryStatus) cardData {
+func renderMemoryCard(mem metrics.MemoryStatus) cardData {
 	var lines []string
 	lines = append(lines, fmt.Sprintf("Used   %s  %5.1f%%", progressBar(mem.UsedPercent), mem.UsedPercent))
-	lines = append(lines, subtleStyle.Render(fmt.Sprintf("%s / %s total", humanBytes(mem.Used), humanBytes(mem.Total))))
+	lines = append(lines, subtleStyle.Render(fmt.Sprintf("%s / %s total", metrics.HumanBytes(mem.Used), metrics.HumanBytes(mem.Total))))
 	available := mem.Total - mem.Used
 	freePercent := 100 - mem.UsedPercent
 	lines = append(lines, fmt.Sprintf("Free   %s  %5.1f%%", progressBar(freePercent), freePercent))
-	lines = append(lines, subtleStyle.Render(fmt.Sprintf("%s available", humanBytes(available))))
+	lines = append(lines, subtleStyle.Render(fmt.Sprintf("%s available", metrics.HumanBytes(available))))
 	if mem.SwapTotal > 0 || mem.SwapUsed > 0 {
 		var swapPercent float64
 		if mem.SwapTotal > 0 {
@@ -348,13 +349,13 @@ func renderMemoryCard(mem MemoryStatus) cardData {
 	return cardData{icon: iconMemory, title: "Memory", lines: lines}
 }
 
-func renderDiskCard(disks []DiskStatus, io DiskIOStatus) cardData {
+func renderDiskCard(disks []metrics.DiskStatus, io metrics.DiskIOStatus) cardData {
 	var lines []string
 	if len(disks) == 0 {
 		lines = append(lines, subtleStyle.Render("Collecting..."))
 	} else {
 		internal, external := splitDisks(disks)
-		addGroup := func(prefix string, list []DiskStatus) {
+		addGroup := func(prefix string, list []metrics.DiskStatus) {
 			if len(list) == 0 {
 				return
 			}
@@ -376,7 +377,7 @@ func renderDiskCard(disks []DiskStatus, io DiskIOStatus) cardData {
 	return cardData{icon: iconDisk, title: "Disk", lines: lines}
 }
 
-func splitDisks(disks []DiskStatus) (internal, external []DiskStatus) {
+func splitDisks(disks []metrics.DiskStatus) (internal, external []metrics.DiskStatus) {
 	for _, d := range disks {
 		if d.External {
 			external = append(external, d)
@@ -394,7 +395,7 @@ func diskLabel(prefix string, index int, total int) string {
 	return fmt.Sprintf("%s%d", prefix, index+1)
 }
 
-func formatDiskLine(label string, d DiskStatus) string {
+func formatDiskLine(label string, d metrics.DiskStatus) string {
 	if label == "" {
 		label = "DISK"
 	}
@@ -423,7 +424,7 @@ func ioBar(rate float64) string {
 	return okStyle.Render(bar)
 }
 
-func renderProcessCard(procs []ProcessInfo) cardData {
+func renderProcessCard(procs []metrics.ProcessInfo) cardData {
 	var lines []string
 	maxProcs := 3
 	for i, p := range procs {
@@ -451,7 +452,7 @@ func miniBar(percent float64) string {
 	return colorizePercent(percent, strings.Repeat("▮", filled)+strings.Repeat("▯", 5-filled))
 }
 
-func renderNetworkCard(netStats []NetworkStatus, proxy ProxyStatus) cardData {
+func renderNetworkCard(netStats []metrics.NetworkStatus, proxy metrics.ProxyStatus) cardData {
 	var lines []string
 	var totalRx, totalTx float64
 	var primaryIP string
@@ -505,7 +506,7 @@ func netBar(rate float64) string {
 	return okStyle.Render(bar)
 }
 
-func renderBatteryCard(batts []BatteryStatus, thermal ThermalStatus) cardData {
+func renderBatteryCard(batts []metrics.BatteryStatus, thermal metrics.ThermalStatus) cardData {
 	var lines []string
 	if len(batts) == 0 {
 		lines = append(lines, subtleStyle.Render("No battery"))
@@ -584,7 +585,7 @@ func renderBatteryCard(batts []BatteryStatus, thermal ThermalStatus) cardData {
 	return cardData{icon: iconBattery, title: "Power", lines: lines}
 }
 
-func renderSensorsCard(sensors []SensorReading) cardData {
+func renderSensorsCard(sensors []metrics.SensorReading) cardData {
 	var lines []string
 	for _, s := range sensors {
 		if s.Note != "" {
@@ -703,21 +704,6 @@ func formatRate(mb float64) string {
 	return fmt.Sprintf("%.0f MB/s", mb)
 }
 
-func humanBytes(v uint64) string {
-	switch {
-	case v > 1<<40:
-		return fmt.Sprintf("%.1f TB", float64(v)/(1<<40))
-	case v > 1<<30:
-		return fmt.Sprintf("%.1f GB", float64(v)/(1<<30))
-	case v > 1<<20:
-		return fmt.Sprintf("%.1f MB", float64(v)/(1<<20))
-	case v > 1<<10:
-		return fmt.Sprintf("%.1f KB", float64(v)/(1<<10))
-	default:
-		return strconv.FormatUint(v, 10) + " B"
-	}
-}
-
 func humanBytesShort(v uint64) string {
 	switch {
 	case v >= 1<<40:
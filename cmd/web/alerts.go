@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tw93/mole/internal/alerts"
+	"github.com/tw93/mole/internal/metrics"
+)
+
+const (
+	alertInterval    = 10 * time.Second
+	alertSinkTimeout = 30 * time.Second
+	alertRecentSize  = 50  // Events kept for GET /api/alerts
+	alertSubBuffer   = 16  // Per-dashboard buffer before events are dropped
+	alertOutputLimit = 512 // Bytes of a failing command's output that are logged
+)
+
+// AlertSink delivers alert events somewhere people will see them.
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, ev alerts.Event) error
+}
+
+// toastSink shows events as toasts in open dashboards, through the status
+// event stream.
+type toastSink struct{ m *AlertManager }
+
+func (s toastSink) Name() string { return "toast" }
+
+func (s toastSink) Send(_ context.Context, ev alerts.Event) error {
+	s.m.publish(ev)
+	return nil
+}
+
+// webhookSink POSTs each event as JSON. The "text" field carries a one-line
+// summary, which is what Slack-style incoming webhooks display.
+type webhookSink struct{ url string }
+
+func (s webhookSink) Name() string { return "webhook" }
+
+func (s webhookSink) Send(ctx context.Context, ev alerts.Event) error {
+	body, err := json.Marshal(struct {
+		alerts.Event
+		Text string `json:"text"`
+	}{ev, fmt.Sprintf("[%s] %s", ev.Host, ev.Message)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// commandSink runs a shell command for each event, with the event as JSON
+// on stdin and its main fields in MOLE_ALERT_* variables.
+type commandSink struct{ command string }
+
+func (s commandSink) Name() string { return "command" }
+
+func (s commandSink) Send(ctx context.Context, ev alerts.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	cmd := newCommand(ctx, "/bin/sh", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"MOLE_ALERT_RULE="+ev.Rule,
+		"MOLE_ALERT_STATE="+ev.State,
+		"MOLE_ALERT_SEVERITY="+ev.Severity,
+		"MOLE_ALERT_MESSAGE="+ev.Message,
+		"MOLE_ALERT_VALUE="+strconv.FormatFloat(ev.Value, 'f', -1, 64),
+		"MOLE_ALERT_HOST="+ev.Host,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if len(out) > alertOutputLimit {
+			out = out[:alertOutputLimit]
+		}
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// validateAlertWebhook checks that the webhook is an http(s) URL.
+func validateAlertWebhook(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("alert_webhook must be an http or https URL")
+	}
+	return nil
+}
+
+// AlertManager evaluates the configured rules against the system metrics
+// and delivers the resulting events to every sink.
+type AlertManager struct {
+	engine *alerts.Engine
+
+	mu     sync.Mutex
+	recent []alerts.Event // Oldest first
+	subs   map[chan alerts.Event]struct{}
+}
+
+func NewAlertManager() *AlertManager {
+	return &AlertManager{
+		engine: alerts.NewEngine(nil),
+		subs:   make(map[chan alerts.Event]struct{}),
+	}
+}
+
+var alertManager = NewAlertManager()
+
+// sinks returns the toast sink plus the sinks configured in cfg.
+func (m *AlertManager) sinks(cfg Config) []AlertSink {
+	sinks := []AlertSink{toastSink{m}}
+	if cfg.AlertWebhook != "" {
+		sinks = append(sinks, webhookSink{cfg.AlertWebhook})
+	}
+	if cfg.AlertCommand != "" {
+		sinks = append(sinks, commandSink{cfg.AlertCommand})
+	}
+	return sinks
+}
+
+// Run evaluates the rules every alertInterval until stop is closed. Rules
+// are re-read each time, so config edits apply without a restart.
+func (m *AlertManager) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *AlertManager) check() {
+	cfg := *currentConfig()
+	if !*cfg.Alerts {
+		m.engine.SetRules(nil)
+		return
+	}
+	m.engine.SetRules(cfg.AlertRules)
+	snap, _ := currentSnapshot() // Rules skip readings that are missing
+	for _, ev := range m.engine.Evaluate(snap) {
+		m.deliver(ev, m.sinks(cfg))
+	}
+}
+
+// deliver logs and records ev and sends it to sinks in the background.
+func (m *AlertManager) deliver(ev alerts.Event, sinks []AlertSink) {
+	writeLog("Alert %s: %s", ev.State, ev.Message)
+	m.mu.Lock()
+	m.recent = append(m.recent, ev)
+	if len(m.recent) > alertRecentSize {
+		m.recent = m.recent[len(m.recent)-alertRecentSize:]
+	}
+	m.mu.Unlock()
+
+	for _, sink := range sinks {
+		go func(sink AlertSink) {
+			ctx, cancel := context.WithTimeout(context.Background(), alertSinkTimeout)
+			defer cancel()
+			if err := sink.Send(ctx, ev); err != nil {
+				writeLog("ERROR: Alert %s sink: %v", sink.Name(), err)
+			}
+		}(sink)
+	}
+}
+
+// publish passes ev to every subscribed dashboard, dropping it for those
+// that are not keeping up.
+func (m *AlertManager) publish(ev alerts.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function that ends the
+// subscription.
+func (m *AlertManager) Subscribe() (<-chan alerts.Event, func()) {
+	ch := make(chan alerts.Event, alertSubBuffer)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subs, ch)
+		m.mu.Unlock()
+	}
+}
+
+// Recent returns the latest events, newest first.
+func (m *AlertManager) Recent() []alerts.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recent := make([]alerts.Event, len(m.recent))
+	for i, ev := range m.recent {
+		recent[len(m.recent)-1-i] = ev
+	}
+	return recent
+}
+
+type AlertsResponse struct {
+	Enabled bool           `json:"enabled"`
+	Rules   []alerts.Rule  `json:"rules"`
+	Metrics []string       `json:"metrics"` // What rules can test
+	Sinks   []string       `json:"sinks"`
+	Active  []alerts.Event `json:"active"`
+	Recent  []alerts.Event `json:"recent"`
+}
+
+// handleAlerts serves GET /api/alerts: the rules, what is firing now and
+// the latest events.
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := *currentConfig()
+	resp := AlertsResponse{
+		Enabled: *cfg.Alerts,
+		Rules:   cfg.AlertRules,
+		Metrics: readingNames(),
+		Active:  alertManager.engine.Active(),
+		Recent:  alertManager.Recent(),
+	}
+	for _, s := range alertManager.sinks(cfg) {
+		resp.Sinks = append(resp.Sinks, s.Name())
+	}
+	if resp.Active == nil {
+		resp.Active = []alerts.Event{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func readingNames() []string {
+	names := make([]string, 0, len(metrics.Readings))
+	for _, m := range metrics.Readings {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// handleAlertTest serves POST /api/alerts/test, sending a test event to
+// every sink and reporting how each one did.
+func handleAlertTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now()
+	ev := alerts.Event{
+		Rule:     "test",
+		State:    alerts.StateFiring,
+		Severity: alerts.SeverityWarning,
+		Message:  "Test alert from Mole",
+		Host:     shortHostname(),
+		Since:    now,
+		Time:     now,
+	}
+	results := make(map[string]string)
+	for _, sink := range alertManager.sinks(*currentConfig()) {
+		ctx, cancel := context.WithTimeout(r.Context(), alertSinkTimeout)
+		if err := sink.Send(ctx, ev); err != nil {
+			results[sink.Name()] = err.Error()
+		} else {
+			results[sink.Name()] = "ok"
+		}
+		cancel()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
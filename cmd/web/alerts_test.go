@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw93/mole/internal/alerts"
+)
+
+func TestWebhookSinkPostsEvent(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	ev := alerts.Event{Rule: "disk_full", State: alerts.StateFiring, Message: "Disk almost full", Host: "studio"}
+	if err := (webhookSink{srv.URL}).Send(t.Context(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if got["rule"] != "disk_full" || got["text"] != "[studio] Disk almost full" {
+		t.Errorf("webhook body = %v", got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (webhookSink{failing.URL}).Send(t.Context(), ev); err == nil {
+		t.Error("expected error for a 502 response")
+	}
+}
+
+func TestCommandSinkGetsEnvironment(t *testing.T) {
+	ev := alerts.Event{Rule: "cpu_hot", State: alerts.StateResolved}
+	sink := commandSink{`test "$MOLE_ALERT_RULE/$MOLE_ALERT_STATE" = cpu_hot/resolved && grep -q '"rule":"cpu_hot"'`}
+	if err := sink.Send(t.Context(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if err := (commandSink{"echo broken >&2; exit 3"}).Send(t.Context(), ev); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("failing command error = %v", err)
+	}
+}
+
+func TestAlertManagerDeliversToSubscribers(t *testing.T) {
+	m := NewAlertManager()
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < alertRecentSize+5; i++ {
+		m.deliver(alerts.Event{Rule: "r", Value: float64(i)}, []AlertSink{toastSink{m}})
+	}
+	select {
+	case ev := <-events:
+		if ev.Rule != "r" {
+			t.Errorf("event = %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event published")
+	}
+	recent := m.Recent()
+	if len(recent) != alertRecentSize || recent[0].Value != alertRecentSize+4 {
+		t.Errorf("recent = %d events, newest %v", len(recent), recent[0].Value)
+	}
+}
+
+func TestAlertConfigValidation(t *testing.T) {
+	rule := alerts.Rule{Name: "x", Metric: "cpu_usage", Op: ">", Threshold: 90}
+	for name, c := range map[string]Config{
+		"duplicate": {AlertRules: []alerts.Rule{rule, rule}},
+		"metric":    {AlertRules: []alerts.Rule{{Name: "y", Metric: "nope", Op: ">"}}},
+		"webhook":   {AlertWebhook: "ftp://example.com/hook"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := (Config{AlertRules: []alerts.Rule{rule}, AlertWebhook: "https://hooks.example.com/x"}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAlertWebhookRedacted(t *testing.T) {
+	useTempConfig(t)
+	store := useConfig(t, Config{AlertWebhook: "https://hooks.example.com/secret"})
+	resp, err := configResponse(*store.Current())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Effective.AlertWebhook != redactedPassword || resp.File.AlertWebhook != redactedPassword {
+		t.Errorf("webhook not redacted: %q", resp.Effective.AlertWebhook)
+	}
+	if err := store.Save(resp.File); err != nil {
+		t.Fatal(err)
+	}
+	if currentConfig().AlertWebhook != "https://hooks.example.com/secret" {
+		t.Error("redacted webhook overwrote the stored one")
+	}
+}
+
+func TestHandleAlerts(t *testing.T) {
+	useTempConfig(t)
+	useConfig(t, Config{})
+	rec := httptest.NewRecorder()
+	handleAlerts(rec, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	var resp AlertsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Enabled || len(resp.Rules) != len(alerts.DefaultRules) || resp.Active == nil {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.Sinks) != 1 || resp.Sinks[0] != "toast" {
+		t.Errorf("sinks = %v", resp.Sinks)
+	}
+	if rules := resp.Rules; rules[0].For != 10*time.Minute {
+		t.Errorf("disk_full for = %v", rules[0].For)
+	}
+}
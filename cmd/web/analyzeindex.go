@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tw93/mole/internal/diskscan"
+)
+
+// IndexedDir is a directory as recorded in an analyzer index.
+type IndexedDir struct {
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	SizeHuman   string    `json:"size_human"`
+	LogicalSize int64     `json:"logical_size"`
+	SharedSize  int64     `json:"shared_size"`
+	Exact       bool      `json:"exact"`
+	Files       int64     `json:"files"`
+	Dirs        int64     `json:"dirs"`
+	Modified    time.Time `json:"modified"`
+	LastAccess  time.Time `json:"last_access"`
+	Folded      bool      `json:"folded"` // Measured as a whole; no children recorded
+}
+
+// IndexResponse is a directory and its children from the index, with when
+// the index was first scanned.
+type IndexResponse struct {
+	IndexedDir
+	Scanned  time.Time    `json:"scanned"`
+	Children []IndexedDir `json:"children"`
+}
+
+// maxLoadedIndexes bounds loadedIndexes: a loaded tree of a whole disk
+// can take hundreds of megabytes.
+const maxLoadedIndexes = 2
+
+// loadedIndexes keeps the trees handleAnalyzeIndex read last, by file,
+// until the analyzer writes to the file again.
+var loadedIndexes = struct {
+	sync.Mutex
+	byFile map[string]loadedIndex
+	order  []string // Files in byFile, least recently used first
+}{byFile: make(map[string]loadedIndex)}
+
+type loadedIndex struct {
+	size    int64
+	modTime time.Time
+	tree    *diskscan.Tree
+}
+
+// loadIndex is diskscan.LoadTree answered from loadedIndexes while file is
+// unchanged.
+func loadIndex(file string) (*diskscan.Tree, error) {
+	info, err := os.Stat(file)
+	loadedIndexes.Lock()
+	defer loadedIndexes.Unlock()
+	if err != nil {
+		forgetIndex(file)
+		return nil, err
+	}
+	if l, ok := loadedIndexes.byFile[file]; ok && l.size == info.Size() && l.modTime.Equal(info.ModTime()) {
+		useIndex(file)
+		return l.tree, nil
+	}
+	// Let the old tree go before loading its replacement
+	forgetIndex(file)
+	tree, err := diskscan.LoadTree(file)
+	if err != nil {
+		return nil, err
+	}
+	loadedIndexes.byFile[file] = loadedIndex{size: info.Size(), modTime: info.ModTime(), tree: tree}
+	useIndex(file)
+	for len(loadedIndexes.order) > maxLoadedIndexes {
+		forgetIndex(loadedIndexes.order[0])
+	}
+	return tree, nil
+}
+
+// useIndex marks file as the most recently used. Callers hold
+// loadedIndexes.
+func useIndex(file string) {
+	forgetOrder(file)
+	loadedIndexes.order = append(loadedIndexes.order, file)
+}
+
+// forgetIndex drops file's tree. Callers hold loadedIndexes.
+func forgetIndex(file string) {
+	delete(loadedIndexes.byFile, file)
+	forgetOrder(file)
+}
+
+func forgetOrder(file string) {
+	order := loadedIndexes.order
+	for i, f := range order {
+		if f == file {
+			loadedIndexes.order = append(order[:i], order[i+1:]...)
+			return
+		}
+	}
+}
+
+// handleAnalyzeIndex answers from the index the analyzer saved, without
+// scanning. Paths no index covers are 404; run the analyzer on them first.
+func handleAnalyzeIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = os.Getenv("HOME")
+	}
+
+	cacheDir, err := diskscan.CacheDir()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tree, err := diskscan.FindIndexWith(cacheDir, path, loadIndex)
+	if err != nil {
+		http.Error(w, "No index covers "+path, http.StatusNotFound)
+		return
+	}
+	dir, children, ok := tree.Dir(path)
+	if !ok {
+		http.Error(w, "No index covers "+path, http.StatusNotFound)
+		return
+	}
+
+	resp := IndexResponse{
+		IndexedDir: indexedDir(dir),
+		Scanned:    tree.Scanned(),
+		Children:   make([]IndexedDir, 0, len(children)),
+	}
+	for _, child := range children {
+		resp.Children = append(resp.Children, indexedDir(child))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func indexedDir(d diskscan.Dir) IndexedDir {
+	return IndexedDir{
+		Path:        d.Path,
+		Name:        d.Name,
+		Size:        d.Size,
+		SizeHuman:   formatBytes(d.Size),
+		LogicalSize: d.Logical,
+		SharedSize:  d.Shared,
+		Exact:       d.Exact,
+		Files:       d.Files,
+		Dirs:        d.Dirs,
+		Modified:    d.ModTime,
+		LastAccess:  d.LastAccess,
+		Folded:      d.Folded,
+	}
+}
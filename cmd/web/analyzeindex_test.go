@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tw93/mole/internal/diskscan"
+)
+
+func TestHandleAnalyzeIndex(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	root := filepath.Join(home, "data")
+	for _, name := range []string{"a/f", "a/b/g", "c/h"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 4096), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleAnalyzeIndex(rec, httptest.NewRequest(http.MethodGet, "/api/analyze/index?path="+path, nil))
+		return rec
+	}
+	if rec := get(root); rec.Code != http.StatusNotFound {
+		t.Fatalf("without an index: status %d, want 404", rec.Code)
+	}
+
+	var s diskscan.Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	cacheDir, err := diskscan.CacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := diskscan.IndexFile(cacheDir, root)
+	if err := tree.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(filepath.Join(root, "a"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Name != "a" || got.Files != 2 || got.Dirs != 1 || got.Size == 0 || got.Scanned.IsZero() {
+		t.Errorf("dir = %+v", got.IndexedDir)
+	}
+	if len(got.Children) != 1 || got.Children[0].Name != "b" || got.Children[0].Files != 1 {
+		t.Errorf("children = %+v", got.Children)
+	}
+
+	// The loaded tree is reused until the analyzer writes the file again
+	first, err := loadIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := loadIndex(file); again != first {
+		t.Error("unchanged index was loaded again")
+	}
+	if err := os.WriteFile(filepath.Join(root, "c", "i"), make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(filepath.Join(root, "c"))
+	if again, _ := loadIndex(file); again == first {
+		t.Error("changed index was not loaded again")
+	}
+	if rec := get(filepath.Join(root, "c")); !strings.Contains(rec.Body.String(), `"files":2`) {
+		t.Errorf("after a change: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAnalyzeIndex(rec, httptest.NewRequest(http.MethodPost, "/api/analyze/index", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", rec.Code)
+	}
+}
+
+func TestLoadIndexKeepsOnlyRecentTrees(t *testing.T) {
+	loadedIndexes.Lock()
+	loadedIndexes.byFile = make(map[string]loadedIndex)
+	loadedIndexes.order = nil
+	loadedIndexes.Unlock()
+
+	dir := t.TempDir()
+	var s diskscan.Scanner
+	tree, _, err := s.ScanTree(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	files := make([]string, maxLoadedIndexes+1)
+	for i := range files {
+		files[i] = filepath.Join(dir, "index"+string(rune('a'+i)))
+		if err := tree.Save(files[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded := func(file string) bool {
+		loadedIndexes.Lock()
+		defer loadedIndexes.Unlock()
+		_, ok := loadedIndexes.byFile[file]
+		return ok
+	}
+
+	// Using the first file again makes the second the one to go
+	for _, file := range []string{files[0], files[1], files[0], files[2]} {
+		if _, err := loadIndex(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !loaded(files[0]) || loaded(files[1]) || !loaded(files[2]) {
+		t.Errorf("loaded = %v", loadedIndexes.order)
+	}
+
+	// A deleted file is forgotten
+	if err := os.Remove(files[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIndex(files[2]); err == nil {
+		t.Error("deleted index loaded")
+	}
+	if loaded(files[2]) {
+		t.Error("deleted index still kept")
+	}
+}
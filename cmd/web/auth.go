@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name  string
+	Token *APIToken // nil for basic auth or when auth is disabled
+}
+
+// Allows reports whether the caller may use scope. Basic auth and
+// unauthenticated access (auth disabled) are unrestricted.
+func (p Principal) Allows(scope Scope) bool {
+	return p.Token == nil || p.Token.Allows(scope)
+}
+
+type principalKey struct{}
+
+// principalFrom returns the caller stored by requireScope.
+func principalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// authEnabled reports whether requests must carry credentials: either basic
+// auth is configured or at least one API token exists. A token file that
+// cannot be read counts as holding tokens, so a damaged file does not open
+// the server to everyone.
+func authEnabled() bool {
+	c := currentConfig()
+	if c.AuthUser != "" && c.AuthPass != "" {
+		return true
+	}
+	n, err := tokens.Count()
+	return err != nil || n > 0
+}
+
+// authenticate identifies the caller. Tokens are accepted as
+// "Authorization: Bearer <token>", as the basic auth password (any user
+// name, so browsers can log in with a token), or as ?token= for
+// EventSource streams and image URLs, which cannot set headers.
+func authenticate(r *http.Request) (Principal, bool) {
+	if !authEnabled() {
+		return Principal{Name: "anonymous"}, true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if secret, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return tokenPrincipal(strings.TrimSpace(secret))
+	}
+	if encoded, ok := strings.CutPrefix(auth, "Basic "); ok {
+		payload, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return Principal{}, false
+		}
+		user, pass, ok := strings.Cut(string(payload), ":")
+		if !ok {
+			return Principal{}, false
+		}
+		c := currentConfig()
+		if c.AuthUser != "" && c.AuthPass != "" &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(c.AuthUser)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(pass), []byte(c.AuthPass)) == 1 {
+			return Principal{Name: user}, true
+		}
+		return tokenPrincipal(pass)
+	}
+	if secret := r.URL.Query().Get("token"); secret != "" {
+		return tokenPrincipal(secret)
+	}
+	return Principal{}, false
+}
+
+func tokenPrincipal(secret string) (Principal, bool) {
+	token, ok := tokens.Lookup(secret)
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Name: "token:" + token.Name, Token: &token}, true
+}
+
+// requireScope authenticates a request and checks that the caller holds
+// scope before calling next.
+func requireScope(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return requireScopes(scope, scope, next)
+}
+
+// requireScopes is requireScope for routes that both read and change state:
+// GET and HEAD need read, every other method needs write.
+func requireScopes(read, write Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Mole"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scope := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = read
+		}
+		if !p.Allows(scope) {
+			http.Error(w, "Forbidden: token lacks the "+string(scope)+" scope", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// requireScopeHandler wraps an http.Handler (used for static files).
+func requireScopeHandler(scope Scope, next http.Handler) http.Handler {
+	return requireScope(scope, next.ServeHTTP)
+}
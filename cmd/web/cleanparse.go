@@ -0,0 +1,172 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CleanCategory is the freed space and file count for one section of mole CLI
+// output (for example "User essentials" or "Developer tools").
+type CleanCategory struct {
+	Name  string `json:"name"`
+	Freed int64  `json:"freed_bytes"`
+	Files int    `json:"files"`
+	Items int    `json:"items"`
+}
+
+// Icons printed by lib/core/base.sh.
+const (
+	iconSection = "➤"
+	iconSuccess = "✓"
+	iconDryRun  = "→"
+	iconWarning = "☺︎"
+	iconError   = "☹︎"
+)
+
+var (
+	// "(12 files, 1.50GB)", "(1.2MB dry)", "(3.4MB, 2 protected)", "(~50MB)"
+	sizeInParens = regexp.MustCompile(`\(([^()]*?)~?(\d+(?:\.\d+)?)\s*(B|KB|MB|GB|TB)\b([^()]*)\)`)
+	fileCountRe  = regexp.MustCompile(`(\d+) (?:files|items)`)
+	// Summary lines: "Space freed: 1.2GB", "Clean complete! Freed: 300MB",
+	// "Removed 2 apps, freed 1.50GB"
+	summaryFreedRe = regexp.MustCompile(`(?i)(?:space freed|freed):?\s+~?(\d+(?:\.\d+)?)\s*(B|KB|MB|GB|TB)\b`)
+	summaryItemsRe = regexp.MustCompile(`(?i)items cleaned:?\s+(\d+)`)
+	// "Cleaned 12 mail attachments (~40MB)" style lines without parentheses
+	// around a file count.
+	cleanedCountRe = regexp.MustCompile(`^Cleaned (\d+) `)
+)
+
+// parseHumanSize converts sizes printed by bytes_to_human ("1.50GB", "12KB")
+// back to bytes. Units are binary, matching the shell formatter.
+func parseHumanSize(value, unit string) int64 {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToUpper(unit) {
+	case "KB":
+		n *= 1 << 10
+	case "MB":
+		n *= 1 << 20
+	case "GB":
+		n *= 1 << 30
+	case "TB":
+		n *= 1 << 40
+	}
+	return int64(n)
+}
+
+// parseCleanOutput extracts per-category results from mole clean or uninstall
+// output. Lines it does not understand are ignored, so new CLI messages never
+// break the web UI; they simply don't contribute to the totals.
+func parseCleanOutput(output string) (categories []CleanCategory, files int, skipped, errors []string, summaryFreed int64) {
+	current := -1
+	section := func(name string) int {
+		for i := range categories {
+			if categories[i].Name == name {
+				return i
+			}
+		}
+		categories = append(categories, CleanCategory{Name: name})
+		return len(categories) - 1
+	}
+
+	for _, raw := range strings.Split(stripANSI(output), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, iconSection):
+			current = section(strings.TrimSpace(strings.TrimPrefix(line, iconSection)))
+			continue
+		case strings.HasPrefix(line, iconError), strings.HasPrefix(line, "ERROR:"):
+			msg := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, iconError), "ERROR:"))
+			errors = append(errors, msg)
+			continue
+		case strings.HasPrefix(line, iconWarning):
+			skipped = append(skipped, strings.TrimSpace(strings.TrimPrefix(line, iconWarning)))
+			continue
+		}
+
+		if m := summaryFreedRe.FindStringSubmatch(line); m != nil && !strings.HasPrefix(line, iconSuccess) {
+			summaryFreed = parseHumanSize(m[1], m[2])
+			if m := summaryItemsRe.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				files = n
+			}
+			continue
+		}
+
+		var body string
+		switch {
+		case strings.HasPrefix(line, iconSuccess):
+			body = strings.TrimSpace(strings.TrimPrefix(line, iconSuccess))
+		case strings.HasPrefix(line, iconDryRun):
+			body = strings.TrimSpace(strings.TrimPrefix(line, iconDryRun))
+		default:
+			continue
+		}
+
+		lower := strings.ToLower(body)
+		if strings.Contains(lower, "skipped") {
+			skipped = append(skipped, body)
+			continue
+		}
+
+		m := sizeInParens.FindStringSubmatch(body)
+		if m == nil {
+			continue
+		}
+		if current < 0 {
+			current = section("General")
+		}
+		cat := &categories[current]
+		cat.Items++
+		cat.Freed += parseHumanSize(m[2], m[3])
+		if fc := fileCountRe.FindStringSubmatch(m[1] + m[4]); fc != nil {
+			n, _ := strconv.Atoi(fc[1])
+			cat.Files += n
+		} else if fc := cleanedCountRe.FindStringSubmatch(body); fc != nil {
+			n, _ := strconv.Atoi(fc[1])
+			cat.Files += n
+		}
+	}
+
+	// Drop sections that produced no measurable results
+	kept := categories[:0]
+	for _, cat := range categories {
+		if cat.Items > 0 {
+			kept = append(kept, cat)
+		}
+	}
+	return kept, files, skipped, errors, summaryFreed
+}
+
+// applyCleanOutput fills the structured fields of result from CLI output.
+// The CLI's own summary total wins over the per-line sum when present since
+// not every cleanup step prints a size.
+func applyCleanOutput(result *CleanResult, output string) {
+	categories, files, skipped, errors, summaryFreed := parseCleanOutput(output)
+
+	var freed int64
+	var lineFiles int
+	for _, cat := range categories {
+		freed += cat.Freed
+		lineFiles += cat.Files
+	}
+	if summaryFreed > freed {
+		freed = summaryFreed
+	}
+	if files == 0 {
+		files = lineFiles
+	}
+
+	result.Categories = append(result.Categories, categories...)
+	result.Skipped = append(result.Skipped, skipped...)
+	result.Errors = append(result.Errors, errors...)
+	result.FilesRemoved += files
+	result.Cleaned += freed
+}
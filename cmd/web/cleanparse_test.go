@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestParseHumanSize(t *testing.T) {
+	tests := []struct {
+		value, unit string
+		want        int64
+	}{
+		{"512", "B", 512},
+		{"12", "KB", 12 << 10},
+		{"1.5", "MB", 3 << 19},
+		{"2.00", "GB", 2 << 30},
+		{"1", "TB", 1 << 40},
+		{"bogus", "MB", 0},
+	}
+	for _, tt := range tests {
+		if got := parseHumanSize(tt.value, tt.unit); got != tt.want {
+			t.Errorf("parseHumanSize(%q, %q) = %d, want %d", tt.value, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCleanOutputParsesCategories(t *testing.T) {
+	output := "\x1b[0;35m➤ User essentials\x1b[0m\n" +
+		"  \x1b[0;32m✓\x1b[0m User app cache \x1b[0;32m(120 files, 1.50GB)\x1b[0m\n" +
+		"  ✓ Sandboxed app caches (300MB)\n" +
+		"  ✓ Cleaned 4 mail attachments (~2MB)\n" +
+		"➤ Developer tools\n" +
+		"  ✓ Homebrew · cleaned 2d ago, skipped\n" +
+		"  ✓ npm cache (10 files, 1.0MB)\n" +
+		"  ☺︎ Docker not running\n" +
+		"☹︎ Permission denied: /Library/Caches/foo\n" +
+		"➤ Empty section\n" +
+		"  ✓ Nothing to tidy\n"
+
+	var result CleanResult
+	applyCleanOutput(&result, output)
+
+	if len(result.Categories) != 2 {
+		t.Fatalf("expected 2 categories, got %+v", result.Categories)
+	}
+	user := result.Categories[0]
+	if user.Name != "User essentials" || user.Items != 3 || user.Files != 124 {
+		t.Fatalf("unexpected user category: %+v", user)
+	}
+	wantUser := int64(3<<29) + 300<<20 + 2<<20
+	if user.Freed != wantUser {
+		t.Fatalf("expected %d bytes freed in user category, got %d", wantUser, user.Freed)
+	}
+	if dev := result.Categories[1]; dev.Freed != 1<<20 || dev.Files != 10 {
+		t.Fatalf("unexpected developer category: %+v", dev)
+	}
+	if result.Cleaned != wantUser+1<<20 {
+		t.Fatalf("expected total to be the sum of categories, got %d", result.Cleaned)
+	}
+	if result.FilesRemoved != 134 {
+		t.Fatalf("expected 134 files, got %d", result.FilesRemoved)
+	}
+	if len(result.Skipped) != 2 {
+		t.Fatalf("expected 2 skipped items, got %q", result.Skipped)
+	}
+	if len(result.Errors) != 1 || result.Errors[0] != "Permission denied: /Library/Caches/foo" {
+		t.Fatalf("unexpected errors: %q", result.Errors)
+	}
+}
+
+func TestApplyCleanOutputPrefersSummaryTotal(t *testing.T) {
+	output := "➤ System\n" +
+		"  ✓ Logs (1MB)\n" +
+		"======================================================================\n" +
+		"Cleanup complete\n" +
+		"Space freed: 2.50GB | Items cleaned: 812 | Free space now: 100GB\n"
+
+	var result CleanResult
+	applyCleanOutput(&result, output)
+	if result.Cleaned != int64(2.5*float64(1<<30)) {
+		t.Fatalf("expected summary total, got %d", result.Cleaned)
+	}
+	if result.FilesRemoved != 812 {
+		t.Fatalf("expected 812 items from summary, got %d", result.FilesRemoved)
+	}
+}
+
+func TestApplyCleanOutputParsesUninstallSummary(t *testing.T) {
+	output := "Files to be removed:\n" +
+		"  ✓ /Applications/Foo.app\n" +
+		"  ✓ ~/Library/Caches/com.foo\n" +
+		"======================================================================\n" +
+		"Uninstall complete\n" +
+		"Removed 1 app, freed 350.4MB\n" +
+		"Foo\n"
+
+	var result CleanResult
+	applyCleanOutput(&result, output)
+	if result.Cleaned != parseHumanSize("350.4", "MB") {
+		t.Fatalf("expected freed size from uninstall summary, got %d", result.Cleaned)
+	}
+}
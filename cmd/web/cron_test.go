@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2026, 10, 16, 14, 37, 20, 0, time.UTC) // Friday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 3 * * *", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)},
+		{"@nightly", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 14, 45, 0, 0, time.UTC)},
+		{"0 4 * * sun", time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 7", time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)},
+		{"30 9 1 * *", time.Date(2026, 11, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Day-of-month or day-of-week when both are restricted
+		{"0 12 20 * mon", time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		// A stepped * still restricts, but both fields must then match
+		{"0 3 */2 * 1", time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{"0 3 */2 * *", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		spec, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := spec.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNeverMatches(t *testing.T) {
+	spec, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parseCron: %v", err)
+	}
+	if got := spec.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected no match for Feb 30, got %v", got)
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	sessionCookie = "mole_session"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// csrfKey signs CSRF tokens. It changes on every start; the UI fetches a
+// fresh token from /api/csrf when an old one is rejected.
+var csrfKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// splitList parses a comma-separated setting.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, strings.TrimSuffix(part, "/"))
+		}
+	}
+	return out
+}
+
+// hostAllowed reports whether a Host header names this machine. Rejecting
+// other names stops DNS rebinding, where an attacker's domain is pointed at
+// 127.0.0.1 to make the browser treat the API as same-origin.
+func hostAllowed(host string) bool {
+	name := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+	name = strings.TrimSuffix(strings.Trim(name, "[]"), ".")
+
+	if name == "" {
+		return false
+	}
+	if net.ParseIP(name) != nil || name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return true
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		hostname = strings.ToLower(strings.TrimSuffix(hostname, ".local"))
+		if name == hostname || name == hostname+".local" {
+			return true
+		}
+	}
+	c := currentConfig()
+	if strings.EqualFold(name, c.Host) {
+		return true
+	}
+	for _, allowed := range c.AllowedHosts {
+		if strings.EqualFold(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether origin is the host the request was sent to.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func corsAllowed(origin string) bool {
+	for _, allowed := range currentConfig().CORSOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// csrfToken derives the CSRF token for a session.
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ensureSession returns the request's session, setting a new session
+// cookie when there is none.
+func ensureSession(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(sessionCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	session := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session
+}
+
+// fromBrowser reports whether a request may carry ambient browser
+// credentials: a session cookie, or the Origin / Sec-Fetch-Site headers
+// every current browser sends. Scripts and curl send none of these.
+func fromBrowser(r *http.Request) bool {
+	if _, err := r.Cookie(sessionCookie); err == nil {
+		return true
+	}
+	return r.Header.Get("Origin") != "" || r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// csrfExempt reports whether a request carries a valid API token, which a
+// cross-site page cannot attach on the user's behalf.
+func csrfExempt(r *http.Request) bool {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		secret = r.URL.Query().Get("token")
+	}
+	if secret == "" {
+		return false
+	}
+	_, valid := tokens.Lookup(strings.TrimSpace(secret))
+	return valid
+}
+
+func csrfValid(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	want := csrfToken(c.Value)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(want)) == 1
+}
+
+// protect validates the Host and Origin of every request, answers CORS
+// for allowlisted origins, and requires a CSRF token on state-changing
+// requests from browsers.
+func protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hostAllowed(r.Host) {
+			http.Error(w, "Forbidden: unknown host "+r.Host, http.StatusForbidden)
+			return
+		}
+
+		trusted := false
+		if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(r, origin) {
+			trusted = corsAllowed(origin)
+			if !trusted {
+				if isMutating(r.Method) || r.Method == http.MethodOptions {
+					http.Error(w, "Forbidden: cross-origin request", http.StatusForbidden)
+					return
+				}
+				// Reads go through without CORS headers, so the browser
+				// does not hand the response to the other site
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Add("Vary", "Origin")
+				if r.Method == http.MethodOptions {
+					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+csrfHeader)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		} else if origin == "" && isMutating(r.Method) && r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+			http.Error(w, "Forbidden: cross-site request", http.StatusForbidden)
+			return
+		}
+
+		// Allowlisted origins are trusted like the UI itself
+		if isMutating(r.Method) && !trusted && fromBrowser(r) && !csrfExempt(r) && !csrfValid(r) {
+			w.Header().Set("X-CSRF-Failed", "1")
+			http.Error(w, "Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCSRF serves GET /api/csrf, returning the CSRF token for the
+// caller's session and starting one if needed.
+func handleCSRF(w http.ResponseWriter, r *http.Request) {
+	session := ensureSession(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"token": csrfToken(session)})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	useConfig(t, Config{AllowedHosts: []string{"mole.example.lan"}})
+
+	for host, want := range map[string]bool{
+		"localhost:8080":        true,
+		"127.0.0.1:8080":        true,
+		"[::1]:8080":            true,
+		"10.0.0.5":              true,
+		"app.localhost":         true,
+		"mole.example.lan:8081": true,
+		"evil.example.com:8080": false,
+		"":                      false,
+	} {
+		if got := hostAllowed(host); got != want {
+			t.Errorf("hostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestProtectRequiresCSRFFromBrowsers(t *testing.T) {
+	useTempConfig(t)
+	useConfig(t, Config{})
+	h := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/files", nil)
+		req.Host = "localhost:8080"
+		return req
+	}
+
+	// Scripts without browser headers or cookies are not CSRF targets
+	if rec := do(post()); rec.Code != http.StatusOK {
+		t.Fatalf("plain client: got %d", rec.Code)
+	}
+
+	// DNS rebinding
+	req := post()
+	req.Host = "attacker.example:8080"
+	if rec := do(req); rec.Code != http.StatusForbidden {
+		t.Errorf("foreign host: got %d", rec.Code)
+	}
+
+	// Cross-origin page
+	req = post()
+	req.Header.Set("Origin", "https://evil.example")
+	if rec := do(req); rec.Code != http.StatusForbidden {
+		t.Errorf("cross-origin: got %d", rec.Code)
+	}
+	// Cross-origin ?token= must not bypass the check when auth is off
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/api/files?token=x", nil)
+	req.Header.Set("Sec-Fetch-Site", "same-site")
+	if rec := do(req); rec.Code != http.StatusForbidden {
+		t.Errorf("bogus token: got %d", rec.Code)
+	}
+
+	// Same-origin browser request needs the session's token
+	req = post()
+	req.Header.Set("Origin", "http://localhost:8080")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "s1"})
+	rec := do(req)
+	if rec.Code != http.StatusForbidden || rec.Header().Get("X-CSRF-Failed") == "" {
+		t.Errorf("missing token: got %d", rec.Code)
+	}
+	req.Header.Set(csrfHeader, csrfToken("s2"))
+	if rec := do(req); rec.Code != http.StatusForbidden {
+		t.Errorf("other session's token: got %d", rec.Code)
+	}
+	req.Header.Set(csrfHeader, csrfToken("s1"))
+	if rec := do(req); rec.Code != http.StatusOK {
+		t.Errorf("valid token: got %d", rec.Code)
+	}
+
+	// A valid API token is not ambient and skips CSRF
+	_, secret, _ := tokens.Create("ci", []Scope{ScopeDestructive})
+	req = post()
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("Authorization", "Bearer "+secret)
+	if rec := do(req); rec.Code != http.StatusOK {
+		t.Errorf("bearer token: got %d", rec.Code)
+	}
+}
+
+func TestProtectCORSAllowlist(t *testing.T) {
+	useConfig(t, Config{CORSOrigins: []string{"https://dash.example.com"}})
+
+	h := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "http://localhost:8080/api/purge", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" {
+		t.Fatalf("preflight: %d %v", rec.Code, rec.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/api/status/stream", nil)
+	req.Header.Set("Origin", "https://other.example")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unlisted origin got CORS headers: %v", rec.Header())
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tw93/mole/internal/mdns"
+)
+
+// moleService is the DNS-SD service type Mole web servers advertise.
+const moleService = "_mole._tcp"
+
+const (
+	discoverTimeout    = 2 * time.Second
+	discoverMaxTimeout = 10 * time.Second
+	// Auth turns on when the first API token is created, so the TXT
+	// records are checked for changes this often.
+	advertiseRefresh = 30 * time.Second
+)
+
+// moleTXT returns the TXT entries advertised for a server running with cfg.
+func moleTXT(cfg Config) []string {
+	auth := "none"
+	if authEnabled() {
+		auth = "required"
+	}
+	tls := "0"
+	if cfg.TLS != nil && *cfg.TLS {
+		tls = "1"
+	}
+	return []string{"txtvers=1", "version=" + getCurrentVersion(), "auth=" + auth, "tls=" + tls, "path=/"}
+}
+
+// shortHostname returns this Mac's name without domain, e.g. "studio".
+func shortHostname() string {
+	hostname, _ := os.Hostname()
+	short, _, _ := strings.Cut(strings.TrimSuffix(hostname, ".local"), ".")
+	return short
+}
+
+// loopbackOnly reports whether a server bound to host is unreachable from
+// other machines.
+func loopbackOnly(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// advertise publishes this server as a _mole._tcp instance until stop is
+// closed. Servers bound to localhost are not advertised.
+func advertise(stop <-chan struct{}) {
+	cfg := *currentConfig()
+	if !*cfg.Advertise || loopbackOnly(cfg.Host) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	host := shortHostname()
+	responder := mdns.NewResponder(mdns.Service{
+		Instance: host,
+		Service:  moleService,
+		Host:     host,
+		Port:     cfg.Port,
+		TXT:      moleTXT(cfg),
+	})
+	go func() {
+		ticker := time.NewTicker(advertiseRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				cancel()
+				return
+			case <-ticker.C:
+				responder.SetTXT(moleTXT(cfg))
+			}
+		}
+	}()
+
+	writeLog("Advertising %s.%s.local on port %d", host, moleService, cfg.Port)
+	if err := responder.Serve(ctx); err != nil {
+		writeLog("ERROR: Bonjour advertising: %v", err)
+	}
+}
+
+// DiscoveredServer is a Mole web server found on the LAN.
+type DiscoveredServer struct {
+	Name         string   `json:"name"`
+	Host         string   `json:"host"` // e.g. "studio.local"
+	Port         int      `json:"port"`
+	IPs          []string `json:"ips"`
+	URL          string   `json:"url"`
+	Version      string   `json:"version,omitempty"`
+	AuthRequired bool     `json:"auth_required"`
+	TLS          bool     `json:"tls"`
+	Self         bool     `json:"self,omitempty"` // This server
+	Peer         string   `json:"peer,omitempty"` // Name of the fleet peer with this address
+}
+
+// discover browses for Mole servers until ctx is done.
+func discover(ctx context.Context) ([]DiscoveredServer, error) {
+	entries, err := mdns.Browse(ctx, moleService)
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]DiscoveredServer, 0, len(entries))
+	for _, e := range entries {
+		s := DiscoveredServer{
+			Name:         e.Instance,
+			Host:         e.Host + ".local",
+			Port:         e.Port,
+			Version:      e.TXT["version"],
+			AuthRequired: e.TXT["auth"] == "required",
+			TLS:          e.TXT["tls"] == "1",
+		}
+		for _, ip := range e.IPs {
+			s.IPs = append(s.IPs, ip.String())
+		}
+		scheme := "http"
+		if s.TLS {
+			scheme = "https"
+		}
+		s.URL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+		s.Self = strings.EqualFold(e.Host, shortHostname()) && s.Port == currentConfig().Port
+		s.Peer = matchPeer(s)
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+// matchPeer returns the name of the configured peer at s's address, by
+// host name or IP and port.
+func matchPeer(s DiscoveredServer) string {
+	for _, p := range currentConfig().Peers {
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+		}
+		if port != strconv.Itoa(s.Port) {
+			continue
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		if host == strings.ToLower(s.Host) || host == strings.ToLower(strings.TrimSuffix(s.Host, ".local")) {
+			return p.Name
+		}
+		for _, ip := range s.IPs {
+			if host == ip {
+				return p.Name
+			}
+		}
+	}
+	return ""
+}
+
+// handleDiscover serves GET /api/discover, listing the Mole servers that
+// answer within ?timeout= (default 2s, at most 10s).
+func handleDiscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	timeout := discoverTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = min(d, discoverMaxTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	servers, err := discover(ctx)
+	if err != nil {
+		http.Error(w, "Discovery unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(servers)
+}
+
+// runDiscoverCommand prints the Mole servers on the LAN, for -discover.
+func runDiscoverCommand() {
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+	servers, err := discover(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Discovery failed: %v\n", err)
+		os.Exit(1)
+	}
+	for _, s := range servers {
+		auth := ""
+		if s.AuthRequired {
+			auth = " (auth required)"
+		}
+		fmt.Printf("%-20s %-40s %s%s\n", s.Name, s.URL, s.Version, auth)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchPeer(t *testing.T) {
+	useConfig(t, Config{Peers: []Peer{
+		{Name: "kids", URL: "http://kids-imac.local:8081"},
+		{Name: "studio", URL: "https://10.0.0.7:8081/"},
+	}})
+
+	for _, tc := range []struct {
+		server DiscoveredServer
+		want   string
+	}{
+		{DiscoveredServer{Host: "Kids-iMac.local", Port: 8081}, "kids"},
+		{DiscoveredServer{Host: "kids-imac.local", Port: 8080}, ""},
+		{DiscoveredServer{Host: "studio.local", Port: 8081, IPs: []string{"10.0.0.7"}}, "studio"},
+		{DiscoveredServer{Host: "other.local", Port: 8081, IPs: []string{"10.0.0.8"}}, ""},
+	} {
+		if got := matchPeer(tc.server); got != tc.want {
+			t.Errorf("matchPeer(%+v) = %q, want %q", tc.server, got, tc.want)
+		}
+	}
+}
+
+func TestMoleTXTReportsAuth(t *testing.T) {
+	useTempConfig(t)
+	useConfig(t, Config{})
+	txt := strings.Join(moleTXT(*currentConfig()), " ")
+	if !strings.Contains(txt, "auth=none") || !strings.Contains(txt, "tls=0") {
+		t.Errorf("txt = %s", txt)
+	}
+
+	useConfig(t, Config{AuthUser: "admin", AuthPass: "pw", TLS: boolPtr(true)})
+	txt = strings.Join(moleTXT(*currentConfig()), " ")
+	if !strings.Contains(txt, "auth=required") || !strings.Contains(txt, "tls=1") {
+		t.Errorf("txt = %s", txt)
+	}
+
+	if !loopbackOnly("localhost") || !loopbackOnly("127.0.0.1") || loopbackOnly("0.0.0.0") {
+		t.Error("loopbackOnly misclassified a bind address")
+	}
+}
+
+func TestHandleDiscoverRejectsBadTimeout(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleDiscover(rec, httptest.NewRequest(http.MethodGet, "/api/discover?timeout=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d", rec.Code)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tw93/mole/internal/pathpolicy"
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+// Planned action kinds reported by dry runs.
+const (
+	actionDelete     = "delete"
+	actionQuarantine = "quarantine"
+	actionUninstall  = "uninstall"
+	actionEmptyTrash = "empty_trash"
+	actionClean      = "clean"
+	actionRun        = "run"
+	actionSkip       = "skip"
+)
+
+// PlannedAction is one step a destructive operation would take.
+type PlannedAction struct {
+	Action    string `json:"action"`
+	Path      string `json:"path,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Size      int64  `json:"size"`
+	SizeHuman string `json:"size_human"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// DryRunResult is returned instead of performing an operation when the
+// request asks for a dry run. Nothing on disk is changed.
+type DryRunResult struct {
+	DryRun    bool                  `json:"dry_run"`
+	Operation string                `json:"operation"`
+	Actions   []PlannedAction       `json:"actions"`
+	Refused   []pathpolicy.Decision `json:"refused,omitempty"`
+	TotalSize int64                 `json:"total_size"`
+	SizeHuman string                `json:"size_human"`
+	Output    string                `json:"output,omitempty"`
+}
+
+func newDryRun(operation string) DryRunResult {
+	return DryRunResult{DryRun: true, Operation: operation, Actions: []PlannedAction{}}
+}
+
+// add records an action. Skipped actions do not count towards the total.
+func (d *DryRunResult) add(a PlannedAction) {
+	a.SizeHuman = formatBytes(a.Size)
+	d.Actions = append(d.Actions, a)
+	if a.Action != actionSkip {
+		d.TotalSize += a.Size
+	}
+	d.SizeHuman = formatBytes(d.TotalSize)
+}
+
+// wantsDryRun reports whether a request asked for a dry run, either in its
+// JSON body or with ?dry_run=1.
+func wantsDryRun(r *http.Request, fromBody bool) bool {
+	if fromBody {
+		return true
+	}
+	v, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	return v
+}
+
+func writeDryRun(w http.ResponseWriter, plan DryRunResult) {
+	plan.SizeHuman = formatBytes(plan.TotalSize)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// planRemoval reports what purgePaths or handleDeleteFiles would do with
+// paths: the policy decision, existence and size of each one.
+func planRemoval(operation string, paths []string, mode string) DryRunResult {
+	plan := newDryRun(operation)
+	allowed, refused := deletePolicy().Partition(paths)
+	plan.Refused = refused
+
+	action := actionDelete
+	if mode == deleteModeQuarantine {
+		action = actionQuarantine
+	}
+	for _, d := range allowed {
+		info, err := os.Lstat(d.Canonical)
+		if err != nil {
+			plan.add(PlannedAction{Action: actionSkip, Path: d.Canonical, Detail: "Path does not exist"})
+			continue
+		}
+		size := info.Size()
+		if info.IsDir() {
+			size = getDirSize(d.Canonical)
+		}
+		plan.add(PlannedAction{Action: action, Path: d.Canonical, Name: filepath.Base(d.Canonical), Size: size})
+	}
+	return plan
+}
+
+// planUninstall lists each app bundle and the related files the mole CLI
+// would remove with it, as found by the CLI's own find_app_files.
+func planUninstall(ctx context.Context, apps []string) DryRunResult {
+	plan := newDryRun("uninstall")
+	allowed, refused := deletePolicy().Partition(apps)
+	plan.Refused = refused
+
+	for _, d := range allowed {
+		appPath := d.Canonical
+		name := strings.TrimSuffix(filepath.Base(appPath), ".app")
+		if _, err := os.Stat(appPath); err != nil {
+			plan.add(PlannedAction{Action: actionSkip, Path: appPath, Name: name, Detail: "Application not found"})
+			continue
+		}
+		plan.add(PlannedAction{Action: actionUninstall, Path: appPath, Name: name, Size: getDirSize(appPath)})
+
+		related, err := cliAppFiles(ctx, appPath)
+		if err != nil {
+			plan.add(PlannedAction{Action: actionSkip, Name: name, Detail: "Related files unknown: " + err.Error()})
+			continue
+		}
+		for _, path := range related {
+			plan.add(PlannedAction{Action: actionDelete, Path: path, Name: name, Size: getDirSize(path), Detail: "Related file"})
+		}
+	}
+	return plan
+}
+
+// cliAppFiles asks the mole shell library for the files it associates with
+// an app, so the preview lists exactly what an uninstall removes.
+func cliAppFiles(ctx context.Context, appPath string) ([]string, error) {
+	mole := findMoleScript()
+	if mole == "" {
+		return nil, fmt.Errorf("mole CLI not found")
+	}
+	if resolved, err := filepath.EvalSymlinks(mole); err == nil {
+		mole = resolved
+	}
+	common := filepath.Join(filepath.Dir(mole), "lib", "core", "common.sh")
+	if !fileExists(common) {
+		return nil, fmt.Errorf("mole shell library not found")
+	}
+
+	bundleID := getBundleID(appPath)
+	if bundleID == "" {
+		bundleID = "unknown"
+	}
+	name := strings.TrimSuffix(filepath.Base(appPath), ".app")
+	script := `source "$1" > /dev/null 2>&1 || exit 1; find_app_files "$2" "$3"; find_app_system_files "$2" "$3"`
+	output, err := newCommand(ctx, "bash", "-c", script, "mole-plan", common, bundleID, name).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		paths = append(paths, line)
+	}
+	return paths, nil
+}
+
+// planEmptyTrash lists what emptyTrash would remove.
+func planEmptyTrash() DryRunResult {
+	plan := newDryRun("clean:trash")
+	home := os.Getenv("HOME")
+	trashDirs := []string{
+		filepath.Join(home, ".Trash"),
+		filepath.Join("/", ".Trashes", fmt.Sprintf("%d", os.Getuid())),
+	}
+
+	for _, dir := range trashDirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Newer macOS hides the Trash without Full Disk Access
+			plan.add(PlannedAction{Action: actionEmptyTrash, Path: dir, Size: getDirSize(dir), Detail: "Contents not readable; size is approximate"})
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			size := int64(0)
+			if entry.IsDir() {
+				size = getDirSize(path)
+			} else if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			plan.add(PlannedAction{Action: actionDelete, Path: path, Name: entry.Name(), Size: size})
+		}
+	}
+	return plan
+}
+
+// planClean previews a clean. The Trash is listed directly; other
+// categories come from `mole clean --dry-run`.
+func planClean(ctx context.Context, category string) DryRunResult {
+	if category == "trash" {
+		return planEmptyTrash()
+	}
+
+	args := []string{"clean", "--dry-run"}
+	operation := "clean"
+	if category != "" && category != "all" {
+		args = append(args, "--"+category)
+		operation += ":" + category
+	}
+	result := runMoleCommandContext(ctx, nil, args...)
+	applyCleanOutput(&result, result.Output)
+
+	plan := newDryRun(operation)
+	plan.Output = result.Output
+	for _, cat := range result.Categories {
+		plan.add(PlannedAction{
+			Action: actionClean,
+			Name:   cat.Name,
+			Size:   cat.Freed,
+			Detail: fmt.Sprintf("%d files", cat.Files),
+		})
+	}
+	if !result.Success {
+		plan.add(PlannedAction{Action: actionSkip, Detail: result.Message})
+	}
+	return plan
+}
+
+// planOptimize lists the optimize tasks with the cache paths they clear,
+// marking the ones the whitelists skip.
+func planOptimize() DryRunResult {
+	plan := newDryRun("optimize")
+	skipTasks := loadWhitelist(whitelist.Optimize)
+	protected := loadWhitelist(whitelist.Clean)
+
+	for _, task := range optimizeTasks(os.Getenv("HOME")) {
+		a := PlannedAction{Action: actionRun, Name: task.name, Path: task.path, Detail: task.label}
+		if reason := optimizeSkipReason(task.task, task.path, skipTasks, protected); reason != "" {
+			a.Action = actionSkip
+			a.Detail = fmt.Sprintf("%s: whitelisted (%s)", task.label, reason)
+		} else if task.path != "" {
+			if _, err := os.Stat(task.path); err != nil {
+				a.Action = actionSkip
+				a.Detail = task.label + ": nothing to clear"
+			} else {
+				a.Action = actionDelete
+				a.Size = getDirSize(task.path)
+			}
+		}
+		plan.add(a)
+	}
+	return plan
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+func TestDeleteFilesDryRunLeavesFilesInPlace(t *testing.T) {
+	home := useTempConfig(t)
+	target := filepath.Join(home, "Downloads", "big.iso")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	os.WriteFile(target, []byte("0123456789"), 0644)
+	missing := filepath.Join(home, "Downloads", "gone.zip")
+
+	body := `{"paths":["` + target + `","` + missing + `","/usr/bin"],"mode":"trash","dry_run":true}`
+	rec := httptest.NewRecorder()
+	handleDeleteFiles(rec, httptest.NewRequest(http.MethodPost, "/api/files", strings.NewReader(body)))
+
+	var plan DryRunResult
+	if err := json.NewDecoder(rec.Body).Decode(&plan); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !plan.DryRun || plan.TotalSize != 10 || len(plan.Refused) != 1 || len(plan.Actions) != 2 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.Actions[0].Action != actionQuarantine || plan.Actions[1].Action != actionSkip {
+		t.Fatalf("unexpected actions: %+v", plan.Actions)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("dry run removed the file: %v", err)
+	}
+}
+
+func TestPurgeDryRunViaQuery(t *testing.T) {
+	home := useTempConfig(t)
+	dir := filepath.Join(home, "code", "app", "dist")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "a.js"), []byte("abc"), 0644)
+
+	body := `{"paths":["` + dir + `"]}`
+	rec := httptest.NewRecorder()
+	handlePurge(rec, httptest.NewRequest(http.MethodPost, "/api/purge?dry_run=1", strings.NewReader(body)))
+
+	var plan DryRunResult
+	json.NewDecoder(rec.Body).Decode(&plan)
+	if plan.Operation != "purge" || plan.TotalSize != 3 || plan.Actions[0].Action != actionDelete {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("dry run removed the directory: %v", err)
+	}
+}
+
+func TestPlanOptimizeHonoursWhitelists(t *testing.T) {
+	home := useTempConfig(t)
+	fonts := filepath.Join(home, "Library", "Caches", "com.apple.FontRegistry")
+	os.MkdirAll(fonts, 0755)
+	os.WriteFile(filepath.Join(fonts, "cache"), []byte("12345"), 0644)
+	// Step names are not whitelist entries; the CLI's task IDs are
+	whitelist.Save(home, whitelist.Optimize, []string{optimizeTaskSwap, optimizeDNSCache})
+
+	plan := planOptimize()
+	byName := make(map[string]PlannedAction)
+	for _, a := range plan.Actions {
+		byName[a.Name] = a
+	}
+	if byName[optimizeMemoryPurge].Action != actionSkip {
+		t.Errorf("memory purge should be skipped: %+v", byName[optimizeMemoryPurge])
+	}
+	if a := byName[optimizeFontCache]; a.Action != actionDelete || a.Size != 5 {
+		t.Errorf("font cache action = %+v", a)
+	}
+	if byName[optimizeDNSCache].Action != actionRun {
+		t.Errorf("dns flush should run: %+v", byName[optimizeDNSCache])
+	}
+
+	// One task covers several steps
+	whitelist.Save(home, whitelist.Optimize, []string{optimizeTaskCaches})
+	byName = make(map[string]PlannedAction)
+	for _, a := range planOptimize().Actions {
+		byName[a.Name] = a
+	}
+	for _, name := range []string{optimizeQuickLookCache, optimizeIconCache, optimizeFontCache, optimizeRestartFinder} {
+		if byName[name].Action != actionSkip {
+			t.Errorf("%s should be skipped: %+v", name, byName[name])
+		}
+	}
+	if byName[optimizeSpotlight].Action != actionRun {
+		t.Errorf("spotlight should run: %+v", byName[optimizeSpotlight])
+	}
+}
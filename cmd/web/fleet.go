@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Peer is another Mole web server shown in the fleet view. Token is an API
+// token created on the peer: the status scope is enough for the dashboard,
+// clean and purge also need analyze and destructive. User and Pass are used
+// instead for peers protected by basic auth.
+type Peer struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	Token          string `json:"token,omitempty"`
+	User           string `json:"user,omitempty"`
+	Pass           string `json:"pass,omitempty"`
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"` // SHA-256 of a self-signed peer certificate, as printed at its startup
+}
+
+var peerNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func (p Peer) validate() error {
+	if !peerNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid peer name %q: use letters, digits, '.', '_' and '-'", p.Name)
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("peer %s: url must be an http or https URL", p.Name)
+	}
+	if p.TLSFingerprint != "" {
+		if u.Scheme != "https" {
+			return fmt.Errorf("peer %s: tls_fingerprint needs an https URL", p.Name)
+		}
+		if fp := normalizeFingerprint(p.TLSFingerprint); len(fp) != sha256.Size*2 {
+			return fmt.Errorf("peer %s: tls_fingerprint must be a SHA-256 fingerprint", p.Name)
+		}
+	}
+	return nil
+}
+
+// normalizeFingerprint turns "AB:CD:..." into "abcd...".
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fp))
+}
+
+// redactPeers returns a copy of peers with their secrets hidden.
+func redactPeers(peers []Peer) []Peer {
+	if peers == nil {
+		return nil
+	}
+	redacted := make([]Peer, len(peers))
+	for i, p := range peers {
+		if p.Token != "" {
+			p.Token = redactedPassword
+		}
+		if p.Pass != "" {
+			p.Pass = redactedPassword
+		}
+		redacted[i] = p
+	}
+	return redacted
+}
+
+func hasRedactedPeerSecrets(peers []Peer) bool {
+	for _, p := range peers {
+		if p.Token == redactedPassword || p.Pass == redactedPassword {
+			return true
+		}
+	}
+	return false
+}
+
+// restorePeerSecrets puts back the secrets of peers that were saved with
+// the redacted values /api/config returned, matching peers by name.
+func restorePeerSecrets(peers, old []Peer) []Peer {
+	restored := make([]Peer, len(peers))
+	for i, p := range peers {
+		for _, o := range old {
+			if o.Name != p.Name {
+				continue
+			}
+			if p.Token == redactedPassword {
+				p.Token = o.Token
+			}
+			if p.Pass == redactedPassword {
+				p.Pass = o.Pass
+			}
+		}
+		restored[i] = p
+	}
+	return restored
+}
+
+const (
+	fleetStatusInterval  = 15 * time.Second
+	fleetStorageInterval = 10 * time.Minute
+	fleetStatusTimeout   = 10 * time.Second
+	fleetStorageTimeout  = 5 * time.Minute // The breakdown walks large directories
+)
+
+// fleetPathAllowed reports whether the fleet proxy forwards the peer API
+// path (without the /api/ prefix).
+func fleetPathAllowed(path string) bool {
+	switch path {
+	case "status", "storage/breakdown", "clean", "clean/preview", "purge", "purge/scan", "jobs":
+		return true
+	}
+	return strings.HasPrefix(path, "jobs/") && !strings.Contains(path, "..")
+}
+
+// PeerState is the latest known state of one host in the fleet.
+type PeerState struct {
+	Name      string            `json:"name"`
+	URL       string            `json:"url,omitempty"`
+	Self      bool              `json:"self,omitempty"` // This server
+	Online    bool              `json:"online"`
+	Error     string            `json:"error,omitempty"`
+	LastSeen  *time.Time        `json:"last_seen,omitempty"`
+	Status    *SystemStatus     `json:"status,omitempty"`
+	Storage   *StorageBreakdown `json:"storage,omitempty"`
+	StorageAt *time.Time        `json:"storage_at,omitempty"`
+
+	storageBusy bool
+}
+
+// FleetSummary adds up the disks of the hosts that reported in.
+type FleetSummary struct {
+	Hosts            int    `json:"hosts"`
+	Online           int    `json:"online"`
+	DiskTotal        uint64 `json:"disk_total"`
+	DiskUsed         uint64 `json:"disk_used"`
+	DiskFree         uint64 `json:"disk_free"`
+	DiskTotalHuman   string `json:"disk_total_human"`
+	DiskUsedHuman    string `json:"disk_used_human"`
+	DiskFreeHuman    string `json:"disk_free_human"`
+	Reclaimable      int64  `json:"reclaimable"` // Sum of cleanup suggestions
+	ReclaimableHuman string `json:"reclaimable_human"`
+}
+
+// FleetView is returned by /api/fleet.
+type FleetView struct {
+	Hosts   []PeerState  `json:"hosts"`
+	Summary FleetSummary `json:"summary"`
+}
+
+// Fleet polls the configured peers and this server, and proxies actions
+// to peers.
+type Fleet struct {
+	mu         sync.Mutex
+	states     map[string]*PeerState // By peer name; "" is this server
+	transports map[string]peerTransport
+}
+
+// peerTransport is a peer's transport and the settings it was made for.
+type peerTransport struct {
+	peer Peer
+	t    *http.Transport
+}
+
+func NewFleet() *Fleet {
+	return &Fleet{
+		states:     make(map[string]*PeerState),
+		transports: make(map[string]peerTransport),
+	}
+}
+
+var fleet = NewFleet()
+
+// Run polls status every fleetStatusInterval and storage every
+// fleetStorageInterval until stop is closed. It does nothing while no
+// peers are configured.
+func (f *Fleet) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(fleetStatusInterval)
+	defer ticker.Stop()
+	for {
+		if len(currentConfig().Peers) > 0 {
+			f.refresh(ctx, false)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh polls every host's status, waiting for the results. Storage
+// breakdowns are slow, so they are fetched in the background when due
+// and outlive ctx, unless storage is true: then they are always fetched
+// and waited for.
+func (f *Fleet) refresh(ctx context.Context, storage bool) {
+	peers := currentConfig().Peers
+	f.dropTransports(peers)
+	var wg sync.WaitGroup
+	poll := func(peer *Peer) {
+		defer wg.Done()
+		f.pollStatus(ctx, peer)
+		if f.claimStorage(peer, storage) {
+			if storage {
+				f.pollStorage(ctx, peer)
+			} else {
+				go f.pollStorage(context.WithoutCancel(ctx), peer)
+			}
+		}
+	}
+	wg.Add(1 + len(peers))
+	go poll(nil)
+	for i := range peers {
+		go poll(&peers[i])
+	}
+	wg.Wait()
+}
+
+func peerKey(peer *Peer) string {
+	if peer == nil {
+		return ""
+	}
+	return peer.Name
+}
+
+// state returns the entry for peer, resetting it if the peer's URL changed.
+// Callers hold f.mu.
+func (f *Fleet) state(peer *Peer) *PeerState {
+	key := peerKey(peer)
+	s := f.states[key]
+	if s == nil || (peer != nil && s.URL != peer.URL) {
+		s = &PeerState{Name: key, Self: peer == nil}
+		if peer != nil {
+			s.URL = peer.URL
+		} else {
+			s.Name, _ = os.Hostname()
+		}
+		f.states[key] = s
+	}
+	return s
+}
+
+// claimStorage reports whether peer's storage breakdown should be fetched
+// now, marking it as in progress.
+func (f *Fleet) claimStorage(peer *Peer, force bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.state(peer)
+	if s.storageBusy || !s.Online {
+		return false
+	}
+	if !force && s.StorageAt != nil && time.Since(*s.StorageAt) < fleetStorageInterval {
+		return false
+	}
+	s.storageBusy = true
+	return true
+}
+
+func (f *Fleet) pollStatus(ctx context.Context, peer *Peer) {
+	var status SystemStatus
+	var err error
+	if peer == nil {
+		status = collectStatus()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, fleetStatusTimeout)
+		err = f.fetch(ctx, *peer, "status", &status)
+		cancel()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.state(peer)
+	if err != nil {
+		if s.Online || s.Error != err.Error() {
+			writeLog("Fleet: %s unreachable: %v", s.Name, err)
+		}
+		s.Online, s.Error = false, err.Error()
+		return
+	}
+	now := time.Now()
+	s.Online, s.Error, s.LastSeen, s.Status = true, "", &now, &status
+}
+
+func (f *Fleet) pollStorage(ctx context.Context, peer *Peer) {
+	var breakdown StorageBreakdown
+	var err error
+	if peer == nil {
+		breakdown, err = collectStorageBreakdown()
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, fleetStorageTimeout)
+		err = f.fetch(ctx, *peer, "storage/breakdown", &breakdown)
+		cancel()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.state(peer)
+	s.storageBusy = false
+	if err != nil {
+		writeLog("Fleet: storage breakdown from %s failed: %v", s.Name, err)
+		return
+	}
+	now := time.Now()
+	s.Storage, s.StorageAt = &breakdown, &now
+}
+
+// fetch GETs /api/<path> from peer and decodes the JSON response into v.
+func (f *Fleet) fetch(ctx context.Context, peer Peer, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peerURL(peer, path).String(), nil)
+	if err != nil {
+		return err
+	}
+	setPeerAuth(req, peer)
+	resp, err := (&http.Client{Transport: f.transport(peer)}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// peerURL returns the URL of /api/<path> on peer.
+func peerURL(peer Peer, path string) *url.URL {
+	u, _ := url.Parse(peer.URL) // Checked by Validate
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/" + path
+	u.RawPath = ""
+	return u
+}
+
+func setPeerAuth(req *http.Request, peer Peer) {
+	switch {
+	case peer.Token != "":
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	case peer.User != "":
+		req.SetBasicAuth(peer.User, peer.Pass)
+	}
+}
+
+// transport returns the HTTP transport for peer. A peer with a
+// TLSFingerprint is trusted by that certificate alone, which is how a
+// generated self-signed certificate is pinned.
+func (f *Fleet) transport(peer Peer) *http.Transport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if old, ok := f.transports[peer.Name]; ok {
+		if old.peer == peer {
+			return old.t
+		}
+		// Edited in the config; drop connections made with the old settings
+		old.t.CloseIdleConnections()
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if peer.TLSFingerprint != "" {
+		want := normalizeFingerprint(peer.TLSFingerprint)
+		t.TLSClientConfig = &tls.Config{
+			// Chain and name checks are replaced by the pin below
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 {
+					return fmt.Errorf("peer sent no certificate")
+				}
+				sum := sha256.Sum256(rawCerts[0])
+				if hex.EncodeToString(sum[:]) != want {
+					return fmt.Errorf("certificate fingerprint does not match tls_fingerprint")
+				}
+				return nil
+			},
+		}
+	}
+	f.transports[peer.Name] = peerTransport{peer: peer, t: t}
+	return t
+}
+
+// dropTransports closes the transports of peers no longer configured.
+func (f *Fleet) dropTransports(peers []Peer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, pt := range f.transports {
+		if !slices.ContainsFunc(peers, func(p Peer) bool { return p.Name == name }) {
+			pt.t.CloseIdleConnections()
+			delete(f.transports, name)
+		}
+	}
+}
+
+// View returns this server and the configured peers, in config order.
+func (f *Fleet) View() FleetView {
+	peers := currentConfig().Peers
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	view := FleetView{Hosts: make([]PeerState, 0, len(peers)+1)}
+	view.Hosts = append(view.Hosts, *f.state(nil))
+	for i := range peers {
+		view.Hosts = append(view.Hosts, *f.state(&peers[i]))
+	}
+
+	sum := &view.Summary
+	for _, h := range view.Hosts {
+		sum.Hosts++
+		if !h.Online {
+			continue
+		}
+		sum.Online++
+		if h.Status != nil {
+			sum.DiskTotal += h.Status.Disk.Total
+			sum.DiskUsed += h.Status.Disk.Used
+			sum.DiskFree += h.Status.Disk.Free
+		}
+		if h.Storage != nil {
+			for _, s := range h.Storage.Suggestions {
+				sum.Reclaimable += s.Size
+			}
+		}
+	}
+	sum.DiskTotalHuman = formatBytes(int64(sum.DiskTotal))
+	sum.DiskUsedHuman = formatBytes(int64(sum.DiskUsed))
+	sum.DiskFreeHuman = formatBytes(int64(sum.DiskFree))
+	sum.ReclaimableHuman = formatBytes(sum.Reclaimable)
+	return view
+}
+
+// handleFleet serves GET /api/fleet. With ?refresh=1 it polls every host's
+// status before answering; with ?refresh=storage it also re-measures
+// storage, which can take minutes.
+func handleFleet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	refresh := r.URL.Query().Get("refresh")
+	if refresh == "" && fleet.View().Hosts[0].LastSeen == nil {
+		// Nothing polled yet, e.g. no peers are configured
+		refresh = "1"
+	}
+	switch refresh {
+	case "":
+	case "storage":
+		fleet.refresh(r.Context(), true)
+	default:
+		fleet.refresh(r.Context(), false)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fleet.View())
+}
+
+// handleFleetPeer proxies /api/fleet/{peer}/{path} to /api/{path} on the
+// peer, using the peer's credentials from the config. Only the status,
+// storage, clean, purge and job endpoints are forwarded.
+func handleFleetPeer(w http.ResponseWriter, r *http.Request) {
+	name, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/fleet/"), "/")
+	var peer *Peer
+	for _, p := range currentConfig().Peers {
+		if p.Name == name {
+			peer = &p
+			break
+		}
+	}
+	if peer == nil {
+		http.Error(w, "Unknown peer", http.StatusNotFound)
+		return
+	}
+	if !fleetPathAllowed(path) {
+		http.Error(w, "Not available through the fleet proxy", http.StatusNotFound)
+		return
+	}
+
+	if isMutating(r.Method) {
+		writeLog("Fleet: %s /api/%s on %s", r.Method, path, peer.Name)
+	}
+	target := peerURL(*peer, path)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			query := pr.In.URL.Query()
+			query.Del("token")
+			pr.Out.URL = &url.URL{Scheme: target.Scheme, Host: target.Host, Path: target.Path, RawQuery: query.Encode()}
+			pr.Out.Host = ""
+			// Our own session and credentials mean nothing to the peer, and
+			// browser headers would make it demand a CSRF token
+			for _, h := range []string{"Authorization", "Cookie", csrfHeader, "Origin", "Referer", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-Dest", "Sec-Fetch-User"} {
+				pr.Out.Header.Del(h)
+			}
+			setPeerAuth(pr.Out, *peer)
+		},
+		Transport:     fleet.transport(*peer),
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			// The peer's session cookie is for the peer, and its auth
+			// challenge would make the browser ask for the wrong password
+			resp.Header.Del("Set-Cookie")
+			resp.Header.Del("WWW-Authenticate")
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeLog("ERROR: Fleet proxy to %s: %v", peer.Name, err)
+			http.Error(w, fmt.Sprintf("Peer %s unreachable: %v", peer.Name, err), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tw93/mole/internal/metrics"
+)
+
+// fakePeer serves the peer API endpoints the fleet uses, requiring token.
+func fakePeer(t *testing.T, token string, clean http.HandlerFunc) *http.ServeMux {
+	t.Helper()
+	mux := http.NewServeMux()
+	auth := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Mole"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("/api/status", auth(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(SystemStatus{MetricsSnapshot: metrics.MetricsSnapshot{Host: "kids-mac"}, Disk: DiskInfo{Total: 1000, Used: 400, Free: 600}})
+	}))
+	mux.HandleFunc("/api/storage/breakdown", auth(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(StorageBreakdown{Suggestions: []CleanupSuggestion{{Title: "Empty Trash", Size: 50}}})
+	}))
+	if clean != nil {
+		mux.HandleFunc("/api/clean", auth(clean))
+	}
+	return mux
+}
+
+func TestFleetPollsPeersAndSummarizes(t *testing.T) {
+	useTempConfig(t)
+	peer := httptest.NewServer(fakePeer(t, "peer-token", nil))
+	defer peer.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	useConfig(t, Config{Peers: []Peer{
+		{Name: "kids", URL: peer.URL, Token: "peer-token"},
+		{Name: "wrong-token", URL: peer.URL, Token: "nope"},
+		{Name: "down", URL: down.URL},
+	}})
+
+	f := NewFleet()
+	f.refresh(context.Background(), true)
+	view := f.View()
+
+	if len(view.Hosts) != 4 || !view.Hosts[0].Self || !view.Hosts[0].Online {
+		t.Fatalf("hosts = %+v", view.Hosts)
+	}
+	kids := view.Hosts[1]
+	if !kids.Online || kids.Status == nil || kids.Status.Host != "kids-mac" || kids.Storage == nil {
+		t.Fatalf("kids = %+v", kids)
+	}
+	if h := view.Hosts[2]; h.Online || !strings.Contains(h.Error, "401") {
+		t.Errorf("wrong token: %+v", h)
+	}
+	if h := view.Hosts[3]; h.Online || h.Error == "" {
+		t.Errorf("down: %+v", h)
+	}
+
+	sum := view.Summary
+	if sum.Hosts != 4 || sum.Online != 2 {
+		t.Errorf("summary = %+v", sum)
+	}
+	if sum.DiskTotal < 1000 || sum.Reclaimable < 50 {
+		t.Errorf("totals = %+v", sum)
+	}
+
+	// A peer removed from the config drops out of the view
+	useConfig(t, Config{})
+	if view := f.View(); len(view.Hosts) != 1 {
+		t.Errorf("after removing peers: %+v", view.Hosts)
+	}
+}
+
+func TestFleetProxyForwardsWithPeerCredentials(t *testing.T) {
+	var got *http.Request
+	peer := httptest.NewServer(fakePeer(t, "peer-token", func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "peer-session"})
+		json.NewEncoder(w).Encode(CleanResult{Success: true})
+	}))
+	defer peer.Close()
+	useConfig(t, Config{Peers: []Peer{{Name: "kids", URL: peer.URL, Token: "peer-token"}}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/fleet/kids/clean?category=cache&token=mine", nil)
+	req.Header.Set("Authorization", "Bearer mine")
+	req.Header.Set(csrfHeader, "csrf")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "ours"})
+	rec := httptest.NewRecorder()
+	handleFleetPeer(rec, req)
+
+	if rec.Code != http.StatusOK || got == nil {
+		t.Fatalf("proxy: %d %s", rec.Code, rec.Body)
+	}
+	if got.URL.Query().Get("category") != "cache" || got.URL.Query().Has("token") {
+		t.Errorf("peer query = %q", got.URL.RawQuery)
+	}
+	if got.Header.Get("Cookie") != "" || got.Header.Get(csrfHeader) != "" || got.Header.Get("Sec-Fetch-Site") != "" {
+		t.Errorf("browser headers forwarded: %v", got.Header)
+	}
+	if rec.Header().Get("Set-Cookie") != "" {
+		t.Error("peer cookie passed back")
+	}
+
+	for _, target := range []string{"/api/fleet/kids/files", "/api/fleet/kids/jobs/../files", "/api/fleet/other/clean"} {
+		rec := httptest.NewRecorder()
+		handleFleetPeer(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestFleetPinsPeerCertificate(t *testing.T) {
+	peer := httptest.NewTLSServer(fakePeer(t, "peer-token", nil))
+	defer peer.Close()
+	sum := sha256.Sum256(peer.Certificate().Raw)
+	pin := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f := NewFleet()
+	var status SystemStatus
+	good := Peer{Name: "kids", URL: peer.URL, Token: "peer-token", TLSFingerprint: pin}
+	if err := f.fetch(context.Background(), good, "status", &status); err != nil {
+		t.Fatalf("pinned fetch: %v", err)
+	}
+	bad := good
+	bad.TLSFingerprint = strings.Repeat("AB", sha256.Size)
+	if err := f.fetch(context.Background(), bad, "status", &status); err == nil {
+		t.Error("wrong fingerprint accepted")
+	}
+	unpinned := good
+	unpinned.TLSFingerprint = ""
+	if err := f.fetch(context.Background(), unpinned, "status", &status); err == nil {
+		t.Error("untrusted certificate accepted without a pin")
+	}
+}
+
+func TestConfigRedactsPeerSecrets(t *testing.T) {
+	store := useConfig(t, Config{Peers: []Peer{{Name: "kids", URL: "http://kids.local:8080", Token: "mole_secret"}}})
+
+	resp, err := configResponse(*currentConfig())
+	if err != nil {
+		t.Fatalf("configResponse: %v", err)
+	}
+	if resp.File.Peers[0].Token != redactedPassword || resp.Effective.Peers[0].Token != redactedPassword {
+		t.Fatalf("peer token not redacted: %+v", resp.File.Peers)
+	}
+
+	// Saving back what GET returned keeps the stored token
+	if err := store.Save(resp.File); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if tok := currentConfig().Peers[0].Token; tok != "mole_secret" {
+		t.Errorf("token = %q", tok)
+	}
+
+	if err := (Config{Peers: []Peer{{Name: "a b", URL: "http://x"}}}).Validate(); err == nil {
+		t.Error("expected error for bad peer name")
+	}
+	if err := (Config{Peers: []Peer{{Name: "a", URL: "x"}, {Name: "a", URL: "http://x"}}}).Validate(); err == nil {
+		t.Error("expected error for bad URL")
+	}
+}
+
+func TestFleetTransportFollowsPeerEdits(t *testing.T) {
+	f := NewFleet()
+	peer := Peer{Name: "studio", URL: "http://studio.local:8081", Token: "mole_a"}
+	first := f.transport(peer)
+	if f.transport(peer) != first {
+		t.Fatal("unchanged peer got a new transport")
+	}
+
+	peer.Token = "mole_b"
+	if f.transport(peer) == first {
+		t.Error("edited peer kept its old transport")
+	}
+	if len(f.transports) != 1 {
+		t.Errorf("%d transports after an edit, want 1", len(f.transports))
+	}
+
+	f.dropTransports(nil)
+	if len(f.transports) != 0 {
+		t.Errorf("%d transports after the peer was removed", len(f.transports))
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryEntry records one completed clean, purge, delete, uninstall or
+// optimize run.
+type HistoryEntry struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Trigger string    `json:"trigger"`
+	Success bool      `json:"success"`
+	Freed   int64     `json:"freed_bytes"`
+	// Bytes moved into quarantine; not counted as freed
+	Quarantined int64    `json:"quarantined_bytes,omitempty"`
+	Files       int      `json:"files,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	JobID       string   `json:"job_id,omitempty"`
+}
+
+// HistoryTotals sums freed bytes and run counts.
+type HistoryTotals struct {
+	Freed      int64  `json:"freed_bytes"`
+	FreedHuman string `json:"freed_human"`
+	Runs       int    `json:"runs"`
+	Failed     int    `json:"failed"`
+}
+
+type MonthlyTotals struct {
+	Month string `json:"month"` // YYYY-MM
+	HistoryTotals
+}
+
+type HistoryResponse struct {
+	Entries  []HistoryEntry           `json:"entries"`
+	Lifetime HistoryTotals            `json:"lifetime"`
+	Monthly  []MonthlyTotals          `json:"monthly"`
+	ByType   map[string]HistoryTotals `json:"by_type"`
+}
+
+// historyTypes are the job types worth keeping a record of.
+var historyTypes = map[string]bool{
+	"clean":     true,
+	"purge":     true,
+	"delete":    true,
+	"uninstall": true,
+	"optimize":  true,
+}
+
+// HistoryStore is an append-only JSON Lines file. An empty path means the
+// default location under the user's config directory, resolved on each call.
+type HistoryStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewHistoryStore(path string) *HistoryStore {
+	return &HistoryStore{path: path}
+}
+
+var history = NewHistoryStore("")
+
+func (s *HistoryStore) filePath() (string, error) {
+	if s.path != "" {
+		return s.path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "history.jsonl"), nil
+}
+
+// Append writes an entry, filling in the ID and time when unset.
+func (s *HistoryStore) Append(entry HistoryEntry) error {
+	if entry.ID == "" {
+		entry.ID = newJobID()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Load returns all entries oldest first. Corrupt lines (for example from a
+// crash mid-write) are skipped.
+func (s *HistoryStore) Load() ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.filePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// recordHistory appends an entry and logs, rather than returns, any failure:
+// history must never make a cleanup look like it failed.
+func recordHistory(entry HistoryEntry) {
+	if !historyTypes[entry.Type] {
+		return
+	}
+	if entry.Trigger == "" {
+		entry.Trigger = "web"
+	}
+	stats.RecordFreed(entry.Type, entry.Freed, entry.Quarantined)
+	if err := history.Append(entry); err != nil {
+		writeLog("ERROR: Failed to record history: %v", err)
+	}
+}
+
+// recordJobHistory stores the outcome of a finished job.
+func recordJobHistory(job *Job, result CleanResult) {
+	entry := HistoryEntry{
+		Type:        job.request.Type,
+		Trigger:     job.request.Trigger,
+		Success:     result.Success,
+		Freed:       result.Cleaned,
+		Quarantined: result.Quarantined,
+		Files:       result.FilesRemoved,
+		Message:     result.Message,
+		JobID:       job.id,
+	}
+	if job.request.Category != "" {
+		entry.Categories = append(entry.Categories, job.request.Category)
+	}
+	for _, cat := range result.Categories {
+		entry.Categories = append(entry.Categories, cat.Name)
+	}
+	entry.Paths = append(entry.Paths, job.request.Apps...)
+	entry.Paths = append(entry.Paths, job.request.Paths...)
+	recordHistory(entry)
+}
+
+// historyFilter holds the query parameters accepted by /api/history.
+type historyFilter struct {
+	Type    string
+	Trigger string
+	Success *bool
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+func parseHistoryTime(value string, endOfDay bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func (f historyFilter) match(entry HistoryEntry) bool {
+	if f.Type != "" && entry.Type != f.Type {
+		return false
+	}
+	if f.Trigger != "" && entry.Trigger != f.Trigger {
+		return false
+	}
+	if f.Success != nil && entry.Success != *f.Success {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+func (t *HistoryTotals) add(entry HistoryEntry) {
+	t.Runs++
+	if entry.Success {
+		t.Freed += entry.Freed
+	} else {
+		t.Failed++
+	}
+	t.FreedHuman = formatBytes(t.Freed)
+}
+
+// summarizeHistory filters entries and computes totals over the whole matching
+// set; Limit only trims the returned entry list.
+func summarizeHistory(entries []HistoryEntry, f historyFilter) HistoryResponse {
+	resp := HistoryResponse{
+		Entries: []HistoryEntry{},
+		Monthly: []MonthlyTotals{},
+		ByType:  make(map[string]HistoryTotals),
+	}
+	resp.Lifetime.FreedHuman = formatBytes(0)
+
+	monthIndex := make(map[string]int)
+	// Newest first
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if !f.match(entry) {
+			continue
+		}
+		if f.Limit <= 0 || len(resp.Entries) < f.Limit {
+			resp.Entries = append(resp.Entries, entry)
+		}
+
+		resp.Lifetime.add(entry)
+
+		byType := resp.ByType[entry.Type]
+		byType.add(entry)
+		resp.ByType[entry.Type] = byType
+
+		month := entry.Time.Local().Format("2006-01")
+		idx, ok := monthIndex[month]
+		if !ok {
+			idx = len(resp.Monthly)
+			monthIndex[month] = idx
+			resp.Monthly = append(resp.Monthly, MonthlyTotals{Month: month})
+		}
+		resp.Monthly[idx].add(entry)
+	}
+	return resp
+}
+
+// handleHistory serves GET /api/history. Query parameters: type, trigger,
+// success (true/false), since and until (RFC 3339 or YYYY-MM-DD; until is
+// inclusive for dates) and limit.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	f := historyFilter{
+		Type:    q.Get("type"),
+		Trigger: q.Get("trigger"),
+		Limit:   200,
+	}
+	if v := q.Get("success"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "invalid success value", http.StatusBadRequest)
+			return
+		}
+		f.Success = &b
+	}
+	for _, p := range []struct {
+		name     string
+		dst      *time.Time
+		endOfDay bool
+	}{{"since", &f.Since, false}, {"until", &f.Until, true}} {
+		v := strings.TrimSpace(q.Get(p.name))
+		if v == "" {
+			continue
+		}
+		t, ok := parseHistoryTime(v, p.endOfDay)
+		if !ok {
+			http.Error(w, "invalid "+p.name+" value", http.StatusBadRequest)
+			return
+		}
+		*p.dst = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit value", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+
+	entries, err := history.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summarizeHistory(entries, f))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempConfig points the user's home and config directories at a temporary
+// directory so tests never touch real history or settings.
+func useTempConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, ".config"))
+	return dir
+}
+
+func TestHistoryStoreAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Mole", "history.jsonl")
+	store := NewHistoryStore(path)
+
+	if entries, err := store.Load(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty history, got %d entries (err %v)", len(entries), err)
+	}
+
+	if err := store.Append(HistoryEntry{Type: "clean", Success: true, Freed: 100}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// A torn write must not hide the entries around it
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString("{\"type\": \"cle\n")
+	f.Close()
+	if err := store.Append(HistoryEntry{Type: "purge", Success: true, Freed: 50}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Type != "clean" || entries[1].Type != "purge" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[0].ID == "" || entries[0].Time.IsZero() {
+		t.Fatalf("expected ID and time to be filled in: %+v", entries[0])
+	}
+}
+
+func TestSummarizeHistoryFiltersAndTotals(t *testing.T) {
+	sept := time.Date(2026, 9, 15, 12, 0, 0, 0, time.Local)
+	oct := time.Date(2026, 10, 2, 12, 0, 0, 0, time.Local)
+	entries := []HistoryEntry{
+		{Time: sept, Type: "clean", Success: true, Freed: 1 << 30},
+		{Time: sept, Type: "purge", Success: false, Freed: 5 << 30},
+		{Time: oct, Type: "clean", Success: true, Freed: 2 << 30},
+		{Time: oct, Type: "delete", Success: true, Freed: 1 << 20},
+	}
+
+	all := summarizeHistory(entries, historyFilter{})
+	if all.Lifetime.Runs != 4 || all.Lifetime.Failed != 1 {
+		t.Fatalf("unexpected lifetime counts: %+v", all.Lifetime)
+	}
+	if want := int64(3<<30 + 1<<20); all.Lifetime.Freed != want {
+		t.Fatalf("failed runs must not count as freed: got %d, want %d", all.Lifetime.Freed, want)
+	}
+	if len(all.Monthly) != 2 || all.Monthly[0].Month != "2026-10" || all.Monthly[1].Freed != 1<<30 {
+		t.Fatalf("unexpected monthly totals: %+v", all.Monthly)
+	}
+	if all.ByType["clean"].Freed != 3<<30 {
+		t.Fatalf("unexpected clean totals: %+v", all.ByType["clean"])
+	}
+	if all.Entries[0].Type != "delete" {
+		t.Fatalf("expected newest entry first, got %q", all.Entries[0].Type)
+	}
+
+	since, _ := parseHistoryTime("2026-10-01", false)
+	cleanOnly := summarizeHistory(entries, historyFilter{Type: "clean", Since: since, Limit: 10})
+	if len(cleanOnly.Entries) != 1 || cleanOnly.Lifetime.Freed != 2<<30 {
+		t.Fatalf("unexpected filtered result: %+v", cleanOnly)
+	}
+
+	limited := summarizeHistory(entries, historyFilter{Limit: 1})
+	if len(limited.Entries) != 1 || limited.Lifetime.Runs != 4 {
+		t.Fatalf("limit should trim entries but not totals: %+v", limited)
+	}
+}
+
+func TestJobCompletionIsRecordedInHistory(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	job, err := m.Submit(JobRequest{Type: "purge", Paths: []string{"/tmp/a"}, Trigger: "schedule"}, func(j *Job) CleanResult {
+		return CleanResult{Success: true, Cleaned: 2048, FilesRemoved: 1}
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForJob(t, job)
+
+	entries, err := history.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected one history entry, got %d", len(entries))
+	}
+	got := entries[0]
+	if got.JobID != job.ID() || got.Trigger != "schedule" || got.Freed != 2048 || len(got.Paths) != 1 {
+		t.Fatalf("unexpected history entry: %+v", got)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxJobHistory = 100 // Finished jobs kept in memory for later lookup
+	jobQueueSize  = 32
+)
+
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// JobRequest describes the operation a job performs. Only the fields relevant
+// to the job type are used.
+type JobRequest struct {
+	Type     string   `json:"type"`
+	Category string   `json:"category,omitempty"`
+	Apps     []string `json:"apps,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Mode     string   `json:"mode,omitempty"` // Purge: "delete" or "quarantine"
+	// Trigger records what started the job ("web" when unset)
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// JobInfo is the JSON view of a job returned by the API.
+type JobInfo struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	State      JobState     `json:"state"`
+	Request    JobRequest   `json:"request"`
+	Output     string       `json:"output,omitempty"`
+	Result     *CleanResult `json:"result,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+type jobFunc func(j *Job) CleanResult
+
+type Job struct {
+	id      string
+	request JobRequest
+	run     jobFunc
+	done    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu         sync.Mutex
+	state      JobState
+	output     strings.Builder
+	result     *CleanResult
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Done is closed once the job reaches a terminal state.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Context is cancelled when the job is cancelled. A nil job returns a
+// background context.
+func (j *Job) Context() context.Context {
+	if j == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// cancelled reports whether the job was asked to stop.
+func (j *Job) cancelled() bool {
+	return j != nil && j.ctx.Err() != nil
+}
+
+// appendLine records a line of command output and publishes it to the log
+// hub tagged with this job. Safe to call on a nil job so helpers can be
+// shared between job and non-job callers.
+func (j *Job) appendLine(line string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.output.WriteString(line)
+	j.output.WriteString("\n")
+	j.mu.Unlock()
+	logHub.Publish(j.id, j.request.Type, stripANSI(line))
+}
+
+func (j *Job) Result() CleanResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.result == nil {
+		return CleanResult{}
+	}
+	return *j.result
+}
+
+func (j *Job) Info(withOutput bool) JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info := JobInfo{
+		ID:        j.id,
+		Type:      j.request.Type,
+		State:     j.state,
+		Request:   j.request,
+		Result:    j.result,
+		CreatedAt: j.createdAt,
+	}
+	if !j.startedAt.IsZero() {
+		started := j.startedAt
+		info.StartedAt = &started
+	}
+	if !j.finishedAt.IsZero() {
+		finished := j.finishedAt
+		info.FinishedAt = &finished
+	}
+	if withOutput {
+		info.Output = stripANSI(j.output.String())
+	}
+	return info
+}
+
+type JobManager struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string
+	queue  chan *Job
+	closed bool // Set on shutdown; no new jobs are accepted
+}
+
+var errShuttingDown = fmt.Errorf("server is shutting down")
+
+func NewJobManager() *JobManager {
+	m := &JobManager{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, jobQueueSize),
+	}
+	go m.worker()
+	return m
+}
+
+var jobs = NewJobManager()
+
+// Submit queues a job. Jobs run one at a time so that concurrent CLI
+// invocations never fight over sudo prompts or the same files.
+func (m *JobManager) Submit(req JobRequest, run jobFunc) (*Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:        newJobID(),
+		request:   req,
+		run:       run,
+		done:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		state:     JobQueued,
+		createdAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		cancel()
+		return nil, errShuttingDown
+	}
+	// Queued under the lock, so a full queue leaves nothing to undo
+	select {
+	case m.queue <- job:
+	default:
+		m.mu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("job queue is full")
+	}
+	m.jobs[job.id] = job
+	m.order = append(m.order, job.id)
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	writeJobLog(job, "Job %s queued: %s", job.id, req.Type)
+	return job, nil
+}
+
+// Cancel stops a queued or running job. Running CLI invocations have their
+// whole process group terminated; partial output is kept on the job.
+func (m *JobManager) Cancel(id string) (*Job, error) {
+	job := m.Get(id)
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+	if isJobFinished(job) {
+		return job, fmt.Errorf("job already finished")
+	}
+	writeJobLog(job, "Job %s cancellation requested", job.id)
+	job.cancel()
+	return job, nil
+}
+
+// Close stops the manager accepting jobs. Queued and running jobs carry on.
+func (m *JobManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+}
+
+// Pending returns the jobs that have not finished.
+func (m *JobManager) Pending() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []*Job
+	for _, id := range m.order {
+		if job := m.jobs[id]; !isJobFinished(job) {
+			pending = append(pending, job)
+		}
+	}
+	return pending
+}
+
+// Drain waits until every job has finished or ctx is done.
+func (m *JobManager) Drain(ctx context.Context) error {
+	for _, job := range m.Pending() {
+		select {
+		case <-job.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// CancelAll cancels every job that has not finished and returns how many
+// there were.
+func (m *JobManager) CancelAll() int {
+	pending := m.Pending()
+	for _, job := range pending {
+		writeJobLog(job, "Job %s cancelled by shutdown", job.id)
+		job.cancel()
+	}
+	return len(pending)
+}
+
+func (m *JobManager) Get(id string) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
+
+// List returns jobs newest first.
+func (m *JobManager) List() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]*Job, 0, len(m.order))
+	for i := len(m.order) - 1; i >= 0; i-- {
+		list = append(list, m.jobs[m.order[i]])
+	}
+	return list
+}
+
+func (m *JobManager) worker() {
+	for job := range m.queue {
+		m.execute(job)
+	}
+}
+
+func (m *JobManager) execute(job *Job) {
+	defer job.cancel()
+
+	var result CleanResult
+	if job.cancelled() {
+		result = CleanResult{Success: false, Message: "Cancelled before start"}
+	} else {
+		job.mu.Lock()
+		job.state = JobRunning
+		job.startedAt = time.Now()
+		job.mu.Unlock()
+
+		writeJobLog(job, "Job %s started: %s", job.id, job.request.Type)
+		result = runJob(job)
+	}
+
+	job.mu.Lock()
+	job.result = &result
+	job.finishedAt = time.Now()
+	switch {
+	case job.cancelled():
+		job.state = JobCancelled
+	case result.Success:
+		job.state = JobSucceeded
+	default:
+		job.state = JobFailed
+	}
+	if job.output.Len() == 0 && result.Output != "" {
+		job.output.WriteString(result.Output)
+	}
+	state := job.state
+	job.mu.Unlock()
+
+	recordJobHistory(job, result)
+	stats.RecordJob(job.request.Type, state)
+	writeJobLog(job, "Job %s finished: %s", job.id, state)
+	close(job.done)
+}
+
+// runJob runs the job's operation, turning a panic into a failed result so
+// the worker carries on with the next job.
+func runJob(job *Job) (result CleanResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			writeJobLog(job, "Job %s panicked: %v\n%s", job.id, r, debug.Stack())
+			result = CleanResult{Success: false, Message: fmt.Sprintf("Internal error: %v", r)}
+		}
+	}()
+	return job.run(job)
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxJobHistory.
+func (m *JobManager) pruneLocked() {
+	excess := len(m.order) - maxJobHistory
+	if excess <= 0 {
+		return
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		job := m.jobs[id]
+		if excess > 0 && isJobFinished(job) {
+			delete(m.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+func isJobFinished(j *Job) bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func newJobID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// buildJob maps an API request onto the function that performs it.
+func buildJob(req JobRequest) (jobFunc, error) {
+	switch req.Type {
+	case "clean":
+		category := req.Category
+		return func(j *Job) CleanResult {
+			return runClean(j, category)
+		}, nil
+	case "uninstall":
+		if len(req.Apps) == 0 {
+			return nil, fmt.Errorf("no apps specified")
+		}
+		apps := append([]string(nil), req.Apps...)
+		return func(j *Job) CleanResult {
+			return uninstallApps(j, apps)
+		}, nil
+	case "purge":
+		if len(req.Paths) == 0 {
+			return nil, fmt.Errorf("no paths specified")
+		}
+		mode, ok := normalizeDeleteMode(req.Mode)
+		if !ok {
+			return nil, fmt.Errorf("invalid delete mode: %q", req.Mode)
+		}
+		paths := append([]string(nil), req.Paths...)
+		return func(j *Job) CleanResult {
+			return purgePaths(j.Context(), paths, mode)
+		}, nil
+	case "optimize":
+		return func(j *Job) CleanResult {
+			return runOptimize(j.Context())
+		}, nil
+	case "update":
+		if req.Name == "" {
+			return nil, fmt.Errorf("update name required")
+		}
+		name := req.Name
+		return func(j *Job) CleanResult {
+			return performUpdate(j, name)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported job type: %q", req.Type)
+	}
+}
+
+// runJobAndRespond submits a job and writes its result once it finishes.
+// The status is 202 Accepted whatever the outcome, since it is sent before
+// the job runs: whether it succeeded is in the body, and in the job at
+// /api/jobs/{id}. If the client goes away the job keeps running and stays
+// available there.
+func runJobAndRespond(w http.ResponseWriter, r *http.Request, req JobRequest, encode func(CleanResult) interface{}) {
+	run, err := buildJob(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job, err := jobs.Submit(req, run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Send headers straight away so the client learns the job ID (and can
+	// cancel it) while the operation is still running.
+	w.Header().Set("X-Mole-Job-ID", job.ID())
+	w.Header().Set("Location", "/api/jobs/"+job.ID())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	select {
+	case <-job.Done():
+	case <-r.Context().Done():
+		return
+	}
+
+	json.NewEncoder(w).Encode(encode(job.Result()))
+}
+
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := jobs.List()
+		infos := make([]JobInfo, 0, len(list))
+		for _, job := range list {
+			infos = append(infos, job.Info(false))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	case http.MethodPost:
+		var req JobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		run, err := buildJob(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err := jobs.Submit(req, run)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+job.ID())
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.Info(false))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		job := jobs.Get(id)
+		if job == nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job.Info(true))
+	case action == "logs" && r.Method == http.MethodGet:
+		if jobs.Get(id) == nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		streamLogs(w, r, id, true)
+	case action == "cancel" && r.Method == http.MethodPost,
+		action == "" && r.Method == http.MethodDelete:
+		job, err := jobs.Cancel(id)
+		if job == nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.Info(false))
+	case action != "" && action != "cancel" && action != "logs":
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
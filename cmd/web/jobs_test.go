@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForJob(t *testing.T, job *Job) {
+	t.Helper()
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job %s did not finish", job.ID())
+	}
+}
+
+func TestJobManagerRunsJobAndCapturesOutput(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	job, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		j.appendLine("line one")
+		j.appendLine("line two")
+		return CleanResult{Success: true, Message: "done", Cleaned: 42}
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForJob(t, job)
+
+	info := m.Get(job.ID()).Info(true)
+	if info.State != JobSucceeded {
+		t.Fatalf("expected state %q, got %q", JobSucceeded, info.State)
+	}
+	if info.Result == nil || info.Result.Cleaned != 42 {
+		t.Fatalf("expected result with 42 cleaned bytes, got %+v", info.Result)
+	}
+	if !strings.Contains(info.Output, "line one\nline two") {
+		t.Fatalf("expected captured output, got %q", info.Output)
+	}
+	if info.StartedAt == nil || info.FinishedAt == nil {
+		t.Fatalf("expected start and finish timestamps")
+	}
+}
+
+func TestJobManagerRecordsFailureAndListsNewestFirst(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	first, err := m.Submit(JobRequest{Type: "optimize"}, func(j *Job) CleanResult {
+		return CleanResult{Success: false, Message: "boom"}
+	})
+	if err != nil {
+		t.Fatalf("Submit first: %v", err)
+	}
+	second, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		return CleanResult{Success: true}
+	})
+	if err != nil {
+		t.Fatalf("Submit second: %v", err)
+	}
+	waitForJob(t, first)
+	waitForJob(t, second)
+
+	if state := first.Info(false).State; state != JobFailed {
+		t.Fatalf("expected failed state, got %q", state)
+	}
+
+	list := m.List()
+	if len(list) != 2 || list[0].ID() != second.ID() {
+		t.Fatalf("expected newest job first, got %d jobs", len(list))
+	}
+}
+
+func TestJobManagerSurvivesPanickingJob(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	bad, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("Submit bad: %v", err)
+	}
+	good, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		return CleanResult{Success: true}
+	})
+	if err != nil {
+		t.Fatalf("Submit good: %v", err)
+	}
+	waitForJob(t, bad)
+	waitForJob(t, good)
+
+	if info := bad.Info(false); info.State != JobFailed || info.Result == nil || !strings.Contains(info.Result.Message, "boom") {
+		t.Errorf("panicking job = %+v", info)
+	}
+	if state := good.Info(false).State; state != JobSucceeded {
+		t.Errorf("next job state = %q, want %q", state, JobSucceeded)
+	}
+}
+
+func TestJobManagerRejectsWhenQueueIsFull(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	release := make(chan struct{})
+	blocker, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		<-release
+		return CleanResult{Success: true}
+	})
+	if err != nil {
+		t.Fatalf("Submit blocker: %v", err)
+	}
+	defer close(release)
+	for blocker.Info(false).State != JobRunning {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	var rejected atomic.Int32
+	for range jobQueueSize + 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+				return CleanResult{Success: true}
+			}); err != nil {
+				rejected.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := rejected.Load(); n != 10 {
+		t.Errorf("rejected %d jobs, want 10", n)
+	}
+	list := m.List()
+	if len(list) != jobQueueSize+1 {
+		t.Errorf("listed %d jobs, want %d", len(list), jobQueueSize+1)
+	}
+	for _, job := range list {
+		if job == nil {
+			t.Fatal("List returned a nil job")
+		}
+	}
+}
+
+func TestBuildJobValidatesRequest(t *testing.T) {
+	if _, err := buildJob(JobRequest{Type: "uninstall"}); err == nil {
+		t.Fatalf("expected error for uninstall without apps")
+	}
+	if _, err := buildJob(JobRequest{Type: "purge"}); err == nil {
+		t.Fatalf("expected error for purge without paths")
+	}
+	if _, err := buildJob(JobRequest{Type: "format-disk"}); err == nil {
+		t.Fatalf("expected error for unknown job type")
+	}
+	if _, err := buildJob(JobRequest{Type: "clean", Category: "logs"}); err != nil {
+		t.Fatalf("unexpected error for clean job: %v", err)
+	}
+}
+
+func TestJobManagerCancelsRunningAndQueuedJobs(t *testing.T) {
+	useTempConfig(t)
+	m := NewJobManager()
+
+	started := make(chan struct{})
+	running, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		j.appendLine("partial output")
+		close(started)
+		<-j.Context().Done()
+		return cancelledResult("partial output\n")
+	})
+	if err != nil {
+		t.Fatalf("Submit running: %v", err)
+	}
+	queued, err := m.Submit(JobRequest{Type: "optimize"}, func(j *Job) CleanResult {
+		t.Errorf("cancelled queued job should not run")
+		return CleanResult{Success: true}
+	})
+	if err != nil {
+		t.Fatalf("Submit queued: %v", err)
+	}
+
+	<-started
+	if _, err := m.Cancel(queued.ID()); err != nil {
+		t.Fatalf("Cancel queued: %v", err)
+	}
+	if _, err := m.Cancel(running.ID()); err != nil {
+		t.Fatalf("Cancel running: %v", err)
+	}
+	waitForJob(t, running)
+	waitForJob(t, queued)
+
+	info := running.Info(true)
+	if info.State != JobCancelled {
+		t.Fatalf("expected running job to be cancelled, got %q", info.State)
+	}
+	if !strings.Contains(info.Output, "partial output") {
+		t.Fatalf("expected partial output to be kept, got %q", info.Output)
+	}
+	if state := queued.Info(false).State; state != JobCancelled {
+		t.Fatalf("expected queued job to be cancelled, got %q", state)
+	}
+	if _, err := m.Cancel(running.ID()); err == nil {
+		t.Fatalf("expected error cancelling a finished job")
+	}
+}
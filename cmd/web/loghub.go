@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	logBacklogSize      = 500 // Lines kept for late subscribers
+	logSubscriberBuffer = 256 // Per-subscriber buffer before lines are dropped
+)
+
+// LogLine is a single line of server or job output.
+type LogLine struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Job  string    `json:"job,omitempty"`
+	Op   string    `json:"op,omitempty"`
+	Text string    `json:"text"`
+}
+
+// logSubscriber receives lines for one SSE client. Lines are dropped for this
+// subscriber only when it falls behind, so a slow client never stalls the
+// jobs producing output or other clients.
+type logSubscriber struct {
+	job     string
+	ch      chan LogLine
+	mu      sync.Mutex
+	dropped int
+}
+
+// takeDropped returns and resets the number of lines dropped since the last
+// call.
+func (s *logSubscriber) takeDropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+// LogHub fans every published line out to all subscribers and keeps a bounded
+// backlog for replay.
+type LogHub struct {
+	mu      sync.Mutex
+	seq     uint64
+	backlog []LogLine // ring buffer, oldest at start once full
+	next    int
+	subs    map[*logSubscriber]struct{}
+}
+
+func NewLogHub() *LogHub {
+	return &LogHub{
+		backlog: make([]LogLine, 0, logBacklogSize),
+		subs:    make(map[*logSubscriber]struct{}),
+	}
+}
+
+var logHub = NewLogHub()
+
+// Publish records a line and delivers it to every matching subscriber.
+func (h *LogHub) Publish(job, op, text string) LogLine {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	line := LogLine{Seq: h.seq, Time: time.Now(), Job: job, Op: op, Text: text}
+	if len(h.backlog) < logBacklogSize {
+		h.backlog = append(h.backlog, line)
+	} else {
+		h.backlog[h.next] = line
+		h.next = (h.next + 1) % logBacklogSize
+	}
+
+	for sub := range h.subs {
+		if sub.job != "" && sub.job != job {
+			continue
+		}
+		select {
+		case sub.ch <- line:
+		default:
+			sub.mu.Lock()
+			sub.dropped++
+			sub.mu.Unlock()
+		}
+	}
+	return line
+}
+
+// Subscribe registers a subscriber for job (all lines when empty) and returns
+// the backlog lines newer than since. Replay and subscription happen under one
+// lock so no line is missed or duplicated in between.
+func (h *LogHub) Subscribe(job string, since uint64) (*logSubscriber, []LogLine) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &logSubscriber{job: job, ch: make(chan LogLine, logSubscriberBuffer)}
+	h.subs[sub] = struct{}{}
+
+	var replay []LogLine
+	for i := 0; i < len(h.backlog); i++ {
+		line := h.backlog[(h.next+i)%len(h.backlog)]
+		if line.Seq <= since {
+			continue
+		}
+		if job != "" && line.Job != job {
+			continue
+		}
+		replay = append(replay, line)
+	}
+	return sub, replay
+}
+
+func (h *LogHub) Unsubscribe(sub *logSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, sub)
+	h.mu.Unlock()
+}
+
+// handleLogsStream streams log lines as SSE events. Query parameters:
+//
+//	job=<id>     only lines produced by that job
+//	replay=1     send the buffered backlog first
+//	since=<seq>  send backlog lines after seq
+//
+// Reconnecting EventSource clients send Last-Event-ID and get exactly the
+// lines they missed, as long as those are still in the backlog.
+func handleLogsStream(w http.ResponseWriter, r *http.Request) {
+	streamLogs(w, r, r.URL.Query().Get("job"), r.URL.Query().Get("replay") == "1")
+}
+
+func streamLogs(w http.ResponseWriter, r *http.Request, job string, replay bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// By default only lines published after subscribing are sent.
+	since := ^uint64(0)
+	if replay {
+		since = 0
+	}
+	resumeFrom := r.Header.Get("Last-Event-ID")
+	if resumeFrom == "" {
+		resumeFrom = r.URL.Query().Get("since")
+	}
+	if resumeFrom != "" {
+		if n, err := strconv.ParseUint(resumeFrom, 10, 64); err == nil {
+			since = n
+		}
+	}
+
+	sub, backlog := logHub.Subscribe(job, since)
+	defer logHub.Unsubscribe(sub)
+
+	fmt.Fprintf(w, "event: connected\ndata: Connected to log stream\n\n")
+	for _, line := range backlog {
+		writeLogEvent(w, line)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			fmt.Fprintf(w, "event: shutdown\ndata: Server shutting down\n\n")
+			flusher.Flush()
+			return
+		case line := <-sub.ch:
+			if n := sub.takeDropped(); n > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", n)
+			}
+			writeLogEvent(w, line)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeLogEvent(w http.ResponseWriter, line LogLine) {
+	data, _ := json.Marshal(line)
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.Seq, data)
+}
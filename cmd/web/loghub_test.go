@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLogHubFansOutToEverySubscriber(t *testing.T) {
+	h := NewLogHub()
+	first, _ := h.Subscribe("", ^uint64(0))
+	second, _ := h.Subscribe("", ^uint64(0))
+	jobOnly, _ := h.Subscribe("job1", ^uint64(0))
+
+	h.Publish("", "", "server line")
+	h.Publish("job1", "clean", "job line")
+	h.Publish("job2", "purge", "other job line")
+
+	for name, sub := range map[string]*logSubscriber{"first": first, "second": second} {
+		if got := len(sub.ch); got != 3 {
+			t.Fatalf("%s subscriber: expected 3 lines, got %d", name, got)
+		}
+	}
+	if got := len(jobOnly.ch); got != 1 {
+		t.Fatalf("job subscriber: expected 1 line, got %d", got)
+	}
+	line := <-jobOnly.ch
+	if line.Job != "job1" || line.Op != "clean" || line.Text != "job line" {
+		t.Fatalf("unexpected job line: %+v", line)
+	}
+}
+
+func TestLogHubReplaysBoundedBacklog(t *testing.T) {
+	h := NewLogHub()
+	total := logBacklogSize + 20
+	for i := 1; i <= total; i++ {
+		h.Publish("job1", "clean", fmt.Sprintf("line %d", i))
+	}
+
+	_, replay := h.Subscribe("", 0)
+	if len(replay) != logBacklogSize {
+		t.Fatalf("expected %d replayed lines, got %d", logBacklogSize, len(replay))
+	}
+	if replay[0].Text != "line 21" || replay[len(replay)-1].Text != fmt.Sprintf("line %d", total) {
+		t.Fatalf("unexpected replay window: %q .. %q", replay[0].Text, replay[len(replay)-1].Text)
+	}
+
+	_, resumed := h.Subscribe("job1", uint64(total-2))
+	if len(resumed) != 2 {
+		t.Fatalf("expected 2 lines after resume point, got %d", len(resumed))
+	}
+}
+
+func TestLogHubDropsOnlyForSlowSubscriber(t *testing.T) {
+	h := NewLogHub()
+	slow, _ := h.Subscribe("", ^uint64(0))
+	fast, _ := h.Subscribe("", ^uint64(0))
+
+	for i := 0; i < logSubscriberBuffer+5; i++ {
+		h.Publish("", "", "line")
+		<-fast.ch
+	}
+	if n := slow.takeDropped(); n != 5 {
+		t.Fatalf("expected 5 dropped lines for slow subscriber, got %d", n)
+	}
+	if n := fast.takeDropped(); n != 0 {
+		t.Fatalf("expected no drops for fast subscriber, got %d", n)
+	}
+}
@@ -2,9 +2,8 @@ package main
 
 import (
 	"bufio"
-	"crypto/subtle"
+	"context"
 	"embed"
-	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -23,11 +22,14 @@ import (
 	"sync"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
-	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/tw93/mole/internal/diskscan"
+	"github.com/tw93/mole/internal/metrics"
+	"github.com/tw93/mole/internal/pathpolicy"
+	"github.com/tw93/mole/internal/quarantine"
+	"github.com/tw93/mole/internal/whitelist"
 )
 
 //go:embed static/*
@@ -37,21 +39,28 @@ var staticFiles embed.FS
 var templateFiles embed.FS
 
 var (
-	moleDir      string
-	Version      = "dev"
-	port         = flag.Int("port", 8080, "Port to run the server on")
-	hostAddr     = flag.String("host", "", "Host to bind to (default: localhost, use 0.0.0.0 for all interfaces)")
-	openBrowser  = flag.Bool("open", true, "Open browser on start")
-	authUser     string
-	authPass     string
-	logBroadcast = make(chan string, 100)
+	moleDir     string
+	Version     = "dev"
+	port        = flag.Int("port", 8080, "Port to run the server on")
+	hostAddr    = flag.String("host", "localhost", "Host to bind to (use 0.0.0.0 for all interfaces)")
+	configPath  = flag.String("config", "", "Config file (default: Mole/config.json in the user config directory; env MOLE_CONFIG)")
+	openBrowser = flag.Bool("open", true, "Open browser on start")
+	tokenCreate = flag.String("token-create", "", "Create an API token with this name, print it and exit")
+	tokenScopes = flag.String("token-scopes", "status", "Comma-separated scopes for -token-create: status, analyze, destructive, admin")
+	tokenRevoke = flag.String("token-revoke", "", "Revoke the API token with this ID and exit")
+	tokenList   = flag.Bool("token-list", false, "List API tokens and exit")
+	corsFlag    = flag.String("cors-origins", "", "Comma-separated origins allowed to call the API cross-origin (e.g. https://dash.example.com)")
+	tlsFlag     = flag.Bool("tls", false, "Serve HTTPS, with -tls-cert/-tls-key or a generated self-signed certificate")
+	tlsCert     = flag.String("tls-cert", "", "TLS certificate file (PEM)")
+	tlsKey      = flag.String("tls-key", "", "TLS private key file (PEM)")
+	stopTimeout = flag.Duration("shutdown-timeout", 2*time.Minute, "How long running operations may take to finish on shutdown before they are cancelled")
+	httpRedir   = flag.Int("http-redirect-port", 0, "With -tls, also listen for plain HTTP on this port and redirect to HTTPS (0 = off)")
+	hostsFlag   = flag.String("allowed-hosts", "", "Comma-separated extra host names the server answers to, besides localhost, IPs and this Mac's name")
+	discoverFl  = flag.Bool("discover", false, "List the Mole servers on the LAN and exit")
+	advertiseFl = flag.Bool("advertise", true, "Advertise the server on the LAN via Bonjour (_mole._tcp) when not bound to localhost")
 )
 
 func init() {
-	// Auth from environment
-	authUser = os.Getenv("MOLE_AUTH_USER")
-	authPass = os.Getenv("MOLE_AUTH_PASS")
-
 	// Find the mole directory
 	if envDir := os.Getenv("MOLE_DIR"); envDir != "" {
 		moleDir = envDir
@@ -78,66 +87,28 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
-// Basic auth middleware
-func basicAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth if not configured
-		if authUser == "" || authPass == "" {
-			next(w, r)
-			return
-		}
-
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Mole"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		pair := strings.SplitN(string(payload), ":", 2)
-		if len(pair) != 2 {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		if subtle.ConstantTimeCompare([]byte(pair[0]), []byte(authUser)) != 1 ||
-			subtle.ConstantTimeCompare([]byte(pair[1]), []byte(authPass)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Mole"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		next(w, r)
-	}
-}
-
-// Wrapper for http.Handler (used for static files)
-func basicAuthHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		basicAuth(func(w http.ResponseWriter, r *http.Request) {
-			next.ServeHTTP(w, r)
-		})(w, r)
-	})
-}
-
 func main() {
 	flag.Parse()
 
-	// Override from env if set
-	if envPort := os.Getenv("MOLE_PORT"); envPort != "" {
-		fmt.Sscanf(envPort, "%d", port)
+	if runTokenCommand(*tokenCreate, *tokenScopes, *tokenRevoke, *tokenList) {
+		return
 	}
-	if envHost := os.Getenv("MOLE_HOST"); envHost != "" {
-		*hostAddr = envHost
+
+	// Settings: flag > env > config file > default
+	if *configPath == "" {
+		*configPath = os.Getenv("MOLE_CONFIG")
 	}
-	if os.Getenv("MOLE_NO_OPEN") != "" {
-		*openBrowser = false
+	config = NewConfigStore(*configPath)
+	if err := config.Load(); err != nil {
+		log.Fatalf("Config: %v", err)
+	}
+	cfg := *currentConfig()
+	startupConfig = cfg
+	moleDir = cfg.MoleDir
+
+	if *discoverFl {
+		runDiscoverCommand()
+		return
 	}
 
 	// Templates
@@ -145,10 +116,10 @@ func main() {
 
 	// Static files
 	staticFS, _ := fs.Sub(staticFiles, "static")
-	http.Handle("/static/", http.StripPrefix("/static/", basicAuthHandler(http.FileServer(http.FS(staticFS)))))
+	http.Handle("/static/", http.StripPrefix("/static/", requireScopeHandler(ScopeStatus, http.FileServer(http.FS(staticFS)))))
 
 	// Page routes
-	http.HandleFunc("/", basicAuth(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/", requireScope(ScopeStatus, func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
@@ -157,7 +128,9 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("Expires", "0")
-		tmpl.ExecuteTemplate(w, "index.html", nil)
+		tmpl.ExecuteTemplate(w, "index.html", map[string]string{
+			"CSRFToken": csrfToken(ensureSession(w, r)),
+		})
 	}))
 
 	// Health check (no auth)
@@ -166,74 +139,150 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": Version})
 	})
 
-	// Installer script endpoint (no auth)
-	http.HandleFunc("/install.sh", handleInstallScript)
+	// Installer script endpoint
+	http.HandleFunc("/install.sh", requireScope(ScopeStatus, handleInstallScript))
 
 	// API routes (all protected)
-	http.HandleFunc("/api/status", basicAuth(handleStatus))
-	http.HandleFunc("/api/clean", basicAuth(handleClean))
-	http.HandleFunc("/api/clean/preview", basicAuth(handleCleanPreview))
-	http.HandleFunc("/api/uninstall/apps", basicAuth(handleListApps))
-	http.HandleFunc("/api/uninstall", basicAuth(handleUninstall))
-	http.HandleFunc("/api/app/icon", handleAppIcon) // No auth needed for icons
-	http.HandleFunc("/api/analyze", basicAuth(handleAnalyze))
-	http.HandleFunc("/api/analyze/large", basicAuth(handleAnalyzeLarge))
-	http.HandleFunc("/api/analyze/downloads", basicAuth(handleAnalyzeDownloads))
-	http.HandleFunc("/api/storage/breakdown", basicAuth(handleStorageBreakdown))
-	http.HandleFunc("/api/storage/analyze-other", basicAuth(handleAnalyzeOther))
-	http.HandleFunc("/api/volumes", basicAuth(handleListVolumes))
-	http.HandleFunc("/api/volumes/analyze", basicAuth(handleAnalyzeVolume))
-	http.HandleFunc("/api/open-finder", basicAuth(handleOpenFinder))
-	http.HandleFunc("/api/permissions/check", basicAuth(handlePermissionsCheck))
-	http.HandleFunc("/api/permissions/open-settings", basicAuth(handleOpenSystemSettings))
-	http.HandleFunc("/api/permissions/admin-test", basicAuth(handlePermissionsAdminTest))
-	http.HandleFunc("/api/logs/open", basicAuth(handleOpenLogs))
-	http.HandleFunc("/api/logs/bundle", basicAuth(handleLogsBundle))
-	http.HandleFunc("/api/updates/check", basicAuth(handleCheckUpdates))
-	http.HandleFunc("/api/updates/perform", basicAuth(handlePerformUpdate))
-	http.HandleFunc("/api/optimize", basicAuth(handleOptimize))
-	http.HandleFunc("/api/debug/logs", basicAuth(handleDebugLogs))
-	http.HandleFunc("/api/purge", basicAuth(handlePurge))
-	http.HandleFunc("/api/purge/scan", basicAuth(handlePurgeScan))
-	http.HandleFunc("/api/status/stream", basicAuth(handleStatusStream))
-	http.HandleFunc("/api/logs", basicAuth(handleLogsStream))
-	http.HandleFunc("/api/files", basicAuth(handleDeleteFiles))
-	http.HandleFunc("/api/apps/unsupported", basicAuth(handleUnsupportedApps))
+	http.HandleFunc("/api/status", requireScope(ScopeStatus, handleStatus))
+	http.HandleFunc("/api/clean", requireScope(ScopeDestructive, handleClean))
+	http.HandleFunc("/api/clean/preview", requireScope(ScopeAnalyze, timedScan("clean_preview", handleCleanPreview)))
+	http.HandleFunc("/api/uninstall/apps", requireScope(ScopeAnalyze, handleListApps))
+	http.HandleFunc("/api/uninstall", requireScope(ScopeDestructive, handleUninstall))
+	http.HandleFunc("/api/app/icon", requireScope(ScopeAnalyze, handleAppIcon))
+	http.HandleFunc("/api/analyze", requireScope(ScopeAnalyze, timedScan("analyze", handleAnalyze)))
+	http.HandleFunc("/api/analyze/large", requireScope(ScopeAnalyze, timedScan("large_files", handleAnalyzeLarge)))
+	http.HandleFunc("/api/analyze/downloads", requireScope(ScopeAnalyze, timedScan("downloads", handleAnalyzeDownloads)))
+	http.HandleFunc("/api/analyze/index", requireScope(ScopeAnalyze, handleAnalyzeIndex))
+	http.HandleFunc("/api/storage/breakdown", requireScope(ScopeAnalyze, timedScan("storage_breakdown", handleStorageBreakdown)))
+	http.HandleFunc("/api/storage/analyze-other", requireScope(ScopeAnalyze, timedScan("storage_other", handleAnalyzeOther)))
+	http.HandleFunc("/api/volumes", requireScope(ScopeAnalyze, handleListVolumes))
+	http.HandleFunc("/api/volumes/analyze", requireScope(ScopeAnalyze, timedScan("volume", handleAnalyzeVolume)))
+	http.HandleFunc("/api/open-finder", requireScope(ScopeAnalyze, handleOpenFinder))
+	http.HandleFunc("/api/permissions/check", requireScope(ScopeStatus, handlePermissionsCheck))
+	http.HandleFunc("/api/permissions/open-settings", requireScope(ScopeDestructive, handleOpenSystemSettings))
+	http.HandleFunc("/api/permissions/admin-test", requireScope(ScopeDestructive, handlePermissionsAdminTest))
+	http.HandleFunc("/api/logs/open", requireScope(ScopeAnalyze, handleOpenLogs))
+	http.HandleFunc("/api/logs/bundle", requireScope(ScopeStatus, handleLogsBundle))
+	http.HandleFunc("/api/updates/check", requireScope(ScopeStatus, handleCheckUpdates))
+	http.HandleFunc("/api/updates/perform", requireScope(ScopeDestructive, handlePerformUpdate))
+	http.HandleFunc("/api/optimize", requireScope(ScopeDestructive, handleOptimize))
+	http.HandleFunc("/api/debug/logs", requireScope(ScopeStatus, handleDebugLogs))
+	http.HandleFunc("/api/purge", requireScope(ScopeDestructive, handlePurge))
+	http.HandleFunc("/api/purge/scan", requireScope(ScopeAnalyze, timedScan("purge_scan", handlePurgeScan)))
+	http.HandleFunc("/api/status/stream", requireScope(ScopeStatus, handleStatusStream))
+	http.HandleFunc("/api/logs", requireScope(ScopeStatus, handleLogsStream))
+	http.HandleFunc("/api/files", requireScope(ScopeDestructive, handleDeleteFiles))
+	http.HandleFunc("/api/apps/unsupported", requireScope(ScopeAnalyze, handleUnsupportedApps))
+	http.HandleFunc("/api/jobs", requireScopes(ScopeStatus, ScopeDestructive, handleJobs))
+	http.HandleFunc("/api/jobs/", requireScopes(ScopeStatus, ScopeDestructive, handleJob))
+	http.HandleFunc("/api/history", requireScope(ScopeStatus, handleHistory))
+	http.HandleFunc("/api/schedules", requireScopes(ScopeStatus, ScopeDestructive, handleSchedules))
+	http.HandleFunc("/api/schedules/", requireScopes(ScopeStatus, ScopeDestructive, handleSchedule))
+	http.HandleFunc("/api/quarantine", requireScopes(ScopeStatus, ScopeDestructive, handleQuarantine))
+	http.HandleFunc("/api/quarantine/", requireScopes(ScopeStatus, ScopeDestructive, handleQuarantineItem))
+	http.HandleFunc("/api/whitelist", requireScopes(ScopeAnalyze, ScopeDestructive, handleWhitelist))
+	http.HandleFunc("/api/fleet", requireScope(ScopeAnalyze, handleFleet))
+	http.HandleFunc("/api/fleet/", requireScopes(ScopeAnalyze, ScopeDestructive, handleFleetPeer))
+	http.HandleFunc("/api/discover", requireScope(ScopeStatus, handleDiscover))
+	http.HandleFunc("/metrics", requireScope(ScopeStatus, handleMetrics))
+	http.HandleFunc("/api/metrics/history", requireScope(ScopeStatus, handleMetricsHistory))
+	http.HandleFunc("/api/alerts", requireScope(ScopeStatus, handleAlerts))
+	http.HandleFunc("/api/alerts/test", requireScope(ScopeAdmin, handleAlertTest))
+	http.HandleFunc("/api/config", requireScope(ScopeAdmin, handleConfig))
+	http.HandleFunc("/api/csrf", requireScope(ScopeStatus, handleCSRF))
+	http.HandleFunc("/api/tokens", requireScope(ScopeAdmin, handleTokens))
+	http.HandleFunc("/api/tokens/", requireScope(ScopeAdmin, handleToken))
 
 	// Determine bind address
-	bindHost := *hostAddr
-	if bindHost == "" {
-		bindHost = "localhost"
-	}
-	addr := fmt.Sprintf("%s:%d", bindHost, *port)
+	bindHost := cfg.Host
+	addr := fmt.Sprintf("%s:%d", bindHost, cfg.Port)
 
 	// Display URL (for user)
 	displayHost := bindHost
 	if bindHost == "0.0.0.0" {
 		displayHost = getLocalIP()
 	}
-	url := fmt.Sprintf("http://%s:%d", displayHost, *port)
+	scheme := "http"
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if *cfg.TLS {
+		scheme = "https"
+		if certFile == "" {
+			dir, err := tlsDir()
+			if err != nil {
+				log.Fatalf("TLS: %v", err)
+			}
+			if certFile, keyFile, err = ensureSelfSignedCert(dir); err != nil {
+				log.Fatalf("TLS: generating certificate: %v", err)
+			}
+		}
+	}
+	url := fmt.Sprintf("%s://%s:%d", scheme, displayHost, cfg.Port)
 
 	fmt.Printf("\n  🐭 Mole Web UI\n")
 	fmt.Printf("  ─────────────────────────────\n")
 	fmt.Printf("  Server:  %s\n", url)
 	fmt.Printf("  Bind:    %s\n", addr)
 	fmt.Printf("  Mole:    %s\n", moleDir)
-	if authUser != "" {
-		fmt.Printf("  Auth:    enabled (user: %s)\n", authUser)
+	if path, err := config.filePath(); err == nil && fileExists(path) {
+		fmt.Printf("  Config:  %s\n", path)
+	}
+	if *cfg.TLS {
+		fmt.Printf("  TLS:     %s\n", certFile)
+		if cfg.TLSCert == "" {
+			fmt.Printf("  SHA-256: %s\n", certFingerprint(certFile))
+		}
+		if cfg.HTTPRedirectPort > 0 {
+			fmt.Printf("  Redirect: http://%s:%d -> https\n", displayHost, cfg.HTTPRedirectPort)
+		}
+	} else if cfg.AuthUser != "" && bindHost != "localhost" {
+		fmt.Printf("  Warning: credentials are sent in cleartext; use -tls on the LAN\n")
+	}
+	if n, err := tokens.Count(); err != nil {
+		fmt.Printf("  Auth:    required (API tokens unreadable: %v)\n", err)
+	} else if cfg.AuthUser != "" && n > 0 {
+		fmt.Printf("  Auth:    enabled (user: %s, %d API tokens)\n", cfg.AuthUser, n)
+	} else if cfg.AuthUser != "" {
+		fmt.Printf("  Auth:    enabled (user: %s)\n", cfg.AuthUser)
+	} else if n > 0 {
+		fmt.Printf("  Auth:    enabled (%d API tokens)\n", n)
 	} else {
 		fmt.Printf("  Auth:    disabled\n")
 	}
+	if n := len(cfg.Peers); n > 0 {
+		fmt.Printf("  Fleet:   %d peers\n", n)
+	}
 	fmt.Printf("  ─────────────────────────────\n\n")
 
-	if *openBrowser && bindHost == "localhost" {
+	if *cfg.Open && bindHost == "localhost" {
 		go func() {
 			time.Sleep(500 * time.Millisecond)
-			openURL(fmt.Sprintf("http://localhost:%d", *port))
+			openURL(fmt.Sprintf("%s://localhost:%d", scheme, cfg.Port))
 		}()
 	}
 
-	log.Fatal(http.ListenAndServe(addr, nil))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           protect(http.DefaultServeMux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serve := srv.ListenAndServe
+	if *cfg.TLS {
+		serve = func() error { return srv.ListenAndServeTLS(certFile, keyFile) }
+	}
+	lifecycle := NewLifecycle(srv, serve, cfg.ShutdownTimeout.Duration)
+	if *cfg.TLS && cfg.HTTPRedirectPort > 0 {
+		lifecycle.Redirect = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", bindHost, cfg.HTTPRedirectPort),
+			Handler:           redirectToHTTPS(cfg.Port),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+
+	// Scheduled cleanups, quarantine expiry and config reload run until
+	// shutdown
+	if err := lifecycle.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func getLocalIP() string {
@@ -266,32 +315,15 @@ func openURL(url string) {
 	cmd.Start()
 }
 
-// Status API - returns system metrics as JSON
+// SystemStatus is the /api/status response: the snapshot mo status shows,
+// plus details about this server and the startup disk Mole cleans.
 type SystemStatus struct {
-	Hostname    string      `json:"hostname"`
-	HomeDir     string      `json:"home_dir"`
-	LocalIP     string      `json:"local_ip"`
-	OS          string      `json:"os"`
-	Uptime      string      `json:"uptime"`
-	Version     string      `json:"version"`
-	CPU         CPUInfo     `json:"cpu"`
-	Memory      MemInfo     `json:"memory"`
-	Disk        DiskInfo    `json:"disk"`
-	Network     NetworkInfo `json:"network"`
-	CollectedAt time.Time   `json:"collected_at"`
-}
-
-type CPUInfo struct {
-	Model string  `json:"model"`
-	Cores int     `json:"cores"`
-	Usage float64 `json:"usage"`
-}
-
-type MemInfo struct {
-	Total     uint64  `json:"total"`
-	Used      uint64  `json:"used"`
-	Available uint64  `json:"available"`
-	Percent   float64 `json:"percent"`
+	metrics.MetricsSnapshot
+	Version string   `json:"version"`
+	HomeDir string   `json:"home_dir"`
+	LocalIP string   `json:"local_ip"`
+	Disk    DiskInfo `json:"disk"`
+	Partial string   `json:"partial,omitempty"` // Readings that could not be collected
 }
 
 type DiskInfo struct {
@@ -301,11 +333,6 @@ type DiskInfo struct {
 	Percent float64 `json:"percent"`
 }
 
-type NetworkInfo struct {
-	BytesSent uint64 `json:"bytes_sent"`
-	BytesRecv uint64 `json:"bytes_recv"`
-}
-
 func handleStatus(w http.ResponseWriter, r *http.Request) {
 	status := collectStatus()
 	w.Header().Set("Content-Type", "application/json")
@@ -313,33 +340,15 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func collectStatus() SystemStatus {
+	snap, err := currentSnapshot()
 	status := SystemStatus{
-		CollectedAt: time.Now(),
-		Version:     getCurrentVersion(),
-		HomeDir:     os.Getenv("HOME"),
+		MetricsSnapshot: snap,
+		Version:         getCurrentVersion(),
+		HomeDir:         os.Getenv("HOME"),
+		LocalIP:         getLocalIP(),
 	}
-
-	if info, err := host.Info(); err == nil {
-		status.Hostname = info.Hostname
-		status.OS = fmt.Sprintf("%s %s", info.Platform, info.PlatformVersion)
-		status.Uptime = formatUptime(info.Uptime)
-	}
-
-	status.LocalIP = getLocalIP()
-
-	if cpus, err := cpu.Info(); err == nil && len(cpus) > 0 {
-		status.CPU.Model = cpus[0].ModelName
-	}
-	status.CPU.Cores = runtime.NumCPU()
-	if usage, err := cpu.Percent(0, false); err == nil && len(usage) > 0 {
-		status.CPU.Usage = usage[0]
-	}
-
-	if m, err := mem.VirtualMemory(); err == nil {
-		status.Memory.Total = m.Total
-		status.Memory.Used = m.Used
-		status.Memory.Available = m.Available
-		status.Memory.Percent = m.UsedPercent
+	if err != nil {
+		status.Partial = err.Error()
 	}
 
 	if d, err := disk.Usage("/"); err == nil {
@@ -349,32 +358,13 @@ func collectStatus() SystemStatus {
 		status.Disk.Percent = d.UsedPercent
 	}
 
-	if n, err := net.IOCounters(false); err == nil && len(n) > 0 {
-		status.Network.BytesSent = n[0].BytesSent
-		status.Network.BytesRecv = n[0].BytesRecv
-	}
-
 	return status
 }
 
-func formatUptime(seconds uint64) string {
-	days := seconds / 86400
-	hours := (seconds % 86400) / 3600
-	mins := (seconds % 3600) / 60
-	if days > 0 {
-		return fmt.Sprintf("%dd %dh %dm", days, hours, mins)
-	}
-	if hours > 0 {
-		return fmt.Sprintf("%dh %dm", hours, mins)
-	}
-	return fmt.Sprintf("%dm", mins)
-}
-
 func handleStatusStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -384,41 +374,25 @@ func handleStatusStream(w http.ResponseWriter, r *http.Request) {
 
 	ticker := time.NewTicker(2 * time.Second) // Slow down status updates slightly
 	defer ticker.Stop()
+	alertEvents, unsubscribe := alertManager.Subscribe()
+	defer unsubscribe()
 
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-shuttingDown:
+			fmt.Fprintf(w, "event: shutdown\ndata: Server shutting down\n\n")
+			flusher.Flush()
+			return
 		case <-ticker.C:
 			status := collectStatus()
 			data, _ := json.Marshal(status)
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
-		}
-	}
-}
-
-func handleLogsStream(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "SSE not supported", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Fprintf(w, "data: Connected to log stream\n\n")
-	flusher.Flush()
-
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case msg := <-logBroadcast:
-			fmt.Fprintf(w, "data: %s\n\n", msg)
+		case ev := <-alertEvents:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: alert\ndata: %s\n\n", data)
 			flusher.Flush()
 		}
 	}
@@ -429,10 +403,23 @@ type CleanResult struct {
 	Message string `json:"message"`
 	Cleaned int64  `json:"cleaned_bytes"`
 	Output  string `json:"output,omitempty"`
+
+	// Parsed from CLI output when the operation ran the mole CLI
+	Categories   []CleanCategory `json:"categories,omitempty"`
+	FilesRemoved int             `json:"files_removed,omitempty"`
+	Skipped      []string        `json:"skipped,omitempty"`
+	Errors       []string        `json:"errors,omitempty"`
+
+	// Bytes moved into quarantine rather than freed
+	Quarantined int64 `json:"quarantined_bytes,omitempty"`
+
+	// Paths the safety policy refused, with reasons
+	Refused []pathpolicy.Decision `json:"refused,omitempty"`
 }
 
 func handleCleanPreview(w http.ResponseWriter, r *http.Request) {
-	result := runMoleCommand("clean", "--dry-run")
+	result := runMoleCommandContext(r.Context(), nil, "clean", "--dry-run")
+	applyCleanOutput(&result, result.Output)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
@@ -443,14 +430,20 @@ func handleClean(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category := r.URL.Query().Get("category")
+	req := JobRequest{Type: "clean", Category: r.URL.Query().Get("category")}
+	if wantsDryRun(r, false) {
+		writeDryRun(w, planClean(r.Context(), req.Category))
+		return
+	}
+	runJobAndRespond(w, r, req, func(result CleanResult) interface{} {
+		return result
+	})
+}
 
+func runClean(j *Job, category string) CleanResult {
 	// Handle trash emptying separately since mole CLI doesn't support it
 	if category == "trash" {
-		result := emptyTrash()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
-		return
+		return emptyTrash(j.Context())
 	}
 
 	args := []string{"clean"}
@@ -459,14 +452,14 @@ func handleClean(w http.ResponseWriter, r *http.Request) {
 	}
 	args = append(args, "--yes")
 
-	result := runMoleCommand(args...)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	result := runMoleCommand(j, args...)
+	applyCleanOutput(&result, result.Output)
+	return result
 }
 
-func emptyTrash() CleanResult {
+func emptyTrash(ctx context.Context) CleanResult {
 	// Check if trash has items using Finder API (works with macOS permissions)
-	countCmd := exec.Command("osascript", "-e", `tell application "Finder" to count of items of trash`)
+	countCmd := newCommand(ctx, "osascript", "-e", `tell application "Finder" to count of items of trash`)
 	countOutput, err := countCmd.Output()
 	if err != nil {
 		return CleanResult{Success: false, Message: "Failed to check trash"}
@@ -494,8 +487,11 @@ func emptyTrash() CleanResult {
 	trashSize += getDirSize(volTrash)
 
 	// Empty trash using Finder (handles permissions properly)
-	emptyCmd := exec.Command("osascript", "-e", `tell application "Finder" to empty trash`)
+	emptyCmd := newCommand(ctx, "osascript", "-e", `tell application "Finder" to empty trash`)
 	output, err := emptyCmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return cancelledResult(string(output))
+	}
 	if err != nil {
 		return CleanResult{
 			Success: false,
@@ -719,30 +715,40 @@ func handleUninstall(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Apps []string `json:"apps"`
+		Apps   []string `json:"apps"`
+		DryRun bool     `json:"dry_run"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Batch uninstall all apps at once (single auth prompt)
-	result := uninstallApps(req.Apps)
+	if wantsDryRun(r, req.DryRun) {
+		writeDryRun(w, planUninstall(r.Context(), req.Apps))
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode([]CleanResult{result})
+	// Batch uninstall all apps at once (single auth prompt)
+	runJobAndRespond(w, r, JobRequest{Type: "uninstall", Apps: req.Apps}, func(result CleanResult) interface{} {
+		return []CleanResult{result}
+	})
 }
 
 func writeLog(format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
+	writeTaggedLog("", "", fmt.Sprintf(format, v...))
+}
+
+// writeJobLog is writeLog for messages about a job, tagged so that clients
+// following that job's stream see them.
+func writeJobLog(j *Job, format string, v ...interface{}) {
+	writeTaggedLog(j.ID(), j.request.Type, fmt.Sprintf(format, v...))
+}
+
+func writeTaggedLog(job, op, msg string) {
 	log.Println(msg)
 
-	// Broadcast to SSE clients (non-blocking)
-	select {
-	case logBroadcast <- msg:
-	default:
-		// Channel full, skip
-	}
+	// Broadcast to SSE clients
+	logHub.Publish(job, op, msg)
 
 	// Also write to a file for user to retrieve
 	cacheDir, err := os.UserCacheDir()
@@ -807,7 +813,7 @@ func findMoleScript() string {
 	return ""
 }
 
-func uninstallApps(appPaths []string) CleanResult {
+func uninstallApps(j *Job, appPaths []string) CleanResult {
 	if len(appPaths) == 0 {
 		return CleanResult{Success: false, Message: "No apps specified"}
 	}
@@ -819,21 +825,33 @@ func uninstallApps(appPaths []string) CleanResult {
 
 	var successful []string
 	var failed []string
-	var totalCleaned int64
+	var summary CleanResult
 
-	for _, appPath := range appPaths {
-		writeLog("Attempting to uninstall: %s", appPath)
+	allowed, refused := deletePolicy().Partition(appPaths)
+	for _, d := range refused {
+		writeJobLog(j, "Refused to uninstall %s: %s", d.Path, d.Reason)
+		failed = append(failed, fmt.Sprintf("%s (%s)", filepath.Base(d.Path), d.Reason))
+	}
+	summary.Refused = refused
+
+	for _, d := range allowed {
+		appPath := d.Canonical
+		if j.cancelled() {
+			writeJobLog(j, "Uninstall cancelled before %s", appPath)
+			break
+		}
+		writeJobLog(j, "Attempting to uninstall: %s", appPath)
 
 		if _, err := os.Stat(appPath); os.IsNotExist(err) {
-			writeLog("ERROR: Path does not exist: %s", appPath)
+			writeJobLog(j, "ERROR: Path does not exist: %s", appPath)
 			failed = append(failed, fmt.Sprintf("%s (not found)", filepath.Base(appPath)))
 			continue
 		}
 
 		// Use the mole CLI for robust uninstallation
 		// mole uninstall --path <path> --debug
-		writeLog("Executing: %s uninstall --path %s --debug", moleScript, appPath)
-		cmd := exec.Command(moleScript, "uninstall", "--path", appPath, "--debug")
+		writeJobLog(j, "Executing: %s uninstall --path %s --debug", moleScript, appPath)
+		cmd := newCommand(j.Context(), moleScript, "uninstall", "--path", appPath, "--debug")
 		// MOLE_NO_CONFIRM=1 skips interactive confirmation
 		// MOLE_GUI_MODE=1 tells the script to use osascript for admin privileges instead of TTY-based sudo
 		cmd.Env = append(os.Environ(), "MOLE_NO_CONFIRM=1", "MOLE_GUI_MODE=1")
@@ -843,12 +861,13 @@ func uninstallApps(appPaths []string) CleanResult {
 		stderr, _ := cmd.StderrPipe()
 
 		if err := cmd.Start(); err != nil {
-			writeLog("ERROR: Failed to start uninstall for %s: %v", appPath, err)
+			writeJobLog(j, "ERROR: Failed to start uninstall for %s: %v", appPath, err)
 			failed = append(failed, fmt.Sprintf("%s (start failed)", filepath.Base(appPath)))
 			continue
 		}
 
 		var output strings.Builder
+		var outputMu sync.Mutex
 		var wg sync.WaitGroup
 		wg.Add(2)
 
@@ -857,12 +876,11 @@ func uninstallApps(appPaths []string) CleanResult {
 			scanner := bufio.NewScanner(r)
 			for scanner.Scan() {
 				line := scanner.Text()
+				outputMu.Lock()
 				output.WriteString(line + "\n")
-				// Broadcast to SSE in real-time
-				select {
-				case logBroadcast <- stripANSI(line):
-				default:
-				}
+				outputMu.Unlock()
+				// Records on the job and broadcasts to SSE in real-time
+				j.appendLine(line)
 			}
 		}
 
@@ -872,17 +890,45 @@ func uninstallApps(appPaths []string) CleanResult {
 		err := cmd.Wait()
 		wg.Wait()
 
-		if err != nil {
-			writeLog("ERROR: Uninstallation failed for %s: %v", appPath, err)
+		if j.cancelled() {
+			writeJobLog(j, "Uninstall of %s cancelled", appPath)
+			failed = append(failed, fmt.Sprintf("%s (cancelled)", filepath.Base(appPath)))
+		} else if err != nil {
+			writeJobLog(j, "ERROR: Uninstallation failed for %s: %v", appPath, err)
 			failed = append(failed, fmt.Sprintf("%s (%v)", filepath.Base(appPath), err))
 		} else {
-			writeLog("SUCCESS: Uninstalled %s", appPath)
+			writeJobLog(j, "SUCCESS: Uninstalled %s", appPath)
 			successful = append(successful, filepath.Base(appPath))
 		}
+
+		// Report each app as its own category in the structured result
+		var parsed CleanResult
+		applyCleanOutput(&parsed, output.String())
+		summary.Categories = append(summary.Categories, CleanCategory{
+			Name:  filepath.Base(appPath),
+			Freed: parsed.Cleaned,
+			Files: parsed.FilesRemoved,
+			Items: 1,
+		})
+		summary.Cleaned += parsed.Cleaned
+		summary.FilesRemoved += parsed.FilesRemoved
+		summary.Skipped = append(summary.Skipped, parsed.Skipped...)
+		summary.Errors = append(summary.Errors, parsed.Errors...)
+	}
+
+	if j.cancelled() {
+		result := summary
+		result.Success = false
+		result.Message = fmt.Sprintf("Cancelled after uninstalling %d app(s)", len(successful))
+		result.Output = fmt.Sprintf("Uninstalled before cancel: %s", strings.Join(successful, ", "))
+		return result
 	}
 
 	if len(failed) > 0 && len(successful) == 0 {
-		return CleanResult{Success: false, Message: fmt.Sprintf("Failed to remove: %s", strings.Join(failed, ", "))}
+		result := summary
+		result.Success = false
+		result.Message = fmt.Sprintf("Failed to remove: %s", strings.Join(failed, ", "))
+		return result
 	}
 
 	msg := fmt.Sprintf("Uninstalled %d app(s)", len(successful))
@@ -890,12 +936,11 @@ func uninstallApps(appPaths []string) CleanResult {
 		msg += fmt.Sprintf(" (Failed %d: %s)", len(failed), strings.Join(failed, ", "))
 	}
 
-	return CleanResult{
-		Success: true,
-		Message: msg,
-		Cleaned: totalCleaned, // Will be 0 for now as we don't parse script output
-		Output:  fmt.Sprintf("Used Mole CLI for comprehensive cleanup of: %s", strings.Join(successful, ", ")),
-	}
+	result := summary
+	result.Success = true
+	result.Message = msg
+	result.Output = fmt.Sprintf("Used Mole CLI for comprehensive cleanup of: %s", strings.Join(successful, ", "))
+	return result
 }
 
 type DirEntry struct {
@@ -904,6 +949,10 @@ type DirEntry struct {
 	Size      int64  `json:"size"`
 	SizeHuman string `json:"size_human"`
 	IsDir     bool   `json:"is_dir"`
+	Exact     bool   `json:"exact"` // False when the size is an estimate
+
+	LogicalSize int64 `json:"logical_size"` // Apparent size; larger than Size for sparse or compressed files
+	SharedSize  int64 `json:"shared_size"`  // Part of Size also referenced by hard links or clones elsewhere
 }
 
 func handleAnalyze(w http.ResponseWriter, r *http.Request) {
@@ -931,24 +980,24 @@ func analyzePath(path string) []DirEntry {
 		if strings.HasPrefix(item.Name(), ".") {
 			continue
 		}
+		dirUsageSlots <- struct{}{}
 		wg.Add(1)
 		go func(item os.DirEntry) {
 			defer wg.Done()
+			defer func() { <-dirUsageSlots }()
 			fullPath := filepath.Join(path, item.Name())
-			var size int64
-			if item.IsDir() {
-				size = getDirSize(fullPath)
-			} else if info, err := item.Info(); err == nil {
-				size = info.Size()
-			}
+			usage := dirUsage(fullPath)
 
 			mu.Lock()
 			entries = append(entries, DirEntry{
-				Path:      fullPath,
-				Name:      item.Name(),
-				Size:      size,
-				SizeHuman: formatBytes(size),
-				IsDir:     item.IsDir(),
+				Path:        fullPath,
+				Name:        item.Name(),
+				Size:        usage.Size,
+				SizeHuman:   formatBytes(usage.Size),
+				IsDir:       item.IsDir(),
+				Exact:       usage.Exact,
+				LogicalSize: usage.Logical,
+				SharedSize:  usage.Shared,
 			})
 			mu.Unlock()
 		}(item)
@@ -1038,7 +1087,7 @@ func handleAnalyzeLarge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	minSizeStr := r.URL.Query().Get("min_size")
-	minSize := int64(104857600) // Default 100MB
+	minSize := currentConfig().LargeFileThreshold
 	if minSizeStr != "" {
 		if parsed, err := strconv.ParseInt(minSizeStr, 10, 64); err == nil {
 			minSize = parsed
@@ -1085,27 +1134,32 @@ func handleAnalyzeLarge(w http.ResponseWriter, r *http.Request) {
 				topLevelFolders = append(topLevelFolders, filePath)
 			} else if isCompact {
 				// Calculate size for compact folders immediately
-				dirSize := getDirSizeWithLimit(filePath, 5)
-				if dirSize >= minSize {
+				usage := dirUsage(filePath)
+				if usage.Size >= minSize {
 					largeItems = append(largeItems, DirEntry{
-						Path:      filePath,
-						Name:      name,
-						Size:      dirSize,
-						SizeHuman: formatBytes(dirSize),
-						IsDir:     true,
+						Path:        filePath,
+						Name:        name,
+						Size:        usage.Size,
+						SizeHuman:   formatBytes(usage.Size),
+						IsDir:       true,
+						Exact:       usage.Exact,
+						LogicalSize: usage.Logical,
+						SharedSize:  usage.Shared,
 					})
 				}
 				return filepath.SkipDir
 			}
 		} else {
 			// Regular file - add if large enough
-			if info.Size() >= minSize {
+			if size := diskscan.FileSize(info); size >= minSize {
 				largeItems = append(largeItems, DirEntry{
-					Path:      filePath,
-					Name:      name,
-					Size:      info.Size(),
-					SizeHuman: formatBytes(info.Size()),
-					IsDir:     false,
+					Path:        filePath,
+					Name:        name,
+					Size:        size,
+					SizeHuman:   formatBytes(size),
+					IsDir:       false,
+					Exact:       true,
+					LogicalSize: info.Size(),
 				})
 			}
 		}
@@ -1120,18 +1174,23 @@ func handleAnalyzeLarge(w http.ResponseWriter, r *http.Request) {
 	// Calculate top-level folder sizes in parallel
 	var wg sync.WaitGroup
 	for _, folderPath := range topLevelFolders {
+		dirUsageSlots <- struct{}{}
 		wg.Add(1)
 		go func(fp string) {
 			defer wg.Done()
-			dirSize := getDirSizeWithLimit(fp, 5)
-			if dirSize >= minSize {
+			defer func() { <-dirUsageSlots }()
+			usage := dirUsage(fp)
+			if usage.Size >= minSize {
 				mu.Lock()
 				largeItems = append(largeItems, DirEntry{
-					Path:      fp,
-					Name:      filepath.Base(fp),
-					Size:      dirSize,
-					SizeHuman: formatBytes(dirSize),
-					IsDir:     true,
+					Path:        fp,
+					Name:        filepath.Base(fp),
+					Size:        usage.Size,
+					SizeHuman:   formatBytes(usage.Size),
+					IsDir:       true,
+					Exact:       usage.Exact,
+					LogicalSize: usage.Logical,
+					SharedSize:  usage.Shared,
 				})
 				mu.Unlock()
 			}
@@ -1169,23 +1228,16 @@ func handleAnalyzeDownloads(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		size := info.Size()
-		if entry.IsDir() {
-			// Calculate directory size
-			size = getDirSize(filepath.Join(downloadsPath, entry.Name()))
-		}
-
+		usage := dirUsage(filepath.Join(downloadsPath, entry.Name()))
 		result = append(result, DirEntry{
-			Path:      filepath.Join(downloadsPath, entry.Name()),
-			Name:      entry.Name(),
-			Size:      size,
-			SizeHuman: formatBytes(size),
-			IsDir:     entry.IsDir(),
+			Path:        filepath.Join(downloadsPath, entry.Name()),
+			Name:        entry.Name(),
+			Size:        usage.Size,
+			SizeHuman:   formatBytes(usage.Size),
+			IsDir:       entry.IsDir(),
+			Exact:       usage.Exact,
+			LogicalSize: usage.Logical,
+			SharedSize:  usage.Shared,
 		})
 	}
 
@@ -1210,6 +1262,10 @@ type StorageCategory struct {
 	Percent   float64 `json:"percent"`
 	Color     string  `json:"color"`
 	Icon      string  `json:"icon"`
+	Exact     bool    `json:"exact"` // False when the size is an estimate
+
+	LogicalSize int64 `json:"logical_size"` // Apparent size; larger than Size for sparse or compressed files
+	SharedSize  int64 `json:"shared_size"`  // Part of Size also referenced by hard links or clones elsewhere
 }
 
 type CleanupSuggestion struct {
@@ -1233,13 +1289,24 @@ type StorageBreakdown struct {
 }
 
 func handleStorageBreakdown(w http.ResponseWriter, r *http.Request) {
+	breakdown, err := collectStorageBreakdown()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakdown)
+}
+
+// collectStorageBreakdown measures the disk and the main storage categories.
+func collectStorageBreakdown() (StorageBreakdown, error) {
 	home := os.Getenv("HOME")
 
 	// Get disk usage
 	usage, err := disk.Usage("/")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return StorageBreakdown{}, err
 	}
 
 	breakdown := StorageBreakdown{
@@ -1279,16 +1346,19 @@ func handleStorageBreakdown(w http.ResponseWriter, r *http.Request) {
 		wg.Add(1)
 		go func(name, path, color, icon string) {
 			defer wg.Done()
-			size := getDirSize(path)
-			if size > 0 {
+			dir := dirUsage(path)
+			if dir.Size > 0 {
 				mu.Lock()
 				breakdown.Categories = append(breakdown.Categories, StorageCategory{
-					Name:      name,
-					Size:      size,
-					SizeHuman: formatBytes(size),
-					Percent:   float64(size) / float64(usage.Used) * 100,
-					Color:     color,
-					Icon:      icon,
+					Name:        name,
+					Size:        dir.Size,
+					SizeHuman:   formatBytes(dir.Size),
+					Percent:     float64(dir.Size) / float64(usage.Used) * 100,
+					Color:       color,
+					Icon:        icon,
+					Exact:       dir.Exact,
+					LogicalSize: dir.Logical,
+					SharedSize:  dir.Shared,
 				})
 				mu.Unlock()
 			}
@@ -1423,8 +1493,7 @@ func handleStorageBreakdown(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(breakdown)
+	return breakdown, nil
 }
 
 // OtherCategory represents a directory contributing to "Other" storage
@@ -1436,6 +1505,10 @@ type OtherCategory struct {
 	Percent   float64 `json:"percent"`
 	Type      string  `json:"type"`
 	Icon      string  `json:"icon"`
+	Exact     bool    `json:"exact"` // False when the size is an estimate
+
+	LogicalSize int64 `json:"logical_size"` // Apparent size; larger than Size for sparse or compressed files
+	SharedSize  int64 `json:"shared_size"`  // Part of Size also referenced by hard links or clones elsewhere
 }
 
 type OtherBreakdown struct {
@@ -1477,64 +1550,41 @@ func handleAnalyzeOther(w http.ResponseWriter, r *http.Request) {
 	}
 	otherSize := int64(usage.Used) - categorizedSize
 
-	// Define directories to scan for "Other" breakdown
-	// These are major directories that might contain significant data
-	otherDirs := []struct {
-		path    string
-		name    string
-		dirType string
-		icon    string
-	}{
-		// System directories
-		{"/private/var", "System Data (var)", "system", "settings"},
-		{"/System", "macOS System", "system", "apple"},
-		{"/usr", "Unix Programs", "system", "terminal"},
-		{"/opt", "Optional Software", "system", "package"},
-		// User hidden directories
-		{filepath.Join(home, ".local"), "Local Data", "user", "folder"},
-		{filepath.Join(home, ".cache"), "User Cache", "cache", "trash"},
-		{filepath.Join(home, ".docker"), "Docker Config", "developer", "docker"},
-		{filepath.Join(home, ".npm"), "NPM Cache", "developer", "package"},
-		{filepath.Join(home, ".cargo"), "Rust/Cargo", "developer", "code"},
-		{filepath.Join(home, ".rustup"), "Rustup", "developer", "code"},
-		{filepath.Join(home, ".gradle"), "Gradle Cache", "developer", "code"},
-		{filepath.Join(home, ".m2"), "Maven Cache", "developer", "code"},
-		{filepath.Join(home, ".vscode"), "VS Code", "developer", "code"},
-		{filepath.Join(home, ".cursor"), "Cursor IDE", "developer", "code"},
-		{filepath.Join(home, ".orbstack"), "OrbStack", "developer", "docker"},
-		{filepath.Join(home, ".lima"), "Lima VMs", "developer", "docker"},
-		{filepath.Join(home, ".vagrant.d"), "Vagrant", "developer", "docker"},
-		// Other Volumes
-		{"/Volumes", "External Volumes", "volumes", "harddrive"},
-	}
-
+	// Directories to scan for the "Other" breakdown, from the config
+	otherDirs := currentConfig().OtherDirs
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	var categories []OtherCategory
 
 	for _, dir := range otherDirs {
+		dir.Path = expandHome(dir.Path)
 		// Skip if this path is categorized
-		if categorizedPaths[dir.path] {
+		if categorizedPaths[dir.Path] {
 			continue
 		}
+		dirUsageSlots <- struct{}{}
 		wg.Add(1)
 		go func(path, name, dirType, icon string) {
 			defer wg.Done()
-			size := getDirSize(path)
-			if size > 10*1024*1024 { // Only include if > 10MB
+			defer func() { <-dirUsageSlots }()
+			usage := dirUsage(path)
+			if usage.Size > 10*1024*1024 { // Only include if > 10MB
 				mu.Lock()
 				categories = append(categories, OtherCategory{
-					Path:      path,
-					Name:      name,
-					Size:      size,
-					SizeHuman: formatBytes(size),
-					Percent:   float64(size) / float64(otherSize) * 100,
-					Type:      dirType,
-					Icon:      icon,
+					Path:        path,
+					Name:        name,
+					Size:        usage.Size,
+					SizeHuman:   formatBytes(usage.Size),
+					Percent:     float64(usage.Size) / float64(otherSize) * 100,
+					Type:        dirType,
+					Icon:        icon,
+					Exact:       usage.Exact,
+					LogicalSize: usage.Logical,
+					SharedSize:  usage.Shared,
 				})
 				mu.Unlock()
 			}
-		}(dir.path, dir.name, dir.dirType, dir.icon)
+		}(dir.Path, dir.Name, dir.Type, dir.Icon)
 	}
 
 	wg.Wait()
@@ -1563,6 +1613,7 @@ func handleAnalyzeOther(w http.ResponseWriter, r *http.Request) {
 			Percent:   float64(unaccounted) / float64(otherSize) * 100,
 			Type:      "system",
 			Icon:      "lock",
+			Exact:     false, // Whatever the scans could not attribute
 		})
 	}
 
@@ -1582,93 +1633,211 @@ func handleOptimize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wantsDryRun(r, false) {
+		writeDryRun(w, planOptimize())
+		return
+	}
+
+	runJobAndRespond(w, r, JobRequest{Type: "optimize"}, func(result CleanResult) interface{} {
+		return result
+	})
+}
+
+// Optimize step names, as reported in results and dry runs.
+const (
+	optimizeDNSCache       = "dns_cache"
+	optimizeQuickLookCache = "quicklook_cache"
+	optimizeIconCache      = "icon_cache"
+	optimizeMemoryPurge    = "memory_purge"
+	optimizeSpotlight      = "spotlight_index"
+	optimizeFontCache      = "font_cache"
+	optimizeRestartFinder  = "restart_finder"
+)
+
+// The CLI's optimize tasks (execute_optimization in lib/optimize/tasks.sh),
+// as listed in ~/.config/mole/whitelist_optimize to skip one. Each step
+// belongs to the task that does the same work in `mole optimize`, so an
+// entry skips the same things in both.
+const (
+	optimizeTaskNetwork     = "network_optimization"
+	optimizeTaskCaches      = "cache_refresh"
+	optimizeTaskSwap        = "swap_cleanup"
+	optimizeTaskMaintenance = "system_maintenance"
+)
+
+type optimizeTask struct {
+	name  string
+	task  string // CLI task the step belongs to
+	label string
+	path  string // Cache removed by the task, if any
+}
+
+// optimizeTasks lists the steps runOptimize performs, in order.
+func optimizeTasks(home string) []optimizeTask {
+	caches := filepath.Join(home, "Library", "Caches")
+	return []optimizeTask{
+		{optimizeDNSCache, optimizeTaskNetwork, "Flush DNS cache", ""},
+		{optimizeQuickLookCache, optimizeTaskCaches, "Clear QuickLook thumbnails", filepath.Join(caches, "com.apple.QuickLook.thumbnailcache")},
+		{optimizeIconCache, optimizeTaskCaches, "Clear icon services cache", filepath.Join(caches, "com.apple.iconservices.store")},
+		{optimizeMemoryPurge, optimizeTaskSwap, "Purge inactive memory", ""},
+		{optimizeSpotlight, optimizeTaskMaintenance, "Refresh Spotlight index", ""},
+		{optimizeFontCache, optimizeTaskCaches, "Clear font caches", filepath.Join(caches, "com.apple.FontRegistry")},
+		{optimizeRestartFinder, optimizeTaskCaches, "Restart Finder", ""},
+	}
+}
+
+// optimizeSkipReason returns the whitelist entry that skips a step: its
+// CLI task in the optimize whitelist, or a clean whitelist pattern covering
+// the cache it clears. Empty means the step runs.
+func optimizeSkipReason(task, path string, skipTasks, protected *whitelist.List) string {
+	if skipTasks.Contains(task) {
+		return task
+	}
+	if path != "" {
+		if pattern, ok := protected.Protects(path); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+func runOptimize(ctx context.Context) CleanResult {
 	// Run optimization tasks directly (no sudo required)
 	var output strings.Builder
 	output.WriteString("System Optimization\n")
 	output.WriteString("==================\n\n")
 
+	home := os.Getenv("HOME")
+	paths := make(map[string]string)
+	tasks := make(map[string]string)
+	for _, task := range optimizeTasks(home) {
+		paths[task.name] = task.path
+		tasks[task.name] = task.task
+	}
+
+	// Steps whose CLI task is named in the optimize whitelist, or whose cache
+	// is covered by the clean whitelist, are skipped just like in the CLI.
+	skipTasks := loadWhitelist(whitelist.Optimize)
+	protected := loadWhitelist(whitelist.Clean)
+	var skipped []string
+	skip := func(name, path string) bool {
+		reason := optimizeSkipReason(tasks[name], path, skipTasks, protected)
+		if reason == "" {
+			return false
+		}
+		output.WriteString("Skipped (whitelisted)\n")
+		skipped = append(skipped, fmt.Sprintf("%s: whitelisted (%s)", name, reason))
+		return true
+	}
+
 	// 1. Flush DNS cache (works without sudo on modern macOS)
 	output.WriteString("DNS Cache: ")
-	if err := exec.Command("dscacheutil", "-flushcache").Run(); err == nil {
-		output.WriteString("Flushed\n")
-	} else {
-		// Attempt with sudo via osascript
-		adminCmd := exec.Command("osascript", "-e", `do shell script "dscacheutil -flushcache; killall -HUP mDNSResponder" with administrator privileges`)
-		if err := adminCmd.Run(); err == nil {
-			output.WriteString("Flushed (with admin)\n")
+	if !skip(optimizeDNSCache, "") {
+		if err := newCommand(ctx, "dscacheutil", "-flushcache").Run(); err == nil {
+			output.WriteString("Flushed\n")
 		} else {
-			output.WriteString("Skipped (requires admin)\n")
+			// Attempt with sudo via osascript
+			adminCmd := newCommand(ctx, "osascript", "-e", `do shell script "dscacheutil -flushcache; killall -HUP mDNSResponder" with administrator privileges`)
+			if err := adminCmd.Run(); err == nil {
+				output.WriteString("Flushed (with admin)\n")
+			} else {
+				output.WriteString("Skipped (requires admin)\n")
+			}
 		}
 	}
 
+	if ctx.Err() != nil {
+		return cancelledResult(output.String())
+	}
+
 	// 2. Clear QuickLook thumbnails
 	output.WriteString("QuickLook Cache: ")
-	qlPath := filepath.Join(os.Getenv("HOME"), "Library", "Caches", "com.apple.QuickLook.thumbnailcache")
-	if err := os.RemoveAll(qlPath); err == nil {
-		output.WriteString("Cleared\n")
-	} else {
-		output.WriteString("Skipped\n")
+	qlPath := paths[optimizeQuickLookCache]
+	if !skip(optimizeQuickLookCache, qlPath) {
+		if err := os.RemoveAll(qlPath); err == nil {
+			output.WriteString("Cleared\n")
+		} else {
+			output.WriteString("Skipped\n")
+		}
 	}
 
 	// 3. Clear icon services cache
 	output.WriteString("Icon Cache: ")
-	iconPath := filepath.Join(os.Getenv("HOME"), "Library", "Caches", "com.apple.iconservices.store")
-	if err := os.RemoveAll(iconPath); err == nil {
-		output.WriteString("Cleared\n")
-	} else {
-		output.WriteString("Skipped\n")
+	iconPath := paths[optimizeIconCache]
+	if !skip(optimizeIconCache, iconPath) {
+		if err := os.RemoveAll(iconPath); err == nil {
+			output.WriteString("Cleared\n")
+		} else {
+			output.WriteString("Skipped\n")
+		}
 	}
 
 	// 4. Purge inactive memory
 	output.WriteString("Memory: ")
-	if err := exec.Command("purge").Run(); err == nil {
-		output.WriteString("Inactive memory purged\n")
-	} else {
-		// Attempt with sudo via osascript as requested by user
-		writeLog("Memory purge requires admin privileges, prompting user...")
-		adminCmd := exec.Command("osascript", "-e", `do shell script "purge" with administrator privileges`)
-		if err := adminCmd.Run(); err == nil {
-			output.WriteString("Memory purged (with admin)\n")
+	if !skip(optimizeMemoryPurge, "") {
+		if err := newCommand(ctx, "purge").Run(); err == nil {
+			output.WriteString("Inactive memory purged\n")
 		} else {
-			output.WriteString("Skipped (requires admin)\n")
+			// Attempt with sudo via osascript as requested by user
+			writeLog("Memory purge requires admin privileges, prompting user...")
+			adminCmd := newCommand(ctx, "osascript", "-e", `do shell script "purge" with administrator privileges`)
+			if err := adminCmd.Run(); err == nil {
+				output.WriteString("Memory purged (with admin)\n")
+			} else {
+				output.WriteString("Skipped (requires admin)\n")
+			}
 		}
 	}
 
+	if ctx.Err() != nil {
+		return cancelledResult(output.String())
+	}
+
 	// 5. Rebuild Spotlight index for user folders
 	output.WriteString("Spotlight: ")
-	homeDir := os.Getenv("HOME")
-	exec.Command("mdutil", "-i", "on", homeDir).Run()
-	output.WriteString("Index refreshed\n")
+	if !skip(optimizeSpotlight, "") {
+		newCommand(ctx, "mdutil", "-i", "on", home).Run()
+		output.WriteString("Index refreshed\n")
+	}
 
 	// 6. Clear font caches
 	output.WriteString("Font Caches: ")
-	fontCaches := []string{
-		filepath.Join(os.Getenv("HOME"), "Library", "Caches", "com.apple.FontRegistry"),
+	fontCache := paths[optimizeFontCache]
+	if !skip(optimizeFontCache, fontCache) {
+		os.RemoveAll(fontCache)
+		output.WriteString("Cleared\n")
 	}
-	for _, fc := range fontCaches {
-		os.RemoveAll(fc)
+
+	if ctx.Err() != nil {
+		return cancelledResult(output.String())
 	}
-	output.WriteString("Cleared\n")
 
 	// 7. Restart Finder to apply changes
-	output.WriteString("\nRestarting Finder to apply changes...\n")
-	exec.Command("killall", "Finder").Run()
+	if optimizeSkipReason(tasks[optimizeRestartFinder], "", skipTasks, protected) == "" {
+		output.WriteString("\nRestarting Finder to apply changes...\n")
+		exec.Command("killall", "Finder").Run()
+	}
 
 	output.WriteString("\nOptimization complete!")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CleanResult{
+	return CleanResult{
 		Success: true,
 		Message: "System optimized",
 		Output:  output.String(),
-	})
+		Skipped: skipped,
+	}
 }
 
 type PurgeItem struct {
-	Path      string `json:"path"`
-	Size      int64  `json:"size"`
-	SizeHuman string `json:"size_human"`
-	Type      string `json:"type"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SizeHuman string    `json:"size_human"`
+	Type      string    `json:"type"`
+	ModTime   time.Time `json:"mod_time"`
+
+	// Whitelisted items are listed for visibility but will not be purged
+	Whitelisted      bool   `json:"whitelisted,omitempty"`
+	WhitelistPattern string `json:"whitelist_pattern,omitempty"`
 }
 
 func handlePurgeScan(w http.ResponseWriter, r *http.Request) {
@@ -1684,7 +1853,8 @@ func handlePurgeScan(w http.ResponseWriter, r *http.Request) {
 
 func scanForPurge(root string) []PurgeItem {
 	var items []PurgeItem
-	targets := []string{"node_modules", "target", "build", "dist", ".next", "__pycache__", "venv", ".venv"}
+	targets := currentConfig().PurgeTargets
+	wl := loadWhitelist(whitelist.Clean)
 
 	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -1695,13 +1865,19 @@ func scanForPurge(root string) []PurgeItem {
 		}
 		for _, t := range targets {
 			if info.Name() == t {
-				size := getDirSize(path)
-				items = append(items, PurgeItem{
-					Path:      path,
-					Size:      size,
-					SizeHuman: formatBytes(size),
-					Type:      t,
-				})
+				item := PurgeItem{
+					Path:    path,
+					Type:    t,
+					ModTime: info.ModTime(),
+				}
+				if pattern, ok := wl.Protects(path); ok {
+					item.Whitelisted = true
+					item.WhitelistPattern = pattern
+				} else {
+					item.Size = getDirSize(path)
+				}
+				item.SizeHuman = formatBytes(item.Size)
+				items = append(items, item)
 				return filepath.SkipDir
 			}
 		}
@@ -1718,29 +1894,84 @@ func handlePurge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Paths []string `json:"paths"`
+		Paths  []string `json:"paths"`
+		Mode   string   `json:"mode"` // "delete" (default) or "quarantine"
+		DryRun bool     `json:"dry_run"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var totalCleaned int64
-	for _, p := range req.Paths {
-		size := getDirSize(p)
-		if err := os.RemoveAll(p); err == nil {
-			totalCleaned += size
+	if wantsDryRun(r, req.DryRun) {
+		mode, ok := normalizeDeleteMode(req.Mode)
+		if !ok {
+			http.Error(w, "Invalid delete mode", http.StatusBadRequest)
+			return
 		}
+		writeDryRun(w, planRemoval("purge", req.Paths, mode))
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CleanResult{
-		Success: true,
-		Message: fmt.Sprintf("Removed %d items", len(req.Paths)),
-		Cleaned: totalCleaned,
+	runJobAndRespond(w, r, JobRequest{Type: "purge", Paths: req.Paths, Mode: req.Mode}, func(result CleanResult) interface{} {
+		return result
 	})
 }
 
+// purgePaths removes paths, or moves them into quarantine when mode is
+// deleteModeQuarantine. Quarantined bytes are reported separately since
+// they are not freed until the quarantine expires.
+func purgePaths(ctx context.Context, paths []string, mode string) CleanResult {
+	var result CleanResult
+	allowed, refused := deletePolicy().Partition(paths)
+	for _, d := range refused {
+		writeLog("Refused to purge %s: %s", d.Path, d.Reason)
+	}
+	result.Refused = refused
+	result.Skipped = refusalMessages(refused)
+
+	removed := 0
+	for _, d := range allowed {
+		p := d.Canonical
+		if ctx.Err() != nil {
+			cancelled := cancelledResult(fmt.Sprintf("Removed %d of %d items before cancel", removed, len(paths)))
+			cancelled.Cleaned = result.Cleaned
+			cancelled.Quarantined = result.Quarantined
+			cancelled.FilesRemoved = removed
+			cancelled.Refused = result.Refused
+			return cancelled
+		}
+		size := getDirSize(p)
+		item, err := removePath(p, size, mode)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", p, err))
+			continue
+		}
+		removed++
+		if item != nil {
+			result.Quarantined += size
+		} else {
+			result.Cleaned += size
+		}
+	}
+
+	// Partial success counts, but not a purge that removed nothing
+	result.Success = removed > 0 || (len(result.Errors) == 0 && len(refused) == 0)
+	result.FilesRemoved = removed
+	if mode == deleteModeQuarantine {
+		result.Message = fmt.Sprintf("Moved %d items to quarantine", removed)
+	} else {
+		result.Message = fmt.Sprintf("Removed %d items", removed)
+	}
+	if len(refused) > 0 {
+		result.Message += fmt.Sprintf(" (%d refused by safety policy)", len(refused))
+	}
+	if len(result.Errors) > 0 {
+		result.Message += fmt.Sprintf(" (%d failed)", len(result.Errors))
+	}
+	return result
+}
+
 func handleInstallScript(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
@@ -1809,6 +2040,12 @@ echo "   Access your dashboard at:"
 echo "   http://$(hostname).local:8081"
 echo "   http://$(ipconfig getifaddr en0 2>/dev/null || echo "localhost"):8081"
 echo ""
+OTHERS=$(./bin/web-go -discover 2>/dev/null | grep -v "^$(hostname -s) " || true)
+if [ -n "$OTHERS" ]; then
+    echo "   Other Mole servers on this network:"
+    echo "$OTHERS" | sed 's/^/   /'
+    echo ""
+fi
 echo "   To stop:  cd $INSTALL_DIR && ./deploy/stop.sh"
 echo "   To start: cd $INSTALL_DIR && ./deploy/start.sh"
 echo ""
@@ -1817,7 +2054,13 @@ echo ""
 	fmt.Fprint(w, installerScript)
 }
 
-func runMoleCommand(args ...string) CleanResult {
+// runMoleCommand runs the mole CLI for a job. Cancelling the job terminates
+// the CLI and everything it spawned.
+func runMoleCommand(j *Job, args ...string) CleanResult {
+	return runMoleCommandContext(j.Context(), j, args...)
+}
+
+func runMoleCommandContext(ctx context.Context, j *Job, args ...string) CleanResult {
 	mole := findMoleScript()
 	if mole == "" {
 		return CleanResult{
@@ -1826,21 +2069,24 @@ func runMoleCommand(args ...string) CleanResult {
 		}
 	}
 
-	cmd := exec.Command(mole, args...)
+	cmd := newCommand(ctx, mole, args...)
 	// Try to set Dir to mole's parent dir if possible
 	cmd.Dir = filepath.Dir(mole)
 
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
 
-	writeLog("Running command: %s %v", mole, args)
-	if err := cmd.Start(); err != nil {
-		errMsg := fmt.Sprintf("Error starting command: %v", err)
-		fmt.Println(errMsg)
-		select {
-		case logBroadcast <- errMsg:
-		default:
+	// Tag messages with the job, or with the command when there is none
+	logf := func(format string, v ...interface{}) {
+		if j != nil {
+			writeJobLog(j, format, v...)
+		} else {
+			writeTaggedLog("", args[0], fmt.Sprintf(format, v...))
 		}
+	}
+	logf("Running command: %s %v", mole, args)
+	if err := cmd.Start(); err != nil {
+		logf("Error starting command: %v", err)
 		return CleanResult{
 			Success: false,
 			Message: err.Error(),
@@ -1848,6 +2094,7 @@ func runMoleCommand(args ...string) CleanResult {
 	}
 
 	var output strings.Builder
+	var outputMu sync.Mutex
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -1856,12 +2103,14 @@ func runMoleCommand(args ...string) CleanResult {
 		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
 			line := scanner.Text()
+			outputMu.Lock()
 			output.WriteString(line + "\n")
-			// Broadcast to SSE
-			select {
-			case logBroadcast <- line:
-			default:
-				// Channel full, drop or handle
+			outputMu.Unlock()
+			// Broadcast to SSE, tagged with the job when there is one
+			if j != nil {
+				j.appendLine(line)
+			} else {
+				logHub.Publish("", args[0], stripANSI(line))
 			}
 		}
 	}
@@ -1872,6 +2121,11 @@ func runMoleCommand(args ...string) CleanResult {
 	err := cmd.Wait()
 	wg.Wait()
 
+	if ctx.Err() != nil {
+		logf("Command cancelled: %s %v", mole, args)
+		return cancelledResult(stripANSI(output.String()))
+	}
+
 	return CleanResult{
 		Success: err == nil,
 		Message: func() string {
@@ -1884,6 +2138,16 @@ func runMoleCommand(args ...string) CleanResult {
 	}
 }
 
+// cancelledResult reports an operation stopped by the user, keeping whatever
+// output was produced before the stop.
+func cancelledResult(output string) CleanResult {
+	return CleanResult{
+		Success: false,
+		Message: "Cancelled",
+		Output:  output,
+	}
+}
+
 // stripANSI removes ANSI escape codes from a string
 var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
 
@@ -1891,39 +2155,22 @@ func stripANSI(s string) string {
 	return ansiRegex.ReplaceAllString(s, "")
 }
 
-func getDirSize(path string) int64 {
-	return getDirSizeWithLimit(path, 3) // Limit depth to 3 levels for speed
-}
+// dirUsageSlots bounds the dirUsage calls handlers run in parallel. Take a
+// slot before starting the goroutine and release it when the call returns.
+var dirUsageSlots = make(chan struct{}, runtime.NumCPU())
 
-func getDirSizeWithLimit(path string, maxDepth int) int64 {
-	var size int64
-	baseDepth := strings.Count(path, string(os.PathSeparator))
-
-	filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil || info == nil {
-			return nil
-		}
-
-		// Calculate current depth relative to base
-		currentDepth := strings.Count(filePath, string(os.PathSeparator)) - baseDepth
-
-		// Skip directories that are too deep
-		if info.IsDir() && currentDepth >= maxDepth {
-			return filepath.SkipDir
-		}
-
-		// Skip slow directories
-		name := info.Name()
-		if info.IsDir() && (name == "node_modules" || name == ".git" || name == "Library" || name == "Caches") {
-			return filepath.SkipDir
-		}
+// dirUsage measures path with the analyzer's scanner. Sizes of folders
+// that take longer than dir_size_timeout, or that have unreadable parts,
+// are flagged estimated.
+func dirUsage(path string) diskscan.Usage {
+	ctx, cancel := context.WithTimeout(context.Background(), currentConfig().DirSizeTimeout.Duration)
+	defer cancel()
+	var scanner diskscan.Scanner
+	return scanner.DirSize(ctx, path)
+}
 
-		if !info.IsDir() {
-			size += info.Size()
-		}
-		return nil
-	})
-	return size
+func getDirSize(path string) int64 {
+	return dirUsage(path).Size
 }
 
 func formatBytes(b int64) string {
@@ -1941,7 +2188,9 @@ func formatBytes(b int64) string {
 
 // Delete files/folders API
 type DeleteRequest struct {
-	Paths []string `json:"paths"`
+	Paths  []string `json:"paths"`
+	Mode   string   `json:"mode,omitempty"` // "delete" (default) or "quarantine"
+	DryRun bool     `json:"dry_run,omitempty"`
 }
 
 type DeleteResult struct {
@@ -1951,29 +2200,12 @@ type DeleteResult struct {
 	SizeHuman    string   `json:"size_human"`
 	Failed       []string `json:"failed,omitempty"`
 	Errors       []string `json:"errors,omitempty"`
-}
 
-func isProtectedPath(path string) bool {
-	protectedPrefixes := []string{
-		"/System",
-		"/Library",
-		"/usr",
-		"/bin",
-		"/sbin",
-		"/private",
-		"/var",
-		"/etc",
-	}
-	for _, prefix := range protectedPrefixes {
-		if strings.HasPrefix(path, prefix) {
-			return true
-		}
-	}
-	// Protect Apple apps in /Applications
-	if strings.HasPrefix(path, "/Applications/") && isProtectedAppPath(path) {
-		return true
-	}
-	return false
+	Quarantined     []quarantine.Item `json:"quarantined,omitempty"`
+	QuarantinedSize int64             `json:"quarantined_size,omitempty"`
+
+	// Paths the safety policy refused, with reasons
+	Refused []pathpolicy.Decision `json:"refused,omitempty"`
 }
 
 func handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
@@ -1992,16 +2224,29 @@ func handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No paths specified", http.StatusBadRequest)
 		return
 	}
+	mode, ok := normalizeDeleteMode(req.Mode)
+	if !ok {
+		http.Error(w, "Invalid delete mode", http.StatusBadRequest)
+		return
+	}
+
+	if wantsDryRun(r, req.DryRun) {
+		writeDryRun(w, planRemoval("delete", req.Paths, mode))
+		return
+	}
 
 	result := DeleteResult{}
 
-	for _, path := range req.Paths {
-		// Safety check: prevent deleting protected paths
-		if isProtectedPath(path) {
-			result.Failed = append(result.Failed, path)
-			result.Errors = append(result.Errors, "Protected system path")
-			continue
-		}
+	allowed, refused := deletePolicy().Partition(req.Paths)
+	for _, d := range refused {
+		writeLog("Refused to delete %s: %s", d.Path, d.Reason)
+		result.Failed = append(result.Failed, d.Path)
+		result.Errors = append(result.Errors, d.Reason)
+	}
+	result.Refused = refused
+
+	for _, d := range allowed {
+		path := d.Canonical
 
 		// Verify path exists
 		info, err := os.Stat(path)
@@ -2019,10 +2264,15 @@ func handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
 			size = info.Size()
 		}
 
-		// Delete the file/folder
-		if err := os.RemoveAll(path); err != nil {
+		// Delete the file/folder, or move it into quarantine
+		item, err := removePath(path, size, mode)
+		if err != nil {
 			result.Failed = append(result.Failed, path)
 			result.Errors = append(result.Errors, err.Error())
+		} else if item != nil {
+			result.DeletedCount++
+			result.Quarantined = append(result.Quarantined, *item)
+			result.QuarantinedSize += size
 		} else {
 			result.DeletedCount++
 			result.DeletedSize += size
@@ -2033,6 +2283,16 @@ func handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
 	result.Success = len(result.Failed) == 0
 	result.SizeHuman = formatBytes(result.DeletedSize)
 
+	recordHistory(HistoryEntry{
+		Type:        "delete",
+		Success:     result.Success,
+		Freed:       result.DeletedSize,
+		Quarantined: result.QuarantinedSize,
+		Files:       result.DeletedCount,
+		Paths:       req.Paths,
+		Message:     fmt.Sprintf("Deleted %d of %d items", result.DeletedCount, len(req.Paths)),
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
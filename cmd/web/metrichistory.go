@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tw93/mole/internal/metrics"
+	"github.com/tw93/mole/internal/ringdb"
+)
+
+const (
+	metricsSampleInterval = time.Second // The finest ring resolution
+	metricsFlushInterval  = 30 * time.Second
+	defaultHistoryRange   = time.Hour
+	maxHistoryRange       = 365 * 24 * time.Hour
+)
+
+// MetricsHistory samples the system status every second into a ring
+// database that keeps 1s samples for an hour, 1m for a day and 1h for a
+// year.
+type MetricsHistory struct {
+	mu   sync.Mutex
+	db   *ringdb.DB // nil when not running
+	last time.Time  // CollectedAt of the last recorded snapshot
+
+	loggedAt time.Time // When a failed Add was last logged
+}
+
+var metricsHistory = &MetricsHistory{}
+
+func metricsHistoryDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "metrics"), nil
+}
+
+// Run samples until stop is closed, unless metrics history is turned off.
+func (h *MetricsHistory) Run(stop <-chan struct{}) {
+	if !*currentConfig().MetricsHistory {
+		return
+	}
+	dir, err := metricsHistoryDir()
+	if err != nil {
+		writeLog("ERROR: Metrics history: %v", err)
+		return
+	}
+	db, err := ringdb.Open(dir, ringdb.DefaultResolutions)
+	if err != nil {
+		writeLog("ERROR: Metrics history: %v", err)
+		return
+	}
+	h.mu.Lock()
+	h.db = db
+	h.mu.Unlock()
+
+	sample := time.NewTicker(metricsSampleInterval)
+	defer sample.Stop()
+	flush := time.NewTicker(metricsFlushInterval)
+	defer flush.Stop()
+	for {
+		select {
+		case <-stop:
+			h.Close()
+			return
+		case <-sample.C:
+			h.record(collectStatus())
+		case <-flush.C:
+			if db := h.database(); db != nil {
+				if err := db.Flush(); err != nil {
+					writeLog("ERROR: Metrics history: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// record adds a snapshot's readings, skipping snapshots already recorded.
+func (h *MetricsHistory) record(status SystemStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil || !status.CollectedAt.After(h.last) {
+		return
+	}
+	h.last = status.CollectedAt
+	var err error
+	for _, m := range metrics.Readings {
+		if v, ok := m.Read(status.MetricsSnapshot); ok {
+			if addErr := h.db.Add(m.Name, status.CollectedAt, v); addErr != nil {
+				err = addErr
+			}
+		}
+	}
+	// Samples arrive every second; log failures once per flush at most
+	if err != nil && time.Since(h.loggedAt) >= metricsFlushInterval {
+		h.loggedAt = time.Now()
+		writeLog("ERROR: Metrics history: %v", err)
+	}
+}
+
+func (h *MetricsHistory) database() *ringdb.DB {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.db
+}
+
+// Close writes pending samples and stops recording.
+func (h *MetricsHistory) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.db == nil {
+		return
+	}
+	if err := h.db.Close(); err != nil {
+		writeLog("ERROR: Metrics history: %v", err)
+	}
+	h.db = nil
+}
+
+// parseHistoryRange parses a range such as "30m", "6h", "7d", "2w" or "1y".
+func parseHistoryRange(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultHistoryRange, nil
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour, 'y': 365 * 24 * time.Hour}
+	var d time.Duration
+	if unit, ok := units[s[len(s)-1]]; ok {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q", s)
+		}
+		d = time.Duration(n) * unit
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if d <= 0 || d > maxHistoryRange {
+		return 0, fmt.Errorf("range must be between 1s and 1y")
+	}
+	return d, nil
+}
+
+// HistoryPoint is one bucket of a metric's history; T is Unix seconds.
+type HistoryPoint struct {
+	T   int64   `json:"t"`
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type MetricHistory struct {
+	Metric string         `json:"metric"`
+	Unit   string         `json:"unit"`
+	Range  string         `json:"range"`
+	Step   int            `json:"step_seconds"` // Bucket width of the resolution answering the query
+	Points []HistoryPoint `json:"points"`
+}
+
+// handleMetricsHistory serves GET /api/metrics/history. Without ?metric= it
+// lists the recorded metrics; with it, it returns the metric's buckets over
+// ?range= (default 1h) at the finest resolution that covers the range.
+func handleMetricsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("metric")
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"metrics": metrics.Readings})
+		return
+	}
+	m, ok := metrics.FindReading(name)
+	if !ok {
+		http.Error(w, "Unknown metric", http.StatusNotFound)
+		return
+	}
+	rangeParam := r.URL.Query().Get("range")
+	span, err := parseHistoryRange(rangeParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	db := metricsHistory.database()
+	if db == nil {
+		http.Error(w, "Metrics history is not being recorded", http.StatusServiceUnavailable)
+		return
+	}
+
+	now := time.Now()
+	points, res, err := db.Query(m.Name, now.Add(-span), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rangeParam == "" {
+		rangeParam = "1h"
+	}
+	resp := MetricHistory{
+		Metric: m.Name,
+		Unit:   m.Unit,
+		Range:  rangeParam,
+		Step:   int(res.Step / time.Second),
+		Points: make([]HistoryPoint, 0, len(points)),
+	}
+	for _, p := range points {
+		resp.Points = append(resp.Points, HistoryPoint{T: p.Time.Unix(), Avg: p.Avg, Min: p.Min, Max: p.Max})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tw93/mole/internal/metrics"
+	"github.com/tw93/mole/internal/ringdb"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"":    time.Hour,
+		"30m": 30 * time.Minute,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"1y":  365 * 24 * time.Hour,
+	} {
+		if got, err := parseHistoryRange(in); err != nil || got != want {
+			t.Errorf("parseHistoryRange(%q) = %v, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"soon", "xd", "-1h", "2y"} {
+		if _, err := parseHistoryRange(in); err == nil {
+			t.Errorf("parseHistoryRange(%q) accepted", in)
+		}
+	}
+}
+
+func useTestMetricsHistory(t *testing.T) *ringdb.DB {
+	t.Helper()
+	db, err := ringdb.Open(t.TempDir(), ringdb.DefaultResolutions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsHistory.mu.Lock()
+	metricsHistory.db, metricsHistory.last = db, time.Time{}
+	metricsHistory.mu.Unlock()
+	t.Cleanup(metricsHistory.Close)
+	return db
+}
+
+func TestMetricsHistoryRecordsAndServes(t *testing.T) {
+	useTestMetricsHistory(t)
+	now := time.Now()
+	status := SystemStatus{MetricsSnapshot: metrics.MetricsSnapshot{
+		CollectedAt: now.Add(-2 * time.Second),
+		Memory:      metrics.MemoryStatus{Total: 100, Used: 40, UsedPercent: 40, Pressure: "warn"},
+		Disks:       []metrics.DiskStatus{{Mount: "/", Total: 1000, Used: 600, UsedPercent: 60}},
+	}}
+	metricsHistory.record(status)
+	metricsHistory.record(status) // Same snapshot again: ignored
+	status.CollectedAt = now.Add(-time.Second)
+	status.Disks[0].Used = 700
+	metricsHistory.record(status)
+
+	rec := httptest.NewRecorder()
+	handleMetricsHistory(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/history?metric=disk_used&range=10m", nil))
+	var got MetricHistory
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if got.Unit != "bytes" || got.Step != 1 || len(got.Points) != 2 || got.Points[1].Avg != 700 {
+		t.Errorf("history = %+v", got)
+	}
+
+	// A day is answered from the minute ring
+	rec = httptest.NewRecorder()
+	handleMetricsHistory(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/history?metric=memory_pressure&range=1d", nil))
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if got.Step != 60 || len(got.Points) == 0 || got.Points[len(got.Points)-1].Max != 1 {
+		t.Errorf("pressure history = %+v", got)
+	}
+
+	// Unavailable readings are not recorded
+	rec = httptest.NewRecorder()
+	handleMetricsHistory(rec, httptest.NewRequest(http.MethodGet, "/api/metrics/history?metric=battery_percent", nil))
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got.Points) != 0 {
+		t.Errorf("battery history = %+v", got)
+	}
+}
+
+func TestHandleMetricsHistoryErrors(t *testing.T) {
+	for url, want := range map[string]int{
+		"/api/metrics/history":                          http.StatusOK,
+		"/api/metrics/history?metric=nope":              http.StatusNotFound,
+		"/api/metrics/history?metric=cpu_usage&range=x": http.StatusBadRequest,
+		"/api/metrics/history?metric=cpu_usage":         http.StatusServiceUnavailable,
+	} {
+		rec := httptest.NewRecorder()
+		handleMetricsHistory(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != want {
+			t.Errorf("%s: got %d, want %d", url, rec.Code, want)
+		}
+	}
+}
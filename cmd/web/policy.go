@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tw93/mole/internal/pathpolicy"
+)
+
+// deletePolicy returns the path-safety policy used by every destructive
+// endpoint. It is built per operation so whitelist edits apply immediately.
+func deletePolicy() *pathpolicy.Policy {
+	p := pathpolicy.Default()
+	p.ProtectedApp = func(path string) (bool, string) {
+		if bundle := enclosingAppBundle(path); bundle != "" && isProtectedAppPath(bundle) {
+			return true, "Apple system application"
+		}
+		return false, ""
+	}
+	return p
+}
+
+// enclosingAppBundle returns the outermost .app bundle containing path, or
+// path itself when it is a bundle.
+func enclosingAppBundle(path string) string {
+	parts := strings.Split(path, string(filepath.Separator))
+	for i, part := range parts {
+		if strings.HasSuffix(part, ".app") {
+			return strings.Join(parts[:i+1], string(filepath.Separator))
+		}
+	}
+	return ""
+}
+
+// refusalMessages formats refused decisions as "path: reason" lines for
+// CleanResult.Skipped and log output.
+func refusalMessages(refused []pathpolicy.Decision) []string {
+	msgs := make([]string, 0, len(refused))
+	for _, d := range refused {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", d.Path, d.Reason))
+	}
+	return msgs
+}
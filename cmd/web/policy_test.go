@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPurgePathsRefusesProtectedPaths(t *testing.T) {
+	home := useTempConfig(t)
+	project := filepath.Join(home, "code", "app", "node_modules")
+	os.MkdirAll(project, 0755)
+	os.WriteFile(filepath.Join(project, "index.js"), []byte("x"), 0644)
+
+	result := purgePaths(context.Background(), []string{"/usr/lib", home, project}, deleteModePermanent)
+	if !result.Success || result.FilesRemoved != 1 || len(result.Refused) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for _, d := range result.Refused {
+		if d.Reason == "" {
+			t.Errorf("refusal without reason: %+v", d)
+		}
+	}
+	if _, err := os.Stat(project); !os.IsNotExist(err) {
+		t.Fatalf("expected node_modules to be removed, err=%v", err)
+	}
+}
+
+func TestPurgePathsFailsWhenNothingRemoved(t *testing.T) {
+	home := useTempConfig(t)
+
+	result := purgePaths(context.Background(), []string{"/usr/lib", home}, deleteModePermanent)
+	if result.Success || result.FilesRemoved != 0 || len(result.Refused) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	result = purgePaths(context.Background(), nil, deleteModePermanent)
+	if !result.Success {
+		t.Fatalf("empty purge failed: %+v", result)
+	}
+}
+
+func TestEnclosingAppBundle(t *testing.T) {
+	cases := map[string]string{
+		"/Applications/Safari.app":                     "/Applications/Safari.app",
+		"/Applications/Safari.app/Contents/Info.plist": "/Applications/Safari.app",
+		"/Users/me/Downloads/file.zip":                 "",
+	}
+	for in, want := range cases {
+		if got := enclosingAppBundle(in); got != want {
+			t.Errorf("enclosingAppBundle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// processKillGrace is how long a cancelled command gets to exit after SIGTERM
+// before the whole process group is killed.
+var processKillGrace = 5 * time.Second
+
+// newCommand builds a command that runs in its own process group so that
+// cancelling ctx stops the shell script and everything it spawned.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = processKillGrace * 2
+	return cmd
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	pgid := cmd.Process.Pid
+	err := syscall.Kill(-pgid, syscall.SIGTERM)
+	// The leader usually exits on SIGTERM at once while children that
+	// ignore it carry on, so the group is killed even after Wait returned.
+	// Its ID cannot be reused while any member is alive; ESRCH means none is.
+	time.AfterFunc(processKillGrace, func() {
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+	return err
+}
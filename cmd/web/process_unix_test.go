@@ -0,0 +1,123 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewCommandKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// The child sleep would keep the pipe open if only the shell were killed.
+	cmd := newCommand(ctx, "sh", "-c", "echo started; sleep 30 & wait")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	buf := make([]byte, 8)
+	if _, err := stdout.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	start := time.Now()
+	cancel()
+	cmd.Wait()
+	if elapsed := time.Since(start); elapsed > processKillGrace {
+		t.Fatalf("process group took %v to stop", elapsed)
+	}
+}
+
+func TestNewCommandKillsChildrenIgnoringSIGTERM(t *testing.T) {
+	grace := processKillGrace
+	processKillGrace = 200 * time.Millisecond
+	t.Cleanup(func() { processKillGrace = grace })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// The shell exits on SIGTERM straight away; its child does not
+	cmd := newCommand(ctx, "sh", "-c", `sh -c 'trap "" TERM; echo $$; exec sleep 60' & wait`)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("child pid %q: %v", line, err)
+	}
+	t.Cleanup(func() { syscall.Kill(child, syscall.SIGKILL) })
+
+	cancel()
+	cmd.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(child) {
+		if time.Now().After(deadline) {
+			t.Fatal("child ignoring SIGTERM survived the cancel")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processAlive reports whether pid is running; a zombie waiting to be
+// reaped by init does not count.
+func processAlive(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	state := strings.TrimSpace(string(out))
+	return err == nil && state != "" && !strings.HasPrefix(state, "Z")
+}
+
+func TestMoleCommandLogsAreTaggedWithJob(t *testing.T) {
+	useTempConfig(t)
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "mole"), []byte("#!/bin/sh\necho ok\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	m := NewJobManager()
+
+	clean, err := m.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		return runMoleCommand(j, "clean")
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForJob(t, clean)
+	uninstall, err := m.Submit(JobRequest{Type: "uninstall"}, func(j *Job) CleanResult {
+		return uninstallApps(j, []string{"/usr/lib"})
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	waitForJob(t, uninstall)
+
+	for job, want := range map[*Job]string{clean: "Running command: ", uninstall: "Refused to uninstall /usr/lib"} {
+		sub, replay := logHub.Subscribe(job.ID(), 0)
+		logHub.Unsubscribe(sub)
+		found := false
+		for _, line := range replay {
+			if line.Job == job.ID() && strings.HasPrefix(line.Text, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("job %s: no tagged %q line in %+v", job.ID(), want, replay)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// scanBuckets are the upper bounds, in seconds, of the scan duration
+// histogram. Scans range from a quick directory listing to walking a
+// whole volume.
+var scanBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(scanBuckets))
+	}
+	for i, le := range scanBuckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// labelKey joins label values into a map key.
+type labelKey [2]string
+
+// MoleStats counts what Mole did since the server started, for /metrics.
+type MoleStats struct {
+	mu             sync.Mutex
+	cleaned        map[string]int64   // Bytes freed, by operation
+	quarantined    map[string]int64   // Bytes moved to quarantine, by operation
+	jobs           map[labelKey]int64 // Finished jobs, by type and state
+	deleteFailures map[string]int64   // Failed removals, by delete mode
+	scans          map[string]*histogram
+}
+
+func NewMoleStats() *MoleStats {
+	return &MoleStats{
+		cleaned:        make(map[string]int64),
+		quarantined:    make(map[string]int64),
+		jobs:           make(map[labelKey]int64),
+		deleteFailures: make(map[string]int64),
+		scans:          make(map[string]*histogram),
+	}
+}
+
+var stats = NewMoleStats()
+
+// RecordFreed adds the bytes an operation freed or quarantined.
+func (s *MoleStats) RecordFreed(operation string, freed, quarantined int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if freed > 0 {
+		s.cleaned[operation] += freed
+	}
+	if quarantined > 0 {
+		s.quarantined[operation] += quarantined
+	}
+}
+
+// RecordJob counts a finished job.
+func (s *MoleStats) RecordJob(jobType string, state JobState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[labelKey{jobType, string(state)}]++
+}
+
+// RecordDeleteFailure counts a path that could not be removed.
+func (s *MoleStats) RecordDeleteFailure(mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteFailures[mode]++
+}
+
+// RecordScan records how long a scan took.
+func (s *MoleStats) RecordScan(scan string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.scans[scan]
+	if h == nil {
+		h = &histogram{}
+		s.scans[scan] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// timedScan wraps a scan handler, recording its duration as scan.
+func timedScan(scan string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		h(w, r)
+		stats.RecordScan(scan, time.Since(start))
+	}
+}
+
+// promWriter writes the Prometheus text exposition format (version 0.0.4).
+type promWriter struct {
+	w    *bufio.Writer
+	last string
+}
+
+// family starts a metric family; its samples must follow.
+func (p *promWriter) family(name, typ, help string) {
+	if p.last == name {
+		return
+	}
+	p.last = name
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one value; labels are name/value pairs.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			fmt.Fprintf(p.w, `%s="%s"`, labels[i], escapeLabel(labels[i+1]))
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(formatPromValue(value))
+	p.w.WriteByte('\n')
+}
+
+// gauge writes a single-sample family.
+func (p *promWriter) gauge(name, help string, value float64, labels ...string) {
+	p.family(name, "gauge", help)
+	p.sample(name, value, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortedKeys returns m's keys in order, so output is stable between scrapes.
+func sortedKeys[K interface{ ~string }, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// writeTo writes the Mole counters.
+func (s *MoleStats) writeTo(p *promWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.family("mole_cleaned_bytes_total", "counter", "Bytes freed by Mole operations since the server started.")
+	for _, op := range sortedKeys(s.cleaned) {
+		p.sample("mole_cleaned_bytes_total", float64(s.cleaned[op]), "operation", op)
+	}
+	p.family("mole_quarantined_bytes_total", "counter", "Bytes moved into quarantine since the server started.")
+	for _, op := range sortedKeys(s.quarantined) {
+		p.sample("mole_quarantined_bytes_total", float64(s.quarantined[op]), "operation", op)
+	}
+
+	p.family("mole_jobs_total", "counter", "Finished jobs by type and final state.")
+	keys := make([]labelKey, 0, len(s.jobs))
+	for k := range s.jobs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		p.sample("mole_jobs_total", float64(s.jobs[k]), "type", k[0], "state", k[1])
+	}
+
+	p.family("mole_delete_failures_total", "counter", "Paths that could not be removed or quarantined.")
+	for _, mode := range sortedKeys(s.deleteFailures) {
+		p.sample("mole_delete_failures_total", float64(s.deleteFailures[mode]), "mode", mode)
+	}
+
+	p.family("mole_scan_duration_seconds", "histogram", "Duration of disk scans.")
+	for _, scan := range sortedKeys(s.scans) {
+		h := s.scans[scan]
+		var cumulative uint64
+		for i, le := range scanBuckets {
+			cumulative += h.counts[i]
+			p.sample("mole_scan_duration_seconds_bucket", float64(cumulative), "scan", scan, "le", formatPromValue(le))
+		}
+		p.sample("mole_scan_duration_seconds_bucket", float64(h.count), "scan", scan, "le", "+Inf")
+		p.sample("mole_scan_duration_seconds_sum", h.sum, "scan", scan)
+		p.sample("mole_scan_duration_seconds_count", float64(h.count), "scan", scan)
+	}
+}
+
+// writeSystemMetrics writes the collector's snapshot.
+func writeSystemMetrics(p *promWriter) {
+	snap, _ := currentSnapshot() // Partial snapshots are still worth exporting
+
+	p.gauge("mole_health_score", "System health score from 0 to 100, as shown by mo status.", float64(snap.HealthScore))
+	p.gauge("mole_processes", "Number of processes.", float64(snap.Procs))
+
+	cpu := snap.CPU
+	p.gauge("mole_cpu_usage_percent", "CPU usage across all cores.", cpu.Usage)
+	p.family("mole_cpu_core_usage_percent", "gauge", "CPU usage per logical core.")
+	for i, u := range cpu.PerCore {
+		p.sample("mole_cpu_core_usage_percent", u, "core", strconv.Itoa(i))
+	}
+	p.family("mole_load_average", "gauge", "System load average.")
+	p.sample("mole_load_average", cpu.Load1, "period", "1m")
+	p.sample("mole_load_average", cpu.Load5, "period", "5m")
+	p.sample("mole_load_average", cpu.Load15, "period", "15m")
+	p.gauge("mole_cpu_logical_cores", "Logical CPU cores.", float64(cpu.LogicalCPU))
+
+	p.family("mole_gpu_usage_percent", "gauge", "GPU usage.")
+	for _, g := range snap.GPU {
+		if g.Usage >= 0 {
+			p.sample("mole_gpu_usage_percent", g.Usage, "gpu", g.Name)
+		}
+	}
+
+	m := snap.Memory
+	p.gauge("mole_memory_total_bytes", "Physical memory.", float64(m.Total))
+	p.gauge("mole_memory_used_bytes", "Used physical memory.", float64(m.Used))
+	p.gauge("mole_memory_used_percent", "Used physical memory as a percentage.", m.UsedPercent)
+	p.gauge("mole_swap_total_bytes", "Swap space.", float64(m.SwapTotal))
+	p.gauge("mole_swap_used_bytes", "Used swap space.", float64(m.SwapUsed))
+	if m.Pressure != "" {
+		p.family("mole_memory_pressure", "gauge", "macOS memory pressure level; 1 for the current level.")
+		for _, level := range []string{"normal", "warn", "critical"} {
+			p.sample("mole_memory_pressure", boolValue(m.Pressure == level), "level", level)
+		}
+	}
+
+	p.family("mole_disk_total_bytes", "gauge", "Size of mounted disks.")
+	for _, d := range snap.Disks {
+		p.sample("mole_disk_total_bytes", float64(d.Total), "mount", d.Mount, "device", d.Device, "external", strconv.FormatBool(d.External))
+	}
+	p.family("mole_disk_used_bytes", "gauge", "Used space on mounted disks.")
+	for _, d := range snap.Disks {
+		p.sample("mole_disk_used_bytes", float64(d.Used), "mount", d.Mount, "device", d.Device, "external", strconv.FormatBool(d.External))
+	}
+	p.gauge("mole_disk_read_bytes_per_second", "Disk read rate since the previous collection.", snap.DiskIO.ReadRate*1024*1024)
+	p.gauge("mole_disk_write_bytes_per_second", "Disk write rate since the previous collection.", snap.DiskIO.WriteRate*1024*1024)
+
+	p.family("mole_network_receive_bytes_per_second", "gauge", "Network receive rate since the previous collection.")
+	for _, n := range snap.Network {
+		p.sample("mole_network_receive_bytes_per_second", n.RxRateMBs*1024*1024, "interface", n.Name)
+	}
+	p.family("mole_network_transmit_bytes_per_second", "gauge", "Network transmit rate since the previous collection.")
+	for _, n := range snap.Network {
+		p.sample("mole_network_transmit_bytes_per_second", n.TxRateMBs*1024*1024, "interface", n.Name)
+	}
+	if counters, err := net.IOCounters(false); err == nil && len(counters) > 0 {
+		p.family("mole_network_receive_bytes_total", "counter", "Bytes received on all interfaces since boot.")
+		p.sample("mole_network_receive_bytes_total", float64(counters[0].BytesRecv))
+		p.family("mole_network_transmit_bytes_total", "counter", "Bytes sent on all interfaces since boot.")
+		p.sample("mole_network_transmit_bytes_total", float64(counters[0].BytesSent))
+	}
+
+	p.family("mole_battery_percent", "gauge", "Battery charge.")
+	for i, b := range snap.Batteries {
+		p.sample("mole_battery_percent", b.Percent, "battery", strconv.Itoa(i))
+	}
+	p.family("mole_battery_charging", "gauge", "1 while the battery is charging.")
+	for i, b := range snap.Batteries {
+		p.sample("mole_battery_charging", boolValue(strings.EqualFold(b.Status, "charging")), "battery", strconv.Itoa(i))
+	}
+	p.family("mole_battery_cycles", "gauge", "Battery charge cycle count.")
+	for i, b := range snap.Batteries {
+		p.sample("mole_battery_cycles", float64(b.CycleCount), "battery", strconv.Itoa(i))
+	}
+
+	t := snap.Thermal
+	p.family("mole_temperature_celsius", "gauge", "Temperatures reported by the system.")
+	if t.CPUTemp > 0 {
+		p.sample("mole_temperature_celsius", t.CPUTemp, "sensor", "cpu")
+	}
+	if t.GPUTemp > 0 {
+		p.sample("mole_temperature_celsius", t.GPUTemp, "sensor", "gpu")
+	}
+	for _, s := range snap.Sensors {
+		if s.Unit == "°C" {
+			p.sample("mole_temperature_celsius", s.Value, "sensor", s.Label)
+		}
+	}
+	if t.FanCount > 0 {
+		p.gauge("mole_fan_speed_rpm", "Fan speed.", float64(t.FanSpeed))
+	}
+	if t.SystemPower > 0 {
+		p.gauge("mole_system_power_watts", "System power consumption.", t.SystemPower)
+	}
+}
+
+// handleMetrics serves GET /metrics in the Prometheus text format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
+
+func writeMetrics(w io.Writer) {
+	p := &promWriter{w: bufio.NewWriter(w)}
+	defer p.w.Flush()
+
+	p.gauge("mole_build_info", "Mole version; always 1.", 1, "version", getCurrentVersion())
+	writeSystemMetrics(p)
+
+	p.gauge("mole_jobs_pending", "Jobs queued or running.", float64(len(jobs.Pending())))
+	p.gauge("mole_alerts_firing", "Alert rules currently firing.", float64(len(alertManager.engine.Active())))
+	stats.writeTo(p)
+}
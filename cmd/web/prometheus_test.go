@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func statsOutput(s *MoleStats) string {
+	var b strings.Builder
+	p := &promWriter{w: bufio.NewWriter(&b)}
+	s.writeTo(p)
+	p.w.Flush()
+	return b.String()
+}
+
+func TestMoleStatsCounters(t *testing.T) {
+	s := NewMoleStats()
+	s.RecordFreed("clean", 1000, 0)
+	s.RecordFreed("clean", 500, 0)
+	s.RecordFreed("purge", 0, 2048)
+	s.RecordJob("clean", JobSucceeded)
+	s.RecordJob("clean", JobSucceeded)
+	s.RecordJob("purge", JobFailed)
+	s.RecordDeleteFailure(deleteModeQuarantine)
+
+	out := statsOutput(s)
+	for _, want := range []string{
+		"# TYPE mole_cleaned_bytes_total counter\n",
+		`mole_cleaned_bytes_total{operation="clean"} 1500` + "\n",
+		`mole_quarantined_bytes_total{operation="purge"} 2048` + "\n",
+		`mole_jobs_total{type="clean",state="succeeded"} 2` + "\n",
+		`mole_jobs_total{type="purge",state="failed"} 1` + "\n",
+		`mole_delete_failures_total{mode="quarantine"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `mole_cleaned_bytes_total{operation="purge"}`) {
+		t.Error("zero bytes freed should not create a series")
+	}
+}
+
+func TestScanHistogramIsCumulative(t *testing.T) {
+	s := NewMoleStats()
+	s.RecordScan("analyze", 300*time.Millisecond)
+	s.RecordScan("analyze", 2*time.Second)
+	s.RecordScan("analyze", time.Hour)
+
+	out := statsOutput(s)
+	for _, want := range []string{
+		"# TYPE mole_scan_duration_seconds histogram\n",
+		`mole_scan_duration_seconds_bucket{scan="analyze",le="0.1"} 0` + "\n",
+		`mole_scan_duration_seconds_bucket{scan="analyze",le="0.5"} 1` + "\n",
+		`mole_scan_duration_seconds_bucket{scan="analyze",le="2.5"} 2` + "\n",
+		`mole_scan_duration_seconds_bucket{scan="analyze",le="600"} 2` + "\n",
+		`mole_scan_duration_seconds_bucket{scan="analyze",le="+Inf"} 3` + "\n",
+		`mole_scan_duration_seconds_count{scan="analyze"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel = %s", got)
+	}
+}
+
+func TestWriteMetricsIncludesSystemAndStats(t *testing.T) {
+	var b strings.Builder
+	writeMetrics(&b)
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE mole_health_score gauge\n",
+		"# TYPE mole_jobs_total counter\n",
+		"mole_build_info{version=",
+		"mole_jobs_pending ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	// Every family is declared once
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			if seen[line] {
+				t.Errorf("duplicate %s", line)
+			}
+			seen[line] = true
+		}
+	}
+}
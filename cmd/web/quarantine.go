@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tw93/mole/internal/quarantine"
+)
+
+// Delete modes accepted by /api/files and /api/purge.
+const (
+	deleteModePermanent  = "delete"
+	deleteModeQuarantine = "quarantine"
+)
+
+const quarantineExpiryInterval = time.Hour
+
+// normalizeDeleteMode maps request values onto a delete mode. "trash" is
+// accepted as an alias for quarantine.
+func normalizeDeleteMode(mode string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", deleteModePermanent:
+		return deleteModePermanent, true
+	case deleteModeQuarantine, "trash":
+		return deleteModeQuarantine, true
+	default:
+		return "", false
+	}
+}
+
+// openQuarantine opens the shared quarantine store. It is resolved per call
+// so changes to the environment (and tests) take effect immediately.
+func openQuarantine() (*quarantine.Store, error) {
+	return quarantine.Default()
+}
+
+// removePath deletes path permanently or moves it into quarantine. The
+// returned item is nil for permanent deletes.
+func removePath(path string, size int64, mode string) (*quarantine.Item, error) {
+	if mode != deleteModeQuarantine {
+		if err := os.RemoveAll(path); err != nil {
+			stats.RecordDeleteFailure(deleteModePermanent)
+			return nil, err
+		}
+		return nil, nil
+	}
+	store, err := openQuarantine()
+	if err == nil {
+		var item quarantine.Item
+		if item, err = store.Move(path, size, "web"); err == nil {
+			writeLog("Quarantined: %s (%s)", path, formatBytes(size))
+			return &item, nil
+		}
+	}
+	stats.RecordDeleteFailure(deleteModeQuarantine)
+	return nil, err
+}
+
+// runQuarantineExpiry permanently removes expired quarantine items, now and
+// then every quarantineExpiryInterval, until stop is closed.
+func runQuarantineExpiry(stop <-chan struct{}) {
+	expire := func() {
+		store, err := openQuarantine()
+		if err != nil {
+			return
+		}
+		expired, err := store.Expire(time.Now())
+		if err != nil {
+			writeLog("ERROR: Quarantine expiry: %v", err)
+		}
+		for _, item := range expired {
+			writeLog("Quarantine expired: %s (%s)", item.OriginalPath, formatBytes(item.Size))
+		}
+	}
+
+	expire()
+	ticker := time.NewTicker(quarantineExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			expire()
+		}
+	}
+}
+
+type QuarantineResponse struct {
+	Items         []quarantine.Item `json:"items"`
+	TotalSize     int64             `json:"total_size"`
+	SizeHuman     string            `json:"size_human"`
+	RetentionDays float64           `json:"retention_days"`
+}
+
+// handleQuarantine serves GET /api/quarantine.
+func handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	store, err := openQuarantine()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items, err := store.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := QuarantineResponse{
+		Items:         items,
+		RetentionDays: store.Retention().Hours() / 24,
+	}
+	if resp.Items == nil {
+		resp.Items = []quarantine.Item{}
+	}
+	for _, item := range items {
+		resp.TotalSize += item.Size
+	}
+	resp.SizeHuman = formatBytes(resp.TotalSize)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleQuarantineItem serves POST /api/quarantine/{id}/restore and
+// DELETE /api/quarantine/{id} (permanent delete).
+func handleQuarantineItem(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/quarantine/"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	store, err := openQuarantine()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var item quarantine.Item
+	switch {
+	case action == "restore" && r.Method == http.MethodPost:
+		item, err = store.Restore(id)
+		if err == nil {
+			writeLog("Restored from quarantine: %s", item.OriginalPath)
+		}
+	case action == "" && r.Method == http.MethodDelete:
+		item, err = store.Remove(id)
+		if err == nil {
+			writeLog("Permanently deleted from quarantine: %s (%s)", item.OriginalPath, formatBytes(item.Size))
+			recordHistory(HistoryEntry{
+				Type:    "delete",
+				Success: true,
+				Freed:   item.Size,
+				Files:   1,
+				Paths:   []string{item.OriginalPath},
+				Message: "Deleted from quarantine",
+			})
+		}
+	case action != "" && action != "restore":
+		http.NotFound(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, quarantine.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, quarantine.ErrRestoreConflict):
+		http.Error(w, err.Error()+": "+item.OriginalPath, http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeleteFilesQuarantineAndRestore(t *testing.T) {
+	home := useTempConfig(t)
+	target := filepath.Join(home, "Downloads", "big.iso")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	if err := os.WriteFile(target, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	body := `{"paths":["` + target + `"],"mode":"trash"}`
+	rec := httptest.NewRecorder()
+	handleDeleteFiles(rec, httptest.NewRequest(http.MethodPost, "/api/files", strings.NewReader(body)))
+
+	var result DeleteResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(result.Quarantined) != 1 || result.DeletedSize != 0 || result.QuarantinedSize != 10 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("expected file to be moved, err=%v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	handleQuarantine(rec, httptest.NewRequest(http.MethodGet, "/api/quarantine", nil))
+	var list QuarantineResponse
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Items) != 1 || list.TotalSize != 10 {
+		t.Fatalf("unexpected quarantine listing: %+v", list)
+	}
+
+	id := list.Items[0].ID
+	rec = httptest.NewRecorder()
+	handleQuarantineItem(rec, httptest.NewRequest(http.MethodPost, "/api/quarantine/"+id+"/restore", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "0123456789" {
+		t.Fatalf("restored content = %q, %v", data, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handleQuarantineItem(rec, httptest.NewRequest(http.MethodPost, "/api/quarantine/"+id+"/restore", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("second restore status = %d, want 404", rec.Code)
+	}
+}
+
+func TestNormalizeDeleteMode(t *testing.T) {
+	for in, want := range map[string]string{"": "delete", "Trash": "quarantine", "quarantine": "quarantine"} {
+		if got, ok := normalizeDeleteMode(in); !ok || got != want {
+			t.Errorf("normalizeDeleteMode(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := normalizeDeleteMode("shred"); ok {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
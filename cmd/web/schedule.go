@@ -0,0 +1,556 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const (
+	schedulerInterval        = 30 * time.Second
+	defaultThresholdCooldown = 6 * time.Hour // Minimum gap between threshold-triggered runs
+)
+
+// ScheduleAction is what a schedule runs. Type is a job type: "clean" (with an
+// optional mole clean category such as "dev" or "trash"), "purge" or
+// "optimize".
+type ScheduleAction struct {
+	Type     string `json:"type"`
+	Category string `json:"category,omitempty"`
+
+	// Purge options: scan Root for Targets (default: all purge targets) last
+	// modified more than OlderThanDays ago.
+	Root          string   `json:"root,omitempty"`
+	Targets       []string `json:"targets,omitempty"`
+	OlderThanDays int      `json:"older_than_days,omitempty"`
+}
+
+// ScheduleTrigger fires on a cron expression, when disk usage crosses a
+// threshold, or both.
+type ScheduleTrigger struct {
+	Cron string `json:"cron,omitempty"`
+
+	DiskPercent float64 `json:"disk_percent,omitempty"`
+	DiskPath    string  `json:"disk_path,omitempty"` // Defaults to "/"
+	// CooldownMinutes stops a threshold trigger re-firing while the disk
+	// stays full. Defaults to six hours.
+	CooldownMinutes int `json:"cooldown_minutes,omitempty"`
+}
+
+type Schedule struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Enabled bool            `json:"enabled"`
+	Action  ScheduleAction  `json:"action"`
+	Trigger ScheduleTrigger `json:"trigger"`
+
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastJobID  string     `json:"last_job_id,omitempty"`
+	LastResult string     `json:"last_result,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+// validate checks the schedule and normalises defaults.
+func (s *Schedule) validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		s.Name = s.Action.Type
+	}
+
+	switch s.Action.Type {
+	case "clean", "optimize":
+	case "purge":
+		if s.Action.Root == "" {
+			return fmt.Errorf("purge schedules need a root directory")
+		}
+		if s.Action.OlderThanDays < 0 {
+			return fmt.Errorf("older_than_days must not be negative")
+		}
+	default:
+		return fmt.Errorf("unsupported schedule action: %q", s.Action.Type)
+	}
+
+	if s.Trigger.Cron == "" && s.Trigger.DiskPercent == 0 {
+		return fmt.Errorf("schedule needs a cron expression or a disk threshold")
+	}
+	if s.Trigger.Cron != "" {
+		if _, err := parseCron(s.Trigger.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression: %w", err)
+		}
+	}
+	if s.Trigger.DiskPercent < 0 || s.Trigger.DiskPercent >= 100 {
+		return fmt.Errorf("disk_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+func (s *Schedule) cooldown() time.Duration {
+	if s.Trigger.CooldownMinutes > 0 {
+		return time.Duration(s.Trigger.CooldownMinutes) * time.Minute
+	}
+	return defaultThresholdCooldown
+}
+
+// updateNextRun recomputes the next cron fire time after t.
+func (s *Schedule) updateNextRun(t time.Time) {
+	s.NextRun = nil
+	if s.Trigger.Cron == "" {
+		return
+	}
+	spec, err := parseCron(s.Trigger.Cron)
+	if err != nil {
+		return
+	}
+	if next := spec.Next(t); !next.IsZero() {
+		s.NextRun = &next
+	}
+}
+
+// Scheduler runs schedules through the job manager so scheduled runs queue
+// behind manual ones and land in history like any other run.
+type Scheduler struct {
+	mu        sync.Mutex
+	path      string
+	schedules []*Schedule
+	diskUsage func(path string) (float64, error)
+}
+
+func NewScheduler(path string) *Scheduler {
+	return &Scheduler{
+		path: path,
+		diskUsage: func(path string) (float64, error) {
+			usage, err := disk.Usage(path)
+			if err != nil {
+				return 0, err
+			}
+			return usage.UsedPercent, nil
+		},
+	}
+}
+
+var scheduler = NewScheduler("")
+
+func (s *Scheduler) filePath() (string, error) {
+	if s.path != "" {
+		return s.path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "schedules.json"), nil
+}
+
+// Load reads schedules from disk. A missing file means no schedules.
+func (s *Scheduler) Load() error {
+	path, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var schedules []*Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	now := time.Now()
+	for _, sched := range schedules {
+		sched.updateNextRun(now)
+	}
+	s.mu.Lock()
+	s.schedules = schedules
+	s.mu.Unlock()
+	return nil
+}
+
+// saveLocked writes schedules atomically so a crash never leaves a truncated
+// file behind.
+func (s *Scheduler) saveLocked() error {
+	path, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	schedules := s.schedules
+	if schedules == nil {
+		schedules = []*Schedule{}
+	}
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		list = append(list, withJobState(*sched))
+	}
+	return list
+}
+
+func (s *Scheduler) Get(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sched := range s.schedules {
+		if sched.ID == id {
+			return withJobState(*sched), true
+		}
+	}
+	return Schedule{}, false
+}
+
+// withJobState reports the live state of the schedule's last job while the
+// job manager still remembers it.
+func withJobState(sched Schedule) Schedule {
+	if sched.LastJobID == "" {
+		return sched
+	}
+	if job := jobs.Get(sched.LastJobID); job != nil {
+		sched.LastResult = string(job.Info(false).State)
+	}
+	return sched
+}
+
+func (s *Scheduler) Create(sched Schedule) (Schedule, error) {
+	if err := sched.validate(); err != nil {
+		return Schedule{}, err
+	}
+	sched.ID = newJobID()
+	sched.LastRun, sched.LastJobID, sched.LastResult = nil, "", ""
+	sched.updateNextRun(time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules = append(s.schedules, &sched)
+	if err := s.saveLocked(); err != nil {
+		s.schedules = s.schedules[:len(s.schedules)-1]
+		return Schedule{}, err
+	}
+	writeLog("Schedule created: %s (%s)", sched.Name, sched.ID)
+	return sched, nil
+}
+
+// Update replaces a schedule's definition, keeping its run state.
+func (s *Scheduler) Update(id string, sched Schedule) (Schedule, error) {
+	if err := sched.validate(); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.schedules {
+		if existing.ID != id {
+			continue
+		}
+		sched.ID = id
+		sched.LastRun, sched.LastJobID, sched.LastResult = existing.LastRun, existing.LastJobID, existing.LastResult
+		sched.updateNextRun(time.Now())
+		s.schedules[i] = &sched
+		if err := s.saveLocked(); err != nil {
+			s.schedules[i] = existing
+			return Schedule{}, err
+		}
+		writeLog("Schedule updated: %s (%s)", sched.Name, sched.ID)
+		return sched, nil
+	}
+	return Schedule{}, fmt.Errorf("schedule not found")
+}
+
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sched := range s.schedules {
+		if sched.ID != id {
+			continue
+		}
+		s.schedules = append(s.schedules[:i], s.schedules[i+1:]...)
+		writeLog("Schedule deleted: %s (%s)", sched.Name, sched.ID)
+		return s.saveLocked()
+	}
+	return fmt.Errorf("schedule not found")
+}
+
+// Start checks schedules every schedulerInterval until stop is closed.
+func (s *Scheduler) Start(stop <-chan struct{}) {
+	if err := s.Load(); err != nil {
+		writeLog("ERROR: Failed to load schedules: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+// tick starts every schedule that is due at now.
+func (s *Scheduler) tick(now time.Time) {
+	var due []Schedule
+	s.mu.Lock()
+	for _, sched := range s.schedules {
+		if !sched.Enabled || s.runningLocked(sched) {
+			continue
+		}
+		if reason := s.dueReason(sched, now); reason != "" {
+			writeLog("Schedule %s due: %s", sched.Name, reason)
+			// Mark the run straight away so a slow purge scan is not started
+			// again on the next tick.
+			started := now
+			sched.LastRun = &started
+			sched.LastResult = "starting"
+			sched.updateNextRun(now)
+			due = append(due, *sched)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sched := range due {
+		go s.run(sched, now)
+	}
+}
+
+// runningLocked reports whether the schedule's previous job is still queued
+// or running, so a slow run is never stacked on top of itself.
+func (s *Scheduler) runningLocked(sched *Schedule) bool {
+	if sched.LastJobID == "" {
+		return false
+	}
+	job := jobs.Get(sched.LastJobID)
+	return job != nil && !isJobFinished(job)
+}
+
+func (s *Scheduler) dueReason(sched *Schedule, now time.Time) string {
+	if sched.NextRun != nil && !now.Before(*sched.NextRun) {
+		return "cron " + sched.Trigger.Cron
+	}
+	if sched.Trigger.DiskPercent > 0 {
+		if sched.LastRun != nil && now.Sub(*sched.LastRun) < sched.cooldown() {
+			return ""
+		}
+		diskPath := sched.Trigger.DiskPath
+		if diskPath == "" {
+			diskPath = "/"
+		}
+		used, err := s.diskUsage(diskPath)
+		if err == nil && used >= sched.Trigger.DiskPercent {
+			return fmt.Sprintf("disk %s at %.1f%% (threshold %.0f%%)", diskPath, used, sched.Trigger.DiskPercent)
+		}
+	}
+	return ""
+}
+
+// RunNow starts a schedule immediately, regardless of its trigger.
+func (s *Scheduler) RunNow(id string) (*Job, error) {
+	sched, ok := s.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("schedule not found")
+	}
+	return s.run(sched, time.Now())
+}
+
+func (s *Scheduler) run(sched Schedule, now time.Time) (*Job, error) {
+	req, err := scheduleJobRequest(sched.Action)
+	var job *Job
+	if err == nil {
+		var run jobFunc
+		if run, err = buildJob(req); err == nil {
+			job, err = jobs.Submit(req, run)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.schedules {
+		if existing.ID != sched.ID {
+			continue
+		}
+		existing.LastRun = &now
+		if err != nil {
+			existing.LastJobID = ""
+			existing.LastResult = err.Error()
+		} else {
+			existing.LastJobID = job.ID()
+			existing.LastResult = "queued"
+		}
+		existing.updateNextRun(now)
+		if saveErr := s.saveLocked(); saveErr != nil {
+			writeLog("ERROR: Failed to save schedules: %v", saveErr)
+		}
+	}
+	if err != nil {
+		writeLog("ERROR: Schedule %s failed to start: %v", sched.Name, err)
+		if _, nothingToDo := err.(errNothingToPurge); nothingToDo {
+			return nil, err
+		}
+		recordHistory(HistoryEntry{Type: sched.Action.Type, Trigger: "schedule", Message: err.Error()})
+	}
+	return job, err
+}
+
+// errNothingToPurge means a purge schedule found no matching directories;
+// it is reported on the schedule but is not a failed run.
+type errNothingToPurge struct{ root string }
+
+func (e errNothingToPurge) Error() string {
+	return fmt.Sprintf("nothing to purge under %s", e.root)
+}
+
+// scheduleJobRequest turns a schedule action into a job request. Purge
+// schedules resolve their paths here via scanForPurge so the job, and its
+// history entry, list exactly what was removed. Whitelisted items are left
+// out rather than refused, so they don't fail every run.
+func scheduleJobRequest(action ScheduleAction) (JobRequest, error) {
+	req := JobRequest{Type: action.Type, Category: action.Category, Trigger: "schedule"}
+	if action.Type != "purge" {
+		return req, nil
+	}
+
+	root := expandHome(action.Root)
+	cutoff := time.Now().AddDate(0, 0, -action.OlderThanDays)
+	for _, item := range scanForPurge(root) {
+		if item.Whitelisted {
+			continue
+		}
+		if len(action.Targets) > 0 && !containsString(action.Targets, item.Type) {
+			continue
+		}
+		if action.OlderThanDays > 0 && item.ModTime.After(cutoff) {
+			continue
+		}
+		req.Paths = append(req.Paths, item.Path)
+	}
+	if len(req.Paths) == 0 {
+		return req, errNothingToPurge{root: root}
+	}
+	return req, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scheduler.List())
+	case http.MethodPost:
+		var sched Schedule
+		if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		created, err := scheduler.Create(sched)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/schedules/"+created.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSchedule serves /api/schedules/{id} (GET, PUT, DELETE) and
+// POST /api/schedules/{id}/run.
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/schedules/"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		sched, ok := scheduler.Get(id)
+		if !ok {
+			http.Error(w, "schedule not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sched)
+	case action == "" && r.Method == http.MethodPut:
+		var sched Schedule
+		if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := scheduler.Get(id); !ok {
+			http.Error(w, "schedule not found", http.StatusNotFound)
+			return
+		}
+		updated, err := scheduler.Update(id, sched)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := scheduler.Delete(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "run" && r.Method == http.MethodPost:
+		job, err := scheduler.RunNow(id)
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, ok := scheduler.Get(id); !ok {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+job.ID())
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.Info(false))
+	case action != "" && action != "run":
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
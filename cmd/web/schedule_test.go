@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	valid := []Schedule{
+		{Action: ScheduleAction{Type: "clean", Category: "dev"}, Trigger: ScheduleTrigger{Cron: "0 3 * * *"}},
+		{Action: ScheduleAction{Type: "clean", Category: "trash"}, Trigger: ScheduleTrigger{DiskPercent: 85}},
+		{Action: ScheduleAction{Type: "purge", Root: "~/Projects", Targets: []string{"node_modules"}, OlderThanDays: 30}, Trigger: ScheduleTrigger{Cron: "@weekly"}},
+	}
+	for i, sched := range valid {
+		if err := sched.validate(); err != nil {
+			t.Errorf("valid schedule %d rejected: %v", i, err)
+		}
+	}
+
+	invalid := []Schedule{
+		{Action: ScheduleAction{Type: "uninstall"}, Trigger: ScheduleTrigger{Cron: "@daily"}},
+		{Action: ScheduleAction{Type: "clean"}},
+		{Action: ScheduleAction{Type: "clean"}, Trigger: ScheduleTrigger{Cron: "every night"}},
+		{Action: ScheduleAction{Type: "purge"}, Trigger: ScheduleTrigger{Cron: "@daily"}},
+		{Action: ScheduleAction{Type: "clean"}, Trigger: ScheduleTrigger{DiskPercent: 150}},
+	}
+	for i, sched := range invalid {
+		if err := sched.validate(); err == nil {
+			t.Errorf("invalid schedule %d accepted", i)
+		}
+	}
+}
+
+func TestSchedulerPersistsSchedules(t *testing.T) {
+	useTempConfig(t)
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s := NewScheduler(path)
+
+	created, err := s.Create(Schedule{
+		Name:    "Nightly dev clean",
+		Enabled: true,
+		Action:  ScheduleAction{Type: "clean", Category: "dev"},
+		Trigger: ScheduleTrigger{Cron: "0 3 * * *"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.NextRun == nil {
+		t.Fatalf("expected ID and next run, got %+v", created)
+	}
+
+	updated := created
+	updated.Trigger.Cron = "0 4 * * *"
+	if _, err := s.Update(created.ID, updated); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	reloaded := NewScheduler(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got, ok := reloaded.Get(created.ID)
+	if !ok || got.Trigger.Cron != "0 4 * * *" || got.NextRun == nil || got.NextRun.Hour() != 4 {
+		t.Fatalf("schedule not persisted correctly: %+v", got)
+	}
+
+	if err := reloaded.Delete(created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Load(); err != nil || len(s.List()) != 0 {
+		t.Fatalf("expected no schedules after delete, got %d (err %v)", len(s.List()), err)
+	}
+}
+
+func TestSchedulerDueReason(t *testing.T) {
+	s := NewScheduler(filepath.Join(t.TempDir(), "schedules.json"))
+	usage := 90.0
+	s.diskUsage = func(string) (float64, error) { return usage, nil }
+	now := time.Now()
+
+	threshold := &Schedule{Enabled: true, Trigger: ScheduleTrigger{DiskPercent: 85}}
+	if s.dueReason(threshold, now) == "" {
+		t.Fatalf("expected threshold schedule to be due at 90%% usage")
+	}
+	lastRun := now.Add(-time.Hour)
+	threshold.LastRun = &lastRun
+	if s.dueReason(threshold, now) != "" {
+		t.Fatalf("expected cooldown to suppress threshold trigger")
+	}
+	threshold.LastRun = nil
+	usage = 50
+	if s.dueReason(threshold, now) != "" {
+		t.Fatalf("expected threshold schedule not to be due at 50%% usage")
+	}
+
+	cron := &Schedule{Enabled: true, Trigger: ScheduleTrigger{Cron: "* * * * *"}}
+	cron.updateNextRun(now.Add(-2 * time.Minute))
+	if s.dueReason(cron, now) == "" {
+		t.Fatalf("expected cron schedule to be due")
+	}
+	cron.updateNextRun(now)
+	if s.dueReason(cron, now) != "" {
+		t.Fatalf("expected cron schedule not to be due before its next run")
+	}
+}
+
+func TestScheduleJobRequestFiltersPurgeTargetsByAge(t *testing.T) {
+	root := t.TempDir()
+	oldModules := filepath.Join(root, "old", "node_modules")
+	newModules := filepath.Join(root, "new", "node_modules")
+	oldBuild := filepath.Join(root, "old", "build")
+	for _, dir := range []string{oldModules, newModules, oldBuild} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	past := time.Now().AddDate(0, 0, -45)
+	for _, dir := range []string{oldModules, oldBuild} {
+		if err := os.Chtimes(dir, past, past); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	req, err := scheduleJobRequest(ScheduleAction{Type: "purge", Root: root, Targets: []string{"node_modules"}, OlderThanDays: 30})
+	if err != nil {
+		t.Fatalf("scheduleJobRequest: %v", err)
+	}
+	if req.Trigger != "schedule" || len(req.Paths) != 1 || req.Paths[0] != oldModules {
+		t.Fatalf("expected only the old node_modules, got %+v", req)
+	}
+
+	if _, err := scheduleJobRequest(ScheduleAction{Type: "purge", Root: root, Targets: []string{"venv"}}); err == nil {
+		t.Fatalf("expected nothing-to-purge error")
+	}
+}
+
+func TestScheduleJobRequestSkipsWhitelistedTargets(t *testing.T) {
+	home := useTempConfig(t)
+	keep := filepath.Join(home, "code", "keep", "node_modules")
+	drop := filepath.Join(home, "code", "drop", "node_modules")
+	for _, dir := range []string{keep, drop} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if _, err := whitelist.Save(home, whitelist.Clean, []string{"~/code/keep/*"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	req, err := scheduleJobRequest(ScheduleAction{Type: "purge", Root: filepath.Join(home, "code")})
+	if err != nil {
+		t.Fatalf("scheduleJobRequest: %v", err)
+	}
+	if len(req.Paths) != 1 || req.Paths[0] != drop {
+		t.Fatalf("expected only the unlisted node_modules, got %+v", req.Paths)
+	}
+
+	if _, err := scheduleJobRequest(ScheduleAction{Type: "purge", Root: filepath.Join(home, "code", "keep")}); err == nil {
+		t.Fatalf("expected nothing-to-purge error when every target is whitelisted")
+	}
+}
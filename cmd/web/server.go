@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cancelGrace is how long cancelled jobs get to stop their process groups
+// before the server closes anyway.
+const cancelGrace = 10 * time.Second
+
+// shuttingDown is closed when shutdown begins. Event streams watch it and
+// end, since http.Server.Shutdown waits for them otherwise.
+var (
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+func beginShutdown() {
+	shuttingDownOnce.Do(func() { close(shuttingDown) })
+}
+
+// Lifecycle runs the HTTP servers and the background loops, and shuts them
+// all down in order when asked to stop.
+type Lifecycle struct {
+	Server   *http.Server
+	Serve    func() error   // Starts Server, e.g. ListenAndServe or ListenAndServeTLS
+	Redirect *http.Server   // Optional plain HTTP redirect server
+	Timeout  time.Duration  // How long running operations may take to finish
+	stop     chan struct{}  // Closed to stop the background loops
+	signals  chan os.Signal // SIGINT and SIGTERM
+}
+
+func NewLifecycle(srv *http.Server, serve func() error, timeout time.Duration) *Lifecycle {
+	return &Lifecycle{
+		Server:  srv,
+		Serve:   serve,
+		Timeout: timeout,
+		stop:    make(chan struct{}),
+		signals: make(chan os.Signal, 2),
+	}
+}
+
+// Run starts background work and the servers, then blocks until a server
+// fails or SIGINT/SIGTERM arrives, and shuts down gracefully.
+func (l *Lifecycle) Run() error {
+	scheduler.Start(l.stop)
+	go runQuarantineExpiry(l.stop)
+	go watchConfig(l.stop)
+	go fleet.Run(l.stop)
+	go advertise(l.stop)
+	go metricsHistory.Run(l.stop)
+	go alertManager.Run(l.stop)
+
+	errc := make(chan error, 2)
+	go func() { errc <- l.Serve() }()
+	if l.Redirect != nil {
+		go func() { errc <- l.Redirect.ListenAndServe() }()
+	}
+
+	signal.Notify(l.signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(l.signals)
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			l.Shutdown()
+			return err
+		}
+	case sig := <-l.signals:
+		writeLog("Received %s, shutting down", sig)
+	}
+	l.Shutdown()
+	return nil
+}
+
+// Shutdown stops accepting work, lets running jobs finish within Timeout
+// (a second signal skips the wait), cancels what is left, and closes the
+// servers once in-flight requests have completed. History and log lines
+// are written synchronously as jobs finish, so nothing is lost after this
+// returns.
+func (l *Lifecycle) Shutdown() {
+	close(l.stop)
+	jobs.Close()
+	beginShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-l.signals:
+			writeLog("Received %s again, cancelling running operations", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Shutdown closes the listeners at once, then waits for handlers,
+	// including the ones waiting on job results
+	done := make(chan error, 1)
+	go func() { done <- l.Server.Shutdown(ctx) }()
+	if l.Redirect != nil {
+		go l.Redirect.Shutdown(ctx)
+	}
+
+	if pending := len(jobs.Pending()); pending > 0 {
+		writeLog("Waiting up to %s for %d operations to finish", l.Timeout, pending)
+	}
+	if err := jobs.Drain(ctx); err != nil {
+		writeLog("Cancelled %d operations still running at shutdown", jobs.CancelAll())
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), cancelGrace)
+		jobs.Drain(graceCtx)
+		graceCancel()
+	}
+
+	if err := <-done; err != nil {
+		// Timed out or interrupted: drop whatever is still connected
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), cancelGrace)
+		if l.Server.Shutdown(graceCtx) != nil {
+			l.Server.Close()
+		}
+		graceCancel()
+	}
+	if l.Redirect != nil {
+		l.Redirect.Close()
+	}
+	metricsHistory.Close()
+	writeLog("Shutdown complete")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestLifecycleState replaces the global job manager and shutdown
+// channel so a test can shut down without affecting the others.
+func useTestLifecycleState(t *testing.T) {
+	t.Helper()
+	oldJobs := jobs
+	jobs = NewJobManager()
+	shuttingDown = make(chan struct{})
+	shuttingDownOnce = sync.Once{}
+	t.Cleanup(func() {
+		jobs = oldJobs
+		shuttingDown = make(chan struct{})
+		shuttingDownOnce = sync.Once{}
+	})
+}
+
+func TestLifecycleShutdownWaitsThenCancelsJobs(t *testing.T) {
+	useTempConfig(t)
+	useTestLifecycleState(t)
+
+	// One job finishes within the timeout, the next one never does
+	quick, _ := jobs.Submit(JobRequest{Type: "clean"}, func(j *Job) CleanResult {
+		time.Sleep(50 * time.Millisecond)
+		return CleanResult{Success: true}
+	})
+	stuck, _ := jobs.Submit(JobRequest{Type: "optimize"}, func(j *Job) CleanResult {
+		<-j.Context().Done()
+		return cancelledResult("")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/logs", handleLogsStream)
+	srv := &http.Server{Handler: mux}
+	l := NewLifecycle(srv, func() error { return srv.Serve(ln) }, 300*time.Millisecond)
+	go l.Serve()
+
+	// An open event stream must not hold up shutdown
+	resp, err := http.Get("http://" + ln.Addr().String() + "/api/logs")
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			events <- scanner.Text()
+		}
+		close(events)
+	}()
+
+	finished := make(chan struct{})
+	go func() {
+		l.Shutdown()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not complete")
+	}
+
+	if quick.Info(false).State != JobSucceeded {
+		t.Errorf("quick job: %s", quick.Info(false).State)
+	}
+	if stuck.Info(false).State != JobCancelled {
+		t.Errorf("stuck job: %s", stuck.Info(false).State)
+	}
+	if _, err := jobs.Submit(JobRequest{Type: "clean"}, nil); err != errShuttingDown {
+		t.Errorf("Submit after shutdown: %v", err)
+	}
+
+	sawShutdown := false
+	for line := range events {
+		if strings.Contains(line, "event: shutdown") {
+			sawShutdown = true
+		}
+	}
+	if !sawShutdown {
+		t.Error("stream was not told about the shutdown")
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/api/logs"); err == nil {
+		t.Error("server still accepting connections")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tw93/mole/internal/metrics"
+)
+
+// snapshotMaxAge is how long a collected snapshot is reused. Collecting
+// runs several system commands, and the collector's IO rates are measured
+// between calls, so concurrent readers share one collector and its result.
+const snapshotMaxAge = time.Second
+
+var (
+	snapshotMu        sync.Mutex
+	snapshotCollector = metrics.NewCollector()
+	lastSnapshot      metrics.MetricsSnapshot
+	lastSnapshotErr   error
+)
+
+// currentSnapshot returns the system metrics, collecting them if the last
+// snapshot is older than snapshotMaxAge. Partial results come with an
+// error describing what could not be read.
+func currentSnapshot() (metrics.MetricsSnapshot, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	if time.Since(lastSnapshot.CollectedAt) >= snapshotMaxAge {
+		lastSnapshot, lastSnapshotErr = snapshotCollector.Collect()
+	}
+	return lastSnapshot, lastSnapshotErr
+}
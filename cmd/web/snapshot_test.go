@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleStatusServesFullSnapshot(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, key := range []string{"health_score", "health_score_msg", "cpu", "memory", "disks", "disk_io", "thermal", "top_processes", "hardware", "version", "disk"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("missing %q", key)
+		}
+	}
+
+	var status SystemStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.HealthScore < 0 || status.HealthScore > 100 || status.CollectedAt.IsZero() {
+		t.Errorf("status = %+v", status.MetricsSnapshot)
+	}
+}
+
+func TestCurrentSnapshotIsShared(t *testing.T) {
+	first, _ := currentSnapshot()
+	second, _ := currentSnapshot()
+	if !first.CollectedAt.Equal(second.CollectedAt) {
+		t.Error("snapshot collected twice within snapshotMaxAge")
+	}
+}
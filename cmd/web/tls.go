@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	selfSignedValidity = 825 * 24 * time.Hour // Longest validity macOS accepts
+	selfSignedRenew    = 30 * 24 * time.Hour  // Regenerate when this close to expiry
+)
+
+// tlsDir is where the generated self-signed certificate is kept.
+func tlsDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "tls"), nil
+}
+
+// certHosts returns the names and addresses the certificate should cover:
+// localhost, the machine's hostname and .local name, and its IPs.
+func certHosts() (names []string, ips []net.IP) {
+	names = []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		short := strings.TrimSuffix(strings.ToLower(hostname), ".local")
+		names = append(names, short, short+".local")
+	}
+	for _, name := range currentConfig().AllowedHosts {
+		if net.ParseIP(name) == nil {
+			names = append(names, name)
+		}
+	}
+
+	ips = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	return names, ips
+}
+
+// ensureSelfSignedCert returns the certificate and key files in dir,
+// generating a new pair when they are missing, near expiry, or no longer
+// cover the machine's names. A changed IP address alone does not replace
+// the certificate, so one the user has trusted keeps working.
+func ensureSelfSignedCert(dir string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	names, ips := certHosts()
+
+	if certCovers(certFile, keyFile, names) {
+		return certFile, keyFile, nil
+	}
+	if err := generateSelfSignedCert(certFile, keyFile, names, ips); err != nil {
+		return "", "", err
+	}
+	writeLog("Generated self-signed TLS certificate for %s", strings.Join(names, ", "))
+	return certFile, keyFile, nil
+}
+
+// certCovers reports whether the existing certificate is usable: present
+// with its key, not close to expiry, and valid for every name.
+func certCovers(certFile, keyFile string, names []string) bool {
+	if !fileExists(keyFile) {
+		return false
+	}
+	cert, err := readCert(certFile)
+	if err != nil || time.Until(cert.NotAfter) < selfSignedRenew {
+		return false
+	}
+	for _, name := range names {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func readCert(certFile string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no certificate found", certFile)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func generateSelfSignedCert(certFile, keyFile string, names []string, ips []net.IP) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Mole self-signed", Organization: []string{"Mole"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// certFingerprint returns the SHA-256 fingerprint of a certificate file,
+// printed at startup so users can check it when their browser warns.
+func certFingerprint(certFile string) string {
+	cert, err := readCert(certFile)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same host and path on
+// the HTTPS port.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !hostAllowed(host) {
+			http.Error(w, "Forbidden: unknown host "+r.Host, http.StatusForbidden)
+			return
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host
+		if httpsPort != 443 {
+			target += ":" + strconv.Itoa(httpsPort)
+		}
+		http.Redirect(w, r, target+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	})
+}
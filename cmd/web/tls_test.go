@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSelfSignedCertGeneratesAndReuses(t *testing.T) {
+	dir := filepath.Join(useTempConfig(t), "tls")
+	useConfig(t, Config{})
+
+	certFile, keyFile, err := ensureSelfSignedCert(dir)
+	if err != nil {
+		t.Fatalf("ensureSelfSignedCert: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("generated pair does not load: %v", err)
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("key mode = %v", info.Mode().Perm())
+	}
+
+	cert, err := readCert(certFile)
+	if err != nil {
+		t.Fatalf("readCert: %v", err)
+	}
+	names, _ := certHosts()
+	for _, name := range append(names, "127.0.0.1") {
+		if err := cert.VerifyHostname(name); err != nil {
+			t.Errorf("certificate does not cover %s: %v", name, err)
+		}
+	}
+
+	first := certFingerprint(certFile)
+	if _, _, err := ensureSelfSignedCert(dir); err != nil {
+		t.Fatalf("second ensureSelfSignedCert: %v", err)
+	}
+	if certFingerprint(certFile) != first {
+		t.Error("valid certificate was regenerated")
+	}
+
+	// A certificate missing a required name is replaced
+	useConfig(t, Config{AllowedHosts: []string{"mole.example.lan"}})
+	if _, _, err := ensureSelfSignedCert(dir); err != nil {
+		t.Fatalf("ensureSelfSignedCert: %v", err)
+	}
+	if certFingerprint(certFile) == first {
+		t.Error("expected a new certificate for the added host")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	h := redirectToHTTPS(8443)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/api/status?x=1", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "https://localhost:8443/api/status?x=1" {
+		t.Fatalf("got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://evil.example/", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("foreign host: got %d", rec.Code)
+	}
+}
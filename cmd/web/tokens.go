@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope limits what an API token may do.
+type Scope string
+
+const (
+	ScopeStatus      Scope = "status"      // Read-only status, history, logs and job state
+	ScopeAnalyze     Scope = "analyze"     // Disk analysis and scans; nothing is changed
+	ScopeDestructive Scope = "destructive" // Clean, purge, delete, uninstall, optimize, updates
+	ScopeAdmin       Scope = "admin"       // Everything, including token management
+)
+
+var validScopes = map[Scope]bool{
+	ScopeStatus:      true,
+	ScopeAnalyze:     true,
+	ScopeDestructive: true,
+	ScopeAdmin:       true,
+}
+
+const tokenPrefix = "mole_"
+
+// APIToken is a stored token. Only the SHA-256 of the secret is kept.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash"`
+	Hint       string     `json:"hint"` // First characters of the secret, for recognising it
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Allows reports whether the token grants scope. Admin grants everything.
+func (t APIToken) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// public hides the hash from API responses.
+func (t APIToken) public() APIToken {
+	t.Hash = ""
+	return t
+}
+
+// parseScopes parses a comma-separated scope list.
+func parseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	seen := make(map[Scope]bool)
+	for _, part := range strings.Split(s, ",") {
+		scope := Scope(strings.ToLower(strings.TrimSpace(part)))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !validScopes[scope] {
+			return nil, fmt.Errorf("unknown scope %q (use status, analyze, destructive or admin)", scope)
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// TokenStore keeps API tokens in a JSON file readable only by the user. An
+// empty path means the default location under the user's config directory.
+type TokenStore struct {
+	mu   sync.Mutex
+	path string
+
+	// The file as last read, reused until its path, size or modification
+	// time changes, so authenticating a request does not parse it again
+	loaded  bool
+	file    string
+	size    int64
+	modTime time.Time
+	list    []APIToken
+	err     error // Parse error of the cached contents
+}
+
+func NewTokenStore(path string) *TokenStore {
+	return &TokenStore{path: path}
+}
+
+var tokens = NewTokenStore("")
+
+func (s *TokenStore) filePath() (string, error) {
+	if s.path != "" {
+		return s.path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "tokens.json"), nil
+}
+
+// loadLocked returns a copy of the stored tokens, reading the file again
+// only when it changed.
+func (s *TokenStore) loadLocked() ([]APIToken, error) {
+	path, err := s.filePath()
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		s.loaded = false
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !s.loaded || s.file != path || s.size != info.Size() || !s.modTime.Equal(info.ModTime()) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var list []APIToken
+		var parseErr error
+		if err := json.Unmarshal(data, &list); err != nil {
+			list, parseErr = nil, fmt.Errorf("parse %s: %w", path, err)
+			writeLog("API tokens unreadable, requiring credentials: %v", parseErr)
+		}
+		s.loaded, s.file, s.size, s.modTime, s.list, s.err = true, path, info.Size(), info.ModTime(), list, parseErr
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]APIToken(nil), s.list...), nil
+}
+
+func (s *TokenStore) saveLocked(list []APIToken) error {
+	path, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if list == nil {
+		list = []APIToken{}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		s.loaded, s.file, s.size, s.modTime, s.list, s.err = true, path, info.Size(), info.ModTime(), append([]APIToken(nil), list...), nil
+	} else {
+		s.loaded = false
+	}
+	return nil
+}
+
+// List returns tokens oldest first, without hashes.
+func (s *TokenStore) List() ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	out := make([]APIToken, 0, len(list))
+	for _, t := range list {
+		out = append(out, t.public())
+	}
+	return out, nil
+}
+
+// Create stores a new token and returns it with its secret, which is never
+// shown again.
+func (s *TokenStore) Create(name string, scopes []Scope) (APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIToken{}, "", fmt.Errorf("token name required")
+	}
+	if len(scopes) == 0 {
+		return APIToken{}, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return APIToken{}, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return APIToken{}, "", err
+	}
+	secret := tokenPrefix + hex.EncodeToString(buf)
+	token := APIToken{
+		ID:        newJobID(),
+		Name:      name,
+		Hash:      hashToken(secret),
+		Hint:      secret[:len(tokenPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.loadLocked()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	if err := s.saveLocked(append(list, token)); err != nil {
+		return APIToken{}, "", err
+	}
+	return token.public(), secret, nil
+}
+
+// Revoke deletes a token by ID.
+func (s *TokenStore) Revoke(id string) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.loadLocked()
+	if err != nil {
+		return APIToken{}, err
+	}
+	for i, t := range list {
+		if t.ID == id {
+			list = append(list[:i], list[i+1:]...)
+			return t.public(), s.saveLocked(list)
+		}
+	}
+	return APIToken{}, fmt.Errorf("token not found")
+}
+
+// Lookup finds the token matching secret and records its use.
+func (s *TokenStore) Lookup(secret string) (APIToken, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return APIToken{}, false
+	}
+	hash := hashToken(secret)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.loadLocked()
+	if err != nil {
+		return APIToken{}, false
+	}
+	for i, t := range list {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			// Record use at most once a minute to avoid rewriting the file
+			// on every status poll
+			now := time.Now()
+			if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > time.Minute {
+				list[i].LastUsedAt = &now
+				s.saveLocked(list)
+			}
+			return list[i].public(), true
+		}
+	}
+	return APIToken{}, false
+}
+
+// Count returns the number of stored tokens. An error means the file
+// exists but cannot be read, and says nothing about how many there are.
+func (s *TokenStore) Count() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.loadLocked()
+	return len(list), err
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// runTokenCommand handles the -token-* flags. It returns false when none
+// were given and the server should start.
+func runTokenCommand(create, scopes, revoke string, list bool) bool {
+	switch {
+	case create != "":
+		parsed, err := parseScopes(scopes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		token, secret, err := tokens.Create(create, parsed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created token %s (%s) with scopes %s\n", token.ID, token.Name, joinScopes(token.Scopes))
+		fmt.Printf("\n  %s\n\nStore it now; it cannot be shown again.\n", secret)
+		return true
+	case revoke != "":
+		token, err := tokens.Revoke(revoke)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Revoked token %s (%s)\n", token.ID, token.Name)
+		return true
+	case list:
+		all, err := tokens.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if len(all) == 0 {
+			fmt.Println("No API tokens")
+		}
+		for _, t := range all {
+			lastUsed := "never"
+			if t.LastUsedAt != nil {
+				lastUsed = t.LastUsedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%s  %-20s  %-28s  %s...  last used %s\n", t.ID, t.Name, joinScopes(t.Scopes), t.Hint, lastUsed)
+		}
+		return true
+	}
+	return false
+}
+
+func joinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// handleTokens serves GET /api/tokens (list) and POST /api/tokens (create).
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := tokens.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		var req struct {
+			Name   string  `json:"name"`
+			Scopes []Scope `json:"scopes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token, secret, err := tokens.Create(req.Name, req.Scopes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeLog("API token created: %s (%s)", token.Name, joinScopes(token.Scopes))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			APIToken
+			Token string `json:"token"`
+		}{token, secret})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleToken serves DELETE /api/tokens/{id}.
+func handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens/"), "/")
+	token, err := tokens.Revoke(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeLog("API token revoked: %s", token.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
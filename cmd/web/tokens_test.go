@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStoreCreateLookupRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Mole", "tokens.json")
+	store := NewTokenStore(path)
+
+	token, secret, err := store.Create("grafana", []Scope{ScopeStatus})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(secret, tokenPrefix) || token.Hash != "" {
+		t.Fatalf("unexpected token %+v / %q", token, secret)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), secret) || !strings.Contains(string(data), hashToken(secret)) {
+		t.Fatal("token file must hold only the hash")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v", info.Mode().Perm())
+	}
+
+	found, ok := store.Lookup(secret)
+	if !ok || found.ID != token.ID || found.LastUsedAt == nil {
+		t.Fatalf("Lookup = %+v, %v", found, ok)
+	}
+	if _, ok := store.Lookup(secret + "x"); ok {
+		t.Error("wrong secret accepted")
+	}
+
+	if _, err := store.Revoke(token.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok := store.Lookup(secret); ok {
+		t.Error("revoked token accepted")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := parseScopes("status, Analyze,status")
+	if err != nil || len(scopes) != 2 || scopes[1] != ScopeAnalyze {
+		t.Fatalf("parseScopes = %v, %v", scopes, err)
+	}
+	if _, err := parseScopes("root"); err == nil {
+		t.Error("expected unknown scope error")
+	}
+	if _, err := parseScopes(" , "); err == nil {
+		t.Error("expected missing scope error")
+	}
+}
+
+func TestRequireScopeEnforcesTokenScopes(t *testing.T) {
+	useTempConfig(t)
+	useConfig(t, Config{})
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	status := requireScope(ScopeStatus, ok)
+	destructive := requireScopes(ScopeStatus, ScopeDestructive, ok)
+
+	do := func(h http.HandlerFunc, method, target string, header string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	// No credentials configured: open, as before
+	if code := do(destructive, http.MethodPost, "/", ""); code != http.StatusOK {
+		t.Fatalf("auth disabled: got %d", code)
+	}
+
+	_, secret, err := tokens.Create("monitor", []Scope{ScopeStatus})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Creating a token turns auth on
+	if code := do(status, http.MethodGet, "/", ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got %d", code)
+	}
+	if code := do(status, http.MethodGet, "/", "Bearer "+secret); code != http.StatusOK {
+		t.Errorf("bearer: got %d", code)
+	}
+	if code := do(status, http.MethodGet, "/?token="+secret, ""); code != http.StatusOK {
+		t.Errorf("query token: got %d", code)
+	}
+	if code := do(destructive, http.MethodGet, "/", "Bearer "+secret); code != http.StatusOK {
+		t.Errorf("read on mixed route: got %d", code)
+	}
+	if code := do(destructive, http.MethodPost, "/", "Bearer "+secret); code != http.StatusForbidden {
+		t.Errorf("write with status token: got %d", code)
+	}
+
+	// Basic auth keeps full access
+	useConfig(t, Config{AuthUser: "admin", AuthPass: "pw"})
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("admin", "pw")
+	rec := httptest.NewRecorder()
+	destructive(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("basic auth: got %d", rec.Code)
+	}
+}
+
+func TestUnreadableTokenFileRequiresAuth(t *testing.T) {
+	useTempConfig(t)
+	useConfig(t, Config{})
+	path, err := tokens.filePath()
+	if err != nil {
+		t.Fatalf("filePath: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`[{"id": "trunc`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tokens.Count(); err == nil {
+		t.Fatal("Count accepted a truncated file")
+	}
+	if !authEnabled() {
+		t.Fatal("a damaged token file turned auth off")
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	rec := httptest.NewRecorder()
+	requireScope(ScopeAdmin, ok)(rec, httptest.NewRequest(http.MethodGet, "/api/tokens", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous with a damaged token file: got %d", rec.Code)
+	}
+}
+
+func TestTokenStoreReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewTokenStore(path)
+	if _, _, err := store.Create("first", []Scope{ScopeStatus}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Another process, such as bin/web-go -token-create, adds a token
+	other := NewTokenStore(path)
+	_, secret, err := other.Create("second", []Scope{ScopeStatus})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.Count(); err != nil || n != 2 {
+		t.Fatalf("Count = %d, %v, want 2", n, err)
+	}
+	if _, ok := store.Lookup(secret); !ok {
+		t.Error("token added by another process not found")
+	}
+}
@@ -154,18 +154,27 @@ func handlePerformUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	runJobAndRespond(w, r, JobRequest{Type: "update", Name: req.Name}, func(result CleanResult) interface{} {
+		return result
+	})
+}
+
+func performUpdate(j *Job, name string) CleanResult {
 	var result CleanResult
-	writeLog("Performing update: %s", req.Name)
-	if req.Name == "Mole" {
-		result = runMoleCommand("update", "--debug")
-	} else if req.Name == "Homebrew" {
+	writeLog("Performing update: %s", name)
+	if name == "Mole" {
+		result = runMoleCommand(j, "update", "--debug")
+	} else if name == "Homebrew" {
 		// Homebrew upgrade
 		writeLog("Executing: brew upgrade")
-		cmd := exec.Command("brew", "upgrade")
+		cmd := newCommand(j.Context(), "brew", "upgrade")
 		var out bytes.Buffer
 		cmd.Stdout = &out
 		cmd.Stderr = &out
 		err := cmd.Run()
+		if j.cancelled() {
+			return cancelledResult(stripANSI(out.String()))
+		}
 		result = CleanResult{
 			Success: err == nil,
 			Message: func() string {
@@ -177,14 +186,12 @@ func handlePerformUpdate(w http.ResponseWriter, r *http.Request) {
 			Output: stripANSI(out.String()),
 		}
 	} else {
-		writeLog("ERROR: Unsupported update type: %s", req.Name)
+		writeLog("ERROR: Unsupported update type: %s", name)
 		result = CleanResult{Success: false, Message: "Unsupported update type"}
 	}
 
-	writeLog("Update result for %s: Success=%v, Message=%s", req.Name, result.Success, result.Message)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	writeLog("Update result for %s: Success=%v, Message=%s", name, result.Success, result.Message)
+	return result
 }
 
 // compareVersions returns:
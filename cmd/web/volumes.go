@@ -137,20 +137,23 @@ func analyzeVolumePath(volumePath string) VolumeAnalysis {
 			continue
 		}
 
-		size := getDirSize(entry)
-		if size > 100*1024*1024 { // Only show > 100MB
-			totalSize += size
+		usage := dirUsage(entry)
+		if usage.Size > 100*1024*1024 { // Only show > 100MB
+			totalSize += usage.Size
 
 			// Assign colors and icons based on name/type
 			color, icon := getCategoryStyle(name)
 
 			categories = append(categories, StorageCategory{
-				Name:      name,
-				Size:      size,
-				SizeHuman: formatBytes(size),
-				Percent:   0, // Will calculate after
-				Color:     color,
-				Icon:      icon,
+				Name:        name,
+				Size:        usage.Size,
+				SizeHuman:   formatBytes(usage.Size),
+				Percent:     0, // Will calculate after
+				Color:       color,
+				Icon:        icon,
+				Exact:       usage.Exact,
+				LogicalSize: usage.Logical,
+				SharedSize:  usage.Shared,
 			})
 		}
 	}
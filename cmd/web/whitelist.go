@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+// loadWhitelist loads the user's whitelist for mode. A load failure is
+// logged and treated as an empty whitelist; the path policy still guards
+// deletions.
+func loadWhitelist(mode whitelist.Mode) *whitelist.List {
+	list, err := whitelist.LoadDefault(mode)
+	if err != nil {
+		writeLog("ERROR: Loading %s whitelist: %v", mode, err)
+		return nil
+	}
+	return list
+}
+
+// handleWhitelist serves GET and PUT /api/whitelist?mode=clean|optimize,
+// reading and writing the same files as `mole whitelist`.
+func handleWhitelist(w http.ResponseWriter, r *http.Request) {
+	mode, err := whitelist.ParseMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var list *whitelist.List
+	switch r.Method {
+	case http.MethodGet:
+		list, err = whitelist.Load(home, mode)
+	case http.MethodPut:
+		var req struct {
+			Patterns []string `json:"patterns"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list, err = whitelist.Save(home, mode, req.Patterns)
+		if err == nil {
+			writeLog("Updated %s whitelist (%d patterns)", mode, len(list.Patterns))
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if list.Patterns == nil {
+		list.Patterns = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+func TestWhitelistAPIRoundTrip(t *testing.T) {
+	home := useTempConfig(t)
+
+	rec := httptest.NewRecorder()
+	handleWhitelist(rec, httptest.NewRequest(http.MethodGet, "/api/whitelist", nil))
+	var list whitelist.List
+	json.NewDecoder(rec.Body).Decode(&list)
+	if !list.Default || len(list.Patterns) == 0 {
+		t.Fatalf("expected default clean whitelist, got %+v", list)
+	}
+
+	body := `{"patterns":["~/code/keep/*"]}`
+	rec = httptest.NewRecorder()
+	handleWhitelist(rec, httptest.NewRequest(http.MethodPut, "/api/whitelist?mode=clean", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".config", "mole", "whitelist"))
+	if err != nil || !strings.Contains(string(data), "~/code/keep/*") {
+		t.Fatalf("whitelist file = %q, %v", data, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handleWhitelist(rec, httptest.NewRequest(http.MethodGet, "/api/whitelist?mode=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bogus mode status = %d", rec.Code)
+	}
+}
+
+func TestWhitelistedPathsAreMarkedAndKept(t *testing.T) {
+	home := useTempConfig(t)
+	keep := filepath.Join(home, "code", "keep", "node_modules")
+	drop := filepath.Join(home, "code", "drop", "node_modules")
+	for _, dir := range []string{keep, drop} {
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "index.js"), []byte("x"), 0644)
+	}
+	if _, err := whitelist.Save(home, whitelist.Clean, []string{"~/code/keep/*"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	items := scanForPurge(filepath.Join(home, "code"))
+	if len(items) != 2 {
+		t.Fatalf("expected 2 purge candidates, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Whitelisted != (item.Path == keep) {
+			t.Errorf("item %s whitelisted = %v", item.Path, item.Whitelisted)
+		}
+	}
+
+	body := `{"paths":["` + keep + `","` + drop + `"]}`
+	rec := httptest.NewRecorder()
+	handleDeleteFiles(rec, httptest.NewRequest(http.MethodPost, "/api/files", strings.NewReader(body)))
+	var result DeleteResult
+	json.NewDecoder(rec.Body).Decode(&result)
+	if result.DeletedCount != 1 || len(result.Refused) != 1 || !strings.HasPrefix(result.Refused[0].Reason, "Whitelisted") {
+		t.Fatalf("unexpected delete result: %+v", result)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Fatalf("whitelisted path was removed: %v", err)
+	}
+}
@@ -36,7 +36,9 @@ if [[ ! -f "$BINARY" ]]; then
     go build -o "$BINARY" ./cmd/web/
 fi
 
-# Create LaunchAgent plist
+# Create LaunchAgent plist. ExitTimeOut gives running operations time to
+# finish on stop (the server waits up to -shutdown-timeout, 2m by default)
+# before launchd sends SIGKILL.
 cat > "$PLIST_PATH" << EOF
 <?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -69,6 +71,8 @@ cat > "$PLIST_PATH" << EOF
     <true/>
     <key>KeepAlive</key>
     <true/>
+    <key>ExitTimeOut</key>
+    <integer>150</integer>
     <key>StandardOutPath</key>
     <string>${SCRIPT_DIR}/mole-web.log</string>
     <key>StandardErrorPath</key>
@@ -0,0 +1,294 @@
+// Package alerts evaluates threshold rules against system metrics snapshots.
+// A rule fires once its condition has held for the rule's duration and
+// resolves once it has been false for as long, so each episode produces one
+// firing and one resolved event however often snapshots are evaluated.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tw93/mole/internal/metrics"
+)
+
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Rule raises an alert when Metric compares to Threshold with Op for at
+// least For.
+type Rule struct {
+	Name      string        `json:"name"`
+	Metric    string        `json:"metric"` // The name of one of metrics.Readings
+	Op        string        `json:"op"`     // ">", ">=", "<" or "<="
+	Threshold float64       `json:"threshold"`
+	For       time.Duration `json:"for,omitempty"`      // Written as "10m" in JSON
+	Severity  string        `json:"severity,omitempty"` // "warning" (default) or "critical"
+	Message   string        `json:"message,omitempty"`  // Shown instead of the generated text
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	out := struct {
+		plain
+		For string `json:"for,omitempty"`
+	}{plain: plain(r)}
+	if r.For > 0 {
+		out.For = shortDuration(r.For)
+	}
+	return json.Marshal(out)
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	in := struct {
+		*plain
+		For string `json:"for,omitempty"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	r.For = 0
+	if in.For != "" {
+		d, err := time.ParseDuration(in.For)
+		if err != nil {
+			return fmt.Errorf("rule %q: invalid for: %w", r.Name, err)
+		}
+		r.For = d
+	}
+	return nil
+}
+
+// Validate checks that the rule can be evaluated.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rules need a name")
+	}
+	if _, ok := metrics.FindReading(r.Metric); !ok {
+		return fmt.Errorf("rule %q: unknown metric %q", r.Name, r.Metric)
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("rule %q: op must be >, >=, < or <=", r.Name)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("rule %q: for must not be negative", r.Name)
+	}
+	if r.Severity != "" && r.Severity != SeverityWarning && r.Severity != SeverityCritical {
+		return fmt.Errorf("rule %q: severity must be warning or critical", r.Name)
+	}
+	return nil
+}
+
+func (r Rule) matches(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	}
+	return false
+}
+
+// DefaultRules watch for the problems that otherwise go unnoticed until
+// someone complains.
+var DefaultRules = []Rule{
+	{Name: "disk_full", Metric: "disk_used_percent", Op: ">", Threshold: 90, For: 10 * time.Minute, Severity: SeverityCritical, Message: "Disk almost full"},
+	{Name: "memory_pressure", Metric: "memory_pressure", Op: ">=", Threshold: 2, For: 5 * time.Minute, Severity: SeverityWarning, Message: "Memory pressure is critical"},
+	{Name: "cpu_hot", Metric: "cpu_temp", Op: ">", Threshold: 90, For: 2 * time.Minute, Severity: SeverityCritical, Message: "CPU is overheating"},
+	{Name: "battery_worn", Metric: "battery_capacity", Op: "<", Threshold: 80, Severity: SeverityWarning, Message: "Battery health below 80%"},
+}
+
+// Event reports that a rule started or stopped firing.
+type Event struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	State     string    `json:"state"` // "firing" or "resolved"
+	Severity  string    `json:"severity"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	Host      string    `json:"host"`
+	Since     time.Time `json:"since"` // When the condition started to hold
+	Time      time.Time `json:"time"`
+}
+
+type ruleState struct {
+	rule      Rule
+	holdSince time.Time // Condition true since, while not firing
+	clearFrom time.Time // Condition false since, while firing
+	firing    bool
+	since     time.Time
+	value     float64
+}
+
+// Engine keeps the state of each rule between evaluations.
+type Engine struct {
+	mu    sync.Mutex
+	rules []*ruleState
+}
+
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{}
+	e.SetRules(rules)
+	return e
+}
+
+// SetRules replaces the rules. Rules that did not change keep their state,
+// so reloading the config does not repeat alerts.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	old := make(map[string]*ruleState, len(e.rules))
+	for _, st := range e.rules {
+		old[st.rule.Name] = st
+	}
+	e.rules = e.rules[:0:0]
+	for _, r := range rules {
+		if st := old[r.Name]; st != nil && reflect.DeepEqual(st.rule, r) {
+			e.rules = append(e.rules, st)
+			continue
+		}
+		e.rules = append(e.rules, &ruleState{rule: r})
+	}
+}
+
+// Evaluate checks every rule against s and returns the rules that started
+// or stopped firing. Rules whose metric is missing from s keep their state.
+func (e *Engine) Evaluate(s metrics.MetricsSnapshot) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := s.CollectedAt
+	var events []Event
+	for _, st := range e.rules {
+		m, ok := metrics.FindReading(st.rule.Metric)
+		if !ok {
+			continue
+		}
+		v, ok := m.Read(s)
+		if !ok {
+			continue
+		}
+		st.value = v
+		if st.rule.matches(v) {
+			st.clearFrom = time.Time{}
+			if st.holdSince.IsZero() {
+				st.holdSince = now
+			}
+			if !st.firing && now.Sub(st.holdSince) >= st.rule.For {
+				st.firing, st.since = true, st.holdSince
+				events = append(events, st.event(StateFiring, s.Host, now))
+			}
+			continue
+		}
+		st.holdSince = time.Time{}
+		if !st.firing {
+			continue
+		}
+		if st.clearFrom.IsZero() {
+			st.clearFrom = now
+		}
+		if now.Sub(st.clearFrom) >= st.rule.For {
+			st.firing = false
+			events = append(events, st.event(StateResolved, s.Host, now))
+		}
+	}
+	return events
+}
+
+// Active returns the rules currently firing.
+func (e *Engine) Active() []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var active []Event
+	for _, st := range e.rules {
+		if st.firing {
+			active = append(active, st.event(StateFiring, "", st.since))
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Since.Before(active[j].Since) })
+	return active
+}
+
+func (st *ruleState) event(state, host string, at time.Time) Event {
+	r := st.rule
+	severity := r.Severity
+	if severity == "" {
+		severity = SeverityWarning
+	}
+	return Event{
+		Rule:      r.Name,
+		Metric:    r.Metric,
+		State:     state,
+		Severity:  severity,
+		Value:     st.value,
+		Threshold: r.Threshold,
+		Message:   st.message(state),
+		Host:      host,
+		Since:     st.since,
+		Time:      at,
+	}
+}
+
+func (st *ruleState) message(state string) string {
+	r := st.rule
+	text := r.Message
+	if text == "" {
+		text = r.Name
+	}
+	m, _ := metrics.FindReading(r.Metric)
+	value := formatValue(st.value, m.Unit)
+	if state == StateResolved {
+		return fmt.Sprintf("Resolved: %s (%s is %s)", text, r.Metric, value)
+	}
+	cond := fmt.Sprintf("%s %s %s", r.Metric, r.Op, formatValue(r.Threshold, m.Unit))
+	if r.For > 0 {
+		cond += " for " + shortDuration(r.For)
+	}
+	return fmt.Sprintf("%s: %s is %s (%s)", text, r.Metric, value, cond)
+}
+
+// shortDuration formats d without trailing zero units, e.g. "10m".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+func formatValue(v float64, unit string) string {
+	switch unit {
+	case "bytes":
+		return metrics.HumanBytes(uint64(max(v, 0)))
+	case "percent":
+		return strconv.FormatFloat(v, 'f', 1, 64) + "%"
+	case "mb_per_s":
+		return strconv.FormatFloat(v, 'f', 1, 64) + " MB/s"
+	case "celsius":
+		return strconv.FormatFloat(v, 'f', 1, 64) + "°C"
+	case "watts":
+		return strconv.FormatFloat(v, 'f', 1, 64) + " W"
+	case "score", "count":
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
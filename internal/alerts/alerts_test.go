@@ -0,0 +1,121 @@
+package alerts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tw93/mole/internal/metrics"
+)
+
+func diskSnapshot(at time.Time, percent float64) metrics.MetricsSnapshot {
+	return metrics.MetricsSnapshot{
+		CollectedAt: at,
+		Host:        "kids-imac",
+		Disks: []metrics.DiskStatus{
+			{Mount: "/Volumes/Backup", External: true, UsedPercent: 10},
+			{Mount: "/", Total: 100 << 30, Used: uint64(percent) << 30, UsedPercent: percent},
+		},
+	}
+}
+
+func TestRuleFiresOnceAfterForAndResolves(t *testing.T) {
+	e := NewEngine([]Rule{{Name: "disk_full", Metric: "disk_used_percent", Op: ">", Threshold: 90, For: 10 * time.Minute}})
+	start := time.Unix(1_700_000_000, 0)
+
+	var fired []Event
+	for i := 0; i <= 20; i++ {
+		fired = append(fired, e.Evaluate(diskSnapshot(start.Add(time.Duration(i)*time.Minute), 95))...)
+	}
+	if len(fired) != 1 || fired[0].State != StateFiring || !fired[0].Time.Equal(start.Add(10*time.Minute)) {
+		t.Fatalf("fired = %+v", fired)
+	}
+	ev := fired[0]
+	if ev.Severity != SeverityWarning || ev.Host != "kids-imac" || !ev.Since.Equal(start) || ev.Value != 95 {
+		t.Errorf("event = %+v", ev)
+	}
+	if !strings.Contains(ev.Message, "disk_used_percent is 95.0%") || !strings.Contains(ev.Message, "for 10m") {
+		t.Errorf("message = %q", ev.Message)
+	}
+	if active := e.Active(); len(active) != 1 {
+		t.Errorf("active = %+v", active)
+	}
+
+	// A brief dip does not resolve; a sustained one does, once
+	end := start.Add(30 * time.Minute)
+	e.Evaluate(diskSnapshot(end, 50))
+	if got := e.Evaluate(diskSnapshot(end.Add(time.Minute), 95)); len(got) != 0 {
+		t.Errorf("dip produced %+v", got)
+	}
+	var resolved []Event
+	for i := 2; i <= 30; i++ {
+		resolved = append(resolved, e.Evaluate(diskSnapshot(end.Add(time.Duration(i)*time.Minute), 50))...)
+	}
+	if len(resolved) != 1 || resolved[0].State != StateResolved {
+		t.Fatalf("resolved = %+v", resolved)
+	}
+	if len(e.Active()) != 0 {
+		t.Error("still active after resolving")
+	}
+}
+
+func TestMissingMetricKeepsState(t *testing.T) {
+	e := NewEngine([]Rule{{Name: "battery_worn", Metric: "battery_capacity", Op: "<", Threshold: 80}})
+	now := time.Unix(1_700_000_000, 0)
+	snap := metrics.MetricsSnapshot{CollectedAt: now, Batteries: []metrics.BatteryStatus{{Percent: 50, Capacity: 72}}}
+	if got := e.Evaluate(snap); len(got) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	// Capacity unknown on this sample: no resolve
+	snap.Batteries[0].Capacity = 0
+	if got := e.Evaluate(snap); len(got) != 0 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestSetRulesKeepsUnchangedState(t *testing.T) {
+	rule := Rule{Name: "hot", Metric: "cpu_temp", Op: ">", Threshold: 90}
+	e := NewEngine([]Rule{rule})
+	snap := metrics.MetricsSnapshot{CollectedAt: time.Unix(1_700_000_000, 0), Thermal: metrics.ThermalStatus{CPUTemp: 95}}
+	e.Evaluate(snap)
+
+	e.SetRules([]Rule{rule})
+	if got := e.Evaluate(snap); len(got) != 0 {
+		t.Errorf("reload repeated the alert: %+v", got)
+	}
+	rule.Threshold = 80
+	e.SetRules([]Rule{rule})
+	if got := e.Evaluate(snap); len(got) != 1 {
+		t.Errorf("changed rule did not start over: %+v", got)
+	}
+}
+
+func TestRuleJSONAndValidate(t *testing.T) {
+	var r Rule
+	if err := json.Unmarshal([]byte(`{"name":"d","metric":"disk_free","op":"<","threshold":2e10,"for":"10m"}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.For != 10*time.Minute || r.Validate() != nil {
+		t.Errorf("rule = %+v, %v", r, r.Validate())
+	}
+	data, _ := json.Marshal(r)
+	if !strings.Contains(string(data), `"for":"10m"`) {
+		t.Errorf("json = %s", data)
+	}
+	for _, bad := range []Rule{
+		{Metric: "cpu_usage", Op: ">"},
+		{Name: "x", Metric: "cpu_nope", Op: ">"},
+		{Name: "x", Metric: "cpu_usage", Op: "=="},
+		{Name: "x", Metric: "cpu_usage", Op: ">", Severity: "page"},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+	for _, r := range DefaultRules {
+		if err := r.Validate(); err != nil {
+			t.Errorf("default rule: %v", err)
+		}
+	}
+}
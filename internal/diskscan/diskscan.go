@@ -0,0 +1,697 @@
+// Package diskscan measures disk usage the way `mo analyze` does: it walks
+// trees concurrently, counts allocated blocks rather than apparent sizes,
+// does not follow symlinks and hands folded directories such as
+// node_modules to du. Every size is flagged exact or estimated, so callers
+// can tell a complete count from one that skipped unreadable directories,
+// ran out of time or came from a cache.
+//
+// A file with several hard links is counted once per scan, by whichever
+// link the scan reaches first, and its bytes are reported as shared. On
+// APFS, the part of a file shared with its clones is reported as shared
+// too, since deleting the file does not free it.
+//
+// ScanTree also keeps the size of every directory it walked in a Tree,
+// which Apply and Watch keep current as files change.
+package diskscan
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a direct child of a scanned directory.
+type Entry struct {
+	Name       string
+	Path       string
+	Size       int64 // On disk
+	Logical    int64 // Sum of file lengths
+	Shared     int64 // Part of Size also used by hard links or clones
+	IsDir      bool
+	LastAccess time.Time
+	Exact      bool // False when Size misses unreadable parts or came from a cache
+}
+
+// File is one of the largest files found by a scan.
+type File struct {
+	Name string
+	Path string
+	Size int64
+}
+
+// Result is what Scan found under a directory: its largest children, its
+// largest files and the total size.
+type Result struct {
+	Entries     []Entry // Largest first
+	LargeFiles  []File  // Largest first
+	TotalSize   int64
+	LogicalSize int64
+	SharedSize  int64
+	Exact       bool
+}
+
+// Usage is the space used by a tree. Deleting the tree frees at most
+// Size - Shared. Folded directories measured with du count their on-disk
+// size as their logical size too.
+type Usage struct {
+	Size    int64 // Allocated on disk
+	Logical int64 // Sum of file lengths, as Finder's "size"
+	Shared  int64 // Part of Size also used by hard links or clones
+	Exact   bool  // False when Size is a lower bound or an estimate
+}
+
+// Progress receives running totals while a scan runs, for progress
+// displays. Any field may be nil.
+type Progress struct {
+	Files       *int64
+	Dirs        *int64
+	Bytes       *int64
+	CurrentPath *string
+}
+
+func (p Progress) addFiles(n int64) {
+	if p.Files != nil {
+		atomic.AddInt64(p.Files, n)
+	}
+}
+
+func (p Progress) addDirs(n int64) {
+	if p.Dirs != nil {
+		atomic.AddInt64(p.Dirs, n)
+	}
+}
+
+func (p Progress) addBytes(n int64) {
+	if p.Bytes != nil {
+		atomic.AddInt64(p.Bytes, n)
+	}
+}
+
+// setCurrent records path every batchUpdateSize files, which keeps the
+// display from jittering.
+func (p Progress) setCurrent(path string) {
+	if p.CurrentPath != nil && p.Files != nil && atomic.LoadInt64(p.Files)%int64(batchUpdateSize) == 0 {
+		*p.CurrentPath = path
+	}
+}
+
+// Scanner measures directories. The zero value is ready to use.
+type Scanner struct {
+	Progress Progress
+
+	// CachedSize, if set, supplies a size measured earlier. Scan uses it for
+	// ~/Library when scanning the home directory, which the analyzer measures
+	// separately; such sizes are flagged estimated.
+	CachedSize func(path string) (int64, bool)
+}
+
+// tally adds up usage from concurrent walkers.
+type tally struct {
+	size, logical, shared atomic.Int64
+	missed                atomic.Bool
+}
+
+func (t *tally) add(u Usage) {
+	t.size.Add(u.Size)
+	t.logical.Add(u.Logical)
+	t.shared.Add(u.Shared)
+	if !u.Exact {
+		t.miss()
+	}
+}
+
+func (t *tally) miss() { t.missed.Store(true) }
+
+func (t *tally) usage() Usage {
+	return Usage{Size: t.size.Load(), Logical: t.logical.Load(), Shared: t.shared.Load(), Exact: !t.missed.Load()}
+}
+
+func (u Usage) plus(v Usage) Usage {
+	return Usage{
+		Size:    u.Size + v.Size,
+		Logical: u.Logical + v.Logical,
+		Shared:  u.Shared + v.Shared,
+		Exact:   u.Exact && v.Exact,
+	}
+}
+
+// inode identifies a file across its hard links.
+type inode struct{ dev, ino uint64 }
+
+// fileStat is what the scanner reads from the platform's stat(2) result.
+type fileStat struct {
+	id     inode
+	links  uint64
+	blocks int64 // 512-byte blocks allocated
+	atime  time.Time
+}
+
+// linkSet remembers which path counted each hard-linked file, so measuring
+// that path again counts it again while its other links still count zero.
+type linkSet struct {
+	mu    sync.Mutex
+	owner map[inode]string
+}
+
+// first reports whether path is the link that counts id.
+func (l *linkSet) first(id inode, path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if owner, ok := l.owner[id]; ok {
+		return owner == path
+	}
+	if l.owner == nil {
+		l.owner = make(map[inode]string)
+	}
+	l.owner[id] = path
+	return true
+}
+
+// ignorable reports errors that do not make a count inexact: the file was
+// deleted between listing and stat.
+func ignorable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// Scan lists root's children with their sizes and finds the largest files
+// below it. Only the largest children and files are kept, so directories
+// with millions of entries stay cheap.
+func (s *Scanner) Scan(ctx context.Context, root string) (Result, error) {
+	return s.scan(ctx, root, nil)
+}
+
+// ScanTree is Scan that also keeps the size of every directory below root
+// in a Tree, so later changes can be applied without another full scan.
+func (s *Scanner) ScanTree(ctx context.Context, root string) (*Tree, Result, error) {
+	t := newTree(root)
+	res, err := s.scan(ctx, root, t.root)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	t.root.sumAll()
+	return t, res, nil
+}
+
+// scan does the work of Scan, recording directory sizes under tree when it
+// is not nil.
+func (s *Scanner) scan(ctx context.Context, root string, tree *node) (Result, error) {
+	children, err := os.ReadDir(root)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var files, dirs tally
+
+	// Use heaps to track Top N items, drastically reducing memory usage
+	// for directories with millions of files
+	entriesHeap := &entryHeap{}
+	heap.Init(entriesHeap)
+
+	largeFilesHeap := &largeFileHeap{}
+	heap.Init(largeFilesHeap)
+
+	// Use worker pool for concurrent directory scanning
+	// For I/O-bound operations, use more workers than CPU count
+	numWorkers := min(max(runtime.NumCPU()*cpuMultiplier, minWorkers), maxWorkers, max(len(children), 1))
+	sem := make(chan struct{}, numWorkers)
+	var wg sync.WaitGroup
+
+	// Use channels to collect results without lock contention
+	entryChan := make(chan Entry, len(children))
+	largeFileChan := make(chan File, maxLargeFiles*2)
+	w := &walker{ctx: ctx, progress: s.Progress, links: &linkSet{}, largeFiles: largeFileChan}
+	if tree != nil {
+		w.links = tree.tree.links
+	}
+
+	// Start goroutines to collect from channels into heaps
+	var collectorWg sync.WaitGroup
+	collectorWg.Add(2)
+	go func() {
+		defer collectorWg.Done()
+		for entry := range entryChan {
+			pushEntry(entriesHeap, entry)
+		}
+	}()
+	go func() {
+		defer collectorWg.Done()
+		for file := range largeFileChan {
+			pushLargeFile(largeFilesHeap, file)
+		}
+	}()
+
+	home := os.Getenv("HOME")
+	isHomeDir := home != "" && root == home
+
+	// measure sizes a child directory in the worker pool and hands it to the
+	// collector
+	measure := func(child fs.DirEntry, path string, size func(n *node) Usage) {
+		name := child.Name()
+		n := tree.child(child, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			u := size(n)
+			dirs.add(u)
+			s.Progress.addDirs(1)
+			entryChan <- Entry{Name: name, Path: path, Size: u.Size, Logical: u.Logical, Shared: u.Shared, IsDir: true, Exact: u.Exact}
+		}()
+	}
+
+	for _, child := range children {
+		fullPath := filepath.Join(root, child.Name())
+
+		if child.IsDir() {
+			// Directories skipped on purpose leave the total short
+			if skipChild(root, child.Name()) {
+				files.miss()
+				continue
+			}
+
+			// ~/Library is measured separately in overview mode; reuse that
+			if isHomeDir && child.Name() == "Library" && s.CachedSize != nil {
+				measure(child, fullPath, func(n *node) Usage {
+					if size, ok := s.CachedSize(fullPath); ok {
+						return n.fold(Usage{Size: size, Logical: size})
+					}
+					return w.dirSize(fullPath, n)
+				})
+				continue
+			}
+
+			// For folded directories, calculate size quickly without expanding
+			if shouldFoldDirWithPath(child.Name(), fullPath) {
+				measure(child, fullPath, func(n *node) Usage {
+					return n.fold(w.foldedSize(fullPath))
+				})
+				continue
+			}
+
+			// Normal directory: full scan with detail
+			measure(child, fullPath, func(n *node) Usage {
+				return w.dirSize(fullPath, n)
+			})
+			continue
+		}
+
+		// Files, and symlinks counted without following them
+		entry, err := w.entry(fullPath, child)
+		if err != nil {
+			if !ignorable(err) {
+				files.miss()
+			}
+			continue
+		}
+		files.add(entry.usage())
+		tree.addFile(entry.LastAccess)
+		entryChan <- entry
+		if child.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+		s.Progress.addFiles(1)
+		s.Progress.addBytes(entry.Size)
+
+		// Only track large files that are not code/text files
+		if file, ok := largeFile(entry); ok {
+			largeFileChan <- file
+			tree.addLarge(file)
+		}
+	}
+
+	wg.Wait()
+
+	// Close channels and wait for collectors to finish
+	close(entryChan)
+	close(largeFileChan)
+	collectorWg.Wait()
+
+	// Convert Heaps to sorted slices (Descending order)
+	entries := entriesHeap.sorted()
+	largeFiles := largeFilesHeap.sorted()
+
+	// Try to use Spotlight (mdfind) for faster large file discovery
+	// This is a performance optimization that gracefully falls back to scan results
+	// if Spotlight is unavailable or fails. The fallback is intentionally silent
+	// because users only care about correct results, not the method used.
+	if spotlightFiles := findLargeFilesWithSpotlight(ctx, root, minLargeFileSize); len(spotlightFiles) > 0 {
+		// Spotlight results are already sorted top N
+		largeFiles = spotlightFiles
+	}
+
+	if ctx.Err() != nil {
+		files.miss()
+	}
+	if tree != nil {
+		tree.files = files.usage()
+		tree.total = tree.files.plus(dirs.usage())
+	}
+	total := files.usage().plus(dirs.usage())
+	return Result{
+		Entries:     entries,
+		LargeFiles:  largeFiles,
+		TotalSize:   total.Size,
+		LogicalSize: total.Logical,
+		SharedSize:  total.Shared,
+		Exact:       total.Exact,
+	}, nil
+}
+
+// skipChild reports directories Scan leaves out of root on purpose.
+func skipChild(root, name string) bool {
+	return defaultSkipDirs[name] || (root == "/" && skipSystemDirs[name])
+}
+
+// largeFile reports whether a file entry belongs in the large file list.
+func largeFile(e Entry) (File, bool) {
+	if e.Size < minLargeFileSize || shouldSkipFileForLargeTracking(e.Path) {
+		return File{}, false
+	}
+	return File{Name: e.Name, Path: e.Path, Size: e.Size}, true
+}
+
+func (e Entry) usage() Usage {
+	return Usage{Size: e.Size, Logical: e.Logical, Shared: e.Shared, Exact: e.Exact}
+}
+
+// DirSize returns the space used by everything under root. Unlike Scan it
+// does not hand folded directories to du, and it stops early with an
+// estimated size when ctx is done.
+func (s *Scanner) DirSize(ctx context.Context, root string) Usage {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return Usage{Exact: ignorable(err)}
+	}
+	w := &walker{ctx: ctx, progress: s.Progress, links: &linkSet{}}
+	if !info.IsDir() {
+		return w.file(root, info)
+	}
+	return w.fastDirSize(root)
+}
+
+// walker holds what the recursive size functions share.
+type walker struct {
+	ctx        context.Context
+	progress   Progress
+	links      *linkSet
+	largeFiles chan<- File // nil when large files are not collected
+}
+
+// file measures a file or symlink. Hard links already counted by this scan
+// measure zero.
+func (w *walker) file(path string, info fs.FileInfo) Usage {
+	u := Usage{Size: FileSize(info), Logical: info.Size(), Exact: true}
+	stat, ok := statInfo(info)
+	if !ok || !info.Mode().IsRegular() {
+		return u
+	}
+	if stat.links > 1 {
+		if !w.links.first(stat.id, path) {
+			return Usage{Exact: true}
+		}
+		u.Shared = u.Size
+	} else if u.Size >= cloneCheckSize {
+		if private, ok := privateSize(path); ok && private < u.Size {
+			u.Shared = u.Size - private
+		}
+	}
+	return u
+}
+
+// entry measures a child of a listed directory that is not a directory.
+// Symlinks are marked with an arrow and stay navigable when they point at
+// a directory.
+func (w *walker) entry(path string, d fs.DirEntry) (Entry, error) {
+	info, err := d.Info()
+	if err != nil {
+		return Entry{}, err
+	}
+	u := w.file(path, info)
+	e := Entry{
+		Name:       d.Name(),
+		Path:       path,
+		Size:       u.Size,
+		Logical:    u.Logical,
+		Shared:     u.Shared,
+		LastAccess: lastAccessFromInfo(info),
+		Exact:      true,
+	}
+	if d.Type()&fs.ModeSymlink != 0 {
+		e.Name += " →"
+		target, err := os.Stat(path)
+		e.IsDir = err == nil && target.IsDir()
+	}
+	return e, nil
+}
+
+// foldedSize measures a folded directory, preferring du, which is much
+// faster than walking trees of many small files.
+func (w *walker) foldedSize(path string) Usage {
+	if size, err := duSize(w.ctx, path); err == nil && size > 0 {
+		w.progress.addBytes(size)
+		return Usage{Size: size, Logical: size, Exact: true}
+	}
+	// Fall back to a concurrent walk if du fails
+	return w.fastDirSize(path)
+}
+
+// dirSize walks root concurrently, reporting large files on the way and
+// recording directory sizes under n when it is not nil.
+func (w *walker) dirSize(root string, n *node) Usage {
+	// Read immediate children
+	children, err := os.ReadDir(root)
+	if err != nil {
+		u := Usage{Exact: ignorable(err)}
+		n.set(u, u)
+		return u
+	}
+
+	var files, dirs tally
+	var wg sync.WaitGroup
+
+	// Limit concurrent subdirectory scans to avoid too many goroutines
+	maxConcurrent := min(runtime.NumCPU()*2, maxDirWorkers)
+	sem := make(chan struct{}, maxConcurrent)
+
+	for _, child := range children {
+		if w.ctx.Err() != nil {
+			files.miss()
+			break
+		}
+		fullPath := filepath.Join(root, child.Name())
+
+		if child.IsDir() {
+			c := n.child(child, fullPath)
+			wg.Add(1)
+			go func(name, path string) {
+				defer wg.Done()
+				if shouldFoldDirWithPath(name, path) {
+					dirs.add(c.fold(w.foldedSize(path)))
+				} else {
+					// Recursively scan subdirectory in parallel
+					sem <- struct{}{}
+					dirs.add(w.dirSize(path, c))
+					<-sem
+				}
+				w.progress.addDirs(1)
+			}(child.Name(), fullPath)
+			continue
+		}
+
+		// Files, and symlinks counted without following them
+		info, err := child.Info()
+		if err != nil {
+			if !ignorable(err) {
+				files.miss()
+			}
+			continue
+		}
+
+		u := w.file(fullPath, info)
+		files.add(u)
+		n.addFile(lastAccessFromInfo(info))
+		w.progress.addFiles(1)
+		w.progress.addBytes(u.Size)
+
+		// Track large files
+		if child.Type().IsRegular() && !shouldSkipFileForLargeTracking(fullPath) && u.Size >= minLargeFileSize {
+			file := File{Name: child.Name(), Path: fullPath, Size: u.Size}
+			if w.largeFiles != nil {
+				w.largeFiles <- file
+			}
+			n.addLarge(file)
+		}
+
+		// Update current path occasionally to prevent UI jitter
+		w.progress.setCurrent(fullPath)
+	}
+
+	wg.Wait()
+	total := files.usage().plus(dirs.usage())
+	n.set(files.usage(), total)
+	return total
+}
+
+// fastReaders is shared by every fastDirSize walk in the process, so many
+// concurrent calls do not multiply into thousands of open directories.
+var fastReaders = make(chan struct{}, min(runtime.NumCPU()*cpuMultiplier, maxWorkers))
+
+// fastDirSize walks root, reading subdirectories on extra goroutines while
+// fastReaders has room and on this one otherwise. It gives up after
+// fastWalkTimeout.
+func (w *walker) fastDirSize(root string) Usage {
+	var t tally
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithTimeout(w.ctx, fastWalkTimeout)
+	defer cancel()
+
+	var walk func(string)
+	walk = func(dirPath string) {
+		if ctx.Err() != nil {
+			t.miss()
+			return
+		}
+
+		w.progress.setCurrent(dirPath)
+
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			if !ignorable(err) {
+				t.miss()
+			}
+			return
+		}
+
+		var local Usage
+		var localFiles int64
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				w.progress.addDirs(1)
+				p := filepath.Join(dirPath, entry.Name())
+				// Waiting for a reader here could deadlock, as every reader
+				// may be waiting too, so walk it inline when none is free
+				select {
+				case fastReaders <- struct{}{}:
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer func() { <-fastReaders }()
+						walk(p)
+					}()
+				default:
+					walk(p)
+				}
+				continue
+			}
+			// Files: process immediately
+			info, err := entry.Info()
+			if err != nil {
+				if !ignorable(err) {
+					t.miss()
+				}
+				continue
+			}
+			u := w.file(filepath.Join(dirPath, entry.Name()), info)
+			local.Size += u.Size
+			local.Logical += u.Logical
+			local.Shared += u.Shared
+			localFiles++
+		}
+
+		local.Exact = true
+		t.add(local)
+		w.progress.addBytes(local.Size)
+		w.progress.addFiles(localFiles)
+	}
+
+	walk(root)
+	wg.Wait()
+
+	return t.usage()
+}
+
+func shouldFoldDirWithPath(name, path string) bool {
+	// Check basic fold list first
+	if foldDirs[name] {
+		return true
+	}
+
+	// Special case: npm cache directories - fold all subdirectories
+	// This includes: .npm/_quick/*, .npm/_cacache/*, .npm/a-z/*, .tnpm/*
+	if strings.Contains(path, "/.npm/") || strings.Contains(path, "/.tnpm/") {
+		// Get the parent directory name
+		parent := filepath.Base(filepath.Dir(path))
+		// If parent is a cache folder (_quick, _cacache, etc) or npm dir itself, fold it
+		if parent == ".npm" || parent == ".tnpm" || strings.HasPrefix(parent, "_") {
+			return true
+		}
+		// Also fold single-letter subdirectories (npm cache structure like .npm/a/, .npm/b/)
+		if len(name) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func shouldSkipFileForLargeTracking(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return skipExtensions[ext]
+}
+
+// isInFoldedDir checks if a path is inside a folded directory (optimized)
+func isInFoldedDir(path string) bool {
+	// Split path into components for faster checking
+	parts := strings.Split(path, string(os.PathSeparator))
+	for _, part := range parts {
+		if foldDirs[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// FileSize returns the space a file occupies on disk: its allocated blocks,
+// or its length when that is smaller, as for sparse and cloud files.
+func FileSize(info fs.FileInfo) int64 {
+	stat, ok := statInfo(info)
+	if !ok {
+		return info.Size()
+	}
+
+	actualSize := stat.blocks * 512
+	if actualSize < info.Size() {
+		return actualSize
+	}
+	return info.Size()
+}
+
+// LastAccess returns path's access time, or the zero time if it cannot be
+// read.
+func LastAccess(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return lastAccessFromInfo(info)
+}
+
+func lastAccessFromInfo(info fs.FileInfo) time.Time {
+	stat, ok := statInfo(info)
+	if !ok {
+		return time.Time{}
+	}
+	return stat.atime
+}
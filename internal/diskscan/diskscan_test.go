@@ -0,0 +1,177 @@
+package diskscan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDirSizeCountsWholeTree(t *testing.T) {
+	root := t.TempDir()
+	// The web server used to skip these and stop three levels down
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "c", "d", "e", "deep.bin"), 300)
+	writeFileWithSize(t, filepath.Join(root, "node_modules", "pkg", "index.js"), 200)
+	writeFileWithSize(t, filepath.Join(root, ".git", "objects", "pack"), 100)
+	writeFileWithSize(t, filepath.Join(root, "Library", "Caches", "blob"), 50)
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	link, _ := os.Lstat(filepath.Join(root, "loop"))
+
+	var s Scanner
+	got := s.DirSize(context.Background(), root)
+	if want := 650 + FileSize(link); got.Size != want || !got.Exact {
+		t.Errorf("DirSize = %+v, want %d exact", got, want)
+	}
+
+	if got := s.DirSize(context.Background(), filepath.Join(root, "missing")); got.Size != 0 || !got.Exact {
+		t.Errorf("missing path = %+v", got)
+	}
+}
+
+func TestConcurrentDirSizesShareReaders(t *testing.T) {
+	root := t.TempDir()
+	for i := range 40 {
+		writeFileWithSize(t, filepath.Join(root, strconv.Itoa(i), "x", "y", "f"), 10)
+	}
+
+	var s Scanner
+	var wg sync.WaitGroup
+	for range 2 * cap(fastReaders) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := s.DirSize(context.Background(), root); got.Size != 400 || !got.Exact {
+				t.Errorf("DirSize = %+v, want 400 exact", got)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(fastReaders); n != 0 {
+		t.Errorf("%d readers still held", n)
+	}
+}
+
+func TestDirSizeEstimatedWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "sub", "f"), 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var s Scanner
+	if got := s.DirSize(ctx, root); got.Exact {
+		t.Errorf("cancelled DirSize = %+v, want estimated", got)
+	}
+}
+
+func TestDirSizeEstimatedWhenUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	root := t.TempDir()
+	locked := filepath.Join(root, "locked")
+	writeFileWithSize(t, filepath.Join(locked, "f"), 10)
+	writeFileWithSize(t, filepath.Join(root, "open"), 20)
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0o755)
+
+	var s Scanner
+	if got := s.DirSize(context.Background(), root); got.Size != 20 || got.Exact {
+		t.Errorf("DirSize = %+v, want 20 estimated", got)
+	}
+}
+
+func TestScanFlagsEntries(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "big", "x", "f"), 400)
+	writeFileWithSize(t, filepath.Join(root, "small.bin"), 100)
+	writeFileWithSize(t, filepath.Join(root, "Library", "f"), 5)
+
+	var files int64
+	s := Scanner{Progress: Progress{Files: &files}}
+	res, err := s.Scan(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalSize != 505 || !res.Exact || files != 3 {
+		t.Fatalf("Scan = %+v (%d files)", res, files)
+	}
+	if len(res.Entries) != 3 || res.Entries[0].Name != "big" || !res.Entries[0].Exact {
+		t.Errorf("entries = %+v", res.Entries)
+	}
+
+	// A cached ~/Library size and a deliberately skipped directory make the
+	// total an estimate
+	t.Setenv("HOME", root)
+	writeFileWithSize(t, filepath.Join(root, "Permissions", "f"), 10)
+	s.CachedSize = func(path string) (int64, bool) { return 1000, path == filepath.Join(root, "Library") }
+	res, err = s.Scan(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalSize != 1500 || res.Exact {
+		t.Errorf("Scan with cache = %d exact=%v", res.TotalSize, res.Exact)
+	}
+	for _, e := range res.Entries {
+		if e.Name == "Library" && (e.Size != 1000 || e.Exact) {
+			t.Errorf("Library entry = %+v", e)
+		}
+	}
+}
+
+func TestHardLinksCountedOnce(t *testing.T) {
+	root := t.TempDir()
+	orig := filepath.Join(root, "a", "orig")
+	writeFileWithSize(t, orig, 8192)
+	if err := os.MkdirAll(filepath.Join(root, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(orig, filepath.Join(root, "b", "link")); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+	info, _ := os.Lstat(orig)
+	size := FileSize(info)
+
+	var s Scanner
+	got := s.DirSize(context.Background(), root)
+	if got.Size != size || got.Logical != 8192 || got.Shared != size || !got.Exact {
+		t.Errorf("DirSize = %+v, want %d on disk shared once", got, size)
+	}
+
+	res, err := s.Scan(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalSize != size || res.SharedSize != size {
+		t.Errorf("Scan total = %d shared = %d, want %d", res.TotalSize, res.SharedSize, size)
+	}
+	var sum int64
+	for _, e := range res.Entries {
+		sum += e.Size
+	}
+	if sum != size {
+		t.Errorf("entries add up to %d, want %d", sum, size)
+	}
+}
+
+func TestSparseFileLogicalSize(t *testing.T) {
+	root := t.TempDir()
+	f, err := os.Create(filepath.Join(root, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(64 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var s Scanner
+	got := s.DirSize(context.Background(), root)
+	if got.Logical != 64<<20 || got.Size >= got.Logical || got.Shared != 0 {
+		t.Errorf("DirSize = %+v, want a small on-disk size for a 64MB hole", got)
+	}
+}
@@ -0,0 +1,172 @@
+package diskscan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DuSize measures path with du, minus excludePath when it is set. Only that
+// exact directory is subtracted, so excluding ~/Library does not also drop
+// every other directory named Library.
+func DuSize(ctx context.Context, path, excludePath string) (int64, error) {
+	if excludePath == "" {
+		return duSize(ctx, path)
+	}
+	totalSize, err := duSize(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	excludeSize, err := duSize(ctx, excludePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return 0, err
+		}
+		excludeSize = 0
+	}
+	if excludeSize > totalSize {
+		excludeSize = 0
+	}
+	return totalSize - excludeSize, nil
+}
+
+func duSize(ctx context.Context, target string) (int64, error) {
+	if _, err := os.Stat(target); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "du", "-sk", target)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return 0, fmt.Errorf("du timeout after %v", duTimeout)
+		}
+		if stderr.Len() > 0 {
+			return 0, fmt.Errorf("du failed: %v (%s)", err, stderr.String())
+		}
+		return 0, fmt.Errorf("du failed: %v", err)
+	}
+	fields := strings.Fields(stdout.String())
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("du output empty")
+	}
+	kb, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse du output: %v", err)
+	}
+	if kb <= 0 {
+		return 0, fmt.Errorf("du size invalid: %d", kb)
+	}
+	return kb * 1024, nil
+}
+
+// WalkSize adds up FileSize over a sequential walk of path, skipping
+// excludePath and unreadable directories. Hard links are counted once. It
+// is the slow fallback when du is unavailable.
+func WalkSize(path, excludePath string) (int64, error) {
+	var total int64
+	w := &walker{ctx: context.Background(), links: &linkSet{}}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Skip excluded path
+		if excludePath != "" && p == excludePath {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += w.file(p, info).Size
+		return nil
+	})
+	if err != nil && err != filepath.SkipDir {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Use Spotlight (mdfind) to quickly find large files in a directory
+func findLargeFilesWithSpotlight(ctx context.Context, root string, minSize int64) []File {
+	// mdfind query: files >= minSize in the specified directory
+	query := fmt.Sprintf("kMDItemFSSize >= %d", minSize)
+
+	ctx, cancel := context.WithTimeout(ctx, mdlsTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "mdfind", "-onlyin", root, query)
+	output, err := cmd.Output()
+	if err != nil {
+		// Fallback: mdfind not available or failed
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	var files []File
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		// Filter out code files first (cheapest check, no I/O)
+		if shouldSkipFileForLargeTracking(line) {
+			continue
+		}
+
+		// Filter out files in folded directories (cheap string check)
+		if isInFoldedDir(line) {
+			continue
+		}
+
+		// Use Lstat instead of Stat (faster, doesn't follow symlinks)
+		info, err := os.Lstat(line)
+		if err != nil {
+			continue
+		}
+
+		// Skip if it's a directory or symlink
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		// Get actual disk usage for sparse files and cloud files
+		files = append(files, File{
+			Name: filepath.Base(line),
+			Path: line,
+			Size: FileSize(info),
+		})
+	}
+
+	// Sort by size (descending)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+
+	// Return top N
+	if len(files) > maxLargeFiles {
+		files = files[:maxLargeFiles]
+	}
+
+	return files
+}
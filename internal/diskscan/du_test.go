@@ -1,4 +1,4 @@
-package main
+package diskscan
 
 import (
 	"os"
@@ -17,7 +17,7 @@ func writeFileWithSize(t *testing.T, path string, size int) {
 	}
 }
 
-func TestGetDirectoryLogicalSizeWithExclude(t *testing.T) {
+func TestWalkSizeWithExclude(t *testing.T) {
 	base := t.TempDir()
 	homeFile := filepath.Join(base, "fileA")
 	libFile := filepath.Join(base, "Library", "fileB")
@@ -27,17 +27,17 @@ func TestGetDirectoryLogicalSizeWithExclude(t *testing.T) {
 	writeFileWithSize(t, libFile, 200)
 	writeFileWithSize(t, projectLibFile, 300)
 
-	total, err := getDirectoryLogicalSizeWithExclude(base, "")
+	total, err := WalkSize(base, "")
 	if err != nil {
-		t.Fatalf("getDirectoryLogicalSizeWithExclude (no exclude) error: %v", err)
+		t.Fatalf("WalkSize (no exclude) error: %v", err)
 	}
 	if total != 600 {
 		t.Fatalf("expected total 600 bytes, got %d", total)
 	}
 
-	excluding, err := getDirectoryLogicalSizeWithExclude(base, filepath.Join(base, "Library"))
+	excluding, err := WalkSize(base, filepath.Join(base, "Library"))
 	if err != nil {
-		t.Fatalf("getDirectoryLogicalSizeWithExclude (exclude Library) error: %v", err)
+		t.Fatalf("WalkSize (exclude Library) error: %v", err)
 	}
 	if excluding != 400 {
 		t.Fatalf("expected 400 bytes when excluding top-level Library, got %d", excluding)
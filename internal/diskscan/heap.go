@@ -0,0 +1,84 @@
+package diskscan
+
+import "container/heap"
+
+// entryHeap implements heap.Interface for a min-heap of Entry (sorted by Size)
+// Since we want Top N Largest, we use a Min Heap of size N.
+// When adding a new item:
+// 1. If heap size < N: push
+// 2. If heap size == N and item > min (root): pop min, push item
+// The heap will thus maintain the largest N items.
+type entryHeap []Entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].Size < h[j].Size } // Min-heap based on Size
+func (h entryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x interface{}) {
+	*h = append(*h, x.(Entry))
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// largeFileHeap implements heap.Interface for File
+type largeFileHeap []File
+
+func (h largeFileHeap) Len() int           { return len(h) }
+func (h largeFileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h largeFileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *largeFileHeap) Push(x interface{}) {
+	*h = append(*h, x.(File))
+}
+
+func (h *largeFileHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// pushEntry keeps the maxEntries largest entries in h.
+func pushEntry(h *entryHeap, entry Entry) {
+	if h.Len() < maxEntries {
+		heap.Push(h, entry)
+	} else if entry.Size > (*h)[0].Size {
+		heap.Pop(h)
+		heap.Push(h, entry)
+	}
+}
+
+// pushLargeFile keeps the maxLargeFiles largest files in h.
+func pushLargeFile(h *largeFileHeap, file File) {
+	if h.Len() < maxLargeFiles {
+		heap.Push(h, file)
+	} else if file.Size > (*h)[0].Size {
+		heap.Pop(h)
+		heap.Push(h, file)
+	}
+}
+
+// sorted empties h into a slice, largest first.
+func (h *entryHeap) sorted() []Entry {
+	entries := make([]Entry, h.Len())
+	for i := len(entries) - 1; i >= 0; i-- {
+		entries[i] = heap.Pop(h).(Entry)
+	}
+	return entries
+}
+
+// sorted empties h into a slice, largest first.
+func (h *largeFileHeap) sorted() []File {
+	files := make([]File, h.Len())
+	for i := len(files) - 1; i >= 0; i-- {
+		files[i] = heap.Pop(h).(File)
+	}
+	return files
+}
@@ -0,0 +1,455 @@
+package diskscan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// A saved tree is a snapshot followed by a journal. Both are sequences of
+// frames: a uvarint length, the payload and its CRC-32. The snapshot is a
+// header, one put record per directory, parents first, and an end record.
+// Changes after that are appended as put and delete records, and once the
+// journal outgrows the snapshot the file is written again from scratch.
+// Replay stops at the first damaged frame, so a torn append loses only
+// itself.
+const (
+	indexMagic   = "mole-index"
+	indexVersion = 1
+
+	opPut byte = 1 // A directory's own measurements; creates it if needed
+	opDel byte = 2 // Removes a directory and everything below it
+	opEnd byte = 3 // Marks the end of the snapshot
+
+	maxFrameSize = 1 << 20 // Far more than any record needs
+)
+
+// ErrIndexVersion is returned for a saved tree in a format this version
+// does not read. Scan again to replace it.
+var ErrIndexVersion = errors.New("unsupported index version")
+
+// store tracks the file a tree is saved in.
+type store struct {
+	file     string
+	snapshot int64 // Bytes written by the last full save
+	journal  int64 // Bytes appended since
+	torn     bool  // Replay stopped early; rewrite before appending
+	pending  []change
+}
+
+// change is a journal entry waiting to be written.
+type change struct {
+	node *node  // Directory to write as it is now; nil for a removal
+	path string // Removed directory
+}
+
+// IndexFile returns where the tree for root is saved inside dir.
+func IndexFile(dir, root string) string {
+	return filepath.Join(dir, fmt.Sprintf("%x.idx", xxhash.Sum64String(filepath.Clean(root))))
+}
+
+// CacheDir returns where the analyzer saves its indexes, ~/.cache/mole.
+func CacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "mole"), nil
+}
+
+// FindIndex loads the saved tree that covers path most closely, looking for
+// trees of path and then of each parent in turn.
+func FindIndex(dir, path string) (*Tree, error) {
+	return FindIndexWith(dir, path, LoadTree)
+}
+
+// FindIndexWith is FindIndex reading trees with load, which may return
+// trees it loaded before.
+func FindIndexWith(dir, path string, load func(file string) (*Tree, error)) (*Tree, error) {
+	path = filepath.Clean(path)
+	for p := path; ; p = filepath.Dir(p) {
+		if t, err := load(IndexFile(dir, p)); err == nil && t.Root() == p {
+			if t.find(path) != nil {
+				return t, nil
+			}
+		}
+		if p == filepath.Dir(p) {
+			return nil, fs.ErrNotExist
+		}
+	}
+}
+
+// Save writes the whole tree to file, replacing what was there, and keeps
+// recording later changes there.
+func (t *Tree) Save(file string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save(file)
+}
+
+func (t *Tree) save(file string) error {
+	var e encoder
+	e.string(indexMagic)
+	e.uvarint(indexVersion)
+	e.string(t.root.path)
+	e.time(t.scanned)
+	out := appendFrame(nil, e.buf)
+
+	t.root.each(func(n *node) {
+		out = appendFrame(out, t.encodePut(n))
+	})
+	out = appendFrame(out, []byte{opEnd})
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	t.store = &store{file: file, snapshot: int64(len(out))}
+	return nil
+}
+
+// Sync appends the changes since the last save or sync to the tree's file,
+// compacting it when the journal has grown larger than the snapshot.
+func (t *Tree) Sync() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sync()
+}
+
+func (t *Tree) sync() error {
+	st := t.store
+	if st == nil || len(st.pending) == 0 {
+		return nil
+	}
+
+	var out []byte
+	seen := make(map[*node]bool)
+	for _, c := range st.pending {
+		if c.node == nil {
+			var e encoder
+			e.byte(opDel)
+			e.string(t.rel(c.path))
+			out = appendFrame(out, e.buf)
+			continue
+		}
+		// Each directory once, as it is now; skip those removed since
+		if seen[c.node] || t.find(c.node.path) != c.node {
+			continue
+		}
+		seen[c.node] = true
+		out = appendFrame(out, t.encodePut(c.node))
+	}
+
+	if _, err := os.Stat(st.file); err != nil || st.torn || st.journal+int64(len(out)) > st.snapshot {
+		return t.save(st.file)
+	}
+	f, err := os.OpenFile(st.file, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(out); err != nil {
+		f.Close()
+		// The tail may be torn; the next sync rewrites the file
+		st.torn = true
+		return err
+	}
+	if err := f.Close(); err != nil {
+		st.torn = true
+		return err
+	}
+	st.journal += int64(len(out))
+	st.pending = nil
+	return nil
+}
+
+// changed queues n for the journal of a saved tree.
+func (t *Tree) changed(n *node) {
+	if t.store != nil {
+		t.store.pending = append(t.store.pending, change{node: n})
+	}
+}
+
+// removed queues the removal of n for the journal of a saved tree.
+func (t *Tree) removed(n *node) {
+	if t.store != nil {
+		t.store.pending = append(t.store.pending, change{path: n.path})
+	}
+}
+
+// Refresh measures again the directories whose modification time differs
+// from the one recorded, as after loading a saved tree, and returns how
+// many there were. Files that changed size in place are not noticed.
+func (t *Tree) Refresh() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var stale []*node
+	t.root.each(func(n *node) {
+		info, err := os.Lstat(n.path)
+		if err != nil || !info.ModTime().Equal(n.modTime) {
+			stale = append(stale, n)
+		} else {
+			n.id = dirID(info)
+		}
+	})
+	sort.Slice(stale, func(i, j int) bool { return len(stale[i].path) < len(stale[j].path) })
+	for _, n := range stale {
+		// Skip nodes an earlier apply dropped
+		if n == t.root || t.find(n.path) == n {
+			t.apply(n)
+		}
+	}
+	_ = t.sync()
+	return len(stale)
+}
+
+// LoadTree reads a tree saved with Save, with the changes recorded since.
+// Later changes are recorded in the same file. The tree is neither
+// refreshed nor watched.
+func LoadTree(file string) (*Tree, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	header, rest, ok := readFrame(data)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an index", file)
+	}
+	d := decoder{buf: header}
+	if magic := d.string(); magic != indexMagic || d.err != nil {
+		return nil, fmt.Errorf("%s: not an index", file)
+	}
+	if version := d.uvarint(); version != indexVersion {
+		return nil, fmt.Errorf("%s: %w %d", file, ErrIndexVersion, version)
+	}
+	root := d.string()
+	scanned := d.time()
+	if d.err != nil {
+		return nil, fmt.Errorf("%s: %w", file, d.err)
+	}
+
+	t := newTree(root)
+	t.scanned = scanned
+	st := &store{file: file}
+	for len(rest) > 0 {
+		payload, next, ok := readFrame(rest)
+		if !ok || !t.replay(payload) {
+			st.torn = true
+			break
+		}
+		if payload[0] == opEnd {
+			st.snapshot = int64(len(data) - len(next))
+		}
+		rest = next
+	}
+	if st.snapshot == 0 {
+		return nil, fmt.Errorf("%s: incomplete index", file)
+	}
+	st.journal = int64(len(data)-len(rest)) - st.snapshot
+	t.root.sumAll()
+	t.store = st
+	return t, nil
+}
+
+// rel returns path relative to the root, with slashes.
+func (t *Tree) rel(path string) string {
+	rel, err := filepath.Rel(t.root.path, path)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (t *Tree) encodePut(n *node) []byte {
+	var e encoder
+	e.byte(opPut)
+	e.string(t.rel(n.path))
+	var flags byte
+	if n.folded {
+		flags |= 1
+	}
+	if n.files.Exact {
+		flags |= 2
+	}
+	e.byte(flags)
+	e.varint(n.files.Size)
+	e.varint(n.files.Logical)
+	e.varint(n.files.Shared)
+	e.varint(n.nfiles)
+	e.time(n.modTime)
+	e.time(n.atime)
+	e.uvarint(uint64(len(n.large)))
+	for _, f := range n.large {
+		e.string(f.Name)
+		e.varint(f.Size)
+	}
+	return e.buf
+}
+
+// replay applies one journal record, reporting false for a damaged one.
+// Records for directories whose parent is gone are skipped.
+func (t *Tree) replay(payload []byte) bool {
+	d := decoder{buf: payload}
+	op := d.byte()
+	if op == opEnd {
+		return d.err == nil
+	}
+	rel := d.string()
+	if op == opDel {
+		if n := t.find(t.abs(rel)); n != nil && n != t.root && d.err == nil {
+			delete(n.parent.children, filepath.Base(n.path))
+		}
+		return d.err == nil
+	}
+	if op != opPut {
+		return false
+	}
+
+	flags := d.byte()
+	var files Usage
+	files.Size = d.varint()
+	files.Logical = d.varint()
+	files.Shared = d.varint()
+	files.Exact = flags&2 != 0
+	nfiles := d.varint()
+	modTime := d.time()
+	atime := d.time()
+	count := d.uvarint()
+	if count > uint64(len(d.buf)) {
+		return false
+	}
+	large := make([]File, count)
+	path := t.abs(rel)
+	for i := range large {
+		name := d.string()
+		large[i] = File{Name: name, Path: filepath.Join(path, name), Size: d.varint()}
+	}
+	if d.err != nil {
+		return false
+	}
+
+	n := t.find(path)
+	if n == nil {
+		parent := t.find(filepath.Dir(path))
+		if parent == nil || rel == "" {
+			return true
+		}
+		n = parent.add(filepath.Base(path), path)
+	}
+	n.folded = flags&1 != 0
+	n.files, n.nfiles, n.modTime, n.atime, n.large = files, nfiles, modTime, atime, large
+	return true
+}
+
+// abs turns a path from the journal back into a full path.
+func (t *Tree) abs(rel string) string {
+	if rel == "" {
+		return t.root.path
+	}
+	return filepath.Join(t.root.path, filepath.FromSlash(rel))
+}
+
+func appendFrame(out, payload []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(payload)))
+	out = append(out, payload...)
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(payload))
+}
+
+// readFrame splits the first frame off data, reporting false when it is
+// cut short or its checksum does not match.
+func readFrame(data []byte) (payload, rest []byte, ok bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size == 0 || size > maxFrameSize || len(data)-n < 4 || size > uint64(len(data)-n-4) {
+		return nil, nil, false
+	}
+	payload = data[n : n+int(size)]
+	rest = data[n+int(size):]
+	if binary.LittleEndian.Uint32(rest) != crc32.ChecksumIEEE(payload) {
+		return nil, nil, false
+	}
+	return payload, rest[4:], true
+}
+
+type encoder struct{ buf []byte }
+
+func (e *encoder) byte(b byte)       { e.buf = append(e.buf, b) }
+func (e *encoder) uvarint(v uint64)  { e.buf = binary.AppendUvarint(e.buf, v) }
+func (e *encoder) varint(v int64)    { e.buf = binary.AppendVarint(e.buf, v) }
+func (e *encoder) string(s string)   { e.uvarint(uint64(len(s))); e.buf = append(e.buf, s...) }
+func (e *encoder) time(tm time.Time) { e.varint(unixNano(tm)) }
+
+func unixNano(tm time.Time) int64 {
+	if tm.IsZero() {
+		return 0
+	}
+	return tm.UnixNano()
+}
+
+var errShortRecord = errors.New("index record cut short")
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) == 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	size := d.uvarint()
+	if d.err != nil || uint64(len(d.buf)) < size {
+		d.err = errShortRecord
+		return ""
+	}
+	s := string(d.buf[:size])
+	d.buf = d.buf[size:]
+	return s
+}
+
+func (d *decoder) time() time.Time {
+	if v := d.varint(); v != 0 {
+		return time.Unix(0, v)
+	}
+	return time.Time{}
+}
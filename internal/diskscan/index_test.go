@@ -0,0 +1,240 @@
+package diskscan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func scanTree(t *testing.T, root string) *Tree {
+	t.Helper()
+	var s Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tree.Close() })
+	return tree
+}
+
+func TestTreeDirCounts(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "x"), 10)
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "y"), 20)
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "z"), 30)
+	writeFileWithSize(t, filepath.Join(root, "c", "w"), 40)
+
+	tree := scanTree(t, root)
+	dir, children, ok := tree.Dir(root)
+	if !ok || dir.Size != 100 || dir.Files != 4 || dir.Dirs != 3 || dir.ModTime.IsZero() || dir.LastAccess.IsZero() {
+		t.Fatalf("Dir(root) = %+v %v", dir, ok)
+	}
+	if len(children) != 2 || children[0].Name != "a" || children[0].Files != 3 || children[0].Dirs != 1 {
+		t.Errorf("children = %+v", children)
+	}
+}
+
+func TestTreeSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "f"), 100)
+	writeFileWithSize(t, filepath.Join(root, "node_modules", "pkg", "i.js"), 50)
+	writeFileWithSize(t, filepath.Join(root, "top"), 7)
+
+	tree := scanTree(t, root)
+	want, _, _ := tree.Dir(root)
+	file := IndexFile(t.TempDir(), root)
+	if err := tree.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadTree(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, ok := loaded.Dir(root)
+	if !ok || got.Usage != want.Usage || got.Files != want.Files || got.Dirs != want.Dirs || !got.ModTime.Equal(want.ModTime) {
+		t.Fatalf("loaded %+v, want %+v", got, want)
+	}
+	if !loaded.Scanned().Equal(tree.Scanned()) {
+		t.Errorf("scanned = %v, want %v", loaded.Scanned(), tree.Scanned())
+	}
+	nm, _, _ := tree.Dir(filepath.Join(root, "node_modules"))
+	if got, _, ok := loaded.Dir(nm.Path); !ok || !got.Folded || got.Usage != nm.Usage {
+		t.Errorf("folded dir = %+v %v, want %+v", got, ok, nm)
+	}
+	if res, ok := loaded.Result(filepath.Join(root, "a")); !ok || res.TotalSize != 100 {
+		t.Errorf("Result(a) = %+v %v", res, ok)
+	}
+
+	// Nothing changed, so nothing is measured again
+	if n := loaded.Refresh(); n != 0 {
+		t.Errorf("Refresh after load measured %d directories", n)
+	}
+}
+
+func TestTreeJournalAndCompaction(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		writeFileWithSize(t, filepath.Join(root, name, "f"), 10)
+	}
+	tree := scanTree(t, root)
+	file := IndexFile(t.TempDir(), root)
+	if err := tree.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(file)
+	snapshot := info.Size()
+
+	// A small change is appended rather than rewriting the file
+	if err := os.RemoveAll(filepath.Join(root, "d")); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(root)
+	info, _ = os.Stat(file)
+	if info.Size() <= snapshot {
+		t.Fatalf("size after one change = %d, want more than the snapshot's %d", info.Size(), snapshot)
+	}
+	loaded, err := LoadTree(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, children, _ := loaded.Dir(root); dir.Size != 30 || len(children) != 3 {
+		t.Fatalf("after replay = %+v with %d children, want 30 in 3", dir, len(children))
+	}
+
+	// Many changes compact it back to a snapshot
+	for i := 0; i < 20; i++ {
+		writeFileWithSize(t, filepath.Join(root, "a", "f"), 10+i)
+		tree.Apply(filepath.Join(root, "a"))
+	}
+	if tree.store.journal > tree.store.snapshot {
+		t.Errorf("journal %d bytes outgrew the snapshot's %d", tree.store.journal, tree.store.snapshot)
+	}
+	loaded, err = LoadTree(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _, _ := tree.Dir(root)
+	if got, _, _ := loaded.Dir(root); got.Usage != want.Usage {
+		t.Errorf("after compaction = %+v, want %+v", got.Usage, want.Usage)
+	}
+}
+
+func TestTreeLoadTornJournal(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "f"), 10)
+	tree := scanTree(t, root)
+	file := IndexFile(t.TempDir(), root)
+	if err := tree.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	writeFileWithSize(t, filepath.Join(root, "a", "g"), 20)
+	tree.Apply(filepath.Join(root, "a"))
+
+	// Cut the last record short, as a crash while appending would
+	data, _ := os.ReadFile(file)
+	if err := os.WriteFile(file, data[:len(data)-3], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadTree(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, _, _ := loaded.Dir(root); dir.Size != 10 {
+		t.Errorf("size after torn append = %d, want the snapshot's 10", dir.Size)
+	}
+	// Refresh catches up and the next write replaces the damaged file
+	if n := loaded.Refresh(); n == 0 {
+		t.Error("Refresh found nothing to measure")
+	}
+	loaded, err = LoadTree(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, _, _ := loaded.Dir(root); dir.Size != 30 || loaded.store.torn {
+		t.Errorf("after rewrite = %d (torn %v), want 30", dir.Size, loaded.store.torn)
+	}
+}
+
+func TestLoadTreeRejectsOtherVersions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x.idx")
+	var e encoder
+	e.string(indexMagic)
+	e.uvarint(indexVersion + 1)
+	if err := os.WriteFile(file, appendFrame(nil, e.buf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTree(file); !errors.Is(err, ErrIndexVersion) {
+		t.Errorf("LoadTree = %v, want ErrIndexVersion", err)
+	}
+	if err := os.WriteFile(file, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTree(file); err == nil {
+		t.Error("LoadTree accepted garbage")
+	}
+}
+
+func TestLoadTreeRejectsCorruptFrames(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x.idx")
+	for _, data := range [][]byte{
+		binary.AppendUvarint(nil, math.MaxUint64-3),                // size+4 wraps around to 0
+		append(binary.AppendUvarint(nil, math.MaxUint64), 1, 2, 3), // and to 3
+		append(binary.AppendUvarint(nil, 2), 'x'),                  // shorter than the checksum
+		append(binary.AppendUvarint(nil, 1<<21), 'x'),              // larger than any record
+	} {
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTree(file); err == nil {
+			t.Errorf("LoadTree accepted %x", data)
+		}
+	}
+}
+
+// FuzzLoadTree checks that no index file, however damaged, panics.
+func FuzzLoadTree(f *testing.F) {
+	seed := filepath.Join(f.TempDir(), "seed.idx")
+	tree := newTree("/seed")
+	tree.root.add("a", "/seed/a")
+	if err := tree.Save(seed); err != nil {
+		f.Fatal(err)
+	}
+	data, err := os.ReadFile(seed)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Add(append(binary.AppendUvarint(nil, math.MaxUint64), 1, 2, 3))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file := filepath.Join(t.TempDir(), "x.idx")
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if tree, err := LoadTree(file); err == nil {
+			tree.Dir(tree.Root())
+		}
+	})
+}
+
+func TestFindIndexUsesClosestParent(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "f"), 10)
+	dir := t.TempDir()
+	if err := scanTree(t, root).Save(IndexFile(dir, root)); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := FindIndex(dir, filepath.Join(root, "a", "b"))
+	if err != nil || tree.Root() != root {
+		t.Fatalf("FindIndex = %v, %v", tree, err)
+	}
+	if _, err := FindIndex(dir, filepath.Join(root, "missing")); err == nil {
+		t.Error("FindIndex found a path the tree does not have")
+	}
+}
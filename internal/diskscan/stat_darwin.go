@@ -0,0 +1,64 @@
+//go:build darwin
+
+package diskscan
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func statInfo(info fs.FileInfo) (fileStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{
+		id:     inode{dev: uint64(uint32(stat.Dev)), ino: stat.Ino},
+		links:  uint64(stat.Nlink),
+		blocks: stat.Blocks,
+		atime:  time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec),
+	}, true
+}
+
+const (
+	attrBitMapCount        = 5    // ATTR_BIT_MAP_COUNT
+	attrCmnExtPrivateSize  = 0x8  // ATTR_CMNEXT_PRIVATESIZE
+	fsoptAttrCmnExtended   = 0x20 // FSOPT_ATTR_CMN_EXTENDED
+	fsoptNoFollow          = 0x1  // FSOPT_NOFOLLOW
+	privateSizeReplyLength = 4 + 8
+)
+
+// attrList is struct attrlist from <sys/attr.h>.
+type attrList struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32 // Extended common attributes with FSOPT_ATTR_CMN_EXTENDED
+}
+
+// privateSize asks APFS how much of path's space is its own, i.e. would be
+// freed by deleting it. The rest is shared with clones of the file.
+func privateSize(path string) (int64, bool) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, false
+	}
+	list := attrList{bitmapCount: attrBitMapCount, forkAttr: attrCmnExtPrivateSize}
+	var buf [privateSizeReplyLength]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETATTRLIST,
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&list)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		fsoptAttrCmnExtended|fsoptNoFollow, 0)
+	if errno != 0 || binary.LittleEndian.Uint32(buf[:4]) < privateSizeReplyLength {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(buf[4:])), true
+}
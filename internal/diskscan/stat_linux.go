@@ -0,0 +1,25 @@
+package diskscan
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func statInfo(info fs.FileInfo) (fileStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{
+		id:     inode{dev: uint64(stat.Dev), ino: stat.Ino},
+		links:  uint64(stat.Nlink),
+		blocks: int64(stat.Blocks),
+		atime:  time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)),
+	}, true
+}
+
+// privateSize is only known on APFS.
+func privateSize(string) (int64, bool) {
+	return 0, false
+}
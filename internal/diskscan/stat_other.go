@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package diskscan
+
+import "io/fs"
+
+// statInfo has nothing to add here: sizes are file lengths, access times
+// are unknown and hard links are counted once per link.
+func statInfo(fs.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
+
+// privateSize is only known on APFS.
+func privateSize(string) (int64, bool) {
+	return 0, false
+}
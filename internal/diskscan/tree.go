@@ -0,0 +1,566 @@
+package diskscan
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tree holds the size of every directory below a root, as measured by
+// ScanTree, and keeps them current without walking the root again: Apply
+// measures one changed directory and updates its ancestors, and Watch does
+// that for every change the OS reports.
+type Tree struct {
+	mu        sync.Mutex
+	root      *node
+	links     *linkSet
+	watcher   *watcher
+	unwatched map[string]bool // Directories the watcher could not take
+	scanned   time.Time       // When the full scan ran
+	store     *store          // Where the tree is saved, if it is
+
+	changes   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// node is a directory in a Tree. While ScanTree runs, a node is only
+// written by the goroutine measuring it; afterwards Tree.mu guards it.
+type node struct {
+	tree     *Tree
+	path     string
+	parent   *node
+	children map[string]*node
+	folded   bool  // Measured as a whole; its subdirectories are not kept
+	id       inode // Zero when unknown, as for nodes loaded from an index
+
+	// Measured from the directory itself
+	files   Usage     // Files directly inside; everything for a folded node
+	nfiles  int64     // Number of files directly inside
+	modTime time.Time // Of the directory, to tell when its entries changed
+	atime   time.Time // Most recent access of a file directly inside
+	large   []File    // Large files directly inside
+
+	// Added up from the directory and those below it
+	total      Usage
+	totalFiles int64
+	totalDirs  int64
+	lastAccess time.Time
+}
+
+func newTree(root string) *Tree {
+	t := &Tree{
+		links:   &linkSet{},
+		scanned: time.Now(),
+		changes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	t.root = &node{tree: t, path: filepath.Clean(root)}
+	if info, err := os.Stat(root); err == nil {
+		t.root.modTime = info.ModTime()
+		t.root.id = dirID(info)
+	}
+	return t
+}
+
+// child adds the subdirectory d. It does nothing on a nil node, so the
+// walkers can record into a tree without checking for one.
+func (n *node) child(d fs.DirEntry, path string) *node {
+	if n == nil {
+		return nil
+	}
+	c := n.add(d.Name(), path)
+	if info, err := d.Info(); err == nil {
+		c.modTime = info.ModTime()
+		c.id = dirID(info)
+	}
+	return c
+}
+
+// dirID returns the device and inode of a directory, or zero where the
+// platform does not say.
+func dirID(info fs.FileInfo) inode {
+	stat, _ := statInfo(info)
+	return stat.id
+}
+
+// replaced reports whether the directory now at n's path is a different
+// one, deleted and created again since n was measured. Filesystems may give
+// the new directory the old inode number, but a watch on n is lost either
+// way.
+func (n *node) replaced(info fs.FileInfo) bool {
+	if id := dirID(info); n.id != (inode{}) && id != (inode{}) && id != n.id {
+		return true
+	}
+	t := n.tree
+	return t.watcher != nil && !t.unwatched[n.path] && !t.watcher.watching(n.path)
+}
+
+func (n *node) add(name, path string) *node {
+	c := &node{tree: n.tree, path: path, parent: n}
+	if n.children == nil {
+		n.children = make(map[string]*node)
+	}
+	n.children[name] = c
+	return c
+}
+
+// fold records n as measured as a whole, returning u.
+func (n *node) fold(u Usage) Usage {
+	if n != nil {
+		n.folded = true
+		n.files = u
+		n.total = u
+	}
+	return u
+}
+
+func (n *node) set(files, total Usage) {
+	if n != nil {
+		n.files = files
+		n.total = total
+	}
+}
+
+func (n *node) addFile(atime time.Time) {
+	if n != nil {
+		n.nfiles++
+		if atime.After(n.atime) {
+			n.atime = atime
+		}
+	}
+}
+
+func (n *node) addLarge(file File) {
+	if n != nil {
+		n.large = append(n.large, file)
+	}
+}
+
+// sum adds up n from its own measurements and its children's totals.
+func (n *node) sum() {
+	n.total = n.files
+	n.totalFiles = n.nfiles
+	n.totalDirs = 0
+	n.lastAccess = n.atime
+	for _, c := range n.children {
+		n.total = n.total.plus(c.total)
+		n.totalFiles += c.totalFiles
+		n.totalDirs += 1 + c.totalDirs
+		if c.lastAccess.After(n.lastAccess) {
+			n.lastAccess = c.lastAccess
+		}
+	}
+}
+
+// sumAll adds up every node below n, children first.
+func (n *node) sumAll() {
+	for _, c := range n.children {
+		c.sumAll()
+	}
+	n.sum()
+}
+
+// settle adds up n and its ancestors again.
+func (n *node) settle() {
+	for ; n != nil; n = n.parent {
+		n.sum()
+	}
+}
+
+// dir describes n.
+func (n *node) dir() Dir {
+	return Dir{
+		Name:       filepath.Base(n.path),
+		Path:       n.path,
+		Usage:      n.total,
+		Files:      n.totalFiles,
+		Dirs:       n.totalDirs,
+		ModTime:    n.modTime,
+		LastAccess: n.lastAccess,
+		Folded:     n.folded,
+	}
+}
+
+// each calls fn for n and every node below it.
+func (n *node) each(fn func(*node)) {
+	fn(n)
+	for _, c := range n.children {
+		c.each(fn)
+	}
+}
+
+// Root returns the directory the tree was scanned from.
+func (t *Tree) Root() string {
+	return t.root.path
+}
+
+// Scanned returns when the tree was scanned in full.
+func (t *Tree) Scanned() time.Time {
+	return t.scanned
+}
+
+// Dir is a directory as a Tree knows it.
+type Dir struct {
+	Name string
+	Path string
+	Usage
+	Files      int64 // Files below it at any depth; unknown inside folded directories
+	Dirs       int64 // Directories below it
+	ModTime    time.Time
+	LastAccess time.Time // Most recent access of a file below it
+	Folded     bool      // Measured as a whole; what is below is not indexed
+}
+
+// Dir returns path and its subdirectories, largest first. It reports false
+// when path is not in the tree.
+func (t *Tree) Dir(path string) (Dir, []Dir, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.find(path)
+	if n == nil {
+		return Dir{}, nil, false
+	}
+	children := make([]Dir, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c.dir())
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].Size != children[j].Size {
+			return children[i].Size > children[j].Size
+		}
+		return children[i].Name < children[j].Name
+	})
+	return n.dir(), children, true
+}
+
+// find returns the node for path, or nil when path is outside the tree or
+// inside a folded directory.
+func (t *Tree) find(path string) *node {
+	rel, err := filepath.Rel(t.root.path, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	n := t.root
+	if rel == "." {
+		return n
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if n = n.children[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// walker returns a walker for measuring changes outside a scan.
+func (t *Tree) walker() *walker {
+	return &walker{ctx: context.Background(), links: t.links}
+}
+
+// Result returns what Scan would find under path, from the tree. Only the
+// files directly in path are read again. It reports false when path is not
+// a directory the tree knows in detail.
+func (t *Tree) Result(path string) (Result, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.find(path)
+	if n == nil || n.folded {
+		return Result{}, false
+	}
+	children, err := os.ReadDir(n.path)
+	if err != nil {
+		return Result{}, false
+	}
+
+	entries := &entryHeap{}
+	for name, c := range n.children {
+		pushEntry(entries, Entry{
+			Name:       name,
+			Path:       c.path,
+			Size:       c.total.Size,
+			Logical:    c.total.Logical,
+			Shared:     c.total.Shared,
+			IsDir:      true,
+			LastAccess: c.lastAccess,
+			Exact:      c.total.Exact,
+		})
+	}
+	w := t.walker()
+	for _, child := range children {
+		if child.IsDir() {
+			continue
+		}
+		if e, err := w.entry(filepath.Join(n.path, child.Name()), child); err == nil {
+			pushEntry(entries, e)
+		}
+	}
+
+	large := &largeFileHeap{}
+	n.each(func(d *node) {
+		for _, file := range d.large {
+			pushLargeFile(large, file)
+		}
+	})
+
+	return Result{
+		Entries:     entries.sorted(),
+		LargeFiles:  large.sorted(),
+		TotalSize:   n.total.Size,
+		LogicalSize: n.total.Logical,
+		SharedSize:  n.total.Shared,
+		Exact:       n.total.Exact,
+	}, true
+}
+
+// Apply brings the tree up to date after the entries of dir changed: its
+// files are measured again, new subdirectories are scanned, vanished ones
+// are dropped and the sizes of its ancestors follow. Subdirectories that
+// are still there keep their sizes. Paths outside the tree are ignored. A
+// saved tree records the change in its file.
+func (t *Tree) Apply(dir string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.apply(t.find(dir))
+	_ = t.sync()
+}
+
+func (t *Tree) apply(n *node) {
+	if n == nil {
+		return
+	}
+	info, err := os.Lstat(n.path)
+	if err != nil || !info.IsDir() || (n.parent != nil && n.replaced(info)) {
+		if n.parent != nil {
+			t.drop(n)
+			if err == nil && info.IsDir() {
+				// Measure and watch the new directory from scratch
+				t.apply(n.parent)
+				return
+			}
+			n.parent.settle()
+		}
+		return
+	}
+	n.modTime = info.ModTime()
+	n.id = dirID(info)
+	t.changed(n)
+
+	w := t.walker()
+	if n.folded {
+		n.fold(w.foldedSize(n.path))
+		n.parent.settle()
+		return
+	}
+
+	children, err := os.ReadDir(n.path)
+	if err != nil {
+		n.files, n.nfiles, n.atime, n.large = Usage{}, 0, time.Time{}, nil
+		n.settle()
+		return
+	}
+
+	var files tally
+	n.nfiles, n.atime, n.large = 0, time.Time{}, nil
+	seen := make(map[string]bool)
+	for _, child := range children {
+		path := filepath.Join(n.path, child.Name())
+		if child.IsDir() {
+			if n == t.root && skipChild(n.path, child.Name()) {
+				files.miss()
+				continue
+			}
+			seen[child.Name()] = true
+			if c := n.children[child.Name()]; c != nil {
+				// A directory deleted and created again within one batch
+				// keeps its name but is new, and no longer watched
+				if info, err := child.Info(); err != nil || !c.replaced(info) {
+					continue
+				}
+				t.drop(c)
+			}
+			c := n.child(child, path)
+			if shouldFoldDirWithPath(child.Name(), path) {
+				c.fold(w.foldedSize(path))
+			} else {
+				w.dirSize(path, c)
+			}
+			c.sumAll()
+			c.each(t.changed)
+			t.watch(c)
+			continue
+		}
+
+		info, err := child.Info()
+		if err != nil {
+			if !ignorable(err) {
+				files.miss()
+			}
+			continue
+		}
+		u := w.file(path, info)
+		files.add(u)
+		n.addFile(lastAccessFromInfo(info))
+		if child.Type().IsRegular() && !shouldSkipFileForLargeTracking(path) && u.Size >= minLargeFileSize {
+			n.addLarge(File{Name: child.Name(), Path: path, Size: u.Size})
+		}
+	}
+	for name, c := range n.children {
+		if !seen[name] {
+			t.drop(c)
+		}
+	}
+
+	n.files = files.usage()
+	n.settle()
+}
+
+// drop removes n and everything below it from the tree.
+func (t *Tree) drop(n *node) {
+	delete(n.parent.children, filepath.Base(n.path))
+	t.removed(n)
+	n.each(func(d *node) {
+		delete(t.unwatched, d.path)
+		if t.watcher != nil {
+			t.watcher.remove(d.path)
+		}
+	})
+}
+
+// Watch keeps the tree current as files change below it, until Close. It
+// fails where the OS offers no directory notifications. Directories are
+// watched nearest the root first, up to maxWatches; Unwatched reports those
+// left over, whose changes go unnoticed until they are scanned again.
+// Folded directories are only watched at their top, so changes deep inside
+// node_modules go unnoticed too.
+func (t *Tree) Watch() error {
+	w, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.watcher = w
+	t.watch(t.root)
+	t.mu.Unlock()
+	go t.run(w)
+	return nil
+}
+
+// Unwatched returns how many directories Watch is not watching because
+// the limit was reached or the OS refused.
+func (t *Tree) Unwatched() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.unwatched)
+}
+
+// watch adds n and the directories below it to the watcher, breadth first
+// so that the limit leaves out the deepest directories.
+func (t *Tree) watch(n *node) {
+	if t.watcher == nil {
+		return
+	}
+	queue := []*node{n}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if t.watcher.count() >= maxWatches || t.watcher.add(n.path) != nil {
+			if t.unwatched == nil {
+				t.unwatched = make(map[string]bool)
+			}
+			n.each(func(d *node) { t.unwatched[d.path] = true })
+			continue
+		}
+		if !n.folded {
+			for _, c := range n.children {
+				queue = append(queue, c)
+			}
+		}
+	}
+}
+
+// run applies the directories the watcher reports, a batch at a time.
+func (t *Tree) run(w *watcher) {
+	defer close(t.changes)
+
+	pending := make(map[string]bool)
+	var flush <-chan time.Time
+	for {
+		select {
+		case dir, ok := <-w.events:
+			if !ok {
+				return
+			}
+			pending[dir] = true
+			if flush == nil {
+				flush = time.After(watchDelay)
+			}
+		case <-flush:
+			flush = nil
+			t.applyPending(pending)
+			clear(pending)
+			select {
+			case t.changes <- struct{}{}:
+			default:
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// applyPending applies dirs parents first, so a removed directory is
+// dropped before its children are looked at. An empty path means events
+// were lost and every directory is measured again.
+func (t *Tree) applyPending(pending map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var nodes []*node
+	if pending[""] {
+		t.root.each(func(n *node) { nodes = append(nodes, n) })
+	} else {
+		for dir := range pending {
+			if n := t.find(dir); n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return len(nodes[i].path) < len(nodes[j].path) })
+	for _, n := range nodes {
+		// Skip nodes an earlier apply dropped
+		if n == t.root || t.find(n.path) == n {
+			t.apply(n)
+		}
+	}
+	_ = t.sync()
+}
+
+// Changes receives a value after Watch has applied a batch of changes. It
+// is closed when watching stops.
+func (t *Tree) Changes() <-chan struct{} {
+	return t.changes
+}
+
+// Close stops watching.
+func (t *Tree) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.watcher == nil {
+			close(t.changes)
+			return
+		}
+		err = t.watcher.close()
+	})
+	return err
+}
@@ -0,0 +1,303 @@
+package diskscan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTreeResultMatchesScan(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "docs", "a", "f"), 300)
+	writeFileWithSize(t, filepath.Join(root, "docs", "b"), 200)
+	writeFileWithSize(t, filepath.Join(root, "node_modules", "pkg", "index.js"), 100)
+	writeFileWithSize(t, filepath.Join(root, "top"), 50)
+
+	var s Scanner
+	want, err := s.Scan(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, res, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if res.TotalSize != want.TotalSize || len(res.Entries) != len(want.Entries) {
+		t.Fatalf("ScanTree = %+v, want %+v", res, want)
+	}
+
+	got, ok := tree.Result(root)
+	if !ok || got.TotalSize != want.TotalSize || !got.Exact || len(got.Entries) != 3 {
+		t.Fatalf("Result(root) = %+v %v, want total %d", got, ok, want.TotalSize)
+	}
+	for i := range got.Entries {
+		if got.Entries[i].Name != want.Entries[i].Name || got.Entries[i].Size != want.Entries[i].Size {
+			t.Errorf("entry %d = %+v, want %+v", i, got.Entries[i], want.Entries[i])
+		}
+	}
+
+	docs, ok := tree.Result(filepath.Join(root, "docs"))
+	if !ok || docs.TotalSize != 500 || len(docs.Entries) != 2 || docs.Entries[0].Name != "a" || !docs.Entries[0].IsDir {
+		t.Errorf("Result(docs) = %+v %v", docs, ok)
+	}
+
+	// Folded directories and paths outside the tree need a real scan
+	if _, ok := tree.Result(filepath.Join(root, "node_modules")); ok {
+		t.Error("Result inside a folded directory should miss")
+	}
+	if _, ok := tree.Result(filepath.Dir(root)); ok {
+		t.Error("Result outside the tree should miss")
+	}
+}
+
+func TestTreeApply(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "keep"), 100)
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "gone"), 400)
+	writeFileWithSize(t, filepath.Join(root, "a", "old", "f"), 50)
+
+	var s Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	total := func(path string) int64 {
+		t.Helper()
+		res, ok := tree.Result(path)
+		if !ok {
+			t.Fatalf("Result(%s) missed", path)
+		}
+		return res.TotalSize
+	}
+	if got := total(root); got != 550 {
+		t.Fatalf("initial total = %d", got)
+	}
+
+	// A removed file shrinks its directory and every ancestor
+	if err := os.Remove(filepath.Join(root, "a", "b", "gone")); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(filepath.Join(root, "a", "b"))
+	if got := total(root); got != 150 {
+		t.Errorf("total after removing a file = %d, want 150", got)
+	}
+	if got := total(filepath.Join(root, "a", "b")); got != 100 {
+		t.Errorf("a/b after removing a file = %d, want 100", got)
+	}
+
+	// New directories are scanned, removed ones dropped
+	writeFileWithSize(t, filepath.Join(root, "a", "new", "deep", "f"), 70)
+	if err := os.RemoveAll(filepath.Join(root, "a", "old")); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(filepath.Join(root, "a"))
+	if got := total(root); got != 170 {
+		t.Errorf("total after adding and removing directories = %d, want 170", got)
+	}
+	if got := total(filepath.Join(root, "a", "new", "deep")); got != 70 {
+		t.Errorf("new directory = %d, want 70", got)
+	}
+	if _, ok := tree.Result(filepath.Join(root, "a", "old")); ok {
+		t.Error("removed directory is still in the tree")
+	}
+
+	// A directory that disappeared is dropped when it is applied itself
+	if err := os.RemoveAll(filepath.Join(root, "a", "new")); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(filepath.Join(root, "a", "new", "deep"))
+	tree.Apply(filepath.Join(root, "a", "new"))
+	if got := total(root); got != 100 {
+		t.Errorf("total after removing a/new = %d, want 100", got)
+	}
+}
+
+func TestTreeApplyRescansRecreatedDirectory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "assets")
+	writeFileWithSize(t, filepath.Join(dir, "sub", "old"), 100)
+	tree := scanTree(t, root)
+
+	// mv assets elsewhere && mkdir assets, noticed as a change of root
+	// only. Deleting it instead could hand the new one the same inode.
+	if err := os.Rename(dir, filepath.Join(t.TempDir(), "assets")); err != nil {
+		t.Fatal(err)
+	}
+	writeFileWithSize(t, filepath.Join(dir, "new"), 10)
+	tree.Apply(root)
+
+	if _, ok := tree.Result(filepath.Join(dir, "sub")); ok {
+		t.Error("the old directory's subdirectory is still in the tree")
+	}
+	if res, ok := tree.Result(root); !ok || res.TotalSize != 10 {
+		t.Errorf("total = %d, want 10", res.TotalSize)
+	}
+}
+
+func TestTreeWatchFollowsRecreatedDirectory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "assets")
+	writeFileWithSize(t, filepath.Join(dir, "old"), 100)
+
+	var s Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if err := tree.Watch(); err != nil {
+		t.Skipf("watching unsupported: %v", err)
+	}
+	deadline := time.After(5 * time.Second)
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		for !done() {
+			select {
+			case <-tree.Changes():
+			case <-deadline:
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	total := func(want int64) func() bool {
+		return func() bool {
+			res, ok := tree.Result(root)
+			return ok && res.TotalSize == want
+		}
+	}
+
+	// Usually within one batch, so the name never looks removed
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the old file to go", total(0))
+	waitFor("the new directory", func() bool {
+		_, ok := tree.Result(dir)
+		return ok
+	})
+
+	// The new directory is watched
+	writeFileWithSize(t, filepath.Join(dir, "new"), 10)
+	waitFor("the new file", total(10))
+}
+
+func TestTreeWatchReportsDirectoriesOverTheLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := range maxWatches {
+		if err := os.MkdirAll(filepath.Join(root, strconv.Itoa(i), "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var s Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if err := tree.Watch(); err != nil {
+		t.Skipf("watching unsupported: %v", err)
+	}
+	// Nearest the root first: all but one top-level directory, no "sub"
+	unwatched := tree.Unwatched()
+	if want := 2*maxWatches + 1 - maxWatches; unwatched != want {
+		t.Fatalf("Unwatched = %d, want %d", unwatched, want)
+	}
+	if n := tree.watcher.count(); n != maxWatches {
+		t.Errorf("watching %d directories, want %d", n, maxWatches)
+	}
+	if tree.unwatched[root] {
+		t.Error("root is not watched")
+	}
+
+	// Dropped directories are no longer counted
+	gone := filepath.Join(root, "0")
+	for path := range tree.unwatched {
+		if path == gone || strings.HasPrefix(path, gone+"/") {
+			unwatched--
+		}
+	}
+	if err := os.RemoveAll(gone); err != nil {
+		t.Fatal(err)
+	}
+	tree.Apply(root)
+	if got := tree.Unwatched(); got != unwatched {
+		t.Errorf("Unwatched after removing a directory = %d, want %d", got, unwatched)
+	}
+}
+
+func TestTreeWatch(t *testing.T) {
+	root := t.TempDir()
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "f"), 100)
+
+	var s Scanner
+	tree, _, err := s.ScanTree(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	if err := tree.Watch(); err != nil {
+		t.Skipf("watching unsupported: %v", err)
+	}
+
+	writeFileWithSize(t, filepath.Join(root, "a", "b", "g"), 8192)
+	if err := os.MkdirAll(filepath.Join(root, "a", "c"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var want int64 = 100 + 8192
+	deadline := time.After(5 * time.Second)
+	for {
+		if res, ok := tree.Result(root); ok && res.TotalSize == want {
+			break
+		}
+		select {
+		case <-tree.Changes():
+		case <-deadline:
+			res, _ := tree.Result(root)
+			t.Fatalf("total = %d after watching, want %d", res.TotalSize, want)
+		}
+	}
+	if _, ok := tree.Result(filepath.Join(root, "a", "c")); !ok {
+		t.Error("new directory was not added")
+	}
+
+	// New directories are watched too
+	writeFileWithSize(t, filepath.Join(root, "a", "c", "h"), 10)
+	want += 10
+	for {
+		if res, ok := tree.Result(root); ok && res.TotalSize == want {
+			break
+		}
+		select {
+		case <-tree.Changes():
+		case <-deadline:
+			res, _ := tree.Result(root)
+			t.Fatalf("total = %d after writing into a new directory, want %d", res.TotalSize, want)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-tree.Changes():
+		if ok {
+			// A batch may have been pending; the channel closes right after
+			if _, ok := <-tree.Changes(); ok {
+				t.Error("Changes still open after Close")
+			}
+		}
+	case <-time.After(time.Second):
+		t.Error("Changes not closed after Close")
+	}
+}
@@ -0,0 +1,152 @@
+package diskscan
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// oEvtOnly opens a directory for notifications only, so watching it does
+// not keep its volume from being ejected.
+const oEvtOnly = 0x8000
+
+// watcher reports directories whose entries changed, using kqueue. Each
+// watched directory holds a descriptor. A directory changes when entries
+// are added, removed or renamed; a file growing in place is noticed the
+// next time its directory changes.
+//
+// FSEvents would watch a whole tree with one stream, but it is only
+// reachable through cgo, and scripts/build-*.sh cross-compile the other
+// architecture of the universal binary, where cgo is off. kqueue keeps the
+// binaries pure Go at the cost of the maxWatches limit.
+type watcher struct {
+	kq     int
+	events chan string
+	done   chan struct{}
+
+	mu    sync.Mutex
+	fds   map[string]int
+	paths map[int]string
+}
+
+func newWatcher() (*watcher, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, os.NewSyscallError("kqueue", err)
+	}
+	syscall.CloseOnExec(kq)
+	w := &watcher{
+		kq:     kq,
+		events: make(chan string, 256),
+		done:   make(chan struct{}),
+		fds:    make(map[string]int),
+		paths:  make(map[int]string),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *watcher) add(path string) error {
+	fd, err := syscall.Open(path, oEvtOnly|syscall.O_CLOEXEC|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	ev.Fflags = syscall.NOTE_WRITE | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+	if _, err := syscall.Kevent(w.kq, []syscall.Kevent_t{ev}, nil, nil); err != nil {
+		syscall.Close(fd)
+		return os.NewSyscallError("kevent", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fds[path] = fd
+	w.paths[fd] = path
+	return nil
+}
+
+func (w *watcher) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if fd, ok := w.fds[path]; ok {
+		// Closing the descriptor removes its event
+		syscall.Close(fd)
+		delete(w.fds, path)
+		delete(w.paths, fd)
+	}
+}
+
+// watching reports whether path is watched. It stops being watched when
+// the directory is deleted, even if a new one takes its name.
+func (w *watcher) watching(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.fds[path]
+	return ok
+}
+
+func (w *watcher) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.fds)
+}
+
+// close stops the reader, which releases the descriptors on its way out.
+func (w *watcher) close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *watcher) read() {
+	defer func() {
+		w.mu.Lock()
+		for _, fd := range w.fds {
+			syscall.Close(fd)
+		}
+		w.fds, w.paths = nil, nil
+		w.mu.Unlock()
+		syscall.Close(w.kq)
+		close(w.events)
+	}()
+
+	events := make([]syscall.Kevent_t, 64)
+	timeout := syscall.NsecToTimespec(int64(200 * time.Millisecond))
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+		n, err := syscall.Kevent(w.kq, nil, events, &timeout)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		for _, ev := range events[:n] {
+			fd := int(ev.Ident)
+			w.mu.Lock()
+			dir, ok := w.paths[fd]
+			if ok && ev.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0 {
+				// The descriptor follows the old directory, so let it go
+				// and have the parent look at what has its name now
+				syscall.Close(fd)
+				delete(w.paths, fd)
+				delete(w.fds, dir)
+				dir = filepath.Dir(dir)
+			}
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+			select {
+			case w.events <- dir:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
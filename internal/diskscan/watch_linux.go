@@ -0,0 +1,136 @@
+//go:build linux
+
+package diskscan
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// watcher reports directories whose entries changed, using inotify.
+type watcher struct {
+	file   *os.File
+	fd     int
+	events chan string // An empty path means events were lost
+	done   chan struct{}
+
+	mu    sync.Mutex
+	wds   map[string]int
+	paths map[int]string
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &watcher{
+		// Non-blocking, so Close interrupts a pending Read
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		events: make(chan string, 256),
+		done:   make(chan struct{}),
+		wds:    make(map[string]int),
+		paths:  make(map[int]string),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *watcher) add(path string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wds[path] = wd
+	w.paths[wd] = path
+	return nil
+}
+
+func (w *watcher) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wd, ok := w.wds[path]; ok {
+		_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+		delete(w.wds, path)
+		delete(w.paths, wd)
+	}
+}
+
+// watching reports whether path is watched. It stops being watched when
+// the directory is deleted, even if a new one takes its name.
+func (w *watcher) watching(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.wds[path]
+	return ok
+}
+
+func (w *watcher) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.wds)
+}
+
+func (w *watcher) close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// send hands dir to the tree unless the watcher is closing.
+func (w *watcher) send(dir string) bool {
+	select {
+	case w.events <- dir:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *watcher) read() {
+	defer close(w.events)
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			off += syscall.SizeofInotifyEvent + int(binary.NativeEndian.Uint32(buf[off+12:]))
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				if !w.send("") {
+					return
+				}
+				continue
+			}
+			w.mu.Lock()
+			dir, ok := w.paths[wd]
+			if ok && mask&syscall.IN_IGNORED != 0 {
+				// The directory is gone. Its parent may be unwatched, or
+				// the name reused by a new directory before the batch is
+				// applied, so report the parent to have it looked at
+				delete(w.paths, wd)
+				if w.wds[dir] == wd {
+					delete(w.wds, dir)
+				}
+				dir = filepath.Dir(dir)
+			}
+			w.mu.Unlock()
+			if ok && !w.send(dir) {
+				return
+			}
+		}
+	}
+}
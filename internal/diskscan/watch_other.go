@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package diskscan
+
+import "errors"
+
+// watcher is not implemented here; trees are kept current with Apply only.
+type watcher struct {
+	events chan string
+}
+
+func newWatcher() (*watcher, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (w *watcher) add(string) error     { return errors.ErrUnsupported }
+func (w *watcher) remove(string)        {}
+func (w *watcher) watching(string) bool { return false }
+func (w *watcher) count() int           { return 0 }
+func (w *watcher) close() error         { return nil }
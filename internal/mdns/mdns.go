@@ -0,0 +1,532 @@
+// Package mdns advertises and browses DNS-SD services over multicast DNS
+// (RFC 6762 and RFC 6763). It covers what Mole needs and no more: one
+// service instance per process, and one-shot browsing over IPv4.
+package mdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// TTLs recommended by RFC 6762 section 10.
+const (
+	hostTTL    = 120
+	serviceTTL = 4500
+	// Responses to legacy unicast queries must not be cached for long.
+	legacyTTL = 10
+)
+
+// Probing timings from RFC 6762 section 8.1.
+const (
+	probeCount    = 3
+	probeInterval = 250 * time.Millisecond
+	// After this many conflicts, probe only every probeBackoff.
+	probeConflicts = 15
+	probeBackoff   = 5 * time.Second
+	// How long to wait after losing a simultaneous probe (section 8.2).
+	probeDefer = time.Second
+)
+
+// servicesName is queried to enumerate the service types on a network.
+const servicesName = "_services._dns-sd._udp.local."
+
+// Service describes an advertised service instance.
+type Service struct {
+	Instance string // Instance name, e.g. "studio"; may not contain dots
+	Service  string // Service type, e.g. "_mole._tcp"
+	// Host is the machine's own mDNS name without ".local". The SRV record
+	// points at it, but its addresses are left to the operating system's
+	// responder (mDNSResponder or Avahi), which owns that name.
+	Host string
+	Port int
+	TXT  []string // "key=value" entries
+}
+
+func (s Service) serviceName() string  { return s.Service + ".local." }
+func (s Service) instanceName() string { return s.Instance + "." + s.serviceName() }
+func (s Service) hostName() string     { return s.Host + ".local." }
+
+// Responder answers mDNS queries for one service instance.
+type Responder struct {
+	mu       sync.Mutex
+	svc      Service
+	base     string // Instance name before any renaming
+	conn     *net.UDPConn
+	probed   bool      // The instance name is ours to answer for
+	conflict chan bool // Set while probing; true if the name is taken
+}
+
+func NewResponder(svc Service) *Responder {
+	svc.Instance = strings.ReplaceAll(svc.Instance, ".", "-")
+	return &Responder{svc: svc, base: svc.Instance}
+}
+
+// Instance returns the instance name, which probing may have changed to
+// avoid another host's, e.g. to "studio (2)".
+func (r *Responder) Instance() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.svc.Instance
+}
+
+// SetTXT replaces the TXT entries, announcing the change if they differ.
+func (r *Responder) SetTXT(txt []string) {
+	r.mu.Lock()
+	same := strings.Join(r.svc.TXT, "\x00") == strings.Join(txt, "\x00")
+	r.svc.TXT = txt
+	conn := r.conn
+	if !r.probed {
+		conn = nil // Announced once probing is done
+	}
+	r.mu.Unlock()
+	if !same && conn != nil {
+		r.announce(conn, serviceTTL)
+	}
+}
+
+// Serve claims the instance name by probing, announces the service and
+// answers queries until ctx is done, then sends a goodbye so browsers
+// forget the instance at once.
+func (r *Responder) Serve(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.mu.Lock()
+	r.conn = conn
+	r.probed = false
+	r.conflict = make(chan bool, 1)
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		if !r.probe(ctx, conn, done) {
+			conn.Close()
+			return
+		}
+		// Announce twice, one second apart (RFC 6762 section 8.3)
+		r.announce(conn, serviceTTL)
+		select {
+		case <-time.After(time.Second):
+			r.announce(conn, serviceTTL)
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		select {
+		case <-ctx.Done():
+			r.announce(conn, 0)
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		m, err := unpack(buf[:n])
+		if err != nil {
+			continue
+		}
+		r.mu.Lock()
+		probed := r.probed
+		r.mu.Unlock()
+		if !probed {
+			r.checkProbeConflict(m)
+			continue
+		}
+		if m.Response {
+			continue
+		}
+		resp := r.answer(m)
+		if resp == nil {
+			continue
+		}
+		switch {
+		case src.Port != groupAddr.Port:
+			// Legacy unicast query (RFC 6762 section 6.7): reply directly,
+			// echoing the ID and questions, with short uncached records
+			resp.ID = m.ID
+			resp.Questions = m.Questions
+			for _, rrs := range [][]record{resp.Answers, resp.Extra} {
+				for i := range rrs {
+					rrs[i].Class &^= classTopBit
+					rrs[i].TTL = legacyTTL
+				}
+			}
+			conn.WriteToUDP(resp.pack(), src)
+		case unicastRequested(m):
+			conn.WriteToUDP(resp.pack(), src)
+		default:
+			conn.WriteToUDP(resp.pack(), groupAddr)
+		}
+	}
+}
+
+func unicastRequested(m *message) bool {
+	for _, q := range m.Questions {
+		if q.Class&classTopBit == 0 {
+			return false
+		}
+	}
+	return len(m.Questions) > 0
+}
+
+// probe claims the instance name as RFC 6762 section 8.1 describes: it
+// asks three times, 250ms apart, whether any host already has records for
+// the name, and picks a new name each time one does. It returns false if
+// ctx or done ends first.
+func (r *Responder) probe(ctx context.Context, conn *net.UDPConn, done <-chan struct{}) bool {
+	wait := func(d time.Duration) (taken, lost, ok bool) {
+		select {
+		case <-time.After(d):
+			return false, false, true
+		case taken := <-r.conflict:
+			return taken, !taken, true
+		case <-ctx.Done():
+		case <-done:
+		}
+		return false, false, false
+	}
+
+	// Start after a random delay so hosts booting together don't collide
+	delay := time.Duration(rand.Int64N(int64(probeInterval)))
+	for conflicts := 0; ; {
+		if conflicts >= probeConflicts {
+			delay = probeBackoff
+		}
+		if _, _, ok := wait(delay); !ok {
+			return false
+		}
+		select {
+		case <-r.conflict: // About a name or a round we are done with
+		default:
+		}
+		taken, lost := false, false
+		for i := 0; i < probeCount && !taken && !lost; i++ {
+			r.sendProbe(conn, i == 0)
+			var ok bool
+			if taken, lost, ok = wait(probeInterval); !ok {
+				return false
+			}
+		}
+		switch {
+		case taken:
+			conflicts++
+			r.mu.Lock()
+			r.svc.Instance = fmt.Sprintf("%s (%d)", r.base, conflicts+1)
+			r.mu.Unlock()
+			delay = 0
+		case lost:
+			delay = probeDefer
+		default:
+			r.mu.Lock()
+			r.probed = true
+			r.mu.Unlock()
+			return true
+		}
+	}
+}
+
+// sendProbe asks for any record named after the instance, proposing this
+// responder's own in the authority section. Only the first probe asks for
+// a unicast reply.
+func (r *Responder) sendProbe(conn *net.UDPConn, unicast bool) {
+	r.mu.Lock()
+	name := r.svc.instanceName()
+	proposed := r.proposed()
+	r.mu.Unlock()
+	q := question{Name: name, Type: typeANY, Class: classIN}
+	if unicast {
+		q.Class |= classTopBit
+	}
+	m := &message{Questions: []question{q}, Authority: proposed}
+	conn.WriteToUDP(m.pack(), groupAddr)
+}
+
+// proposed returns the unique records a probe puts in its authority
+// section, without the cache-flush bit. Callers hold r.mu.
+func (r *Responder) proposed() []record {
+	_, srv, txt := r.records()
+	srv.Class &^= classTopBit
+	txt.Class &^= classTopBit
+	return []record{srv, txt}
+}
+
+// checkProbeConflict reports on r.conflict whether m shows the instance
+// name being probed for is in use: another host answers for it, or probes
+// for it at the same time with records that win the tiebreak of RFC 6762
+// section 8.2. Our own probes, looped back, tie and are ignored.
+func (r *Responder) checkProbeConflict(m *message) {
+	r.mu.Lock()
+	name := r.svc.instanceName()
+	ours := r.proposed()
+	r.mu.Unlock()
+	named := func(rrs ...[]record) []record {
+		var found []record
+		for _, rr := range rrs {
+			for _, x := range rr {
+				if strings.EqualFold(x.Name, name) {
+					found = append(found, x)
+				}
+			}
+		}
+		return found
+	}
+
+	var taken bool
+	if m.Response {
+		if len(named(m.Answers, m.Extra)) == 0 {
+			return
+		}
+		taken = true
+	} else {
+		theirs := named(m.Authority)
+		if len(theirs) == 0 || compareRecords(ours, theirs) >= 0 {
+			return
+		}
+	}
+	select {
+	case r.conflict <- taken:
+	default:
+	}
+}
+
+// compareRecords orders two sets of proposed records as the tiebreak of
+// RFC 6762 section 8.2 does: each set sorted, then record by record on
+// class, type and data, and a longer set wins when one is a prefix.
+func compareRecords(a, b []record) int {
+	key := func(rr record) []byte {
+		k := binary.BigEndian.AppendUint16(nil, rr.Class&^classTopBit)
+		k = binary.BigEndian.AppendUint16(k, rr.Type)
+		return appendData(k, rr)
+	}
+	keys := func(rrs []record) [][]byte {
+		ks := make([][]byte, len(rrs))
+		for i, rr := range rrs {
+			ks[i] = key(rr)
+		}
+		sort.Slice(ks, func(i, j int) bool { return bytes.Compare(ks[i], ks[j]) < 0 })
+		return ks
+	}
+	ka, kb := keys(a), keys(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if c := bytes.Compare(ka[i], kb[i]); c != 0 {
+			return c
+		}
+	}
+	return len(ka) - len(kb)
+}
+
+func (r *Responder) announce(conn *net.UDPConn, ttl uint32) {
+	r.mu.Lock()
+	ptr, srv, txt := r.records()
+	r.mu.Unlock()
+	answers := []record{ptr, srv, txt}
+	for i := range answers {
+		if ttl == 0 || answers[i].TTL > ttl {
+			answers[i].TTL = ttl
+		}
+	}
+	m := &message{Response: true, Answers: answers}
+	conn.WriteToUDP(m.pack(), groupAddr)
+}
+
+// records returns the service's records. The SRV and TXT records are
+// unique to this instance; the host's address records are not ours to
+// publish. Callers hold r.mu.
+func (r *Responder) records() (ptr, srv, txt record) {
+	s := r.svc
+	unique := classIN | classTopBit // Records only this host publishes
+	ptr = record{Name: s.serviceName(), Type: typePTR, Class: classIN, TTL: serviceTTL, Target: s.instanceName()}
+	srv = record{Name: s.instanceName(), Type: typeSRV, Class: unique, TTL: hostTTL, Port: uint16(s.Port), Target: s.hostName()}
+	txt = record{Name: s.instanceName(), Type: typeTXT, Class: unique, TTL: serviceTTL, Text: s.TXT}
+	return ptr, srv, txt
+}
+
+// answer builds the response to query, or nil if none of its questions
+// are about this service.
+func (r *Responder) answer(query *message) *message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ptr, srv, txt := r.records()
+	s := r.svc
+
+	resp := &message{Response: true}
+	matches := func(q question, name string, types ...uint16) bool {
+		if !strings.EqualFold(q.Name, name) {
+			return false
+		}
+		for _, t := range types {
+			if q.Type == t || q.Type == typeANY {
+				return true
+			}
+		}
+		return false
+	}
+	for _, q := range query.Questions {
+		switch {
+		case matches(q, servicesName, typePTR):
+			resp.Answers = append(resp.Answers, record{Name: servicesName, Type: typePTR, Class: classIN, TTL: serviceTTL, Target: s.serviceName()})
+		case matches(q, s.serviceName(), typePTR):
+			resp.Answers = append(resp.Answers, ptr)
+			resp.Extra = append(resp.Extra, srv, txt)
+		case strings.EqualFold(q.Name, s.instanceName()):
+			if matches(q, s.instanceName(), typeSRV) {
+				resp.Answers = append(resp.Answers, srv)
+			}
+			if matches(q, s.instanceName(), typeTXT) {
+				resp.Answers = append(resp.Answers, txt)
+			}
+		}
+	}
+	if len(resp.Answers) == 0 {
+		return nil
+	}
+	return resp
+}
+
+// Entry is a service instance found by Browse.
+type Entry struct {
+	Instance string            `json:"instance"`
+	Host     string            `json:"host"` // Without ".local"
+	Port     int               `json:"port"`
+	IPs      []net.IP          `json:"ips"`
+	TXT      map[string]string `json:"txt"`
+}
+
+// Browse asks for instances of service (e.g. "_mole._tcp") and returns the
+// ones that answer before ctx is done. The query is sent from an ephemeral
+// port, so responders reply to it directly and port 5353 need not be free.
+// ctx should carry a timeout: browsing has no natural end.
+func Browse(ctx context.Context, service string) ([]Entry, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	query := &message{Questions: []question{{Name: service + ".local.", Type: typePTR, Class: classIN}}}
+	if _, err := conn.WriteToUDP(query.pack(), groupAddr); err != nil {
+		return nil, err
+	}
+	// Ask again in case the first packet was lost
+	resend := time.AfterFunc(time.Second, func() { conn.WriteToUDP(query.pack(), groupAddr) })
+	defer resend.Stop()
+
+	var responses []*message
+	asked := make(map[string]bool) // Host names whose addresses were asked for
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		m, err := unpack(buf[:n])
+		if err != nil || !m.Response {
+			continue
+		}
+		responses = append(responses, m)
+		// Responders leave their host's addresses to the host's own
+		// responder, so ask it for them
+		var questions []question
+		for _, rr := range append(append([]record(nil), m.Answers...), m.Extra...) {
+			if host := strings.ToLower(rr.Target); rr.Type == typeSRV && !asked[host] {
+				asked[host] = true
+				questions = append(questions,
+					question{Name: rr.Target, Type: typeA, Class: classIN},
+					question{Name: rr.Target, Type: typeAAAA, Class: classIN})
+			}
+		}
+		if len(questions) > 0 {
+			conn.WriteToUDP((&message{Questions: questions}).pack(), groupAddr)
+		}
+	}
+	return entries(service, responses), nil
+}
+
+// entries assembles the instances of service described by responses.
+func entries(service string, responses []*message) []Entry {
+	serviceName := strings.ToLower(service + ".local.")
+	instances := make(map[string]string) // Lowercased full name to instance name
+	srvs := make(map[string]record)
+	txts := make(map[string]record)
+	ips := make(map[string][]net.IP)
+	for _, m := range responses {
+		for _, rr := range append(append([]record(nil), m.Answers...), m.Extra...) {
+			name := strings.ToLower(rr.Name)
+			switch rr.Type {
+			case typePTR:
+				target := strings.ToLower(rr.Target)
+				if name == serviceName && strings.HasSuffix(target, "."+serviceName) && rr.TTL > 0 {
+					instances[target] = rr.Target[:len(rr.Target)-len(serviceName)-1]
+				}
+			case typeSRV:
+				srvs[name] = rr
+			case typeTXT:
+				txts[name] = rr
+			case typeA, typeAAAA:
+				if !containsIP(ips[name], rr.IP) {
+					ips[name] = append(ips[name], rr.IP)
+				}
+			}
+		}
+	}
+
+	var found []Entry
+	for full, instance := range instances {
+		srv, ok := srvs[full]
+		if !ok {
+			continue
+		}
+		e := Entry{
+			Instance: instance,
+			Host:     strings.TrimSuffix(strings.TrimSuffix(srv.Target, "."), ".local"),
+			Port:     int(srv.Port),
+			IPs:      ips[strings.ToLower(srv.Target)],
+			TXT:      make(map[string]string),
+		}
+		for _, kv := range txts[full].Text {
+			k, v, _ := strings.Cut(kv, "=")
+			e.TXT[strings.ToLower(k)] = v
+		}
+		found = append(found, e)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Instance < found[j].Instance })
+	return found
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, x := range ips {
+		if x.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func testService() Service {
+	return Service{
+		Instance: "studio.lan",
+		Service:  "_mole._tcp",
+		Host:     "studio",
+		Port:     8081,
+		TXT:      []string{"version=1.2.0", "auth=required"},
+	}
+}
+
+func TestAnswerBrowseQueryRoundTrip(t *testing.T) {
+	r := NewResponder(testService())
+	query := &message{Questions: []question{{Name: "_MOLE._tcp.local.", Type: typePTR, Class: classIN | classTopBit}}}
+
+	parsed, err := unpack(query.pack())
+	if err != nil || parsed.Questions[0].Name != "_MOLE._tcp.local." || !unicastRequested(parsed) {
+		t.Fatalf("query round trip: %+v, %v", parsed, err)
+	}
+
+	resp := r.answer(parsed)
+	if resp == nil {
+		t.Fatal("no answer for the service's PTR query")
+	}
+	decoded, err := unpack(resp.pack())
+	if err != nil {
+		t.Fatalf("unpack response: %v", err)
+	}
+	if !decoded.Response || len(decoded.Answers) != 1 || len(decoded.Extra) != 2 {
+		t.Fatalf("response = %+v", decoded)
+	}
+
+	// The host's addresses come from its own responder
+	addrs := &message{Response: true, Answers: []record{
+		{Name: "studio.local.", Type: typeA, Class: classIN, TTL: hostTTL, IP: net.ParseIP("10.0.0.5").To4()},
+		{Name: "studio.local.", Type: typeAAAA, Class: classIN, TTL: hostTTL, IP: net.ParseIP("fe80::1")},
+	}}
+	if addrs, err = unpack(addrs.pack()); err != nil {
+		t.Fatalf("unpack addresses: %v", err)
+	}
+	found := entries("_mole._tcp", []*message{decoded, decoded, addrs})
+	if len(found) != 1 {
+		t.Fatalf("entries = %+v", found)
+	}
+	e := found[0]
+	if e.Instance != "studio-lan" || e.Host != "studio" || e.Port != 8081 {
+		t.Errorf("entry = %+v", e)
+	}
+	if len(e.IPs) != 2 || !e.IPs[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("ips = %v", e.IPs)
+	}
+	if e.TXT["version"] != "1.2.0" || e.TXT["auth"] != "required" {
+		t.Errorf("txt = %v", e.TXT)
+	}
+}
+
+func TestAnswerIgnoresOtherNames(t *testing.T) {
+	r := NewResponder(testService())
+	for _, q := range []question{
+		{Name: "_http._tcp.local.", Type: typePTR, Class: classIN},
+		{Name: "other.local.", Type: typeA, Class: classIN},
+		{Name: "studio.local.", Type: typeSRV, Class: classIN},
+		// The host name belongs to the operating system's responder
+		{Name: "studio.local.", Type: typeA, Class: classIN},
+		{Name: "studio.local.", Type: typeANY, Class: classIN},
+	} {
+		if resp := r.answer(&message{Questions: []question{q}}); resp != nil {
+			t.Errorf("%+v answered: %+v", q, resp)
+		}
+	}
+}
+
+func TestProbeConflicts(t *testing.T) {
+	r := NewResponder(testService())
+	r.conflict = make(chan bool, 1)
+	r.mu.Lock()
+	name, ours := r.svc.instanceName(), r.proposed()
+	r.mu.Unlock()
+	for _, rr := range ours {
+		if rr.Class&classTopBit != 0 {
+			t.Errorf("proposed record has the cache-flush bit: %+v", rr)
+		}
+	}
+	signal := func() (taken, ok bool) {
+		select {
+		case taken := <-r.conflict:
+			return taken, true
+		default:
+			return false, false
+		}
+	}
+
+	// Our own probe, looped back, ties
+	r.checkProbeConflict(&message{Questions: []question{{Name: name, Type: typeANY, Class: classIN}}, Authority: ours})
+	if _, ok := signal(); ok {
+		t.Error("own probe reported as a conflict")
+	}
+
+	// A host answering for the name has it already
+	other := ours[0]
+	other.Port++
+	r.checkProbeConflict(&message{Response: true, Answers: []record{other}})
+	if taken, ok := signal(); !ok || !taken {
+		t.Errorf("answer for the name: taken = %v, %v", taken, ok)
+	}
+
+	// Simultaneous probes: the lexicographically later records win
+	r.checkProbeConflict(&message{Authority: []record{other, ours[1]}})
+	if taken, ok := signal(); !ok || taken {
+		t.Errorf("later probe: taken = %v, %v", taken, ok)
+	}
+	other.Port -= 2
+	r.checkProbeConflict(&message{Authority: []record{other, ours[1]}})
+	if _, ok := signal(); ok {
+		t.Error("earlier probe reported as a conflict")
+	}
+}
+
+func TestProbeRenamesOnConflict(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	defer conn.Close()
+	r := NewResponder(testService())
+	r.conflict = make(chan bool, 1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for r.Instance() == "studio-lan" {
+			select {
+			case r.conflict <- true:
+			case <-stop:
+				return
+			default:
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	if !r.probe(context.Background(), conn, stop) {
+		t.Fatal("probe gave up")
+	}
+	if got := r.Instance(); got != "studio-lan (2)" {
+		t.Errorf("instance = %q", got)
+	}
+	r.mu.Lock()
+	probed := r.probed
+	r.mu.Unlock()
+	if !probed {
+		t.Error("not marked as probed")
+	}
+}
+
+func TestReadNameFollowsCompressionPointers(t *testing.T) {
+	// "_mole._tcp.local." at 12, then "studio" + pointer to it
+	b := make([]byte, 12)
+	b = appendName(b, "_mole._tcp.local.")
+	at := len(b)
+	b = append(b, 6)
+	b = append(b, "studio"...)
+	b = append(b, 0xC0, 12)
+
+	name, next, err := readName(b, at)
+	if err != nil || name != "studio._mole._tcp.local." || next != len(b) {
+		t.Fatalf("readName = %q, %d, %v", name, next, err)
+	}
+
+	// A pointer to itself must not loop forever
+	loop := append(make([]byte, 12), 0xC0, 12)
+	if _, _, err := readName(loop, 12); err == nil {
+		t.Error("expected error for pointer loop")
+	}
+	if _, err := unpack([]byte{0, 0, 0x84, 0, 0, 1}); err == nil {
+		t.Error("expected error for short message")
+	}
+}
+
+func TestGoodbyeRemovesInstance(t *testing.T) {
+	r := NewResponder(testService())
+	resp := r.answer(&message{Questions: []question{{Name: "_mole._tcp.local.", Type: typePTR, Class: classIN}}})
+	resp.Answers[0].TTL = 0
+	if found := entries("_mole._tcp", []*message{resp}); len(found) != 0 {
+		t.Errorf("goodbye still listed: %+v", found)
+	}
+}
+
+func TestServeAndBrowse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewResponder(testService())
+	errc := make(chan error, 1)
+	go func() { errc <- r.Serve(ctx) }()
+	// Wait for probing to finish
+	for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		select {
+		case err := <-errc:
+			t.Skipf("multicast unavailable: %v", err)
+		default:
+		}
+		r.mu.Lock()
+		probed := r.probed
+		r.mu.Unlock()
+		if probed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("probing did not finish")
+		}
+	}
+
+	browseCtx, browseCancel := context.WithTimeout(ctx, 1500*time.Millisecond)
+	defer browseCancel()
+	found, err := Browse(browseCtx, "_mole._tcp")
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	if len(found) == 0 {
+		t.Skip("no multicast loopback on this host")
+	}
+	if found[0].Port != 8081 {
+		t.Errorf("found = %+v", found)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DNS record types and classes used by DNS-SD.
+const (
+	typeA    uint16 = 1
+	typePTR  uint16 = 12
+	typeTXT  uint16 = 16
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+	typeANY  uint16 = 255
+
+	classIN uint16 = 1
+	// The top bit of the class is the unicast-response bit in questions
+	// and the cache-flush bit in records (RFC 6762 sections 5.4 and 10.2).
+	classTopBit uint16 = 1 << 15
+)
+
+var errMalformed = errors.New("mdns: malformed message")
+
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// record is a resource record. Which data fields are used depends on Type.
+type record struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	Target string   // PTR and SRV
+	Port   uint16   // SRV
+	Text   []string // TXT
+	IP     net.IP   // A and AAAA
+}
+
+type message struct {
+	ID        uint16
+	Response  bool
+	Questions []question
+	Answers   []record
+	Authority []record // Records proposed by a probe
+	Extra     []record // Additional section
+}
+
+// pack encodes m without name compression.
+func (m *message) pack() []byte {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	if m.Response {
+		binary.BigEndian.PutUint16(b[2:], 0x8400) // QR and AA
+	}
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Extra)))
+
+	for _, q := range m.Questions {
+		b = appendName(b, q.Name)
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, rrs := range [][]record{m.Answers, m.Authority, m.Extra} {
+		for _, rr := range rrs {
+			b = appendName(b, rr.Name)
+			b = binary.BigEndian.AppendUint16(b, rr.Type)
+			b = binary.BigEndian.AppendUint16(b, rr.Class)
+			b = binary.BigEndian.AppendUint32(b, rr.TTL)
+			lenAt := len(b)
+			b = appendData(append(b, 0, 0), rr)
+			binary.BigEndian.PutUint16(b[lenAt:], uint16(len(b)-lenAt-2))
+		}
+	}
+	return b
+}
+
+// appendData encodes rr's data.
+func appendData(b []byte, rr record) []byte {
+	switch rr.Type {
+	case typePTR:
+		b = appendName(b, rr.Target)
+	case typeSRV:
+		b = append(b, 0, 0, 0, 0) // Priority and weight
+		b = binary.BigEndian.AppendUint16(b, rr.Port)
+		b = appendName(b, rr.Target)
+	case typeTXT:
+		if len(rr.Text) == 0 {
+			b = append(b, 0)
+		}
+		for _, s := range rr.Text {
+			if len(s) > 255 {
+				s = s[:255]
+			}
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+	case typeA:
+		b = append(b, rr.IP.To4()...)
+	case typeAAAA:
+		b = append(b, rr.IP.To16()...)
+	}
+	return b
+}
+
+// appendName encodes a dotted name. Labels are not escaped, so a label
+// cannot contain a dot.
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// unpack decodes a message, skipping records of types it does not know.
+func unpack(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+	m := &message{
+		ID:       binary.BigEndian.Uint16(b[0:]),
+		Response: b[2]&0x80 != 0,
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	an := int(binary.BigEndian.Uint16(b[6:]))
+	ns := int(binary.BigEndian.Uint16(b[8:]))
+	ar := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, errMalformed
+		}
+		m.Questions = append(m.Questions, question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[off:]),
+			Class: binary.BigEndian.Uint16(b[off+2:]),
+		})
+		off += 4
+	}
+	for i := 0; i < an+ns+ar; i++ {
+		rr, n, err := readRecord(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if rr == nil {
+			continue
+		}
+		switch {
+		case i < an:
+			m.Answers = append(m.Answers, *rr)
+		case i < an+ns:
+			m.Authority = append(m.Authority, *rr)
+		default:
+			m.Extra = append(m.Extra, *rr)
+		}
+	}
+	return m, nil
+}
+
+// readRecord decodes the record at off and returns the offset after it.
+// The record is nil if its type is not one DNS-SD browsing needs.
+func readRecord(b []byte, off int) (*record, int, error) {
+	name, off, err := readName(b, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if off+10 > len(b) {
+		return nil, 0, errMalformed
+	}
+	rr := &record{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(b[off:]),
+		Class: binary.BigEndian.Uint16(b[off+2:]),
+		TTL:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	start, end := off+10, off+10+length
+	if end > len(b) {
+		return nil, 0, errMalformed
+	}
+	data := b[start:end]
+
+	switch rr.Type {
+	case typePTR:
+		if rr.Target, _, err = readName(b, start); err != nil {
+			return nil, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return nil, 0, errMalformed
+		}
+		rr.Port = binary.BigEndian.Uint16(data[4:])
+		if rr.Target, _, err = readName(b, start+6); err != nil {
+			return nil, 0, err
+		}
+	case typeTXT:
+		for i := 0; i < len(data); {
+			n := int(data[i])
+			if i+1+n > len(data) {
+				return nil, 0, errMalformed
+			}
+			if n > 0 {
+				rr.Text = append(rr.Text, string(data[i+1:i+1+n]))
+			}
+			i += 1 + n
+		}
+	case typeA:
+		if length != net.IPv4len {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), data...))
+	case typeAAAA:
+		if length != net.IPv6len {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), data...))
+	default:
+		return nil, end, nil
+	}
+	return rr, end, nil
+}
+
+// readName decodes a possibly compressed name at off and returns it with a
+// trailing dot, along with the offset after it.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1 // Offset after the name, once a pointer was followed
+	for hops := 0; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		n := int(b[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(b) || hops > 16 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3FFF)
+			hops++
+		case n&0xC0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+n > len(b) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package metrics
 
 import (
 	"context"
@@ -33,8 +33,11 @@ func collectBatteries() (batts []BatteryStatus, err error) {
 	if runtime.GOOS == "darwin" && commandExists("pmset") {
 		if out, err := runCmd(context.Background(), "pmset", "-g", "batt"); err == nil {
 			// Get heavy info (health, cycles) from cached system_profiler
-			health, cycles := getCachedPowerData()
+			health, cycles, capacity := getCachedPowerData()
 			if batts := parsePMSet(out, health, cycles); len(batts) > 0 {
+				for i := range batts {
+					batts[i].Capacity = capacity
+				}
 				return batts, nil
 			}
 		}
@@ -121,11 +124,11 @@ func parsePMSet(raw string, health string, cycles int) []BatteryStatus {
 	return out
 }
 
-// getCachedPowerData returns condition, cycles, and fan speed from cached system_profiler output.
-func getCachedPowerData() (health string, cycles int) {
+// getCachedPowerData returns condition, cycles, and maximum capacity from cached system_profiler output.
+func getCachedPowerData() (health string, cycles int, capacity float64) {
 	out := getSystemPowerOutput()
 	if out == "" {
-		return "", 0
+		return "", 0, 0
 	}
 
 	lines := strings.Split(out, "\n")
@@ -141,8 +144,13 @@ func getCachedPowerData() (health string, cycles int) {
 				health = strings.TrimSpace(after)
 			}
 		}
+		if strings.Contains(lower, "maximum capacity") {
+			if _, after, found := strings.Cut(line, ":"); found {
+				capacity, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(after), "%"), 64)
+			}
+		}
 	}
-	return health, cycles
+	return health, cycles, capacity
 }
 
 func getSystemPowerOutput() string {
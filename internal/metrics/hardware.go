@@ -1,4 +1,4 @@
-package main
+package metrics
 
 import (
 	"context"
@@ -12,7 +12,7 @@ func collectHardware(totalRAM uint64, disks []DiskStatus) HardwareInfo {
 		return HardwareInfo{
 			Model:     "Unknown",
 			CPUModel:  runtime.GOARCH,
-			TotalRAM:  humanBytes(totalRAM),
+			TotalRAM:  HumanBytes(totalRAM),
 			DiskSize:  "Unknown",
 			OSVersion: runtime.GOOS,
 		}
@@ -63,13 +63,13 @@ func collectHardware(totalRAM uint64, disks []DiskStatus) HardwareInfo {
 	// Get disk size
 	diskSize := "Unknown"
 	if len(disks) > 0 {
-		diskSize = humanBytes(disks[0].Total)
+		diskSize = HumanBytes(disks[0].Total)
 	}
 
 	return HardwareInfo{
 		Model:     model,
 		CPUModel:  cpuModel,
-		TotalRAM:  humanBytes(totalRAM),
+		TotalRAM:  HumanBytes(totalRAM),
 		DiskSize:  diskSize,
 		OSVersion: osVersion,
 	}
@@ -1,9 +1,13 @@
-package main
+// Package metrics collects the system metrics shown by `mo status` and the
+// web dashboard: CPU, GPU, memory, disks, network, battery, thermal sensors,
+// Bluetooth devices, top processes and an overall health score.
+package metrics
 
 import (
 	"context"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,132 +16,135 @@ import (
 	"github.com/shirou/gopsutil/v3/net"
 )
 
+// MetricsSnapshot is one reading of everything mo status shows. The web
+// server serves it as JSON on /api/status.
 type MetricsSnapshot struct {
-	CollectedAt    time.Time
-	Host           string
-	Platform       string
-	Uptime         string
-	Procs          uint64
-	Hardware       HardwareInfo
-	HealthScore    int    // 0-100 system health score
-	HealthScoreMsg string // Brief explanation
-
-	CPU          CPUStatus
-	GPU          []GPUStatus
-	Memory       MemoryStatus
-	Disks        []DiskStatus
-	DiskIO       DiskIOStatus
-	Network      []NetworkStatus
-	Proxy        ProxyStatus
-	Batteries    []BatteryStatus
-	Thermal      ThermalStatus
-	Sensors      []SensorReading
-	Bluetooth    []BluetoothDevice
-	TopProcesses []ProcessInfo
+	CollectedAt    time.Time    `json:"collected_at"`
+	Host           string       `json:"host"`
+	Platform       string       `json:"platform"`
+	Uptime         string       `json:"uptime"`
+	Procs          uint64       `json:"procs"`
+	Hardware       HardwareInfo `json:"hardware"`
+	HealthScore    int          `json:"health_score"`     // 0-100 system health score
+	HealthScoreMsg string       `json:"health_score_msg"` // Brief explanation
+
+	CPU          CPUStatus         `json:"cpu"`
+	GPU          []GPUStatus       `json:"gpu"`
+	Memory       MemoryStatus      `json:"memory"`
+	Disks        []DiskStatus      `json:"disks"`
+	DiskIO       DiskIOStatus      `json:"disk_io"`
+	Network      []NetworkStatus   `json:"network"`
+	Proxy        ProxyStatus       `json:"proxy"`
+	Batteries    []BatteryStatus   `json:"batteries"`
+	Thermal      ThermalStatus     `json:"thermal"`
+	Sensors      []SensorReading   `json:"sensors"`
+	Bluetooth    []BluetoothDevice `json:"bluetooth"`
+	TopProcesses []ProcessInfo     `json:"top_processes"`
 }
 
 type HardwareInfo struct {
-	Model     string // MacBook Pro 14-inch, 2021
-	CPUModel  string // Apple M1 Pro / Intel Core i7
-	TotalRAM  string // 16GB
-	DiskSize  string // 512GB
-	OSVersion string // macOS Sonoma 14.5
+	Model     string `json:"model"`      // MacBook Pro 14-inch, 2021
+	CPUModel  string `json:"cpu_model"`  // Apple M1 Pro / Intel Core i7
+	TotalRAM  string `json:"total_ram"`  // 16GB
+	DiskSize  string `json:"disk_size"`  // 512GB
+	OSVersion string `json:"os_version"` // macOS Sonoma 14.5
 }
 
 type DiskIOStatus struct {
-	ReadRate  float64 // MB/s
-	WriteRate float64 // MB/s
+	ReadRate  float64 `json:"read_rate"`  // MB/s
+	WriteRate float64 `json:"write_rate"` // MB/s
 }
 
 type ProcessInfo struct {
-	Name   string
-	CPU    float64
-	Memory float64
+	Name   string  `json:"name"`
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
 }
 
 type CPUStatus struct {
-	Usage            float64
-	PerCore          []float64
-	PerCoreEstimated bool
-	Load1            float64
-	Load5            float64
-	Load15           float64
-	CoreCount        int
-	LogicalCPU       int
-	PCoreCount       int // Performance cores (Apple Silicon)
-	ECoreCount       int // Efficiency cores (Apple Silicon)
+	Usage            float64   `json:"usage"`
+	PerCore          []float64 `json:"per_core"`
+	PerCoreEstimated bool      `json:"per_core_estimated"`
+	Load1            float64   `json:"load1"`
+	Load5            float64   `json:"load5"`
+	Load15           float64   `json:"load15"`
+	CoreCount        int       `json:"core_count"`
+	LogicalCPU       int       `json:"logical_cpu"`
+	PCoreCount       int       `json:"p_core_count"` // Performance cores (Apple Silicon)
+	ECoreCount       int       `json:"e_core_count"` // Efficiency cores (Apple Silicon)
 }
 
 type GPUStatus struct {
-	Name        string
-	Usage       float64
-	MemoryUsed  float64
-	MemoryTotal float64
-	CoreCount   int
-	Note        string
+	Name        string  `json:"name"`
+	Usage       float64 `json:"usage"`
+	MemoryUsed  float64 `json:"memory_used"`
+	MemoryTotal float64 `json:"memory_total"`
+	CoreCount   int     `json:"core_count"`
+	Note        string  `json:"note"`
 }
 
 type MemoryStatus struct {
-	Used        uint64
-	Total       uint64
-	UsedPercent float64
-	SwapUsed    uint64
-	SwapTotal   uint64
-	Pressure    string // macOS memory pressure: normal/warn/critical
+	Used        uint64  `json:"used"`
+	Total       uint64  `json:"total"`
+	UsedPercent float64 `json:"used_percent"`
+	SwapUsed    uint64  `json:"swap_used"`
+	SwapTotal   uint64  `json:"swap_total"`
+	Pressure    string  `json:"pressure"` // macOS memory pressure: normal/warn/critical
 }
 
 type DiskStatus struct {
-	Mount       string
-	Device      string
-	Used        uint64
-	Total       uint64
-	UsedPercent float64
-	Fstype      string
-	External    bool
+	Mount       string  `json:"mount"`
+	Device      string  `json:"device"`
+	Used        uint64  `json:"used"`
+	Total       uint64  `json:"total"`
+	UsedPercent float64 `json:"used_percent"`
+	Fstype      string  `json:"fstype"`
+	External    bool    `json:"external"`
 }
 
 type NetworkStatus struct {
-	Name      string
-	RxRateMBs float64
-	TxRateMBs float64
-	IP        string
+	Name      string  `json:"name"`
+	RxRateMBs float64 `json:"rx_rate_mbs"`
+	TxRateMBs float64 `json:"tx_rate_mbs"`
+	IP        string  `json:"ip"`
 }
 
 type ProxyStatus struct {
-	Enabled bool
-	Type    string // HTTP, SOCKS, System
-	Host    string
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"` // HTTP, SOCKS, System
+	Host    string `json:"host"`
 }
 
 type BatteryStatus struct {
-	Percent    float64
-	Status     string
-	TimeLeft   string
-	Health     string
-	CycleCount int
+	Percent    float64 `json:"percent"`
+	Status     string  `json:"status"`
+	TimeLeft   string  `json:"time_left"`
+	Health     string  `json:"health"`
+	CycleCount int     `json:"cycle_count"`
+	Capacity   float64 `json:"capacity"` // Maximum capacity as % of design, 0 if unknown
 }
 
 type ThermalStatus struct {
-	CPUTemp      float64
-	GPUTemp      float64
-	FanSpeed     int
-	FanCount     int
-	SystemPower  float64 // System power consumption in Watts
-	AdapterPower float64 // AC adapter max power in Watts
-	BatteryPower float64 // Battery charge/discharge power in Watts (positive = discharging)
+	CPUTemp      float64 `json:"cpu_temp"`
+	GPUTemp      float64 `json:"gpu_temp"`
+	FanSpeed     int     `json:"fan_speed"`
+	FanCount     int     `json:"fan_count"`
+	SystemPower  float64 `json:"system_power"`  // System power consumption in Watts
+	AdapterPower float64 `json:"adapter_power"` // AC adapter max power in Watts
+	BatteryPower float64 `json:"battery_power"` // Battery charge/discharge power in Watts (positive = discharging)
 }
 
 type SensorReading struct {
-	Label string
-	Value float64
-	Unit  string
-	Note  string
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Note  string  `json:"note"`
 }
 
 type BluetoothDevice struct {
-	Name      string
-	Connected bool
-	Battery   string
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Battery   string `json:"battery"`
 }
 
 type Collector struct {
@@ -296,4 +303,18 @@ func commandExists(name string) bool {
 	return err == nil
 }
 
-// humanBytes is defined in view.go to avoid duplication
+// HumanBytes formats a byte count with a binary unit, e.g. "1.5 GB".
+func HumanBytes(v uint64) string {
+	switch {
+	case v > 1<<40:
+		return fmt.Sprintf("%.1f TB", float64(v)/(1<<40))
+	case v > 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(v)/(1<<30))
+	case v > 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(v)/(1<<20))
+	case v > 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(v)/(1<<10))
+	default:
+		return strconv.FormatUint(v, 10) + " B"
+	}
+}
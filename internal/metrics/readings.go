@@ -0,0 +1,130 @@
+package metrics
+
+// Reading is one number taken from a snapshot, such as CPU usage, that can
+// be charted over time or tested by an alert rule.
+type Reading struct {
+	Name string `json:"name"`
+	Unit string `json:"unit"` // bytes, percent, mb_per_s, celsius, watts, score, level, load or count
+	Help string `json:"help"`
+	// Read reports false when the Mac does not have the reading, e.g. a
+	// battery on a Mac mini.
+	Read func(s MetricsSnapshot) (float64, bool) `json:"-"`
+}
+
+// PressureLevels maps macOS memory pressure to the memory_pressure value.
+var PressureLevels = map[string]float64{"normal": 0, "warn": 1, "critical": 2}
+
+// Readings are the values the web server records and alerts on.
+var Readings = []Reading{
+	{"health_score", "score", "System health score (0-100)", func(s MetricsSnapshot) (float64, bool) {
+		return float64(s.HealthScore), true
+	}},
+	{"cpu_usage", "percent", "CPU usage across all cores", func(s MetricsSnapshot) (float64, bool) {
+		return s.CPU.Usage, true
+	}},
+	{"load1", "load", "1-minute load average", func(s MetricsSnapshot) (float64, bool) {
+		return s.CPU.Load1, true
+	}},
+	{"memory_used_percent", "percent", "Memory in use", func(s MetricsSnapshot) (float64, bool) {
+		return s.Memory.UsedPercent, s.Memory.Total > 0
+	}},
+	{"memory_used", "bytes", "Memory in use", func(s MetricsSnapshot) (float64, bool) {
+		return float64(s.Memory.Used), s.Memory.Total > 0
+	}},
+	{"swap_used", "bytes", "Swap in use", func(s MetricsSnapshot) (float64, bool) {
+		return float64(s.Memory.SwapUsed), true
+	}},
+	{"memory_pressure", "level", "Memory pressure: 0 normal, 1 warn, 2 critical", func(s MetricsSnapshot) (float64, bool) {
+		v, ok := PressureLevels[s.Memory.Pressure]
+		return v, ok
+	}},
+	{"disk_used", "bytes", "Space used on the startup disk", func(s MetricsSnapshot) (float64, bool) {
+		d, ok := s.StartupDisk()
+		return float64(d.Used), ok
+	}},
+	{"disk_used_percent", "percent", "Startup disk usage", func(s MetricsSnapshot) (float64, bool) {
+		d, ok := s.StartupDisk()
+		return d.UsedPercent, ok
+	}},
+	{"disk_free", "bytes", "Space left on the startup disk", func(s MetricsSnapshot) (float64, bool) {
+		d, ok := s.StartupDisk()
+		return float64(d.Total - d.Used), ok
+	}},
+	{"disk_read_rate", "mb_per_s", "Disk reads", func(s MetricsSnapshot) (float64, bool) {
+		return s.DiskIO.ReadRate, true
+	}},
+	{"disk_write_rate", "mb_per_s", "Disk writes", func(s MetricsSnapshot) (float64, bool) {
+		return s.DiskIO.WriteRate, true
+	}},
+	{"disk_io_rate", "mb_per_s", "Disk reads and writes", func(s MetricsSnapshot) (float64, bool) {
+		return s.DiskIO.ReadRate + s.DiskIO.WriteRate, true
+	}},
+	{"network_rx_rate", "mb_per_s", "Network download, all interfaces", func(s MetricsSnapshot) (float64, bool) {
+		var total float64
+		for _, n := range s.Network {
+			total += n.RxRateMBs
+		}
+		return total, true
+	}},
+	{"network_tx_rate", "mb_per_s", "Network upload, all interfaces", func(s MetricsSnapshot) (float64, bool) {
+		var total float64
+		for _, n := range s.Network {
+			total += n.TxRateMBs
+		}
+		return total, true
+	}},
+	{"cpu_temp", "celsius", "CPU temperature", func(s MetricsSnapshot) (float64, bool) {
+		return s.Thermal.CPUTemp, s.Thermal.CPUTemp > 0
+	}},
+	{"gpu_temp", "celsius", "GPU temperature", func(s MetricsSnapshot) (float64, bool) {
+		return s.Thermal.GPUTemp, s.Thermal.GPUTemp > 0
+	}},
+	{"system_power", "watts", "System power consumption", func(s MetricsSnapshot) (float64, bool) {
+		return s.Thermal.SystemPower, s.Thermal.SystemPower > 0
+	}},
+	{"battery_percent", "percent", "Battery charge", func(s MetricsSnapshot) (float64, bool) {
+		if len(s.Batteries) == 0 {
+			return 0, false
+		}
+		return s.Batteries[0].Percent, true
+	}},
+	{"battery_capacity", "percent", "Battery health: capacity left of the design capacity", func(s MetricsSnapshot) (float64, bool) {
+		if len(s.Batteries) == 0 || s.Batteries[0].Capacity <= 0 {
+			return 0, false
+		}
+		return s.Batteries[0].Capacity, true
+	}},
+	{"battery_cycles", "count", "Battery charge cycles", func(s MetricsSnapshot) (float64, bool) {
+		if len(s.Batteries) == 0 || s.Batteries[0].CycleCount <= 0 {
+			return 0, false
+		}
+		return float64(s.Batteries[0].CycleCount), true
+	}},
+}
+
+// FindReading returns the reading called name.
+func FindReading(name string) (Reading, bool) {
+	for _, r := range Readings {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Reading{}, false
+}
+
+// StartupDisk returns the disk mounted at /, or the largest internal disk
+// when / is not among the disks listed.
+func (s MetricsSnapshot) StartupDisk() (DiskStatus, bool) {
+	for _, d := range s.Disks {
+		if d.Mount == "/" {
+			return d, true
+		}
+	}
+	// Disks are sorted largest first
+	for _, d := range s.Disks {
+		if !d.External {
+			return d, true
+		}
+	}
+	return DiskStatus{}, false
+}
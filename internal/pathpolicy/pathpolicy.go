@@ -0,0 +1,221 @@
+// Package pathpolicy decides whether Mole may remove a path. Every
+// destructive entry point (the web server's delete, purge and uninstall
+// endpoints and the analyze TUI) asks the same Policy, so the rules are
+// applied consistently and every refusal carries a reason.
+package pathpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tw93/mole/internal/quarantine"
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+// Decision is the outcome of checking one path.
+type Decision struct {
+	Path      string `json:"path"`                // As requested
+	Canonical string `json:"canonical,omitempty"` // Absolute, cleaned, parent symlinks resolved
+	Allowed   bool   `json:"allowed"`
+	Reason    string `json:"reason,omitempty"` // Set when refused
+}
+
+// Rule matches a canonical path. Exact rules match only the path itself;
+// other rules match the path and everything below it.
+type Rule struct {
+	Path   string
+	Reason string
+	Exact  bool
+}
+
+// Policy holds the rules a path is checked against, in order:
+//
+//  1. Exact deny rules (the filesystem root, the home directory, ...)
+//  2. The user's whitelist, which also protects the parents of whitelisted
+//     paths
+//  3. Subtree deny rules (/System, /usr, ...), unless a more specific
+//     allow rule covers the path
+//  4. ProtectedApp, for application bundles
+type Policy struct {
+	Deny      []Rule
+	Allow     []Rule
+	Whitelist *whitelist.List // The user's clean whitelist; optional
+
+	// ProtectedApp reports whether an application bundle must not be
+	// removed, returning the reason. Optional.
+	ProtectedApp func(path string) (bool, string)
+}
+
+// Default returns the policy for the current user, including their mole
+// whitelist. It is cheap enough to build per operation, which keeps it in
+// step with whitelist edits made from the CLI.
+func Default() *Policy {
+	home, _ := os.UserHomeDir()
+	p := &Policy{}
+
+	p.Deny = append(p.Deny, Rule{Path: "/", Reason: "Filesystem root", Exact: true})
+	for _, dir := range []string{"/Applications", "/Users", "/Volumes", "/home"} {
+		p.Deny = append(p.Deny, Rule{Path: dir, Reason: "Top-level system folder", Exact: true})
+	}
+	for _, dir := range []string{"/System", "/Library", "/usr", "/bin", "/sbin", "/private", "/var", "/etc", "/dev", "/cores", "/proc", "/sys", "/boot"} {
+		p.Deny = append(p.Deny, Rule{Path: dir, Reason: "Protected system path"})
+	}
+
+	if home != "" {
+		home = Canonicalize(home)
+		p.Deny = append(p.Deny, Rule{Path: home, Reason: "Home directory", Exact: true})
+		for _, name := range []string{"Applications", "Desktop", "Documents", "Downloads", "Library", "Movies", "Music", "Pictures", "Public"} {
+			p.Deny = append(p.Deny, Rule{Path: filepath.Join(home, name), Reason: "Standard user folder", Exact: true})
+		}
+		p.Whitelist, _ = whitelist.Load(home, whitelist.Clean)
+	}
+	if dir, err := quarantine.DefaultDir(); err == nil {
+		p.Deny = append(p.Deny, Rule{Path: Canonicalize(dir), Reason: "Mole quarantine (restore or delete items from the quarantine view)"})
+	}
+
+	// The per-user temporary directory lives under /private/var on macOS
+	if tmp := os.TempDir(); tmp != "" {
+		p.Allow = append(p.Allow, Rule{Path: Canonicalize(tmp)})
+	}
+	return p
+}
+
+// Canonicalize returns the absolute, cleaned form of path with symlinks in
+// its parent directories resolved. The final element is left alone because
+// removing a symlink removes the link, not its target. Parents that do not
+// exist are kept as written.
+func Canonicalize(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	dir, base := filepath.Split(abs)
+	if base == "" {
+		return abs
+	}
+	return filepath.Join(resolveExisting(filepath.Clean(dir)), base)
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of path.
+func resolveExisting(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolveExisting(parent), filepath.Base(path))
+}
+
+// Check decides whether path may be removed.
+func (p *Policy) Check(path string) Decision {
+	d := Decision{Path: path}
+	if strings.TrimSpace(path) == "" {
+		d.Reason = "Empty path"
+		return d
+	}
+	if !filepath.IsAbs(path) {
+		d.Reason = "Path must be absolute"
+		return d
+	}
+	canonical := Canonicalize(path)
+	d.Canonical = canonical
+
+	for _, rule := range p.Deny {
+		if rule.Exact && canonical == rule.Path {
+			d.Reason = rule.Reason
+			return d
+		}
+	}
+	if pattern, ok := p.whitelisted(canonical); ok {
+		d.Reason = "Whitelisted (" + pattern + ")"
+		return d
+	}
+
+	// The most specific matching rule wins
+	allowLen := -1
+	for _, rule := range p.Allow {
+		if rule.matches(canonical) && len(rule.Path) > allowLen {
+			allowLen = len(rule.Path)
+		}
+	}
+	for _, rule := range p.Deny {
+		if !rule.Exact && Within(canonical, rule.Path) && len(rule.Path) > allowLen {
+			d.Reason = rule.Reason
+			return d
+		}
+	}
+
+	if p.ProtectedApp != nil {
+		if protected, reason := p.ProtectedApp(canonical); protected {
+			d.Reason = reason
+			return d
+		}
+	}
+
+	d.Allowed = true
+	return d
+}
+
+// Partition checks paths and splits them into allowed and refused decisions,
+// preserving order.
+func (p *Policy) Partition(paths []string) (allowed, refused []Decision) {
+	for _, path := range paths {
+		d := p.Check(path)
+		if d.Allowed {
+			allowed = append(allowed, d)
+		} else {
+			refused = append(refused, d)
+		}
+	}
+	return allowed, refused
+}
+
+// whitelisted reports the whitelist pattern protecting path: one matching
+// the path or one of its ancestors, or one that lies inside path (so a
+// parent of protected data cannot be deleted wholesale).
+func (p *Policy) whitelisted(path string) (string, bool) {
+	if p.Whitelist == nil {
+		return "", false
+	}
+	if pattern, ok := p.Whitelist.Protects(path); ok {
+		return pattern, true
+	}
+	for _, pattern := range p.Whitelist.Expanded() {
+		if Within(staticPrefix(pattern), path) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// staticPrefix is the directory part of pattern before its first glob
+// metacharacter.
+func staticPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[")
+	if i < 0 {
+		return pattern
+	}
+	return filepath.Dir(pattern[:i+1])
+}
+
+func (r Rule) matches(path string) bool {
+	if r.Exact {
+		return path == r.Path
+	}
+	return Within(path, r.Path)
+}
+
+// Within reports whether path is root or lies below it, comparing whole
+// path elements so "/Library2" is not within "/Library".
+func Within(path, root string) bool {
+	if path == root {
+		return true
+	}
+	if root == string(filepath.Separator) {
+		return strings.HasPrefix(path, root)
+	}
+	return strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,122 @@
+package pathpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tw93/mole/internal/whitelist"
+)
+
+func TestWithinComparesWholeElements(t *testing.T) {
+	cases := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/Library", "/Library", true},
+		{"/Library/Caches", "/Library", true},
+		{"/Library2", "/Library", false},
+		{"/varfoo/x", "/var", false},
+		{"/anything", "/", true},
+	}
+	for _, c := range cases {
+		if got := Within(c.path, c.root); got != c.want {
+			t.Errorf("Within(%q, %q) = %v, want %v", c.path, c.root, got, c.want)
+		}
+	}
+}
+
+func TestCheckDenyAndAllowRules(t *testing.T) {
+	p := &Policy{
+		Deny: []Rule{
+			{Path: "/", Reason: "root", Exact: true},
+			{Path: "/srv", Reason: "system"},
+			{Path: "/srv/scratch/keep", Reason: "keep"},
+		},
+		Allow: []Rule{{Path: "/srv/scratch"}},
+	}
+
+	cases := map[string]string{
+		"/":                     "root",
+		"/srv/data":             "system",
+		"/srv2/data":            "",
+		"/srv/scratch/tmp":      "",
+		"/srv/scratch/keep/a":   "keep",
+		"/srv/scratch/../x":     "system",
+		"relative/path":         "Path must be absolute",
+		"/srv/scratch/./ok.txt": "",
+	}
+	for path, wantReason := range cases {
+		d := p.Check(path)
+		if d.Allowed != (wantReason == "") || d.Reason != wantReason {
+			t.Errorf("Check(%q) = %+v, want reason %q", path, d, wantReason)
+		}
+	}
+}
+
+func TestCheckResolvesParentSymlinks(t *testing.T) {
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	protected := filepath.Join(base, "protected")
+	os.MkdirAll(filepath.Join(protected, "data"), 0o755)
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(protected, link); err != nil {
+		t.Skipf("symlink: %v", err)
+	}
+
+	p := &Policy{Deny: []Rule{{Path: protected, Reason: "protected"}}}
+	if d := p.Check(filepath.Join(link, "data")); d.Allowed || d.Canonical != filepath.Join(protected, "data") {
+		t.Fatalf("expected refusal through symlinked parent, got %+v", d)
+	}
+	// Removing the link itself only removes the link
+	if d := p.Check(link); !d.Allowed {
+		t.Fatalf("expected the symlink itself to be removable, got %+v", d)
+	}
+}
+
+func TestCheckWhitelist(t *testing.T) {
+	home := t.TempDir()
+	list, err := whitelist.Save(home, whitelist.Clean, []string{"~/.m2/repository/*", "~/Library/Caches/JetBrains*", "FINDER_METADATA"})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	p := &Policy{Whitelist: list}
+
+	refused := []string{
+		filepath.Join(home, ".m2", "repository", "org"),
+		filepath.Join(home, ".m2", "repository", "org", "lib.jar"),
+		filepath.Join(home, ".m2"), // Contains whitelisted data
+		filepath.Join(home, "Library", "Caches", "JetBrains2024"),
+		filepath.Join(home, "Library", "Caches"),
+	}
+	for _, path := range refused {
+		if d := p.Check(path); d.Allowed {
+			t.Errorf("Check(%q) allowed, want whitelisted", path)
+		}
+	}
+	allowed := []string{
+		filepath.Join(home, ".m2", "settings.xml"),
+		filepath.Join(home, "Library", "Caches", "com.example"),
+	}
+	for _, path := range allowed {
+		if d := p.Check(path); !d.Allowed {
+			t.Errorf("Check(%q) refused: %s", path, d.Reason)
+		}
+	}
+}
+
+func TestDefaultProtectsHomeAndQuarantine(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	p := Default()
+	for _, path := range []string{home, filepath.Join(home, "Documents"), filepath.Join(home, ".config", "Mole", "quarantine", "items"), "/usr/local/bin", "/"} {
+		if d := p.Check(path); d.Allowed {
+			t.Errorf("Check(%q) allowed, want refused", path)
+		}
+	}
+	if d := p.Check(filepath.Join(home, "Documents", "old.zip")); !d.Allowed {
+		t.Errorf("expected file in Documents to be removable, got %q", d.Reason)
+	}
+}
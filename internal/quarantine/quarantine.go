@@ -0,0 +1,438 @@
+// Package quarantine implements Mole's move-to-trash deletion mode. Items are
+// moved into a Mole-managed staging directory and tracked in a manifest so
+// they can be listed, restored, or expired after a retention period.
+package quarantine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultRetention is how long quarantined items are kept before expiry.
+const DefaultRetention = 7 * 24 * time.Hour
+
+const (
+	manifestName = "manifest.json"
+	lockName     = "manifest.json.lock"
+)
+
+// Item is one quarantined file or directory.
+type Item struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"original_path"`
+	StoredPath   string    `json:"stored_path"`
+	Size         int64     `json:"size"`
+	IsDir        bool      `json:"is_dir"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	Source       string    `json:"source,omitempty"` // "web", "analyze", ...
+}
+
+var (
+	ErrNotFound = errors.New("quarantine item not found")
+	// ErrRestoreConflict means something already exists at the original path.
+	ErrRestoreConflict = errors.New("original path already exists")
+	// ErrOtherVolume means the path is not on the store's volume. Copying it
+	// over could fill the startup disk, so it is refused.
+	ErrOtherVolume = errors.New("on a different volume than the quarantine; delete it permanently instead")
+)
+
+// Store manages a quarantine directory. Every operation re-reads the manifest
+// under a lock file, so the web server and the analyze TUI can share one
+// store.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	retention time.Duration
+}
+
+// Open returns a store rooted at dir. A retention of zero keeps items until
+// they are removed explicitly.
+func Open(dir string, retention time.Duration) *Store {
+	return &Store{dir: dir, retention: retention}
+}
+
+// DefaultDir is the quarantine directory under the user's Mole config
+// directory, which lives on the same volume as most user data so moves are
+// cheap renames.
+func DefaultDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "Mole", "quarantine"), nil
+}
+
+// RetentionFromEnv reads MOLE_QUARANTINE_DAYS, falling back to
+// DefaultRetention. "0" disables expiry.
+func RetentionFromEnv() time.Duration {
+	if v := os.Getenv("MOLE_QUARANTINE_DAYS"); v != "" {
+		if days, err := strconv.ParseFloat(v, 64); err == nil && days >= 0 {
+			return time.Duration(days * float64(24*time.Hour))
+		}
+	}
+	return DefaultRetention
+}
+
+// Default opens the store at DefaultDir with the environment's retention.
+func Default() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return Open(dir, RetentionFromEnv()), nil
+}
+
+func (s *Store) Dir() string { return s.dir }
+
+func (s *Store) Retention() time.Duration { return s.retention }
+
+// SetRetention changes the retention used for newly quarantined items.
+func (s *Store) SetRetention(d time.Duration) {
+	s.mu.Lock()
+	s.retention = d
+	s.mu.Unlock()
+}
+
+// lock serializes manifest changes with this and other processes. The
+// caller holds it from loading the manifest until saving it.
+func (s *Store) lock() (unlock func(), err error) {
+	s.mu.Lock()
+	unlockDir, err := lockDir(s.dir)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockDir()
+		s.mu.Unlock()
+	}, nil
+}
+
+func (s *Store) loadLocked() ([]Item, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("read quarantine manifest: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Store) saveLocked(items []Item) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if items == nil {
+		items = []Item{}
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, manifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// List returns quarantined items, most recently deleted first.
+func (s *Store) List() ([]Item, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	items, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Move quarantines path. size may be zero, in which case it is measured.
+func (s *Store) Move(path string, size int64, source string) (Item, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return Item{}, err
+	}
+	if size <= 0 {
+		size = measure(abs, info)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Item{}, err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+
+	// Keep the original name inside a per-item directory so restoring and
+	// browsing the store by hand both stay obvious.
+	itemDir := filepath.Join(s.dir, "items", id)
+	if err := os.MkdirAll(itemDir, 0700); err != nil {
+		return Item{}, err
+	}
+	stored := filepath.Join(itemDir, filepath.Base(abs))
+	if err := os.Rename(abs, stored); err != nil {
+		os.RemoveAll(itemDir)
+		if errors.Is(err, syscall.EXDEV) {
+			return Item{}, fmt.Errorf("%s: %w", abs, ErrOtherVolume)
+		}
+		return Item{}, err
+	}
+
+	now := time.Now()
+	item := Item{
+		ID:           id,
+		OriginalPath: abs,
+		StoredPath:   stored,
+		Size:         size,
+		IsDir:        info.IsDir(),
+		DeletedAt:    now,
+		Source:       source,
+	}
+	if s.retention > 0 {
+		item.ExpiresAt = now.Add(s.retention)
+	}
+
+	items, err := s.loadLocked()
+	if err == nil {
+		err = s.saveLocked(append(items, item))
+	}
+	if err != nil {
+		// Without a manifest entry the item could never be restored, so put
+		// it back.
+		os.Rename(stored, abs)
+		os.RemoveAll(itemDir)
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// Restore moves an item back to its original path.
+func (s *Store) Restore(id string) (Item, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+
+	items, err := s.loadLocked()
+	if err != nil {
+		return Item{}, err
+	}
+	idx := indexOf(items, id)
+	if idx < 0 {
+		return Item{}, ErrNotFound
+	}
+	item := items[idx]
+
+	if _, err := os.Lstat(item.OriginalPath); err == nil {
+		return item, ErrRestoreConflict
+	}
+	if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return item, err
+	}
+	if err := moveFile(item.StoredPath, item.OriginalPath); err != nil {
+		return item, err
+	}
+	os.RemoveAll(filepath.Dir(item.StoredPath))
+
+	items = append(items[:idx], items[idx+1:]...)
+	return item, s.saveLocked(items)
+}
+
+// Remove permanently deletes an item from the quarantine.
+func (s *Store) Remove(id string) (Item, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Item{}, err
+	}
+	defer unlock()
+
+	items, err := s.loadLocked()
+	if err != nil {
+		return Item{}, err
+	}
+	idx := indexOf(items, id)
+	if idx < 0 {
+		return Item{}, ErrNotFound
+	}
+	item := items[idx]
+	if err := os.RemoveAll(filepath.Dir(item.StoredPath)); err != nil {
+		return item, err
+	}
+	items = append(items[:idx], items[idx+1:]...)
+	return item, s.saveLocked(items)
+}
+
+// Expire permanently deletes items whose retention has passed and returns
+// them.
+func (s *Store) Expire(now time.Time) ([]Item, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	items, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	var expired, kept []Item
+	var firstErr error
+	for _, item := range items {
+		if item.ExpiresAt.IsZero() || now.Before(item.ExpiresAt) {
+			kept = append(kept, item)
+			continue
+		}
+		if err := os.RemoveAll(filepath.Dir(item.StoredPath)); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			kept = append(kept, item)
+			continue
+		}
+		expired = append(expired, item)
+	}
+	if len(expired) == 0 {
+		return nil, firstErr
+	}
+	if err := s.saveLocked(kept); err != nil {
+		return expired, err
+	}
+	return expired, firstErr
+}
+
+func indexOf(items []Item, id string) int {
+	for i, item := range items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func measure(path string, info fs.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if fi, err := d.Info(); err == nil {
+				total += fi.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// moveFile renames src to dst, falling back to copy-then-delete when they are
+// on different volumes. Only Restore needs this, when the original path's
+// volume has changed since the item was quarantined.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
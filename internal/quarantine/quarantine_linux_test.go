@@ -0,0 +1,48 @@
+package quarantine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMoveRefusesOtherVolumes(t *testing.T) {
+	base := t.TempDir()
+	other, err := os.MkdirTemp("/dev/shm", "mole-quarantine-test")
+	if err != nil {
+		t.Skipf("no second volume: %v", err)
+	}
+	defer os.RemoveAll(other)
+	if sameDevice(t, base, other) {
+		t.Skip("/dev/shm is on the same volume as the temp dir")
+	}
+
+	store := Open(filepath.Join(base, "store"), 0)
+	file := filepath.Join(other, "big.iso")
+	if err := os.WriteFile(file, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Move(file, 0, "test"); !errors.Is(err, ErrOtherVolume) {
+		t.Fatalf("Move = %v, want ErrOtherVolume", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("refused file is gone: %v", err)
+	}
+	if items, _ := store.List(); len(items) != 0 {
+		t.Errorf("manifest lists %d items", len(items))
+	}
+}
+
+func sameDevice(t *testing.T, a, b string) bool {
+	t.Helper()
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		t.Fatalf("stat: %v, %v", errA, errB)
+	}
+	sa, okA := ia.Sys().(*syscall.Stat_t)
+	sb, okB := ib.Sys().(*syscall.Stat_t)
+	return !okA || !okB || sa.Dev == sb.Dev
+}
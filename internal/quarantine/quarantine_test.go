@@ -0,0 +1,147 @@
+package quarantine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMoveListAndRestore(t *testing.T) {
+	base := t.TempDir()
+	store := Open(filepath.Join(base, "store"), time.Hour)
+
+	project := filepath.Join(base, "work", "project")
+	if err := os.MkdirAll(filepath.Join(project, "src"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "src", "main.go"), []byte("package main"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	item, err := store.Move(project, 0, "test")
+	if err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if _, err := os.Stat(project); !os.IsNotExist(err) {
+		t.Fatalf("expected original to be gone, err=%v", err)
+	}
+	if item.Size != int64(len("package main")) || !item.IsDir || item.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+
+	items, err := store.List()
+	if err != nil || len(items) != 1 || items[0].ID != item.ID {
+		t.Fatalf("List = %+v, %v", items, err)
+	}
+
+	if _, err := store.Restore(item.ID); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(project, "src", "main.go"))
+	if err != nil || string(data) != "package main" {
+		t.Fatalf("restored content = %q, %v", data, err)
+	}
+	if items, _ := store.List(); len(items) != 0 {
+		t.Fatalf("expected empty quarantine after restore, got %d", len(items))
+	}
+}
+
+func TestRestoreRefusesToOverwrite(t *testing.T) {
+	base := t.TempDir()
+	store := Open(filepath.Join(base, "store"), 0)
+	file := filepath.Join(base, "notes.txt")
+	os.WriteFile(file, []byte("old"), 0o644)
+
+	item, err := store.Move(file, 0, "test")
+	if err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	os.WriteFile(file, []byte("new"), 0o644)
+
+	if _, err := store.Restore(item.ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("expected ErrRestoreConflict, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "new" {
+		t.Fatalf("existing file was overwritten: %q", data)
+	}
+	if _, err := store.Restore("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestConcurrentStoresKeepEveryItem(t *testing.T) {
+	base := t.TempDir()
+	// Two stores on one directory, as the web server and the TUI open
+	stores := []*Store{Open(filepath.Join(base, "store"), 0), Open(filepath.Join(base, "store"), 0)}
+
+	const perStore = 20
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		for j := range perStore {
+			file := filepath.Join(base, fmt.Sprintf("f%d-%d", i, j))
+			if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.Move(file, 0, "test"); err != nil {
+					t.Errorf("Move: %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if items, err := stores[0].List(); err != nil || len(items) != 2*perStore {
+		t.Fatalf("List = %d items, %v; want %d", len(items), err, 2*perStore)
+	}
+}
+
+func TestExpireRemovesOnlyExpiredItems(t *testing.T) {
+	base := t.TempDir()
+	store := Open(filepath.Join(base, "store"), time.Hour)
+
+	oldFile := filepath.Join(base, "old.log")
+	newFile := filepath.Join(base, "new.log")
+	os.WriteFile(oldFile, []byte("old"), 0o644)
+	os.WriteFile(newFile, []byte("new"), 0o644)
+
+	oldItem, err := store.Move(oldFile, 0, "test")
+	if err != nil {
+		t.Fatalf("Move old: %v", err)
+	}
+	store.SetRetention(0)
+	if _, err := store.Move(newFile, 0, "test"); err != nil {
+		t.Fatalf("Move new: %v", err)
+	}
+
+	expired, err := store.Expire(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != oldItem.ID {
+		t.Fatalf("expected only the old item to expire, got %+v", expired)
+	}
+	if _, err := os.Stat(oldItem.StoredPath); !os.IsNotExist(err) {
+		t.Fatalf("expected expired data to be removed, err=%v", err)
+	}
+	if items, _ := store.List(); len(items) != 1 {
+		t.Fatalf("expected one item kept without expiry, got %d", len(items))
+	}
+}
+
+func TestRetentionFromEnv(t *testing.T) {
+	t.Setenv("MOLE_QUARANTINE_DAYS", "2")
+	if got := RetentionFromEnv(); got != 48*time.Hour {
+		t.Fatalf("expected 48h, got %v", got)
+	}
+	t.Setenv("MOLE_QUARANTINE_DAYS", "bogus")
+	if got := RetentionFromEnv(); got != DefaultRetention {
+		t.Fatalf("expected default retention, got %v", got)
+	}
+}
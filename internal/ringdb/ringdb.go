@@ -0,0 +1,348 @@
+// Package ringdb stores metric time series in fixed-size on-disk rings, one
+// file per metric, at several resolutions. Every sample is folded into the
+// current bucket of each resolution, so coarser rings keep the average,
+// minimum and maximum of what they cover, and old data is overwritten in
+// place instead of being compacted.
+package ringdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolution is one ring: buckets Step wide reaching back Keep.
+type Resolution struct {
+	Step time.Duration
+	Keep time.Duration
+}
+
+func (r Resolution) slots() int { return int(r.Keep / r.Step) }
+
+// DefaultResolutions keep 1s samples for an hour, 1m for a day and 1h for
+// a year.
+var DefaultResolutions = []Resolution{
+	{Step: time.Second, Keep: time.Hour},
+	{Step: time.Minute, Keep: 24 * time.Hour},
+	{Step: time.Hour, Keep: 365 * 24 * time.Hour},
+}
+
+// Point is one bucket of a series.
+type Point struct {
+	Time  time.Time // Start of the bucket
+	Avg   float64
+	Min   float64
+	Max   float64
+	Count int // Samples folded into the bucket
+}
+
+var ErrInvalidName = errors.New("invalid metric name")
+
+const (
+	magic      = "MOLERDB1"
+	bucketSize = 40 // start, count, sum, min, max
+)
+
+// bucket is a ring slot. A zero start means the slot was never written.
+type bucket struct {
+	start uint64 // Unix seconds
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+type series struct {
+	f      *os.File
+	rings  [][]bucket
+	dirty  []map[int]bool
+	offset []int64 // File offset of each ring
+}
+
+// DB is a directory of ring files, all with the same resolutions.
+type DB struct {
+	mu     sync.Mutex
+	dir    string
+	res    []Resolution
+	series map[string]*series
+	now    func() time.Time
+}
+
+// Open returns a database stored in dir, creating dir if needed. Each
+// resolution's step must be a whole number of seconds, and steps must
+// increase.
+func Open(dir string, res []Resolution) (*DB, error) {
+	if len(res) == 0 {
+		return nil, fmt.Errorf("ringdb: no resolutions")
+	}
+	for i, r := range res {
+		if r.Step < time.Second || r.Step%time.Second != 0 || r.slots() < 1 {
+			return nil, fmt.Errorf("ringdb: invalid resolution %v/%v", r.Step, r.Keep)
+		}
+		if i > 0 && r.Step <= res[i-1].Step {
+			return nil, fmt.Errorf("ringdb: resolutions must get coarser")
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DB{dir: dir, res: res, series: make(map[string]*series), now: time.Now}, nil
+}
+
+// validName accepts lowercase letters, digits and underscores, which keeps
+// names safe to use as file names.
+func validName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func (db *DB) path(name string) string {
+	return filepath.Join(db.dir, name+".ring")
+}
+
+func (db *DB) header() []byte {
+	h := []byte(magic)
+	h = binary.LittleEndian.AppendUint64(h, uint64(len(db.res)))
+	for _, r := range db.res {
+		h = binary.LittleEndian.AppendUint64(h, uint64(r.Step/time.Second))
+		h = binary.LittleEndian.AppendUint64(h, uint64(r.slots()))
+	}
+	return h
+}
+
+// load returns the named series, reading its file on first use. Missing
+// files are created only when create is set; otherwise load returns nil.
+// Files written with other resolutions are started over.
+func (db *DB) load(name string, create bool) (*series, error) {
+	if s := db.series[name]; s != nil {
+		return s, nil
+	}
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(db.path(name), flags, 0644)
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := db.header()
+	s := &series{f: f}
+	size := int64(len(header))
+	for _, r := range db.res {
+		s.offset = append(s.offset, size)
+		s.rings = append(s.rings, make([]bucket, r.slots()))
+		s.dirty = append(s.dirty, make(map[int]bool))
+		size += int64(r.slots()) * bucketSize
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if int64(len(data)) == size && string(data[:len(header)]) == string(header) {
+		for i, ring := range s.rings {
+			for j := range ring {
+				ring[j] = decodeBucket(data[s.offset[i]+int64(j)*bucketSize:])
+			}
+		}
+	} else {
+		// New file, or one with other resolutions: start over
+		if err := f.Truncate(0); err == nil {
+			err = f.Truncate(size)
+		}
+		if err == nil {
+			_, err = f.WriteAt(header, 0)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	db.series[name] = s
+	return s, nil
+}
+
+func decodeBucket(b []byte) bucket {
+	return bucket{
+		start: binary.LittleEndian.Uint64(b),
+		count: binary.LittleEndian.Uint64(b[8:]),
+		sum:   math.Float64frombits(binary.LittleEndian.Uint64(b[16:])),
+		min:   math.Float64frombits(binary.LittleEndian.Uint64(b[24:])),
+		max:   math.Float64frombits(binary.LittleEndian.Uint64(b[32:])),
+	}
+}
+
+func (b bucket) append(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, b.start)
+	dst = binary.LittleEndian.AppendUint64(dst, b.count)
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(b.sum))
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(b.min))
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(b.max))
+}
+
+// Add records v for name at t. Samples older than what a ring slot already
+// holds are dropped from that ring, and NaN or infinite values are ignored.
+func (db *DB) Add(name string, t time.Time, v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) || t.Unix() <= 0 {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s, err := db.load(name, true)
+	if err != nil {
+		return err
+	}
+	unix := uint64(t.Unix())
+	for i, r := range db.res {
+		step := uint64(r.Step / time.Second)
+		start := unix - unix%step
+		ring := s.rings[i]
+		idx := int(start / step % uint64(len(ring)))
+		b := &ring[idx]
+		if b.start > start {
+			continue
+		}
+		if b.start < start {
+			*b = bucket{start: start, min: v, max: v}
+		}
+		b.count++
+		b.sum += v
+		b.min = min(b.min, v)
+		b.max = max(b.max, v)
+		s.dirty[i][idx] = true
+	}
+	return nil
+}
+
+// Query returns name's buckets between from and to, oldest first, from the
+// finest resolution that still reaches back to from. A step of slack keeps
+// a range of exactly Keep, measured a moment ago, on that resolution.
+func (db *DB) Query(name string, from, to time.Time) ([]Point, Resolution, error) {
+	i := len(db.res) - 1
+	for j, r := range db.res {
+		if db.now().Sub(from) <= r.Keep+r.Step {
+			i = j
+			break
+		}
+	}
+	res := db.res[i]
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s, err := db.load(name, false)
+	if err != nil || s == nil {
+		return nil, res, err
+	}
+	lo, hi := from.Unix()-from.Unix()%int64(res.Step/time.Second), to.Unix()
+	var points []Point
+	for _, b := range s.rings[i] {
+		if b.count == 0 || int64(b.start) < lo || int64(b.start) > hi {
+			continue
+		}
+		points = append(points, Point{
+			Time:  time.Unix(int64(b.start), 0),
+			Avg:   b.sum / float64(b.count),
+			Min:   b.min,
+			Max:   b.max,
+			Count: int(b.count),
+		})
+	}
+	sort.Slice(points, func(a, b int) bool { return points[a].Time.Before(points[b].Time) })
+	return points, res, nil
+}
+
+// Metrics lists the series stored in the database.
+func (db *DB) Metrics() ([]string, error) {
+	entries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".ring"); ok && validName(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Flush writes the buckets changed since the last flush.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var firstErr error
+	for _, s := range db.series {
+		if err := s.flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// flush writes each run of adjacent dirty slots with one write.
+func (s *series) flush() error {
+	for i, dirty := range s.dirty {
+		if len(dirty) == 0 {
+			continue
+		}
+		idx := make([]int, 0, len(dirty))
+		for j := range dirty {
+			idx = append(idx, j)
+		}
+		sort.Ints(idx)
+		for len(idx) > 0 {
+			n := 1
+			for n < len(idx) && idx[n] == idx[0]+n {
+				n++
+			}
+			buf := make([]byte, 0, n*bucketSize)
+			for _, j := range idx[:n] {
+				buf = s.rings[i][j].append(buf)
+			}
+			if _, err := s.f.WriteAt(buf, s.offset[i]+int64(idx[0])*bucketSize); err != nil {
+				return err
+			}
+			idx = idx[n:]
+		}
+		s.dirty[i] = make(map[int]bool)
+	}
+	return nil
+}
+
+// Close flushes and closes the ring files. The DB can be used again
+// afterwards; files are reopened on demand.
+func (db *DB) Close() error {
+	err := db.Flush()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for name, s := range db.series {
+		if cerr := s.f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(db.series, name)
+	}
+	return err
+}
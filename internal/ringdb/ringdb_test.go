@@ -0,0 +1,120 @@
+package ringdb
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+var testResolutions = []Resolution{
+	{Step: time.Second, Keep: 10 * time.Second},
+	{Step: time.Minute, Keep: time.Hour},
+}
+
+func openTest(t *testing.T, dir string, now time.Time) *DB {
+	t.Helper()
+	db, err := Open(dir, testResolutions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.now = func() time.Time { return now }
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestAddDownsamplesIntoCoarserRings(t *testing.T) {
+	base := time.Unix(1_700_000_040, 0) // On a minute boundary
+	db := openTest(t, t.TempDir(), base.Add(5*time.Second))
+	for i, v := range []float64{10, 20, 60} {
+		if err := db.Add("cpu", base.Add(time.Duration(i)*time.Second), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, res, err := db.Query("cpu", base, base.Add(5*time.Second))
+	if err != nil || res.Step != time.Second || len(points) != 3 || points[2].Avg != 60 {
+		t.Fatalf("1s query = %+v, %v, %v", points, res, err)
+	}
+
+	// Further back than the 1s ring reaches, the minute ring answers
+	db.now = func() time.Time { return base.Add(30 * time.Minute) }
+	points, res, err = db.Query("cpu", base.Add(-time.Minute), base.Add(30*time.Minute))
+	if err != nil || res.Step != time.Minute || len(points) != 1 {
+		t.Fatalf("1m query = %+v, %v, %v", points, res, err)
+	}
+	p := points[0]
+	if p.Avg != 30 || p.Min != 10 || p.Max != 60 || p.Count != 3 || !p.Time.Equal(base) {
+		t.Errorf("minute bucket = %+v", p)
+	}
+}
+
+func TestRingOverwritesOldBuckets(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	db := openTest(t, t.TempDir(), base.Add(25*time.Second))
+	for i := 0; i < 25; i++ {
+		db.Add("mem", base.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	points, _, _ := db.Query("mem", base.Add(15*time.Second), base.Add(25*time.Second))
+	if len(points) != 10 || points[0].Avg != 15 || points[9].Avg != 24 {
+		t.Errorf("points = %+v", points)
+	}
+
+	// A late sample must not replace the newer bucket in its slot
+	db.Add("mem", base.Add(5*time.Second), 999)
+	points, _, _ = db.Query("mem", base.Add(15*time.Second), base.Add(25*time.Second))
+	for _, p := range points {
+		if p.Max == 999 {
+			t.Errorf("late sample overwrote %+v", p)
+		}
+	}
+}
+
+func TestPersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1_700_000_000, 0)
+	db := openTest(t, dir, base)
+	db.Add("disk_used", base, 42)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, dir, base)
+	db.Add("disk_used", base, 44)
+	points, _, err := db.Query("disk_used", base, base)
+	if err != nil || len(points) != 1 || points[0].Avg != 43 || points[0].Count != 2 {
+		t.Fatalf("after reopen = %+v, %v", points, err)
+	}
+	names, _ := db.Metrics()
+	if len(names) != 1 || names[0] != "disk_used" {
+		t.Errorf("metrics = %v", names)
+	}
+
+	// Other resolutions discard the old file
+	db.Close()
+	other, err := Open(dir, []Resolution{{Step: time.Second, Keep: time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.now = func() time.Time { return base }
+	if points, _, _ := other.Query("disk_used", base, base); len(points) != 0 {
+		t.Errorf("stale points = %+v", points)
+	}
+}
+
+func TestRejectsBadInput(t *testing.T) {
+	dir := t.TempDir()
+	db := openTest(t, dir, time.Now())
+	if err := db.Add("../escape", time.Now(), 1); err != ErrInvalidName {
+		t.Errorf("Add with bad name: %v", err)
+	}
+	if points, _, err := db.Query("missing", time.Now().Add(-time.Second), time.Now()); err != nil || points != nil {
+		t.Errorf("missing series = %v, %v", points, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("query created files: %v", entries)
+	}
+	if _, err := Open(dir, []Resolution{{Step: time.Minute, Keep: time.Hour}, {Step: time.Second, Keep: time.Hour}}); err == nil {
+		t.Error("expected error for finer resolution after coarser")
+	}
+}
@@ -0,0 +1,376 @@
+// Package whitelist reads and writes the whitelist files maintained by
+// `mole whitelist` (lib/manage/whitelist.sh), with the same parsing and glob
+// semantics as the shell, so the Go tools honour exactly what the CLI does.
+package whitelist
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode selects which whitelist file is used.
+type Mode string
+
+const (
+	Clean    Mode = "clean"    // Paths and globs protected from cleanup
+	Optimize Mode = "optimize" // Names of optimize tasks and checks to skip
+)
+
+// FinderMetadataSentinel is the clean whitelist entry meaning ".DS_Store
+// files" rather than a path.
+const FinderMetadataSentinel = "FINDER_METADATA"
+
+const (
+	cleanHeader    = "# Mole Whitelist - Protected paths won't be deleted\n# Default protections: Playwright browsers, HuggingFace models, Maven repo, Ollama models, Surge Mac, R renv, Finder metadata\n# Add one pattern per line to keep items safe."
+	optimizeHeader = "# Mole Optimization Whitelist - These checks will be skipped during optimization"
+)
+
+// List is a loaded whitelist.
+type List struct {
+	Mode     Mode     `json:"mode"`
+	Path     string   `json:"path"`
+	Patterns []string `json:"patterns"`
+	// Default is set when no file exists and the built-in defaults apply
+	Default bool `json:"default"`
+
+	home string
+}
+
+// ParseMode accepts "clean" (also the empty string) and "optimize".
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", string(Clean):
+		return Clean, nil
+	case string(Optimize):
+		return Optimize, nil
+	default:
+		return "", fmt.Errorf("unknown whitelist mode: %q", s)
+	}
+}
+
+// FilePath returns the whitelist file for mode under home.
+func FilePath(home string, mode Mode) string {
+	name := "whitelist"
+	if mode == Optimize {
+		name = "whitelist_optimize"
+	}
+	return filepath.Join(home, ".config", "mole", name)
+}
+
+func legacyPath(home string, mode Mode) string {
+	if mode == Optimize {
+		return filepath.Join(home, ".config", "mole", "whitelist_checks")
+	}
+	return ""
+}
+
+// DefaultPatterns mirrors DEFAULT_WHITELIST_PATTERNS and
+// DEFAULT_OPTIMIZE_WHITELIST_PATTERNS in lib/core/base.sh.
+func DefaultPatterns(home string, mode Mode) []string {
+	if mode == Optimize {
+		return []string{
+			"check_brew_updates",
+			"check_brew_health",
+			"check_touchid",
+			"check_git_config",
+		}
+	}
+	return []string{
+		home + "/Library/Caches/ms-playwright*",
+		home + "/.cache/huggingface*",
+		home + "/.m2/repository/*",
+		home + "/.ollama/models/*",
+		home + "/Library/Caches/com.nssurge.surge-mac/*",
+		home + "/Library/Application Support/com.nssurge.surge-mac/*",
+		home + "/Library/Caches/org.R-project.R/R/renv/*",
+		home + "/Library/Caches/JetBrains*",
+		home + "/Library/Caches/com.jetbrains.toolbox*",
+		home + "/Library/Caches/com.apple.finder",
+		home + "/Library/Mobile Documents*",
+		FinderMetadataSentinel,
+	}
+}
+
+// Load reads the whitelist for mode, falling back to the legacy optimize
+// file and then to the defaults when no file exists, like load_whitelist.
+func Load(home string, mode Mode) (*List, error) {
+	l := &List{Mode: mode, Path: FilePath(home, mode), home: home}
+
+	path := l.Path
+	if !fileExists(path) {
+		if legacy := legacyPath(home, mode); legacy != "" && fileExists(legacy) {
+			path = legacy
+		} else {
+			l.Default = true
+			l.Patterns = dedupe(DefaultPatterns(home, mode), home)
+			return l, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	l.Patterns = dedupe(patterns, home)
+	return l, nil
+}
+
+// LoadDefault loads the current user's whitelist for mode.
+func LoadDefault(mode Mode) (*List, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return Load(home, mode)
+}
+
+// Save writes patterns to the whitelist file for mode in the format
+// save_whitelist_patterns uses, and returns the reloaded list.
+func Save(home string, mode Mode, patterns []string) (*List, error) {
+	header := cleanHeader
+	if mode == Optimize {
+		header = optimizeHeader
+	}
+
+	var cleaned []string
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" && !strings.HasPrefix(p, "#") {
+			cleaned = append(cleaned, p)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString("\n")
+	if unique := dedupe(cleaned, home); len(unique) > 0 {
+		b.WriteString("\n")
+		for _, p := range unique {
+			b.WriteString(p)
+			b.WriteString("\n")
+		}
+	}
+
+	path := FilePath(home, mode)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return Load(home, mode)
+}
+
+// Match reports the pattern that whitelists path, using is_path_whitelisted
+// semantics: a leading "~" means home, trailing slashes are ignored, and a
+// pattern matches on string equality or as a shell glob in which "*" also
+// matches "/".
+func (l *List) Match(path string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	target := strings.TrimSuffix(path, "/")
+	for _, pattern := range l.Patterns {
+		if pattern == FinderMetadataSentinel {
+			continue
+		}
+		expanded := strings.TrimSuffix(l.expand(pattern), "/")
+		if target == expanded || Glob(expanded, target) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Protects is Match applied to path and each of its ancestors, so the
+// contents of a whitelisted directory are covered too.
+func (l *List) Protects(path string) (string, bool) {
+	for candidate := filepath.Clean(path); ; candidate = filepath.Dir(candidate) {
+		if pattern, ok := l.Match(candidate); ok {
+			return pattern, true
+		}
+		if parent := filepath.Dir(candidate); parent == candidate {
+			return "", false
+		}
+	}
+}
+
+// Contains reports whether name is listed, using exact comparison after
+// tilde expansion like is_whitelisted. Optimize whitelists are checked this
+// way.
+func (l *List) Contains(name string) bool {
+	if l == nil {
+		return false
+	}
+	check := l.expand(name)
+	for _, pattern := range l.Patterns {
+		if l.expand(pattern) == check {
+			return true
+		}
+	}
+	return false
+}
+
+// Expanded returns the path patterns with "~" expanded, leaving out
+// sentinel entries.
+func (l *List) Expanded() []string {
+	if l == nil {
+		return nil
+	}
+	var out []string
+	for _, pattern := range l.Patterns {
+		if pattern != FinderMetadataSentinel {
+			out = append(out, strings.TrimSuffix(l.expand(pattern), "/"))
+		}
+	}
+	return out
+}
+
+// ProtectsFinderMetadata reports whether .DS_Store files are whitelisted.
+func (l *List) ProtectsFinderMetadata() bool {
+	return l.Contains(FinderMetadataSentinel)
+}
+
+func (l *List) expand(pattern string) string {
+	return expandTilde(pattern, l.home)
+}
+
+func expandTilde(pattern, home string) string {
+	if strings.HasPrefix(pattern, "~") {
+		return home + pattern[1:]
+	}
+	return pattern
+}
+
+// dedupe drops patterns equivalent to an earlier one (patterns_equivalent).
+func dedupe(patterns []string, home string) []string {
+	seen := make(map[string]bool, len(patterns))
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		key := expandTilde(p, home)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, p)
+	}
+	return out
+}
+
+// Glob matches name against a bash pattern as used by [[ name == pattern ]]:
+// "*" matches any string including "/", "?" any single character, "[...]"
+// a character class ("!" or "^" negates), and "\" escapes the next
+// character.
+func Glob(pattern, name string) bool {
+	p := []rune(pattern)
+	n := []rune(name)
+	// Backtracking positions for the most recent "*"
+	starP, starN := -1, -1
+	pi, ni := 0, 0
+	for ni < len(n) {
+		if pi < len(p) {
+			switch p[pi] {
+			case '*':
+				starP, starN = pi, ni
+				pi++
+				continue
+			case '?':
+				pi++
+				ni++
+				continue
+			case '[':
+				if ok, next, valid := matchClass(p, pi, n[ni]); valid {
+					if ok {
+						pi = next
+						ni++
+						continue
+					}
+				} else if n[ni] == '[' {
+					// An unterminated "[" matches itself
+					pi++
+					ni++
+					continue
+				}
+			case '\\':
+				if pi+1 < len(p) && p[pi+1] == n[ni] {
+					pi += 2
+					ni++
+					continue
+				}
+			default:
+				if p[pi] == n[ni] {
+					pi++
+					ni++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starN++
+		pi, ni = starP+1, starN
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// matchClass matches c against the bracket expression starting at p[start].
+// valid is false when the expression is unterminated.
+func matchClass(p []rune, start int, c rune) (matched bool, next int, valid bool) {
+	i := start + 1
+	negate := false
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		negate = true
+		i++
+	}
+	first := true
+	for i < len(p) {
+		if p[i] == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		first = false
+		lo := p[i]
+		if lo == '\\' && i+1 < len(p) {
+			i++
+			lo = p[i]
+		}
+		hi := lo
+		if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+			hi = p[i+2]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	return false, 0, false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
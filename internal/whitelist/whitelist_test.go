@@ -0,0 +1,89 @@
+package whitelist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobMatchesShellSemantics(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"/h/.m2/repository/*", "/h/.m2/repository/org/lib.jar", true}, // "*" crosses "/"
+		{"/h/.m2/repository/*", "/h/.m2/repository", false},
+		{"/h/Caches/JetBrains*", "/h/Caches/JetBrains", true},
+		{"/h/Caches/ms-playwright*", "/h/Caches/ms-playwright-go/1.0", true},
+		{"/h/file?.txt", "/h/file1.txt", true},
+		{"/h/file?.txt", "/h/file12.txt", false},
+		{"/h/[abc].log", "/h/b.log", true},
+		{"/h/[!abc].log", "/h/b.log", false},
+		{"/h/[a-c]x", "/h/cx", true},
+		{"/h/\\*", "/h/*", true},
+		{"/h/\\*", "/h/x", false},
+		{"/h/[unterminated", "/h/[unterminated", true},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if got := Glob(c.pattern, c.name); got != c.want {
+			t.Errorf("Glob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestLoadFallsBackToDefaults(t *testing.T) {
+	home := t.TempDir()
+	l, err := Load(home, Clean)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !l.Default || !l.ProtectsFinderMetadata() {
+		t.Fatalf("expected defaults, got %+v", l)
+	}
+	if _, ok := l.Match(filepath.Join(home, ".m2", "repository", "junit")); !ok {
+		t.Error("expected default Maven whitelist to match")
+	}
+}
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	l, err := Save(home, Clean, []string{"~/Projects/keep", "  ", "# note", home + "/Projects/keep/", "~/Library/Caches/Foo*"})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if l.Default || len(l.Patterns) != 3 {
+		t.Fatalf("unexpected patterns: %+v", l.Patterns)
+	}
+
+	data, _ := os.ReadFile(FilePath(home, Clean))
+	if !strings.HasPrefix(string(data), "# Mole Whitelist") {
+		t.Fatalf("missing header:\n%s", data)
+	}
+
+	if pattern, ok := l.Match(filepath.Join(home, "Projects", "keep") + "/"); !ok || pattern != "~/Projects/keep" {
+		t.Errorf("Match = %q, %v", pattern, ok)
+	}
+	if _, ok := l.Match(filepath.Join(home, "Library", "Caches", "Foo", "bar")); !ok {
+		t.Error("expected glob to match nested path")
+	}
+	if _, ok := l.Match(filepath.Join(home, "Projects", "other")); ok {
+		t.Error("unexpected match")
+	}
+}
+
+func TestOptimizeLegacyFile(t *testing.T) {
+	home := t.TempDir()
+	legacy := filepath.Join(home, ".config", "mole", "whitelist_checks")
+	os.MkdirAll(filepath.Dir(legacy), 0o755)
+	os.WriteFile(legacy, []byte("# old\ncheck_sip\n"), 0o644)
+
+	l, err := Load(home, Optimize)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if l.Default || !l.Contains("check_sip") || l.Contains("check_touchid") {
+		t.Fatalf("unexpected list: %+v", l)
+	}
+}
@@ -164,6 +164,13 @@ TouchID sudo check|check_touchid|config_check
 Rosetta 2 check|check_rosetta|config_check
 Git configuration check|check_git_config|config_check
 Login items check|check_login_items|config_check
+DNS and network cache refresh|network_optimization|optimize_task
+System caches refresh (QuickLook, icons, fonts)|cache_refresh|optimize_task
+Spotlight index refresh|system_maintenance|optimize_task
+Memory and swap cleanup|swap_cleanup|optimize_task
+Periodic maintenance scripts|maintenance_scripts|optimize_task
+Time Machine local snapshots|local_snapshots|optimize_task
+Broken preferences and login items fix|fix_broken_configs|optimize_task
 EOF
 }
 
@@ -11,6 +11,7 @@ SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")/../.." && pwd)"
 # Source optimization modules
 source "$SCRIPT_DIR/lib/optimize/maintenance.sh"
 source "$SCRIPT_DIR/lib/optimize/tasks.sh"
+source "$SCRIPT_DIR/lib/manage/whitelist.sh"
 
 # ============================================================================
 # CLI Flag Parsing
@@ -110,6 +111,19 @@ fi
 # Main Execution
 # ============================================================================
 
+# Tasks named in ~/.config/mole/whitelist_optimize (execute_optimization
+# action names, shared with the web UI) are skipped
+load_whitelist "optimize"
+task_whitelisted() {
+    local task="$1" title="$2"
+    if is_whitelisted "$task"; then
+        echo -e "${BLUE}${title}${NC} - skipped (whitelisted: $task)"
+        [[ "$dry_run" == "true" ]] || echo ""
+        return 0
+    fi
+    return 1
+}
+
 echo ""
 echo -e "${PURPLE_BOLD}System Optimization${NC}"
 echo ""
@@ -120,7 +134,7 @@ if [[ "$dry_run" == "true" ]]; then
 fi
 
 # Run selected optimizations
-if [[ "$run_all" == "true" || "$run_dns" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_dns" == "true" ]] && ! task_whitelisted network_optimization "DNS Cache"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}DNS Cache${NC}"
         if flush_dns_cache; then
@@ -134,7 +148,7 @@ if [[ "$run_all" == "true" || "$run_dns" == "true" ]]; then
     fi
 fi
 
-if [[ "$run_all" == "true" || "$run_caches" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_caches" == "true" ]] && ! task_whitelisted cache_refresh "System Caches"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}System Caches${NC}"
         opt_cache_refresh
@@ -144,7 +158,7 @@ if [[ "$run_all" == "true" || "$run_caches" == "true" ]]; then
     fi
 fi
 
-if [[ "$run_all" == "true" || "$run_network" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_network" == "true" ]] && ! task_whitelisted network_optimization "Network Optimization"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}Network Optimization${NC}"
         opt_network_optimization
@@ -154,7 +168,7 @@ if [[ "$run_all" == "true" || "$run_network" == "true" ]]; then
     fi
 fi
 
-if [[ "$run_all" == "true" || "$run_maintenance" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_maintenance" == "true" ]] && ! task_whitelisted maintenance_scripts "System Maintenance"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}System Maintenance${NC}"
         opt_maintenance_scripts
@@ -164,7 +178,7 @@ if [[ "$run_all" == "true" || "$run_maintenance" == "true" ]]; then
     fi
 fi
 
-if [[ "$run_all" == "true" || "$run_snapshots" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_snapshots" == "true" ]] && ! task_whitelisted local_snapshots "Time Machine Snapshots"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}Time Machine Snapshots${NC}"
         opt_local_snapshots
@@ -174,7 +188,7 @@ if [[ "$run_all" == "true" || "$run_snapshots" == "true" ]]; then
     fi
 fi
 
-if [[ "$run_all" == "true" || "$run_prefs" == "true" || "$run_login" == "true" ]]; then
+if [[ "$run_all" == "true" || "$run_prefs" == "true" || "$run_login" == "true" ]] && ! task_whitelisted fix_broken_configs "System Configuration"; then
     if [[ "$dry_run" == "false" ]]; then
         echo -e "${BLUE}System Configuration${NC}"
         opt_fix_broken_configs
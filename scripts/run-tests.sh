@@ -68,7 +68,8 @@ echo ""
 # 4. Go Tests
 echo "4. Running Go tests..."
 if command -v go > /dev/null 2>&1; then
-    if go build ./... && go vet ./cmd/... && go test ./cmd/...; then
+    if go build ./... && GOOS=linux go build ./... && GOOS=windows go build ./... &&
+        go vet ./... && go test ./...; then
         printf "${GREEN}✓ Go tests passed${NC}\n"
     else
         printf "${RED}✗ Go tests failed${NC}\n"